@@ -3,6 +3,8 @@ package ast
 import (
 	"bytes"
 	"lang/token"
+	"sort"
+	"strconv"
 	"strings"
 )
 
@@ -49,20 +51,28 @@ func (p *Program) String() string {
 
 type Identifier struct {
 	Token token.Token // token.ID
-	Type  token.Token // token.TYPE
+	Type  *TypeNode
 	Value string
 }
 
 func (i *Identifier) expressionNode()      {}
 func (i *Identifier) TokenLiteral() string { return i.Token.Literal }
-func (i *Identifier) ReturnType() string   { return i.Type.Literal }
+func (i *Identifier) ReturnType() string   { return i.Type.String() }
 func (i *Identifier) String() string       { return i.Value }
-func (i *Identifier) ParamString() string  { return i.Value + ": " + i.Type.Literal }
+func (i *Identifier) ParamString() string {
+	// the receiver of a method is declared without a type
+	if i.Value == "self" {
+		return i.Value
+	}
+	return i.Value + ": " + i.Type.String()
+}
 
 type LetStatement struct {
-	Token token.Token // token.LET
-	Name  *Identifier
-	Value Expression
+	Token   token.Token // token.LET
+	Name    *Identifier
+	Value   Expression
+	Mutable bool // declared with let mut, can be reassigned
+	Public  bool // declared with pub let, exported from its module
 }
 
 func (ls *LetStatement) statementNode()       {}
@@ -70,9 +80,12 @@ func (ls *LetStatement) TokenLiteral() string { return ls.Token.Literal }
 func (ls *LetStatement) String() string {
 	var out bytes.Buffer
 
-	out.WriteString(ls.TokenLiteral() + " ")
+	out.WriteString(pub(ls.Public) + ls.TokenLiteral() + " ")
+	if ls.Mutable {
+		out.WriteString("mut ")
+	}
 	out.WriteString(ls.Name.String())
-	out.WriteString(": " + ls.Name.Type.Literal)
+	out.WriteString(": " + ls.Name.Type.String())
 	out.WriteString(" = ")
 
 	if ls.Value != nil {
@@ -120,36 +133,36 @@ func (es *ExpressionStatement) String() string {
 
 type IntegerLiteral struct {
 	Token token.Token // token.INT
-	Type  token.Token // token.TYPE
+	Type  *TypeNode
 	Value int64
 }
 
 func (il *IntegerLiteral) expressionNode()      {}
 func (il *IntegerLiteral) TokenLiteral() string { return il.Token.Literal }
-func (il *IntegerLiteral) ReturnType() string   { return il.Type.Literal }
+func (il *IntegerLiteral) ReturnType() string   { return il.Type.String() }
 func (il *IntegerLiteral) String() string       { return il.Token.Literal }
 
 type FloatLiteral struct {
 	Token token.Token // token.FLOAT
-	Type  token.Token // token.TYPE
+	Type  *TypeNode
 	Value float64
 }
 
 func (fl *FloatLiteral) expressionNode()      {}
 func (fl *FloatLiteral) TokenLiteral() string { return fl.Token.Literal }
-func (fl *FloatLiteral) ReturnType() string   { return fl.Type.Literal }
+func (fl *FloatLiteral) ReturnType() string   { return fl.Type.String() }
 func (fl *FloatLiteral) String() string       { return fl.Token.Literal }
 
 type PrefixExpression struct {
 	Token    token.Token
-	Type     token.Token // token.TYPE
+	Type     *TypeNode
 	Operator string
 	Right    Expression
 }
 
 func (pe *PrefixExpression) expressionNode()      {}
 func (pe *PrefixExpression) TokenLiteral() string { return pe.Token.Literal }
-func (pe *PrefixExpression) ReturnType() string   { return pe.Type.Literal }
+func (pe *PrefixExpression) ReturnType() string   { return pe.Type.String() }
 func (pe *PrefixExpression) String() string {
 	var out bytes.Buffer
 
@@ -162,7 +175,7 @@ func (pe *PrefixExpression) String() string {
 
 type InfixExpression struct {
 	Token    token.Token
-	Type     token.Token // token.TYPE
+	Type     *TypeNode
 	Operator string
 	Right    Expression
 	Left     Expression
@@ -170,7 +183,7 @@ type InfixExpression struct {
 
 func (ie *InfixExpression) expressionNode()      {}
 func (ie *InfixExpression) TokenLiteral() string { return ie.Token.Literal }
-func (ie *InfixExpression) ReturnType() string   { return ie.Type.Literal }
+func (ie *InfixExpression) ReturnType() string   { return ie.Type.String() }
 func (ie *InfixExpression) String() string {
 	var out bytes.Buffer
 
@@ -183,18 +196,18 @@ func (ie *InfixExpression) String() string {
 
 type Boolean struct {
 	Token token.Token
-	Type  token.Token // token.TYPE
+	Type  *TypeNode
 	Value bool
 }
 
 func (b *Boolean) expressionNode()      {}
 func (b *Boolean) TokenLiteral() string { return b.Token.Literal }
-func (b *Boolean) ReturnType() string   { return b.Type.Literal }
+func (b *Boolean) ReturnType() string   { return b.Type.String() }
 func (b *Boolean) String() string       { return b.Token.Literal }
 
 type IfExpression struct {
 	Token       token.Token // token.IF
-	Type        token.Token // token.TYPE
+	Type        *TypeNode
 	Condition   Expression
 	Consequence *BlockStatement
 	Others      Expression // else if
@@ -203,7 +216,7 @@ type IfExpression struct {
 
 func (ie *IfExpression) expressionNode()      {}
 func (ie *IfExpression) TokenLiteral() string { return ie.Token.Literal }
-func (ie *IfExpression) ReturnType() string   { return ie.Type.Literal }
+func (ie *IfExpression) ReturnType() string   { return ie.Type.String() }
 func (ie *IfExpression) String() string {
 	var out bytes.Buffer
 
@@ -237,14 +250,14 @@ func (bs *BlockStatement) String() string {
 
 type FunctionLiteral struct {
 	Token      token.Token // token.FUNC
-	Type       token.Token // token.TYPE
+	Type       *TypeNode   // declared return type
 	Parameters []*Identifier
 	Body       *BlockStatement
 }
 
 func (fl *FunctionLiteral) expressionNode()      {}
 func (fl *FunctionLiteral) TokenLiteral() string { return fl.Token.Literal }
-func (fl *FunctionLiteral) ReturnType() string   { return fl.Type.Literal }
+func (fl *FunctionLiteral) ReturnType() string   { return fl.Type.String() }
 func (fl *FunctionLiteral) String() string {
 	var out bytes.Buffer
 
@@ -255,7 +268,7 @@ func (fl *FunctionLiteral) String() string {
 
 	out.WriteString(fl.TokenLiteral())
 	out.WriteString("(" + strings.Join(params, ", ") + ") ")
-	out.WriteString(fl.Type.Literal + " ")
+	out.WriteString(fl.Type.String() + " ")
 	out.WriteString(fl.Body.String())
 
 	return out.String()
@@ -263,14 +276,14 @@ func (fl *FunctionLiteral) String() string {
 
 type CallExpression struct {
 	Token     token.Token // token.LPAREN
-	Type      token.Token // token.TYPE
-	Function  Expression  // Identifier or FunctionLiteral
+	Type      *TypeNode
+	Function  Expression // Identifier or FunctionLiteral
 	Arguments []Expression
 }
 
 func (ce *CallExpression) expressionNode()      {}
 func (ce *CallExpression) TokenLiteral() string { return ce.Token.Literal }
-func (ce *CallExpression) ReturnType() string   { return ce.Type.Literal }
+func (ce *CallExpression) ReturnType() string   { return ce.Type.String() }
 func (ce *CallExpression) String() string {
 	var out bytes.Buffer
 
@@ -287,18 +300,19 @@ func (ce *CallExpression) String() string {
 
 type StringLiteral struct {
 	Token token.Token // token.STRING
-	Type  token.Token // token.TYPE
+	Type  *TypeNode
 	Value string
 }
 
 func (sl *StringLiteral) expressionNode()      {}
 func (sl *StringLiteral) TokenLiteral() string { return sl.Token.Literal }
-func (sl *StringLiteral) ReturnType() string   { return sl.Type.Literal }
+func (sl *StringLiteral) ReturnType() string   { return sl.Type.String() }
 func (sl *StringLiteral) String() string       { return sl.Token.Literal }
 
 type Function struct {
 	*FunctionLiteral
-	Name *Identifier
+	Name   *Identifier
+	Public bool // declared with pub fn, exported from its module
 }
 
 func (f *Function) String() string {
@@ -309,9 +323,9 @@ func (f *Function) String() string {
 		params = append(params, p.ParamString())
 	}
 
-	out.WriteString(f.TokenLiteral() + " " + f.Name.Value)
+	out.WriteString(pub(f.Public) + f.TokenLiteral() + " " + f.Name.Value)
 	out.WriteString("(" + strings.Join(params, ", ") + ") ")
-	out.WriteString(f.Type.Literal + " ")
+	out.WriteString(f.Type.String() + " ")
 	out.WriteString(f.Body.String())
 
 	return out.String()
@@ -319,13 +333,13 @@ func (f *Function) String() string {
 
 type ListLiteral struct {
 	Token    token.Token // token.LBRACKET
-	Type     token.Token // token.TYPE
+	Type     *TypeNode
 	Elements []Expression
 }
 
 func (ll *ListLiteral) expressionNode()      {}
 func (ll *ListLiteral) TokenLiteral() string { return ll.Token.Literal }
-func (ll *ListLiteral) ReturnType() string   { return ll.Type.Literal }
+func (ll *ListLiteral) ReturnType() string   { return ll.Type.String() }
 func (ll *ListLiteral) String() string {
 	var out bytes.Buffer
 
@@ -338,57 +352,412 @@ func (ll *ListLiteral) String() string {
 	return out.String()
 }
 
+// xs[i], or the slice xs[start:end] of a list or a string whose bounds
+// may be left out
 type IndexExpression struct {
 	Token token.Token // token.LBRACKET
-	Type  token.Token // token.TYPE
+	Type  *TypeNode
 	Left  Expression
-	Index Expression
+	Index Expression // the start of a slice, nil when left out
+	Slice bool
+	End   Expression // nil when left out
 }
 
 func (ie *IndexExpression) expressionNode()      {}
 func (ie *IndexExpression) TokenLiteral() string { return ie.Token.Literal }
-func (ie *IndexExpression) ReturnType() string   { return ie.Type.Literal }
+func (ie *IndexExpression) ReturnType() string   { return ie.Type.String() }
 func (ie *IndexExpression) String() string {
 	var out bytes.Buffer
 
 	out.WriteString("(")
 	out.WriteString(ie.Left.String())
-	out.WriteString("[" + ie.Index.String() + "]")
-	out.WriteString(")")
+	out.WriteString("[")
+	if ie.Index != nil {
+		out.WriteString(ie.Index.String())
+	}
+	if ie.Slice {
+		out.WriteString(":")
+		if ie.End != nil {
+			out.WriteString(ie.End.String())
+		}
+	}
+	out.WriteString("])")
 
 	return out.String()
 }
 
+// start..end or start..=end, the integers from start up to end
+type RangeExpression struct {
+	Token     token.Token // token.DOTDOT or token.DOTDOTEQ
+	Type      *TypeNode
+	Start     Expression
+	End       Expression
+	Inclusive bool
+}
+
+func (re *RangeExpression) expressionNode()      {}
+func (re *RangeExpression) TokenLiteral() string { return re.Token.Literal }
+func (re *RangeExpression) ReturnType() string   { return re.Type.String() }
+func (re *RangeExpression) String() string {
+	return "(" + re.Start.String() + re.Token.Literal + re.End.String() + ")"
+}
+
+// the postfix ? operator, unwraps a Some or an Ok and returns a None
+// or an Err from the current function
+type TryExpression struct {
+	Token token.Token // token.QUESTION
+	Type  *TypeNode
+	Value Expression
+}
+
+func (te *TryExpression) expressionNode()      {}
+func (te *TryExpression) TokenLiteral() string { return te.Token.Literal }
+func (te *TryExpression) ReturnType() string   { return te.Type.String() }
+func (te *TryExpression) String() string       { return "(" + te.Value.String() + "?)" }
+
 type AccessExpression struct {
-	Token     token.Token // token.DOT
-	Type      token.Token // token.TYPE
+	Token     token.Token // token.DOT or token.PATH
+	Type      *TypeNode
 	Struct    Expression
 	Attribute string
 }
 
 func (ae *AccessExpression) expressionNode()      {}
 func (ae *AccessExpression) TokenLiteral() string { return ae.Token.Literal }
-func (ae *AccessExpression) ReturnType() string   { return ae.Type.Literal }
+func (ae *AccessExpression) ReturnType() string   { return ae.Type.String() }
 
-func (ae *AccessExpression) String() string { return ae.Struct.String() + "." + ae.Attribute }
+func (ae *AccessExpression) String() string {
+	// enum variants are written Shape::Circle
+	if ae.Token.Type == token.PATH {
+		return ae.Struct.String() + "::" + ae.Attribute
+	}
+	return ae.Struct.String() + "." + ae.Attribute
+}
 
 type MapLiteral struct {
 	Token     token.Token // token.LBRACE
-	Type      token.Token // token.TYPE
-	KeyType   token.Token // token.TYPE
-	ValueType token.Token // token.TYPE
+	Type      *TypeNode
+	KeyType   *TypeNode
+	ValueType *TypeNode
 	Pairs     map[Expression]Expression
 }
 
 func (ml *MapLiteral) expressionNode()      {}
 func (ml *MapLiteral) TokenLiteral() string { return ml.Token.Literal }
 
-func (ml *MapLiteral) ReturnType() string { return ml.Type.Literal }
+func (ml *MapLiteral) ReturnType() string { return ml.Type.String() }
 func (ml *MapLiteral) String() string {
 	pairs := []string{}
-	for key, value := range ml.Pairs {
-		pairs = append(pairs, key.String()+":"+value.String())
+	for _, key := range ml.Keys() {
+		pairs = append(pairs, key.String()+":"+ml.Pairs[key].String())
 	}
 
 	return "{" + strings.Join(pairs, ", ") + "}"
 }
+
+// Keys returns the keys of the literal sorted by their source, the order
+// its pairs are evaluated and printed in
+func (ml *MapLiteral) Keys() []Expression {
+	keys := make([]Expression, 0, len(ml.Pairs))
+	for key := range ml.Pairs {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i].String() < keys[j].String()
+	})
+	return keys
+}
+
+type StructStatement struct {
+	Token  token.Token // token.STRUCT
+	Name   *Identifier
+	Fields []*Identifier
+	Public bool // declared with pub struct, exported from its module
+}
+
+func (ss *StructStatement) statementNode()       {}
+func (ss *StructStatement) TokenLiteral() string { return ss.Token.Literal }
+func (ss *StructStatement) String() string {
+	fields := []string{}
+	for _, f := range ss.Fields {
+		fields = append(fields, f.ParamString())
+	}
+
+	return pub(ss.Public) + "struct " + ss.Name.Value + " { " + strings.Join(fields, ", ") + " }"
+}
+
+type ImplStatement struct {
+	Token   token.Token // token.IMPL
+	Name    *Identifier
+	Methods []*Function
+}
+
+func (is *ImplStatement) statementNode()       {}
+func (is *ImplStatement) TokenLiteral() string { return is.Token.Literal }
+func (is *ImplStatement) String() string {
+	methods := []string{}
+	for _, m := range is.Methods {
+		methods = append(methods, m.String())
+	}
+
+	return "impl " + is.Name.Value + " { " + strings.Join(methods, " ") + " }"
+}
+
+type StructLiteral struct {
+	Token  token.Token // token.ID, the name of the struct
+	Type   *TypeNode
+	Name   *Identifier
+	Fields []*Identifier // in the order they are written
+	Values []Expression
+}
+
+func (sl *StructLiteral) expressionNode()      {}
+func (sl *StructLiteral) TokenLiteral() string { return sl.Token.Literal }
+func (sl *StructLiteral) ReturnType() string   { return sl.Type.String() }
+func (sl *StructLiteral) String() string {
+	fields := []string{}
+	for i, f := range sl.Fields {
+		fields = append(fields, f.Value+": "+sl.Values[i].String())
+	}
+
+	return sl.Name.Value + " { " + strings.Join(fields, ", ") + " }"
+}
+
+type EnumStatement struct {
+	Token    token.Token // token.ENUM
+	Name     *Identifier
+	Variants []*Variant
+	Public   bool // declared with pub enum, exported from its module
+}
+
+func (es *EnumStatement) statementNode()       {}
+func (es *EnumStatement) TokenLiteral() string { return es.Token.Literal }
+func (es *EnumStatement) String() string {
+	variants := []string{}
+	for _, v := range es.Variants {
+		variants = append(variants, v.String())
+	}
+
+	return pub(es.Public) + "enum " + es.Name.Value + " { " + strings.Join(variants, ", ") + " }"
+}
+
+// a variant of an enum, Fields are the types of its payload
+type Variant struct {
+	Name   *Identifier
+	Fields []*TypeNode
+}
+
+func (v *Variant) String() string {
+	if len(v.Fields) == 0 {
+		return v.Name.Value
+	}
+
+	fields := []string{}
+	for _, f := range v.Fields {
+		fields = append(fields, f.String())
+	}
+	return v.Name.Value + "(" + strings.Join(fields, ", ") + ")"
+}
+
+type MatchExpression struct {
+	Token   token.Token // token.MATCH
+	Type    *TypeNode
+	Subject Expression
+	Arms    []*MatchArm
+}
+
+func (me *MatchExpression) expressionNode()      {}
+func (me *MatchExpression) TokenLiteral() string { return me.Token.Literal }
+func (me *MatchExpression) ReturnType() string   { return me.Type.String() }
+func (me *MatchExpression) String() string {
+	arms := []string{}
+	for _, a := range me.Arms {
+		arms = append(arms, a.String())
+	}
+
+	return "match " + me.Subject.String() + " { " + strings.Join(arms, ", ") + " }"
+}
+
+// an arm with an expression body is stored as a block holding that
+// expression, so every arm yields the value of its block like if does
+type MatchArm struct {
+	Token   token.Token // first token of the pattern
+	Pattern Pattern
+	Guard   Expression
+	Body    *BlockStatement
+}
+
+func (ma *MatchArm) String() string {
+	out := ma.Pattern.String()
+	if ma.Guard != nil {
+		out += " if " + ma.Guard.String()
+	}
+	return out + " => " + ma.Body.String()
+}
+
+type WhileStatement struct {
+	Token     token.Token // token.WHILE
+	Condition Expression
+	Body      *BlockStatement
+}
+
+func (ws *WhileStatement) statementNode()       {}
+func (ws *WhileStatement) TokenLiteral() string { return ws.Token.Literal }
+func (ws *WhileStatement) String() string {
+	return "while " + ws.Condition.String() + " { " + ws.Body.String() + " }"
+}
+
+// for x in xs, or for i, x in xs where the first name is the index of
+// a list or string element, or the key of a map entry
+type ForStatement struct {
+	Token     token.Token // token.FOR
+	Variables []*Identifier
+	Iterable  Expression
+	Body      *BlockStatement
+}
+
+func (fs *ForStatement) statementNode()       {}
+func (fs *ForStatement) TokenLiteral() string { return fs.Token.Literal }
+func (fs *ForStatement) String() string {
+	names := []string{}
+	for _, v := range fs.Variables {
+		names = append(names, v.Value)
+	}
+
+	return "for " + strings.Join(names, ", ") + " in " + fs.Iterable.String() + " { " + fs.Body.String() + " }"
+}
+
+// loop { } runs until a break, whose value becomes the value of the loop
+type LoopExpression struct {
+	Token token.Token // token.LOOP
+	Type  *TypeNode
+	Body  *BlockStatement
+}
+
+func (le *LoopExpression) expressionNode()      {}
+func (le *LoopExpression) TokenLiteral() string { return le.Token.Literal }
+func (le *LoopExpression) ReturnType() string   { return le.Type.String() }
+func (le *LoopExpression) String() string       { return "loop { " + le.Body.String() + " }" }
+
+type BreakStatement struct {
+	Token token.Token // token.BREAK
+	Value Expression  // only allowed inside loop
+}
+
+func (bs *BreakStatement) statementNode()       {}
+func (bs *BreakStatement) TokenLiteral() string { return bs.Token.Literal }
+func (bs *BreakStatement) String() string {
+	if bs.Value == nil {
+		return "break;"
+	}
+	return "break " + bs.Value.String() + ";"
+}
+
+type ContinueStatement struct {
+	Token token.Token // token.CONTINUE
+}
+
+func (cs *ContinueStatement) statementNode()       {}
+func (cs *ContinueStatement) TokenLiteral() string { return cs.Token.Literal }
+func (cs *ContinueStatement) String() string       { return "continue;" }
+
+// use utils::math; and import "lib/strings.mist"; bind the module found
+// at Path to Name, whose public definitions are read as math::name
+type UseStatement struct {
+	Token token.Token // token.USE or token.IMPORT
+	Path  string      // utils::math for use, the file as written for import
+	Name  *Identifier // the last part of the path unless renamed with as
+	Alias bool        // Name was given with as
+}
+
+func (us *UseStatement) statementNode()       {}
+func (us *UseStatement) TokenLiteral() string { return us.Token.Literal }
+func (us *UseStatement) String() string {
+	out := us.TokenLiteral() + " " + us.Path
+	if us.Token.Type == token.IMPORT {
+		out = us.TokenLiteral() + " " + strconv.Quote(us.Path)
+	}
+	if us.Alias {
+		out += " as " + us.Name.Value
+	}
+	return out + ";"
+}
+
+// "pub " in front of public definitions
+func pub(public bool) string {
+	if public {
+		return "pub "
+	}
+	return ""
+}
+
+// test "name" { ... }, run by mist test and skipped otherwise
+type TestStatement struct {
+	Token token.Token // the test identifier
+	Name  string
+	Body  *BlockStatement
+}
+
+func (ts *TestStatement) statementNode()       {}
+func (ts *TestStatement) TokenLiteral() string { return ts.Token.Literal }
+func (ts *TestStatement) String() string {
+	return "test " + strconv.Quote(ts.Name) + " { " + ts.Body.String() + " }"
+}
+
+// x = v, xs[i] = v and the compound forms such as x += v
+type AssignStatement struct {
+	Token    token.Token // the assignment operator
+	Target   Expression  // an Identifier or an IndexExpression
+	Operator string      // the infix operator of a compound assignment, empty for =
+	Value    Expression
+}
+
+func (as *AssignStatement) statementNode()       {}
+func (as *AssignStatement) TokenLiteral() string { return as.Token.Literal }
+func (as *AssignStatement) String() string {
+	return as.Target.String() + " " + as.TokenLiteral() + " " + as.Value.String() + ";"
+}
+
+// AssignTarget splits the target of an assignment into the variable it
+// rebinds and the index expressions leading to the replaced element,
+// outermost first, e.g. xs and [xs[i], xs[i][j]] for xs[i][j] = v.
+// Slices can't be assigned to.
+func AssignTarget(target Expression) (*Identifier, []*IndexExpression) {
+	switch target := target.(type) {
+	case *Identifier:
+		return target, nil
+	case *IndexExpression:
+		if target.Slice {
+			return nil, nil
+		}
+		name, indexes := AssignTarget(target.Left)
+		if name == nil {
+			return nil, nil
+		}
+		return name, append(indexes, target)
+	default:
+		return nil, nil
+	}
+}
+
+// BadExpression stands in for an expression the parser couldn't make
+// sense of, an error was reported for it
+type BadExpression struct {
+	Token token.Token // where the expression was expected
+}
+
+func (be *BadExpression) expressionNode()      {}
+func (be *BadExpression) TokenLiteral() string { return be.Token.Literal }
+func (be *BadExpression) ReturnType() string   { return "" }
+func (be *BadExpression) String() string       { return "<bad expression>" }
+
+// BadStatement stands in for a statement the parser couldn't make sense
+// of, the tokens from From to To were skipped after reporting an error
+type BadStatement struct {
+	From token.Token
+	To   token.Token
+}
+
+func (bs *BadStatement) statementNode()       {}
+func (bs *BadStatement) TokenLiteral() string { return bs.From.Literal }
+func (bs *BadStatement) String() string       { return "<bad statement>" }
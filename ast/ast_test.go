@@ -2,6 +2,7 @@ package ast
 
 import (
 	"lang/token"
+	"strings"
 	"testing"
 )
 
@@ -14,7 +15,7 @@ func TestString(t *testing.T) {
 				Name: &Identifier{
 					Token: token.Token{Type: token.ID, Literal: "Var"},
 					Value: "Var",
-					Type:  token.Token{Type: token.TYPE, Literal: "int"},
+					Type:  NewType("int"),
 				},
 				Value: &Identifier{
 					Token: token.Token{Type: token.ID, Literal: "anotherVar"},
@@ -28,3 +29,140 @@ func TestString(t *testing.T) {
 		t.Errorf("program.String() expected %s, got=%s", expected, program.String())
 	}
 }
+
+func TestTypeString(t *testing.T) {
+	tests := []struct {
+		typ      *TypeNode
+		expected string
+	}{
+		{NewType("Int"), "Int"},
+		{NewType("List", NewType("Int")), "List<Int>"},
+		{NewType("Map", NewType("String"), NewType("List", NewType("Float"))), "Map<String, List<Float>>"},
+		{NewFunctionType([]*TypeNode{NewType("Int"), NewType("Int")}, NewType("Bool")), "Fn(Int, Int) -> Bool"},
+		{nil, ""},
+	}
+
+	for i, test := range tests {
+		if test.typ.String() != test.expected {
+			t.Errorf("case %d: expected %s, got=%s", i, test.expected, test.typ.String())
+		}
+	}
+}
+
+func TestTypeAccepts(t *testing.T) {
+	ints := NewType("List", NewType("Int"))
+	strings := NewType("List", NewType("String"))
+	predicate := NewFunctionType([]*TypeNode{NewType("Int")}, NewType("Bool"))
+
+	tests := []struct {
+		expected *TypeNode
+		actual   *TypeNode
+		accepts  bool
+	}{
+		{ints, ints, true},
+		{ints, strings, false},
+		{NewType("List"), strings, true},
+		{ints, NewType("List"), true},
+		{ints, nil, true},
+		{NewType("Map", NewType("String"), ints), NewType("Map", NewType("String"), strings), false},
+		{predicate, NewFunctionType([]*TypeNode{NewType("Int")}, NewType("Bool")), true},
+		{predicate, NewFunctionType([]*TypeNode{NewType("String")}, NewType("Bool")), false},
+		{predicate, NewFunctionType([]*TypeNode{NewType("Int")}, NewType("Int")), false},
+		{NewType("Func"), predicate, true},
+		{NewType("Int"), NewType("Float"), false},
+	}
+
+	for i, test := range tests {
+		if test.expected.Accepts(test.actual) != test.accepts {
+			t.Errorf("case %d: expected %s accepting %s to be %t",
+				i, test.expected, test.actual, test.accepts)
+		}
+	}
+}
+
+func TestDump(t *testing.T) {
+	// let x: Int = -1;
+	program := &Program{
+		Statements: []Statement{
+			&LetStatement{
+				Token: token.Token{Type: token.LET, Literal: "let", Row: 1, Column: 1},
+				Name: &Identifier{
+					Token: token.Token{Type: token.ID, Literal: "x", Row: 1, Column: 5},
+					Value: "x",
+					Type:  NewType("Int"),
+				},
+				Value: &PrefixExpression{
+					Token:    token.Token{Type: token.MINUS, Literal: "-", Row: 1, Column: 14},
+					Operator: "-",
+					Right: &IntegerLiteral{
+						Token: token.Token{Type: token.INT, Literal: "1", Row: 1, Column: 15},
+						Value: 1,
+					},
+				},
+			},
+		},
+	}
+
+	text := `Program
+  statements[0]: LetStatement 1:1 mutable: false public: false
+    name: Identifier 1:5 type: "Int" value: "x"
+    value: PrefixExpression 1:14 operator: "-"
+      right: IntegerLiteral 1:15 value: 1
+`
+	if actual := Dump(program); actual != text {
+		t.Errorf("Dump expected\n%s\ngot\n%s", text, actual)
+	}
+
+	json := `{"kind":"Program","statements":[{"kind":"LetStatement","row":1,"column":1,` +
+		`"name":{"kind":"Identifier","row":1,"column":5,"type":"Int","value":"x"},` +
+		`"value":{"kind":"PrefixExpression","row":1,"column":14,"operator":"-",` +
+		`"right":{"kind":"IntegerLiteral","row":1,"column":15,"value":1}},"mutable":false,"public":false}]}`
+	encoded, err := JSON(program)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if actual := strings.Join(strings.Fields(string(encoded)), ""); actual != json {
+		t.Errorf("JSON expected\n%s\ngot\n%s", json, actual)
+	}
+
+	dot := `digraph ast {
+	node [shape=box];
+	n0 [label="Program"];
+	n1 [label="LetStatement 1:1\nmutable: false\npublic: false"];
+	n2 [label="Identifier 1:5\ntype: \"Int\"\nvalue: \"x\""];
+	n1 -> n2 [label="name"];
+	n3 [label="PrefixExpression 1:14\noperator: \"-\""];
+	n4 [label="IntegerLiteral 1:15\nvalue: 1"];
+	n3 -> n4 [label="right"];
+	n1 -> n3 [label="value"];
+	n0 -> n1 [label="statements[0]"];
+}
+`
+	if actual := Dot(program); actual != dot {
+		t.Errorf("Dot expected\n%s\ngot\n%s", dot, actual)
+	}
+}
+
+func TestDumpMapLiteral(t *testing.T) {
+	key := func(s string) Expression { return &StringLiteral{Token: token.Token{Literal: s}, Value: s} }
+	value := func(i int64) Expression { return &IntegerLiteral{Token: token.Token{Literal: "1"}, Value: i} }
+	literal := &MapLiteral{Pairs: map[Expression]Expression{key("b"): value(2), key("a"): value(1), key("c"): value(3)}}
+
+	// pairs in the order of their keys, whatever the order of the go map
+	expected := `MapLiteral
+  pairs[0]: Pair
+    key: StringLiteral value: "a"
+    value: IntegerLiteral value: 1
+  pairs[1]: Pair
+    key: StringLiteral value: "b"
+    value: IntegerLiteral value: 2
+  pairs[2]: Pair
+    key: StringLiteral value: "c"
+    value: IntegerLiteral value: 3
+`
+	for i := 0; i < 5; i++ {
+		if actual := Dump(literal); actual != expected {
+			t.Fatalf("expected\n%s\ngot\n%s", expected, actual)
+		}
+	}
+}
@@ -0,0 +1,233 @@
+package ast
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"lang/token"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// a node the way JSON, Dot and Dump show it: its kind, where it starts
+// and its fields. Field values are nil, strings, numbers, booleans,
+// dumped nodes or slices of them. Types are shown as they are written.
+type dumped struct {
+	kind        string
+	row, column int
+	fields      []field
+}
+
+type field struct {
+	name  string
+	value interface{}
+}
+
+var (
+	tokenType    = reflect.TypeOf(token.Token{})
+	typeNodeType = reflect.TypeOf(&TypeNode{})
+)
+
+func dump(v reflect.Value) interface{} {
+	switch v.Kind() {
+	case reflect.Invalid:
+		return nil
+	case reflect.Interface:
+		if v.IsNil() {
+			return nil
+		}
+		return dump(v.Elem())
+	case reflect.Ptr:
+		if v.IsNil() {
+			return nil
+		}
+		if v.Type() == typeNodeType {
+			return v.Interface().(*TypeNode).String()
+		}
+		return dump(v.Elem())
+	case reflect.Struct:
+		if v.Type() == tokenType {
+			return v.Interface().(token.Token).Literal
+		}
+		return dumpStruct(v)
+	case reflect.Slice:
+		values := []interface{}{}
+		for i := 0; i < v.Len(); i++ {
+			values = append(values, dump(v.Index(i)))
+		}
+		return values
+	case reflect.Map:
+		// the pairs of map literals, in the order of their keys
+		keys := v.MapKeys()
+		sort.Slice(keys, func(i, j int) bool {
+			return fmt.Sprint(keys[i].Interface()) < fmt.Sprint(keys[j].Interface())
+		})
+		pairs := []interface{}{}
+		for _, key := range keys {
+			pairs = append(pairs, &dumped{kind: "Pair", fields: []field{
+				{"key", dump(key)},
+				{"value", dump(v.MapIndex(key))},
+			}})
+		}
+		return pairs
+	default:
+		return v.Interface()
+	}
+}
+
+func dumpStruct(v reflect.Value) *dumped {
+	d := &dumped{kind: v.Type().Name()}
+	for i := 0; i < v.NumField(); i++ {
+		f := v.Type().Field(i)
+		switch {
+		case f.PkgPath != "":
+			// unexported
+		case f.Name == "Token" && f.Type == tokenType:
+			tok := v.Field(i).Interface().(token.Token)
+			d.row, d.column = tok.Row, tok.Column
+		case f.Anonymous:
+			// the function literal of a function declaration
+			if embedded, ok := dump(v.Field(i)).(*dumped); ok {
+				d.row, d.column = embedded.row, embedded.column
+				d.fields = append(d.fields, embedded.fields...)
+			}
+		default:
+			if value := dump(v.Field(i)); value != nil {
+				d.fields = append(d.fields, field{strings.ToLower(f.Name[:1]) + f.Name[1:], value})
+			}
+		}
+	}
+	return d
+}
+
+func (d *dumped) MarshalJSON() ([]byte, error) {
+	var out bytes.Buffer
+	fmt.Fprintf(&out, `{"kind":%q`, d.kind)
+	if d.row != 0 {
+		fmt.Fprintf(&out, `,"row":%d,"column":%d`, d.row, d.column)
+	}
+	for _, f := range d.fields {
+		value, err := json.Marshal(f.value)
+		if err != nil {
+			return nil, err
+		}
+		fmt.Fprintf(&out, `,%q:%s`, f.name, value)
+	}
+	out.WriteString("}")
+	return out.Bytes(), nil
+}
+
+// the kind and position of d followed by its fields that aren't nodes
+func (d *dumped) label() []string {
+	label := []string{d.kind}
+	if d.row != 0 {
+		label[0] += fmt.Sprintf(" %d:%d", d.row, d.column)
+	}
+	for _, f := range d.fields {
+		if scalar, ok := scalarString(f.value); ok {
+			label = append(label, f.name+": "+scalar)
+		}
+	}
+	return label
+}
+
+// the fields of d that are nodes, the ones in slices named by their index
+func (d *dumped) children() ([]string, []*dumped) {
+	names, children := []string{}, []*dumped{}
+	for _, f := range d.fields {
+		switch value := f.value.(type) {
+		case *dumped:
+			names, children = append(names, f.name), append(children, value)
+		case []interface{}:
+			for i, element := range value {
+				if child, ok := element.(*dumped); ok {
+					names, children = append(names, fmt.Sprintf("%s[%d]", f.name, i)), append(children, child)
+				}
+			}
+		}
+	}
+	return names, children
+}
+
+func scalarString(value interface{}) (string, bool) {
+	switch value := value.(type) {
+	case *dumped:
+		return "", false
+	case []interface{}:
+		if len(value) == 0 {
+			return "[]", true
+		}
+		return "", false
+	case string:
+		return fmt.Sprintf("%q", value), true
+	default:
+		return fmt.Sprint(value), true
+	}
+}
+
+// JSON encodes node and the nodes under it as JSON objects, each with
+// its kind, the row and column it starts at and its fields
+func JSON(node Node) ([]byte, error) {
+	var out bytes.Buffer
+	encoded, err := json.Marshal(dump(reflect.ValueOf(node)))
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Indent(&out, encoded, "", "  "); err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
+
+// Dot draws node and the nodes under it as a graphviz digraph
+func Dot(node Node) string {
+	var out strings.Builder
+	out.WriteString("digraph ast {\n\tnode [shape=box];\n")
+
+	id := 0
+	var draw func(d *dumped) int
+	draw = func(d *dumped) int {
+		self := id
+		id++
+		fmt.Fprintf(&out, "\tn%d [label=\"%s\"];\n", self, dotEscape(strings.Join(d.label(), "\n")))
+		names, children := d.children()
+		for i, child := range children {
+			fmt.Fprintf(&out, "\tn%d -> n%d [label=\"%s\"];\n", self, draw(child), dotEscape(names[i]))
+		}
+		return self
+	}
+	if d, ok := dump(reflect.ValueOf(node)).(*dumped); ok {
+		draw(d)
+	}
+
+	out.WriteString("}\n")
+	return out.String()
+}
+
+func dotEscape(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(s)
+}
+
+// Dump writes node and the nodes under it as indented text, a line for
+// each node with its position and the fields that aren't nodes
+func Dump(node Node) string {
+	var out strings.Builder
+
+	var write func(name string, d *dumped, depth int)
+	write = func(name string, d *dumped, depth int) {
+		out.WriteString(strings.Repeat("  ", depth))
+		if name != "" {
+			out.WriteString(name + ": ")
+		}
+		out.WriteString(strings.Join(d.label(), " ") + "\n")
+		names, children := d.children()
+		for i, child := range children {
+			write(names[i], child, depth+1)
+		}
+	}
+	if d, ok := dump(reflect.ValueOf(node)).(*dumped); ok {
+		write("", d, 0)
+	}
+	return out.String()
+}
@@ -0,0 +1,146 @@
+package ast
+
+import (
+	"lang/token"
+	"strings"
+)
+
+// patterns are matched against a value by match arms
+type Pattern interface {
+	Node
+	patternNode()
+}
+
+// _ matches anything
+type WildcardPattern struct {
+	Token token.Token // token.ID, the underscore
+}
+
+func (wp *WildcardPattern) patternNode()         {}
+func (wp *WildcardPattern) TokenLiteral() string { return wp.Token.Literal }
+func (wp *WildcardPattern) String() string       { return "_" }
+
+// a name matches anything and binds the value to it
+type BindingPattern struct {
+	Token token.Token // token.ID
+	Name  *Identifier
+}
+
+func (bp *BindingPattern) patternNode()         {}
+func (bp *BindingPattern) TokenLiteral() string { return bp.Token.Literal }
+func (bp *BindingPattern) String() string       { return bp.Name.Value }
+
+// an integer, float, string or boolean literal, possibly negated
+type LiteralPattern struct {
+	Token token.Token
+	Value Expression
+}
+
+func (lp *LiteralPattern) patternNode()         {}
+func (lp *LiteralPattern) TokenLiteral() string { return lp.Token.Literal }
+func (lp *LiteralPattern) String() string {
+	if s, ok := lp.Value.(*StringLiteral); ok {
+		return "\"" + s.Value + "\""
+	}
+	return lp.Value.String()
+}
+
+// [a, b] matches lists of exactly two elements, [a, ..rest] lists of
+// at least one, binding the remaining elements to rest
+type ListPattern struct {
+	Token    token.Token // token.LBRACKET
+	Elements []Pattern
+	HasRest  bool
+	Rest     *Identifier // nil for a bare ..
+}
+
+func (lp *ListPattern) patternNode()         {}
+func (lp *ListPattern) TokenLiteral() string { return lp.Token.Literal }
+func (lp *ListPattern) String() string {
+	elements := []string{}
+	for _, e := range lp.Elements {
+		elements = append(elements, e.String())
+	}
+	if lp.HasRest {
+		rest := ".."
+		if lp.Rest != nil {
+			rest += lp.Rest.Value
+		}
+		elements = append(elements, rest)
+	}
+
+	return "[" + strings.Join(elements, ", ") + "]"
+}
+
+// Shape::Circle(r) matches the Circle variant of Shape
+type VariantPattern struct {
+	Token   token.Token // token.ID, the name of the enum
+	Enum    *Identifier
+	Variant *Identifier
+	Fields  []Pattern
+	// written without the enum name, e.g. Some(x)
+	Prelude bool
+}
+
+func (vp *VariantPattern) patternNode()         {}
+func (vp *VariantPattern) TokenLiteral() string { return vp.Token.Literal }
+func (vp *VariantPattern) String() string {
+	out := vp.Enum.Value + "::" + vp.Variant.Value
+	if vp.Prelude {
+		out = vp.Variant.Value
+	}
+	if len(vp.Fields) == 0 {
+		return out
+	}
+
+	fields := []string{}
+	for _, f := range vp.Fields {
+		fields = append(fields, f.String())
+	}
+	return out + "(" + strings.Join(fields, ", ") + ")"
+}
+
+// Bindings are the names a pattern binds, in the order they appear
+func Bindings(p Pattern) []*Identifier {
+	switch p := p.(type) {
+	case *BindingPattern:
+		return []*Identifier{p.Name}
+	case *ListPattern:
+		names := []*Identifier{}
+		for _, e := range p.Elements {
+			names = append(names, Bindings(e)...)
+		}
+		if p.Rest != nil {
+			names = append(names, p.Rest)
+		}
+		return names
+	case *VariantPattern:
+		names := []*Identifier{}
+		for _, f := range p.Fields {
+			names = append(names, Bindings(f)...)
+		}
+		return names
+	default:
+		return []*Identifier{}
+	}
+}
+
+// Enums are the enum names a pattern refers to, in the order they appear
+func Enums(p Pattern) []*Identifier {
+	switch p := p.(type) {
+	case *ListPattern:
+		names := []*Identifier{}
+		for _, e := range p.Elements {
+			names = append(names, Enums(e)...)
+		}
+		return names
+	case *VariantPattern:
+		names := []*Identifier{p.Enum}
+		for _, f := range p.Fields {
+			names = append(names, Enums(f)...)
+		}
+		return names
+	default:
+		return []*Identifier{}
+	}
+}
@@ -0,0 +1,138 @@
+package ast
+
+import (
+	"lang/token"
+	"strings"
+)
+
+// TypeNode is a type annotation, such as Int, List<Int>,
+// Map<String, List<Float>> or Fn(Int, Int) -> Bool. A nil
+// TypeNode is a type that is not known.
+type TypeNode struct {
+	Token      token.Token // token.TYPE
+	Name       string
+	Parameters []*TypeNode // element of List, key and value of Map, parameters of Fn
+	Return     *TypeNode   // Fn only
+}
+
+func NewType(name string, parameters ...*TypeNode) *TypeNode {
+	if name == "" {
+		return nil
+	}
+	return &TypeNode{
+		Token:      token.Token{Type: token.TYPE, Literal: name},
+		Name:       name,
+		Parameters: parameters,
+	}
+}
+
+func NewFunctionType(parameters []*TypeNode, ret *TypeNode) *TypeNode {
+	t := NewType("Fn", parameters...)
+	t.Return = ret
+	return t
+}
+
+func (t *TypeNode) String() string {
+	if t == nil {
+		return ""
+	}
+
+	if t.IsFunction() && t.Return != nil {
+		params := []string{}
+		for _, p := range t.Parameters {
+			params = append(params, p.String())
+		}
+		return "Fn(" + strings.Join(params, ", ") + ") -> " + t.Return.String()
+	}
+
+	if len(t.Parameters) == 0 {
+		return t.Name
+	}
+
+	params := []string{}
+	for _, p := range t.Parameters {
+		if p == nil {
+			// e.g. the error of Ok(1), any type is accepted
+			params = append(params, "_")
+			continue
+		}
+		params = append(params, p.String())
+	}
+	return t.Name + "<" + strings.Join(params, ", ") + ">"
+}
+
+// Func and Fn name the same type
+func (t *TypeNode) IsFunction() bool {
+	return t != nil && (t.Name == "Func" || t.Name == "Fn")
+}
+
+// a bare List, Map or Func accepts any element, key, value or signature
+func (t *TypeNode) IsGeneric() bool {
+	return t != nil && len(t.Parameters) == 0 && t.Return == nil
+}
+
+func (t *TypeNode) Elem() *TypeNode {
+	if t == nil || (t.Name != "List" && t.Name != "Iterator") || len(t.Parameters) != 1 {
+		return nil
+	}
+	return t.Parameters[0]
+}
+
+func (t *TypeNode) Key() *TypeNode {
+	if t == nil || t.Name != "Map" || len(t.Parameters) != 2 {
+		return nil
+	}
+	return t.Parameters[0]
+}
+
+func (t *TypeNode) Value() *TypeNode {
+	if t == nil || t.Name != "Map" || len(t.Parameters) != 2 {
+		return nil
+	}
+	return t.Parameters[1]
+}
+
+// Accepts reports whether a value of type other can be used where t is
+// expected. Unknown types and bare collections are accepted, they are
+// validated once the value is known.
+func (t *TypeNode) Accepts(other *TypeNode) bool {
+	if t == nil || other == nil {
+		return true
+	}
+
+	if t.IsFunction() && other.IsFunction() {
+		if t.IsGeneric() || other.IsGeneric() {
+			return true
+		}
+		if len(t.Parameters) != len(other.Parameters) {
+			return false
+		}
+		for i, p := range t.Parameters {
+			if !p.Accepts(other.Parameters[i]) || !other.Parameters[i].Accepts(p) {
+				return false
+			}
+		}
+		return t.Return.Accepts(other.Return)
+	}
+
+	// a Range is accepted as the List of its Ints, which range() used to
+	// return
+	if t.Name == "List" && other.Name == "Range" {
+		return t.Elem().Accepts(NewType("Int"))
+	}
+
+	if t.Name != other.Name {
+		return false
+	}
+
+	if t.IsGeneric() || other.IsGeneric() || len(t.Parameters) != len(other.Parameters) {
+		return true
+	}
+
+	for i, p := range t.Parameters {
+		if !p.Accepts(other.Parameters[i]) {
+			return false
+		}
+	}
+	return true
+}
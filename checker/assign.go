@@ -0,0 +1,27 @@
+package checker
+
+import "lang/ast"
+
+// mirrors eval's evalAssignStatement
+func (c *Checker) checkAssignStatement(node *ast.AssignStatement) {
+	name, _ := ast.AssignTarget(node.Target)
+	_, defined := c.scope.get(name.Value)
+	_, builtin := builtinReturnTypes[name.Value]
+
+	target := c.checkExpression(node.Target)
+	value := c.checkExpression(node.Value)
+
+	if (defined || builtin) && !c.scope.isMutable(name.Value) {
+		c.setError(name.Token, "cannot assign to immutable variable %s", name.Value)
+		return
+	}
+
+	if node.Operator != "" {
+		infix := &ast.InfixExpression{Token: node.Token, Operator: node.Operator}
+		c.expectType(c.infixType(infix, target.typ, value.typ), target.typ, node.Token,
+			"type mismatch, expected value of type %[2]s to be of type %[1]s")
+		return
+	}
+	c.expectValue(node.Value, target.typ, node.Token,
+		"type mismatch, expected value of type %[2]s to be of type %[1]s")
+}
@@ -0,0 +1,265 @@
+package checker
+
+import (
+	"lang/ast"
+	"lang/eval"
+	"lang/object"
+)
+
+// return types of the builtin functions, an empty type is unknown
+// and skips further checks
+var builtinReturnTypes = map[string]*ast.TypeNode{
+	"len":          ast.NewType("Int"),
+	"max":          nil,
+	"print":        ast.NewType("Void"),
+	"println":      ast.NewType("Void"),
+	"eprint":       ast.NewType("Void"),
+	"eprintln":     ast.NewType("Void"),
+	"range":        ast.NewType("List", ast.NewType("Int")),
+	"string":       ast.NewType("String"),
+	"catch":        ast.NewType("Result", nil, ast.NewType("String")),
+	"from_entries": ast.NewType("Map"),
+	"assert":       ast.NewType("Void"),
+	"assert_eq":    ast.NewType("Void"),
+	"assert_ne":    ast.NewType("Void"),
+	"assert_error": ast.NewType("String"),
+}
+
+var methodReturnTypes = map[string]map[string]string{
+	"List": {
+		"map":     "List",
+		"max":     "",
+		"len":     "Int",
+		"reverse": "List",
+		"slice":   "List",
+		"filter":  "List",
+		"update":  "List",
+		"get":     "Option",
+		"join":    "String",
+
+		"fold":       "",
+		"reduce":     "Option",
+		"sum":        "",
+		"min":        "Option",
+		"sort":       "List",
+		"sort_by":    "List",
+		"zip":        "List",
+		"enumerate":  "List",
+		"flat_map":   "List",
+		"flatten":    "List",
+		"find":       "Option",
+		"index_of":   "Option",
+		"contains":   "Bool",
+		"any":        "Bool",
+		"all":        "Bool",
+		"count":      "Int",
+		"take":       "List",
+		"drop":       "List",
+		"take_while": "List",
+		"chunk":      "List",
+		"window":     "List",
+		"group_by":   "Map",
+		"unique":     "List",
+		"push":       "List",
+		"pop":        "List",
+		"first":      "Option",
+		"last":       "Option",
+		"iter":       "Iterator",
+	},
+	"String": {
+		"otherwise":   "String",
+		"len":         "Int",
+		"chars":       "List",
+		"bytes":       "List",
+		"split":       "List",
+		"lines":       "List",
+		"trim":        "String",
+		"trim_start":  "String",
+		"trim_end":    "String",
+		"upper":       "String",
+		"lower":       "String",
+		"contains":    "Bool",
+		"starts_with": "Bool",
+		"ends_with":   "Bool",
+		"find":        "Option",
+		"replace":     "String",
+		"repeat":      "String",
+		"pad_left":    "String",
+		"pad_right":   "String",
+		"parse_int":   "Result",
+		"parse_float": "Result",
+		"iter":        "Iterator",
+	},
+	"Map": {
+		"len":        "Int",
+		"keys":       "List",
+		"values":     "List",
+		"entries":    "List",
+		"to_list":    "List",
+		"has":        "Bool",
+		"get":        "",
+		"set":        "Map",
+		"insert":     "Map",
+		"remove":     "Map",
+		"merge":      "Map",
+		"map_values": "Map",
+		"filter":     "Map",
+		"iter":       "Iterator",
+	},
+	"Option": {
+		"unwrap":    "",
+		"unwrap_or": "",
+		"map":       "Option",
+		"and_then":  "Option",
+		"is_some":   "Bool",
+		"is_none":   "Bool",
+	},
+	"Result": {
+		"unwrap":    "",
+		"unwrap_or": "",
+		"map":       "Result",
+		"and_then":  "Result",
+		"is_ok":     "Bool",
+		"is_err":    "Bool",
+	},
+}
+
+// methods of a List<T> that keep or expose its element type
+func refineListMethod(list *ast.TypeNode, sig *signature) {
+	elem := list.Elem()
+	switch sig.name {
+	case "max", "sum":
+		sig.returnType = elem
+	case "reverse", "slice", "filter", "sort", "sort_by", "take", "drop", "take_while", "unique", "push", "pop":
+		sig.returnType = list
+	case "get", "reduce", "find", "first", "last", "min":
+		sig.returnType = optionOf(elem)
+	case "iter":
+		sig.returnType = iteratorOf(elem)
+	case "index_of":
+		sig.returnType = optionOf(ast.NewType("Int"))
+	case "chunk", "window":
+		sig.returnType = ast.NewType("List", list)
+	case "enumerate":
+		// [index, element] lists, whose elements share a type when the
+		// elements are Ints
+		if nameOf(elem) == "Int" {
+			sig.returnType = ast.NewType("List", list)
+		}
+	case "zip":
+		sig.infer = func(args []*ast.TypeNode) *ast.TypeNode {
+			if len(args) == 1 && elem != nil && args[0].Elem() != nil && elem.String() == args[0].Elem().String() {
+				return ast.NewType("List", list)
+			}
+			return sig.returnType
+		}
+	case "flatten":
+		if isIterable(elem) {
+			sig.returnType = listOf(valuesOf(elem))
+		}
+	case "map", "flat_map":
+		sig.infer = func(args []*ast.TypeNode) *ast.TypeNode {
+			if len(args) != 1 || !args[0].IsFunction() || args[0].Return == nil {
+				return sig.returnType
+			}
+			if sig.name == "flat_map" {
+				if isIterable(args[0].Return) {
+					return listOf(valuesOf(args[0].Return))
+				}
+				return sig.returnType
+			}
+			return ast.NewType("List", args[0].Return)
+		}
+	case "fold":
+		sig.infer = func(args []*ast.TypeNode) *ast.TypeNode {
+			if len(args) == 2 && args[1].IsFunction() && args[1].Return != nil {
+				return args[1].Return
+			}
+			if len(args) == 2 {
+				return args[0]
+			}
+			return sig.returnType
+		}
+	case "group_by":
+		sig.infer = func(args []*ast.TypeNode) *ast.TypeNode {
+			if len(args) == 1 && args[0].IsFunction() && args[0].Return != nil {
+				return ast.NewType("Map", args[0].Return, list)
+			}
+			return sig.returnType
+		}
+	}
+}
+
+// methods of a String whose results have type parameters
+func refineStringMethod(sig *signature) {
+	switch sig.name {
+	case "chars", "split", "lines":
+		sig.returnType = ast.NewType("List", ast.NewType("String"))
+	case "bytes":
+		sig.returnType = ast.NewType("List", ast.NewType("Int"))
+	case "iter":
+		sig.returnType = ast.NewType("Iterator", ast.NewType("String"))
+	case "find":
+		sig.returnType = optionOf(ast.NewType("Int"))
+	case "parse_int":
+		sig.returnType = ast.NewType("Result", ast.NewType("Int"), ast.NewType("String"))
+	case "parse_float":
+		sig.returnType = ast.NewType("Result", ast.NewType("Float"), ast.NewType("String"))
+	}
+}
+
+// methods of a Map<K, V> that keep or expose its key and value types
+func refineMapMethod(m *ast.TypeNode, sig *signature) {
+	switch sig.name {
+	case "keys":
+		sig.returnType = ast.NewType("List", m.Key())
+	case "values":
+		sig.returnType = ast.NewType("List", m.Value())
+	case "entries", "to_list", "iter":
+		// [key, value] lists, whose elements share a type when K and V do
+		if m.Key() != nil && m.Value() != nil && m.Key().String() == m.Value().String() {
+			sig.returnType = ast.NewType(sig.returnType.Name, ast.NewType("List", m.Key()))
+		}
+	case "set", "insert", "remove", "merge", "filter":
+		sig.returnType = m
+	case "get":
+		sig.infer = func(args []*ast.TypeNode) *ast.TypeNode {
+			if len(args) == 2 {
+				return m.Value()
+			}
+			return optionOf(m.Value())
+		}
+	case "map_values":
+		sig.infer = func(args []*ast.TypeNode) *ast.TypeNode {
+			if len(args) == 1 && args[0].IsFunction() && args[0].Return != nil && m.Key() != nil {
+				return ast.NewType("Map", m.Key(), args[0].Return)
+			}
+			return sig.returnType
+		}
+	}
+}
+
+// the methods are looked up on real objects, so the checker never
+// rejects a method the evaluator knows about
+func methodsOf(typ string) (map[string]object.BuiltinMethod, bool) {
+	switch typ {
+	case "List":
+		return eval.NewList(nil).Methods, true
+	case "String":
+		return eval.NewString("").Methods, true
+	case "Map":
+		return eval.NewMap(nil).Methods, true
+	case "Option":
+		return eval.OptionType.Methods, true
+	case "Result":
+		return eval.ResultType.Methods, true
+	case "Range":
+		return eval.NewRange(0, 0, false).Methods, true
+	case "Iterator":
+		return eval.NewIterator(nil).Methods, true
+	case "Int", "Float", "Bool", "Func", "Fn", "Void":
+		return nil, true
+	default:
+		return nil, false
+	}
+}
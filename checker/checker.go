@@ -0,0 +1,946 @@
+package checker
+
+import (
+	"fmt"
+	"lang/ast"
+	"lang/diagnostic"
+	"lang/object"
+	"lang/token"
+)
+
+// Checker reports type errors before a program is evaluated. A nil
+// type means the checker can't tell statically (e.g. the value of an
+// index into a bare List), such expressions are left to the evaluator.
+type Checker struct {
+	errors   []diagnostic.Diagnostic
+	warnings []diagnostic.Diagnostic
+	scope    *scope
+	structs  map[string]*structDef
+	enums    map[string]*enumDef
+
+	// declared return types of the functions being checked
+	returns []*ast.TypeNode
+
+	// types of the values broken out of the loops being checked
+	breaks [][]*ast.TypeNode
+
+	// a module the host didn't declare is used, whose structs and enums
+	// may be the types that are unknown
+	undeclaredModules bool
+}
+
+func NewChecker() *Checker {
+	c := &Checker{
+		errors:   []diagnostic.Diagnostic{},
+		warnings: []diagnostic.Diagnostic{},
+		scope:    newScope(nil),
+		structs:  make(map[string]*structDef),
+		enums:    make(map[string]*enumDef),
+	}
+	c.declarePrelude()
+	return c
+}
+
+// errors of the last Check, in source order
+func (c *Checker) Errors() []string {
+	return diagnostic.Strings(c.Diagnostics())
+}
+
+// problems of the last Check that don't stop the program from running,
+// such as a match over an enum that misses variants
+func (c *Checker) Warnings() []string {
+	return diagnostic.Strings(c.WarningDiagnostics())
+}
+
+// Diagnostics are the errors of the last Check
+func (c *Checker) Diagnostics() []diagnostic.Diagnostic {
+	diagnostic.Sort(c.errors)
+	return c.errors
+}
+
+// WarningDiagnostics are the warnings of the last Check
+func (c *Checker) WarningDiagnostics() []diagnostic.Diagnostic {
+	diagnostic.Sort(c.warnings)
+	return c.warnings
+}
+
+func (c *Checker) setError(tok token.Token, format string, a ...interface{}) {
+	c.errors = append(c.errors, diagnostic.New(diagnostic.Error, diagnostic.TypeError, span(tok), format, a...))
+}
+
+func (c *Checker) setWarning(tok token.Token, format string, a ...interface{}) {
+	c.warnings = append(c.warnings, diagnostic.New(diagnostic.Warning, diagnostic.TypeWarning, span(tok), format, a...))
+}
+
+func span(tok token.Token) diagnostic.Span {
+	return diagnostic.SpanOf(tok.Row, tok.Column, len(tok.Literal))
+}
+
+// Declare binds a global the host sets outside of any program, t is
+// nil when its type is unknown
+func (c *Checker) Declare(name string, t *ast.TypeNode) {
+	c.scope.set(name, binding{typ: t})
+}
+
+// entry point, the global scope is kept between calls so the repl
+// can check one line at a time
+func (c *Checker) Check(program *ast.Program) {
+	c.errors = []diagnostic.Diagnostic{}
+	c.warnings = []diagnostic.Diagnostic{}
+	c.declare(program.Statements)
+	for _, s := range program.Statements {
+		c.checkStatement(s)
+	}
+}
+
+// functions and variables can be used inside function bodies before
+// their definition is reached, declare them upfront
+func (c *Checker) declare(statements []ast.Statement) {
+	for _, s := range statements {
+		switch s := s.(type) {
+		case *ast.LetStatement:
+			if !c.scope.has(s.Name.Value) && s.Mutable {
+				c.scope.setMutable(s.Name.Value, binding{typ: s.Name.Type})
+			} else if !c.scope.has(s.Name.Value) {
+				c.scope.set(s.Name.Value, binding{typ: s.Name.Type})
+			}
+		case *ast.ExpressionStatement:
+			if fn, ok := s.Expression.(*ast.Function); ok {
+				c.scope.set(fn.Name.Value, functionBinding(fn.FunctionLiteral, fn.Name.Value))
+			}
+		case *ast.StructStatement:
+			def := &structDef{name: s.Name.Value, fields: s.Fields, methods: make(map[string]*signature)}
+			c.structs[def.name] = def
+			c.scope.set(def.name, binding{def: def})
+		case *ast.EnumStatement:
+			def := &enumDef{name: s.Name.Value, variants: s.Variants}
+			c.enums[def.name] = def
+			c.scope.set(def.name, binding{enum: def})
+		case *ast.UseStatement:
+			// modules the host didn't declare are left to the evaluator
+			if !c.scope.has(s.Name.Value) {
+				c.scope.set(s.Name.Value, binding{module: &moduleDef{name: s.Name.Value}})
+				c.undeclaredModules = true
+			}
+		}
+	}
+
+	// impl blocks may come before the struct they implement
+	for _, s := range statements {
+		if impl, ok := s.(*ast.ImplStatement); ok {
+			b, _ := c.scope.get(impl.Name.Value)
+			if b.def == nil {
+				continue
+			}
+			for _, m := range impl.Methods {
+				b.def.methods[m.Name.Value] = functionBinding(m.FunctionLiteral, m.Name.Value).fn
+			}
+		}
+	}
+}
+
+func functionBinding(fn *ast.FunctionLiteral, name string) binding {
+	return binding{
+		typ: functionType(fn),
+		fn: &signature{
+			name:       name,
+			parameters: fn.Parameters,
+			returnType: fn.Type,
+		},
+	}
+}
+
+func functionType(fn *ast.FunctionLiteral) *ast.TypeNode {
+	params := []*ast.TypeNode{}
+	for _, p := range fn.Parameters {
+		params = append(params, p.Type)
+	}
+	return ast.NewFunctionType(params, fn.Type)
+}
+
+func (c *Checker) checkStatement(node ast.Statement) {
+	switch node := node.(type) {
+	case *ast.LetStatement:
+		expected := c.knownType(node.Name.Type)
+		value := c.checkExpression(node.Value)
+		c.expectValue(node.Value, expected, node.Token,
+			"type mismatch, expected value of type %[2]s to be of type %[1]s")
+
+		// a bare annotation takes the more precise type of the value
+		b := binding{typ: expected}
+		if expected.IsGeneric() && expected.Accepts(value.typ) && value.typ != nil {
+			b.typ = value.typ
+		}
+		if expected.IsFunction() {
+			b.fn = value.fn
+		}
+		if node.Mutable {
+			// later assignments are checked against the declared type
+			c.scope.setMutable(node.Name.Value, binding{typ: expected})
+			return
+		}
+		c.scope.set(node.Name.Value, b)
+	case *ast.AssignStatement:
+		c.checkAssignStatement(node)
+	case *ast.ReturnStatement:
+		c.checkExpression(node.ReturnValue)
+		if len(c.returns) == 0 {
+			return
+		}
+		expected := c.returns[len(c.returns)-1]
+		if node.ReturnValue == nil {
+			c.expectType(ast.NewType("Void"), expected, node.Token, "expected return to be of type %s, found %s")
+			return
+		}
+		c.expectValue(node.ReturnValue, expected, node.Token, "expected return to be of type %s, found %s")
+	case *ast.ExpressionStatement:
+		c.checkExpression(node.Expression)
+	case *ast.BlockStatement:
+		c.checkBlock(node, newScope(c.scope))
+	case *ast.StructStatement:
+		for _, f := range node.Fields {
+			c.checkTypeNode(f.Type)
+		}
+	case *ast.WhileStatement:
+		c.checkExpression(node.Condition)
+		c.checkLoopBody(node.Body, newScope(c.scope))
+	case *ast.ForStatement:
+		c.checkForStatement(node)
+	case *ast.TestStatement:
+		c.checkBlock(node.Body, newScope(c.scope))
+	case *ast.BreakStatement:
+		value := c.checkExpression(node.Value)
+		if node.Value != nil && len(c.breaks) > 0 {
+			c.breaks[len(c.breaks)-1] = append(c.breaks[len(c.breaks)-1], value.typ)
+		}
+	case *ast.EnumStatement:
+		for _, v := range node.Variants {
+			for _, f := range v.Fields {
+				c.checkTypeNode(f)
+			}
+		}
+	case *ast.ImplStatement:
+		b, ok := c.scope.get(node.Name.Value)
+		switch {
+		case !ok:
+			c.setError(node.Name.Token, "%s is not defined", node.Name.Value)
+		case b.def == nil:
+			c.setError(node.Name.Token, "impl expected a struct, got %s", objectName(b.typ))
+		}
+		for _, m := range node.Methods {
+			c.checkFunctionBody(m.FunctionLiteral)
+		}
+	}
+}
+
+// reports type names that are neither builtin nor declared structs or enums
+func (c *Checker) checkTypeNode(t *ast.TypeNode) bool {
+	if t == nil {
+		return true
+	}
+
+	known := true
+	if _, ok := methodsOf(t.Name); !ok && c.structs[t.Name] == nil && c.enums[t.Name] == nil {
+		if !c.undeclaredModules {
+			c.setError(t.Token, "unknown type %s", t.Name)
+		}
+		known = false
+	}
+	for _, p := range t.Parameters {
+		known = c.checkTypeNode(p) && known
+	}
+	return c.checkTypeNode(t.Return) && known
+}
+
+// t, or nil when it names an unknown type so it isn't reported twice
+func (c *Checker) knownType(t *ast.TypeNode) *ast.TypeNode {
+	if !c.checkTypeNode(t) {
+		return nil
+	}
+	return t
+}
+
+func (c *Checker) checkBlock(block *ast.BlockStatement, s *scope) *ast.TypeNode {
+	outer := c.scope
+	c.scope = s
+	defer func() { c.scope = outer }()
+
+	c.declare(block.Statements)
+	for _, stmt := range block.Statements {
+		c.checkStatement(stmt)
+	}
+	return blockType(block)
+}
+
+// the type of the implicit value of a block, like evalBlockStatements
+func blockType(block *ast.BlockStatement) *ast.TypeNode {
+	if len(block.Statements) == 0 {
+		return nil
+	}
+
+	switch last := block.Statements[len(block.Statements)-1].(type) {
+	case *ast.LetStatement, *ast.AssignStatement, *ast.WhileStatement, *ast.ForStatement:
+		return ast.NewType("Void")
+	case *ast.ExpressionStatement:
+		return typeOf(last.Expression)
+	default:
+		return nil
+	}
+}
+
+// reports a mismatch for every branch that can produce the value of
+// node, so a wrong type in a rarely taken else if branch is caught
+func (c *Checker) expectValue(node ast.Expression, expected *ast.TypeNode, tok token.Token, format string) {
+	switch node := node.(type) {
+	case *ast.IfExpression:
+		c.expectBlock(node.Consequence, expected, tok, format)
+		if node.Others != nil {
+			c.expectValue(node.Others, expected, tok, format)
+		} else if node.Alternative != nil {
+			c.expectBlock(node.Alternative, expected, tok, format)
+		}
+	case *ast.MatchExpression:
+		for _, arm := range node.Arms {
+			c.expectBlock(arm.Body, expected, tok, format)
+		}
+	case *ast.ListLiteral:
+		// a literal mixing types is a bare List, its elements are checked
+		// one by one against the declared one
+		elem := expected.Elem()
+		if nameOf(expected) != "List" || elem == nil || typeOf(node).Elem() != nil {
+			c.expectType(typeOf(node), expected, tok, format)
+			return
+		}
+		for _, el := range node.Elements {
+			c.expectValue(el, elem, tokenOf(el, tok), format)
+		}
+	default:
+		c.expectType(typeOf(node), expected, tok, format)
+	}
+}
+
+func (c *Checker) expectBlock(block *ast.BlockStatement, expected *ast.TypeNode, tok token.Token, format string) {
+	if len(block.Statements) == 0 {
+		return
+	}
+
+	switch last := block.Statements[len(block.Statements)-1].(type) {
+	case *ast.LetStatement:
+		c.expectType(ast.NewType("Void"), expected, last.Token, format)
+	case *ast.WhileStatement:
+		c.expectType(ast.NewType("Void"), expected, last.Token, format)
+	case *ast.ForStatement:
+		c.expectType(ast.NewType("Void"), expected, last.Token, format)
+	case *ast.AssignStatement:
+		c.expectType(ast.NewType("Void"), expected, last.Token, format)
+	case *ast.ExpressionStatement:
+		c.expectValue(last.Expression, expected, tokenOf(last.Expression, tok), format)
+	}
+}
+
+// format receives the expected type first and the actual type second,
+// named like the evaluator names them unless only their parameters differ
+func (c *Checker) expectType(actual *ast.TypeNode, expected *ast.TypeNode, tok token.Token, format string) {
+	if expected.Accepts(actual) {
+		return
+	}
+
+	want, got := objectName(expected), objectName(actual)
+	if want == got {
+		want, got = expected.String(), actual.String()
+	}
+	c.setError(tok, format, want, got)
+}
+
+// result of checking an expression, fn is known when the expression
+// evaluates to a function whose signature is known
+type result struct {
+	typ    *ast.TypeNode
+	fn     *signature
+	def    *structDef
+	enum   *enumDef
+	module *moduleDef
+}
+
+func (c *Checker) checkExpression(node ast.Expression) result {
+	res := c.inferExpression(node)
+	setType(node, res.typ)
+	return res
+}
+
+func (c *Checker) inferExpression(node ast.Expression) result {
+	switch node := node.(type) {
+	case nil:
+		return result{typ: ast.NewType("Void")}
+	case *ast.IntegerLiteral:
+		return result{typ: ast.NewType("Int")}
+	case *ast.FloatLiteral:
+		return result{typ: ast.NewType("Float")}
+	case *ast.StringLiteral:
+		return result{typ: ast.NewType("String")}
+	case *ast.Boolean:
+		return result{typ: ast.NewType("Bool")}
+	case *ast.Identifier:
+		if b, ok := c.scope.get(node.Value); ok {
+			return result(b)
+		}
+		if returnType, ok := builtinReturnTypes[node.Value]; ok {
+			return result{typ: ast.NewType("Func"), fn: &signature{name: node.Value, returnType: returnType}}
+		}
+		c.setError(node.Token, "%s is not defined", node.Value)
+		return result{}
+	case *ast.PrefixExpression:
+		right := c.checkExpression(node.Right)
+		return result{typ: c.prefixType(node, right.typ)}
+	case *ast.InfixExpression:
+		left := c.checkExpression(node.Left)
+		right := c.checkExpression(node.Right)
+		return result{typ: c.infixType(node, left.typ, right.typ)}
+	case *ast.IfExpression:
+		return result{typ: c.checkIfExpression(node)}
+	case *ast.Function:
+		b := functionBinding(node.FunctionLiteral, node.Name.Value)
+		c.scope.set(node.Name.Value, b)
+		c.checkFunctionBody(node.FunctionLiteral)
+		return result(b)
+	case *ast.FunctionLiteral:
+		c.checkFunctionBody(node)
+		return result(functionBinding(node, ""))
+	case *ast.CallExpression:
+		return c.checkCallExpression(node)
+	case *ast.ListLiteral:
+		elements := []*ast.TypeNode{}
+		for _, el := range node.Elements {
+			elements = append(elements, c.checkExpression(el).typ)
+		}
+		if elem := commonType(elements); elem != nil {
+			return result{typ: ast.NewType("List", elem)}
+		}
+		return result{typ: ast.NewType("List")}
+	case *ast.MapLiteral:
+		keys, values := []*ast.TypeNode{}, []*ast.TypeNode{}
+		for _, key := range node.Keys() {
+			keys = append(keys, c.checkExpression(key).typ)
+			values = append(values, c.checkExpression(node.Pairs[key]).typ)
+		}
+		node.KeyType, node.ValueType = commonType(keys), commonType(values)
+		if node.KeyType != nil && node.ValueType != nil {
+			return result{typ: ast.NewType("Map", node.KeyType, node.ValueType)}
+		}
+		return result{typ: ast.NewType("Map")}
+	case *ast.RangeExpression:
+		return c.checkRangeExpression(node)
+	case *ast.IndexExpression:
+		left := c.checkExpression(node.Left)
+		if node.Slice {
+			return result{typ: c.checkSlice(node, left.typ)}
+		}
+		index := c.checkExpression(node.Index)
+		switch {
+		case nameOf(left.typ) == "List" && (nameOf(index.typ) == "Int" || index.typ == nil):
+			return result{typ: left.typ.Elem()}
+		case nameOf(left.typ) == "String" && (nameOf(index.typ) == "Int" || index.typ == nil):
+			return result{typ: left.typ}
+		case nameOf(left.typ) == "Map":
+			return result{typ: left.typ.Value()}
+		case left.typ == nil:
+		default:
+			c.setError(node.Token, "index operator is not defined over %ss", objectName(left.typ))
+		}
+		return result{}
+	case *ast.AccessExpression:
+		return c.checkAccessExpression(node)
+	case *ast.TryExpression:
+		return result{typ: c.checkTryExpression(node)}
+	case *ast.StructLiteral:
+		return c.checkStructLiteral(node)
+	case *ast.MatchExpression:
+		return result{typ: c.checkMatchExpression(node)}
+	case *ast.LoopExpression:
+		return result{typ: c.checkLoopBody(node.Body, newScope(c.scope))}
+	default:
+		return result{}
+	}
+}
+
+func (c *Checker) checkIfExpression(node *ast.IfExpression) *ast.TypeNode {
+	c.checkExpression(node.Condition)
+
+	types := []*ast.TypeNode{c.checkBlock(node.Consequence, newScope(c.scope))}
+	if node.Others != nil {
+		types = append(types, c.checkExpression(node.Others).typ)
+	} else if node.Alternative != nil {
+		types = append(types, c.checkBlock(node.Alternative, newScope(c.scope)))
+	}
+
+	// the value is only known when every branch agrees
+	return commonType(types)
+}
+
+// the type shared by all types, nil when they differ or none is given
+func commonType(types []*ast.TypeNode) *ast.TypeNode {
+	if len(types) == 0 || types[0] == nil {
+		return nil
+	}
+
+	for _, t := range types[1:] {
+		if t.String() != types[0].String() {
+			return nil
+		}
+	}
+	return types[0]
+}
+
+func (c *Checker) checkFunctionBody(fn *ast.FunctionLiteral) {
+	s := newScope(c.scope)
+	for _, p := range fn.Parameters {
+		s.set(p.Value, binding{typ: c.knownType(p.Type)})
+	}
+	c.checkTypeNode(fn.Type)
+
+	c.returns = append(c.returns, fn.Type)
+	c.checkBlock(fn.Body, s)
+	c.expectBlock(fn.Body, fn.Type, fn.Token, "expected return to be of type %s, found %s")
+	c.returns = c.returns[:len(c.returns)-1]
+}
+
+// calls through a parameter, a variable or a registered Go function
+// whose type is a signature such as Fn(Int, String) -> Bool, their
+// arguments are checked like the ones of builtins
+func (c *Checker) checkSignatureCall(node *ast.CallExpression, t *ast.TypeNode, args []*ast.TypeNode) result {
+	if t == nil || t.IsGeneric() {
+		return result{}
+	}
+
+	name := node.Function.String()
+	if len(t.Parameters) != len(args) {
+		c.setError(node.Token, "function %s expected %d arguments, got %d", name, len(t.Parameters), len(args))
+		return result{typ: t.Return}
+	}
+	for i, arg := range args {
+		format := fmt.Sprintf("%s expected argument %d to be of type %%s, got=%%s", name, i+1)
+		c.expectType(arg, t.Parameters[i], node.Token, format)
+	}
+	return result{typ: t.Return}
+}
+
+func (c *Checker) checkCallExpression(node *ast.CallExpression) result {
+	callee := c.checkExpression(node.Function)
+
+	args := []*ast.TypeNode{}
+	for _, arg := range node.Arguments {
+		args = append(args, c.checkExpression(arg).typ)
+	}
+
+	switch {
+	case callee.typ != nil && !callee.typ.IsFunction():
+		c.setError(node.Token, "not a function: %s", objectName(callee.typ))
+		return result{}
+	case callee.fn == nil:
+		return c.checkSignatureCall(node, callee.typ, args)
+	}
+
+	sig := callee.fn
+	if sig.fields != nil {
+		return c.checkVariantCall(node, sig, args)
+	}
+
+	// builtins and methods don't declare their parameters
+	if sig.parameters == nil {
+		if sig.infer != nil {
+			return result{typ: sig.infer(args)}
+		}
+		return result{typ: sig.returnType}
+	}
+
+	if len(sig.parameters) != len(args) {
+		kind := "function"
+		if sig.method {
+			kind = "method"
+		}
+		c.setError(node.Token, "%s %s expected %d arguments, got %d",
+			kind, sig.name, len(sig.parameters), len(args))
+		return result{typ: sig.returnType}
+	}
+
+	for i, arg := range args {
+		format := fmt.Sprintf("expected argument %d (%s) to be of type %%s, got %%s", i, sig.parameters[i])
+		c.expectType(arg, sig.parameters[i].Type, node.Token, format)
+	}
+
+	return result{typ: sig.returnType}
+}
+
+func (c *Checker) checkAccessExpression(node *ast.AccessExpression) result {
+	structure := c.checkExpression(node.Struct)
+
+	if structure.module != nil {
+		return c.checkModuleAccess(node, structure.module)
+	}
+
+	// methods called on the struct itself, e.g. Point.new(1, 2)
+	if structure.def != nil {
+		sig, ok := structure.def.methods[node.Attribute]
+		if !ok {
+			c.setError(node.Token, "struct %s has no method %s", structure.def.name, node.Attribute)
+			return result{}
+		}
+		return result{typ: ast.NewType("Func"), fn: sig}
+	}
+
+	if structure.enum != nil {
+		return c.checkVariant(node, structure.enum)
+	}
+
+	if def := c.structs[nameOf(structure.typ)]; def != nil {
+		return c.checkMember(node, def)
+	}
+
+	methods, known := methodsOf(nameOf(structure.typ))
+	if !known {
+		return result{typ: ast.NewType("Func")}
+	}
+
+	if _, ok := methods[node.Attribute]; !ok {
+		c.setError(node.Token, "type %s has no method %s",
+			objectName(structure.typ), node.Attribute)
+		return result{}
+	}
+
+	sig := &signature{
+		name:       node.Attribute,
+		returnType: ast.NewType(methodReturnTypes[structure.typ.Name][node.Attribute]),
+	}
+	switch structure.typ.Name {
+	case "List":
+		refineListMethod(structure.typ, sig)
+	case "String":
+		refineStringMethod(sig)
+	case "Map":
+		refineMapMethod(structure.typ, sig)
+	case "Option", "Result":
+		refineOptionMethod(structure.typ, sig)
+	case "Range":
+		refineRangeMethod(sig)
+	case "Iterator":
+		refineIteratorMethod(structure.typ, sig)
+	}
+	return result{typ: ast.NewType("Func"), fn: sig}
+}
+
+// xs[start:end] is a list or a string like xs, mirrors evalSliceExpression
+func (c *Checker) checkSlice(node *ast.IndexExpression, left *ast.TypeNode) *ast.TypeNode {
+	for _, bound := range []ast.Expression{node.Index, node.End} {
+		if bound == nil {
+			continue
+		}
+		if t := c.checkExpression(bound).typ; t != nil && nameOf(t) != "Int" {
+			c.setError(node.Token, "slice bounds must be INTEGERs, got %s", objectName(t))
+		}
+	}
+
+	switch nameOf(left) {
+	case "List", "String", "":
+		return left
+	default:
+		c.setError(node.Token, "slice operator is not defined over %ss", objectName(left))
+		return nil
+	}
+}
+
+// fields and methods of struct instances, mirrors evalAccessExpression
+func (c *Checker) checkMember(node *ast.AccessExpression, def *structDef) result {
+	if field := def.field(node.Attribute); field != nil {
+		return result{typ: field.Type}
+	}
+
+	sig, ok := def.methods[node.Attribute]
+	if !ok {
+		c.setError(node.Token, "type %s has no field or method %s", def.name, node.Attribute)
+		return result{}
+	}
+
+	if len(sig.parameters) == 0 || sig.parameters[0].Value != "self" {
+		c.setError(node.Token, "%s.%s takes no self, call it on the struct instead", def.name, sig.name)
+		return result{}
+	}
+
+	bound := &signature{
+		name:       sig.name,
+		method:     true,
+		parameters: sig.parameters[1:],
+		returnType: sig.returnType,
+	}
+	return result{typ: ast.NewType("Func"), fn: bound}
+}
+
+// mirrors eval.StructLiteral, but reports every problem instead of the first
+func (c *Checker) checkStructLiteral(node *ast.StructLiteral) result {
+	for _, v := range node.Values {
+		c.checkExpression(v)
+	}
+
+	b, ok := c.scope.get(node.Name.Value)
+	switch {
+	case !ok:
+		c.setError(node.Token, "%s is not defined", node.Name.Value)
+		return result{}
+	case b.def == nil:
+		c.setError(node.Token, "expected a struct, got %s", objectName(b.typ))
+		return result{}
+	}
+
+	def := b.def
+	set := map[string]bool{}
+	for i, name := range node.Fields {
+		field := def.field(name.Value)
+		switch {
+		case field == nil:
+			c.setError(node.Token, "struct %s has no field %s", def.name, name.Value)
+		case set[name.Value]:
+			c.setError(node.Token, "field %s of %s is set twice", name.Value, def.name)
+		default:
+			format := fmt.Sprintf("expected field %s of %s to be of type %%s, got %%s", name.Value, def.name)
+			c.expectValue(node.Values[i], field.Type, node.Token, format)
+		}
+		set[name.Value] = true
+	}
+
+	for _, f := range def.fields {
+		if !set[f.Value] {
+			c.setError(node.Token, "missing field %s in %s", f.Value, def.name)
+		}
+	}
+
+	return result{typ: ast.NewType(def.name)}
+}
+
+func (c *Checker) prefixType(node *ast.PrefixExpression, right *ast.TypeNode) *ast.TypeNode {
+	switch node.Operator {
+	case "!":
+		return ast.NewType("Bool")
+	case "-":
+		switch nameOf(right) {
+		case "Int", "Float", "":
+			return right
+		}
+		c.setError(node.Token, "operator - is not defined over %s", objectName(right))
+	}
+	return nil
+}
+
+// mirrors evalInfixExpression
+func (c *Checker) infixType(node *ast.InfixExpression, leftType *ast.TypeNode, rightType *ast.TypeNode) *ast.TypeNode {
+	left, right := nameOf(leftType), nameOf(rightType)
+	if left == "" || right == "" {
+		return nil
+	}
+
+	op := node.Operator
+	comparison := op == "==" || op == "!=" || op == "<" || op == ">" || op == "<=" || op == ">="
+	numeric := func(t string) bool { return t == "Int" || t == "Float" }
+
+	switch {
+	case left == "Int" && right == "Int":
+		switch {
+		case comparison:
+			return ast.NewType("Bool")
+		case op == "+" || op == "-" || op == "*" || op == "/" || op == "%" || op == "^":
+			return ast.NewType("Int")
+		}
+		c.setError(node.Token, "operator %s is not defined over INTEGERs", op)
+	case numeric(left) && numeric(right):
+		switch {
+		case comparison:
+			return ast.NewType("Bool")
+		case op == "+" || op == "-" || op == "*" || op == "/" || op == "^":
+			return ast.NewType("Float")
+		}
+		c.setError(node.Token, "operator %s is not defined over FLOATs", op)
+	case left == "Bool" && right == "Bool":
+		if op == "||" || op == "&&" || op == "==" || op == "!=" {
+			return ast.NewType("Bool")
+		}
+		c.setError(node.Token, "%s is not defined over BOOLEANs", op)
+	case left == "String" && right == "String":
+		switch op {
+		case "==", "!=":
+			return ast.NewType("Bool")
+		case "+":
+			return ast.NewType("String")
+		}
+		c.setError(node.Token, "%s is not defined over STRINGs", op)
+	case left == "String" && (right == "Int" || right == "Bool") && op == "*":
+		return ast.NewType("String")
+	case left == "List" && right == "List":
+		if op == "+" {
+			if leftType.String() == rightType.String() {
+				return leftType
+			}
+			return ast.NewType("List")
+		}
+		c.setError(node.Token, "%s is not defined over LISTs", op)
+	default:
+		c.setError(node.Token, "operator %s is not defined over %s and %s",
+			op, object.MapTypeToObject(left), object.MapTypeToObject(right))
+	}
+	return nil
+}
+
+// fills in the Type of the node, function literals keep theirs since
+// it holds the declared return type
+func setType(node ast.Expression, t *ast.TypeNode) {
+	switch node := node.(type) {
+	case *ast.Identifier:
+		node.Type = t
+	case *ast.IntegerLiteral:
+		node.Type = t
+	case *ast.FloatLiteral:
+		node.Type = t
+	case *ast.StringLiteral:
+		node.Type = t
+	case *ast.Boolean:
+		node.Type = t
+	case *ast.PrefixExpression:
+		node.Type = t
+	case *ast.InfixExpression:
+		node.Type = t
+	case *ast.IfExpression:
+		node.Type = t
+	case *ast.CallExpression:
+		node.Type = t
+	case *ast.ListLiteral:
+		node.Type = t
+	case *ast.MapLiteral:
+		node.Type = t
+	case *ast.IndexExpression:
+		node.Type = t
+	case *ast.RangeExpression:
+		node.Type = t
+	case *ast.AccessExpression:
+		node.Type = t
+	case *ast.TryExpression:
+		node.Type = t
+	case *ast.StructLiteral:
+		node.Type = t
+	case *ast.MatchExpression:
+		node.Type = t
+	case *ast.LoopExpression:
+		node.Type = t
+	}
+}
+
+// TypeOf is the type the last Check found for node, nil when it can't
+// tell statically
+func TypeOf(node ast.Expression) *ast.TypeNode {
+	return typeOf(node)
+}
+
+// the type setType filled in
+func typeOf(node ast.Expression) *ast.TypeNode {
+	switch node := node.(type) {
+	case nil:
+		return ast.NewType("Void")
+	case *ast.Function:
+		return functionType(node.FunctionLiteral)
+	case *ast.FunctionLiteral:
+		return functionType(node)
+	case *ast.Identifier:
+		return node.Type
+	case *ast.IntegerLiteral:
+		return node.Type
+	case *ast.FloatLiteral:
+		return node.Type
+	case *ast.StringLiteral:
+		return node.Type
+	case *ast.Boolean:
+		return node.Type
+	case *ast.PrefixExpression:
+		return node.Type
+	case *ast.InfixExpression:
+		return node.Type
+	case *ast.IfExpression:
+		return node.Type
+	case *ast.CallExpression:
+		return node.Type
+	case *ast.ListLiteral:
+		return node.Type
+	case *ast.MapLiteral:
+		return node.Type
+	case *ast.IndexExpression:
+		return node.Type
+	case *ast.RangeExpression:
+		return node.Type
+	case *ast.AccessExpression:
+		return node.Type
+	case *ast.TryExpression:
+		return node.Type
+	case *ast.StructLiteral:
+		return node.Type
+	case *ast.MatchExpression:
+		return node.Type
+	case *ast.LoopExpression:
+		return node.Type
+	default:
+		return nil
+	}
+}
+
+// name of the type as the switches below spell it, empty when unknown
+func nameOf(t *ast.TypeNode) string {
+	switch {
+	case t == nil:
+		return ""
+	case t.IsFunction():
+		return "Func"
+	default:
+		return t.Name
+	}
+}
+
+// name of the type as the evaluator reports it
+func objectName(t *ast.TypeNode) string {
+	return string(object.MapTypeToObject(nameOf(t)))
+}
+
+// position of the token errors about node point at
+func tokenOf(node ast.Expression, fallback token.Token) token.Token {
+	switch node := node.(type) {
+	case *ast.Identifier:
+		return node.Token
+	case *ast.IntegerLiteral:
+		return node.Token
+	case *ast.FloatLiteral:
+		return node.Token
+	case *ast.StringLiteral:
+		return node.Token
+	case *ast.Boolean:
+		return node.Token
+	case *ast.PrefixExpression:
+		return node.Token
+	case *ast.InfixExpression:
+		return node.Token
+	case *ast.CallExpression:
+		return node.Token
+	case *ast.ListLiteral:
+		return node.Token
+	case *ast.MapLiteral:
+		return node.Token
+	case *ast.IndexExpression:
+		return node.Token
+	case *ast.RangeExpression:
+		return node.Token
+	case *ast.AccessExpression:
+		return node.Token
+	case *ast.TryExpression:
+		return node.Token
+	case *ast.StructLiteral:
+		return node.Token
+	case *ast.MatchExpression:
+		return node.Token
+	case *ast.LoopExpression:
+		return node.Token
+	default:
+		return fallback
+	}
+}
@@ -0,0 +1,428 @@
+package checker
+
+import (
+	"lang/ast"
+	"lang/diagnostic"
+	"lang/lexer"
+	"lang/parser"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func testCheck(input string) (*ast.Program, []string) {
+	l := lexer.NewLexer(input)
+	p := parser.NewParser(l)
+	program := p.Parse()
+
+	c := NewChecker()
+	c.Check(program)
+	return program, c.Errors()
+}
+
+func TestExamplesTypeCheck(t *testing.T) {
+	files, err := filepath.Glob("../examples/*.rs")
+	if err != nil || len(files) == 0 {
+		t.Fatalf("no examples found: %v", err)
+	}
+
+	for _, file := range files {
+		bytes, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatalf("could not read %s: %v", file, err)
+		}
+
+		_, errors := testCheck(string(bytes) + "\nmain();")
+		for _, msg := range errors {
+			t.Errorf("%s: unexpected error %s", file, msg)
+		}
+	}
+}
+
+func TestTypeErrors(t *testing.T) {
+	tests := []struct {
+		code     string
+		expected []string
+	}{
+		{code: `"Hello"+3`, expected: []string{"[1,8] operator + is not defined over STRING and INTEGER"}},
+		{code: "3 || 8", expected: []string{"[1,3] operator || is not defined over INTEGERs"}},
+		{code: "someVar;", expected: []string{"[1,1] someVar is not defined"}},
+		{
+			code:     "let x: Int = 1.0;",
+			expected: []string{"[1,1] type mismatch, expected value of type FLOAT to be of type INTEGER"},
+		},
+		{
+			code:     "fn f(x: Int) Int { x }; f(1, 2)",
+			expected: []string{"[1,26] function f expected 1 arguments, got 2"},
+		},
+		{
+			code:     "fn f(x: Int) Int { x }; f(true)",
+			expected: []string{"[1,26] expected argument 0 (x) to be of type INTEGER, got BOOLEAN"},
+		},
+		{
+			code: `fn f(x: Int) Int {
+    if (x > 0) {
+        1
+    } else if (x < -100) {
+        "rare"
+    } else {
+        return 2.0;
+    }
+}`,
+			expected: []string{
+				"[5,11] expected return to be of type INTEGER, found STRING",
+				"[7,9] expected return to be of type INTEGER, found FLOAT",
+			},
+		},
+		{code: "[1].append(2)", expected: []string{"[1,4] type LIST has no method append"}},
+		{code: "true[0]", expected: []string{"[1,5] index operator is not defined over BOOLEANs"}},
+		{code: `let c: String = "abc"[0]; let s: String = "abc"[1:]; let xs: List<Int> = [1, 2][:1];`, expected: []string{}},
+		{code: `let n: Int = "abc"[0:2];`, expected: []string{"[1,1] type mismatch, expected value of type STRING to be of type INTEGER"}},
+		{code: `"abc"["a":]`, expected: []string{"[1,6] slice bounds must be INTEGERs, got STRING"}},
+		{code: "true[1:]", expected: []string{"[1,5] slice operator is not defined over BOOLEANs"}},
+		{code: `let xs: List<String> = "a b".split(" "); let n: Option<Int> = "ab".find("b"); let r: Result<Int, String> = "1".parse_int();`, expected: []string{}},
+		{code: `let n: Int = "a".chars();`, expected: []string{"[1,1] type mismatch, expected value of type LIST to be of type INTEGER"}},
+		{code: `let s: String = ["a", "b"].join(", ");`, expected: []string{}},
+		{code: `let m: Map<String, Int> = {"a": 1}; let ks: List<String> = m.keys(); let n: Int = m.get("b", 0); let d: Map<String, Float> = m.map_values(fn(v: Int) Float { 1.5 }).set("c", 2.0);`, expected: []string{}},
+		{code: `let m: Map<String, Int> = {"a": 1}; let ks: List<Int> = m.keys();`, expected: []string{"[1,37] type mismatch, expected value of type List<String> to be of type List<Int>"}},
+		{code: `let m: Map<String, Int> = {"a": 1}; let n: Int = m.get("a");`, expected: []string{"[1,37] type mismatch, expected value of type Option to be of type INTEGER"}},
+		{code: "let xs: List<Int> = [1, 2]; let s: Int = xs.sum(); let f: Option<Int> = xs.first(); let ws: List<List<Int>> = xs.window(2); let g: Map<Bool, List<Int>> = xs.group_by(fn(x: Int) Bool { x > 1 }); let n: Int = xs.fold(0, fn(a: Int, x: Int) Int { a + x });", expected: []string{}},
+		{code: "let xs: List<Int> = [1, 2]; let s: List<Int> = xs.flat_map(fn(x: Int) List<String> { [string(x)] });", expected: []string{"[1,29] type mismatch, expected value of type List<String> to be of type List<Int>"}},
+		{code: `let m: Map<Int, Int> = {1: 2}; let es: List<List<Int>> = m.entries(); let o: Map<Int, Int> = from_entries(es);`, expected: []string{}},
+		{code: "let xs: List<Int> = [1, 2]; let s: List<String> = xs.flat_map(fn(x: Int) Iterator<String> { [string(x)].iter() });", expected: []string{}},
+		{code: "let xs: List<Int> = [1, 2]; let s: List<String> = xs.flat_map(fn(x: Int) Range { 0..x });", expected: []string{"[1,29] type mismatch, expected value of type List<Int> to be of type List<String>"}},
+		{code: "let l: List<Int> = range(1, 3).map(fn(x: Int) Int { x * 2 }); let r: List<Int> = 0..3; let n: Int = max(range(1, 3)) + r[0];", expected: []string{}},
+		{code: "let l: List<String> = 0..3;", expected: []string{"[1,1] type mismatch, expected value of type RANGE to be of type LIST"}},
+		{
+			code: "let a: Int = true; let b: String = 1;",
+			expected: []string{
+				"[1,1] type mismatch, expected value of type BOOLEAN to be of type INTEGER",
+				"[1,20] type mismatch, expected value of type INTEGER to be of type STRING",
+			},
+		},
+		{code: "fn main() { helper() }; fn helper() {}; main();", expected: []string{}},
+		{code: "let l: List = [1, 2]; l[0] + 1", expected: []string{}},
+		{code: `let xs: List<Int> = [1, 2, "a"];`, expected: []string{"[1,30] type mismatch, expected value of type STRING to be of type INTEGER"}},
+		{code: `let xs: List<List<Int>> = [[1], [2.5, 3]]; let ys: List<Int> = [1, if (true) { 2 } else { 3 }];`, expected: []string{"[1,34] type mismatch, expected value of type FLOAT to be of type INTEGER"}},
+		{code: `fn f() List<String> { return [1, "a"]; }`, expected: []string{"[1,31] expected return to be of type STRING, found INTEGER"}},
+		{code: `let xs: List = [1, "a"]; let n: Int = [1];`, expected: []string{"[1,26] type mismatch, expected value of type LIST to be of type INTEGER"}},
+		{
+			code:     `let xs: List<Int> = ["a", "b"];`,
+			expected: []string{"[1,1] type mismatch, expected value of type List<String> to be of type List<Int>"},
+		},
+		{
+			code:     `let xs: List<String> = ["a"]; xs[0] + 1`,
+			expected: []string{"[1,37] operator + is not defined over STRING and INTEGER"},
+		},
+		{
+			code:     `let m: Map<String, Int> = {"a": 1}; m["a"] * 2.0; m["a"] || true`,
+			expected: []string{"[1,58] operator || is not defined over INTEGER and BOOLEAN"},
+		},
+		{
+			code:     "fn f(xs: List<Int>) Int { 0 }; f([1.5])",
+			expected: []string{"[1,33] expected argument 0 (xs) to be of type List<Int>, got List<Float>"},
+		},
+		{
+			code:     "let f: Fn(Int) -> Bool = fn(x: String) Bool { true };",
+			expected: []string{"[1,1] type mismatch, expected value of type Fn(String) -> Bool to be of type Fn(Int) -> Bool"},
+		},
+		{
+			code:     "fn apply(f: Fn(Int) -> Int, x: Int) Int { f(x) }; apply(fn(x: Int) Int { x }, 1) + true",
+			expected: []string{"[1,82] operator + is not defined over INTEGER and BOOLEAN"},
+		},
+		{
+			code:     `let lens: List<Int> = ["a"].map(fn(x: String) String { x });`,
+			expected: []string{"[1,1] type mismatch, expected value of type List<String> to be of type List<Int>"},
+		},
+		{code: "let xs: List<Int> = range(0, 3).filter(fn(x: Int) Bool { x > 0 }).reverse();", expected: []string{}},
+		{
+			code:     "struct P { x: Int } impl P { fn get(self) Int { self.x } } let n: Int = P { x: 1 }.get(); n",
+			expected: []string{},
+		},
+		{
+			code: `struct P { x: Int, y: Int } P { x: "a", z: 1 }`,
+			expected: []string{
+				"[1,29] expected field x of P to be of type INTEGER, got STRING",
+				"[1,29] struct P has no field z",
+				"[1,29] missing field y in P",
+			},
+		},
+		{
+			code:     "struct P { x: Int } let s: String = P { x: 1 }.x;",
+			expected: []string{"[1,21] type mismatch, expected value of type INTEGER to be of type STRING"},
+		},
+		{
+			code:     "struct P { x: Int } impl P { fn f(self, n: Int) Int { n } } P { x: 1 }.f()",
+			expected: []string{"[1,73] method f expected 1 arguments, got 0"},
+		},
+		{
+			code:     "struct P { x: Int } P { x: 1 }.y",
+			expected: []string{"[1,31] type P has no field or method y"},
+		},
+		{
+			code:     "struct P { x: Int } fn f(p: P) Int { p.x } f(1)",
+			expected: []string{"[1,45] expected argument 0 (p) to be of type P, got INTEGER"},
+		},
+		{code: "let p: Pint = 1;", expected: []string{"[1,8] unknown type Pint"}},
+		{code: "impl Q { fn f() {} }", expected: []string{"[1,6] Q is not defined"}},
+		{
+			code:     "enum S { C(Float), E } let s: S = S::C(1.0); let f: Float = match s { S::C(r) => r, S::E => 0.0 };",
+			expected: []string{},
+		},
+		{
+			code: `enum S { C(Float), E } let n: Int = match S::E { S::C(r) => r, S::E => "none" };`,
+			expected: []string{
+				"[1,61] type mismatch, expected value of type FLOAT to be of type INTEGER",
+				"[1,74] type mismatch, expected value of type STRING to be of type INTEGER",
+			},
+		},
+		{
+			code: "enum S { C(Float) } S::C(1); S::C(1.0, 2.0); S::D",
+			expected: []string{
+				"[1,25] expected field 0 of S::C to be of type FLOAT, got INTEGER",
+				"[1,34] variant S::C expected 1 arguments, got 2",
+				"[1,47] enum S has no variant D",
+			},
+		},
+		{
+			code: "enum S { C(Float) } match S::C(1.0) { S::C(a, b) => 1, S::D => 2, Q::C(x) => 3, _ => 4 }",
+			expected: []string{
+				"[1,39] pattern S::C expected 1 fields, got 2",
+				"[1,59] enum S has no variant D",
+				"[1,67] Q is not defined",
+			},
+		},
+		{
+			code:     `let xs: List<String> = ["a"]; match xs { [x, ..rest] => x + 1, _ => 0 }`,
+			expected: []string{"[1,59] operator + is not defined over STRING and INTEGER"},
+		},
+		{code: "let b: Bool = match 1 { n if n + true => true, _ => false };", expected: []string{"[1,32] operator + is not defined over INTEGER and BOOLEAN"}},
+		{code: "fn f(s: Shape) Int { 1 }", expected: []string{"[1,9] unknown type Shape"}},
+		{
+			code:     `let m: Map<String, Int> = {"a": 1}; for k, v in m { k + v; }; for i, c in "ab" { i + c; }`,
+			expected: []string{"[1,55] operator + is not defined over STRING and INTEGER", "[1,84] operator + is not defined over INTEGER and STRING"},
+		},
+		{code: "for x in 5 { x; }", expected: []string{"[1,1] for expected a List, Map, String, Range or Iterator, got INTEGER"}},
+		{code: "let s: String = loop { break 1; };", expected: []string{"[1,1] type mismatch, expected value of type INTEGER to be of type STRING"}},
+		{code: "let n: Int = loop { break 1; }; let xs: List<Int> = [1]; for x in xs { x + true; }", expected: []string{"[1,74] operator + is not defined over INTEGER and BOOLEAN"}},
+		{
+			code:     `let mut x: Int = 1; x = 2; x += 3; let mut xs: List<Int> = [1]; xs[0] = 2; let mut m: Map<String, Int> = {}; m["a"] = 1;`,
+			expected: []string{},
+		},
+		{
+			code: `let x: Int = 1; x = 2; y = 3; len = 4;`,
+			expected: []string{
+				"[1,17] cannot assign to immutable variable x",
+				"[1,24] y is not defined",
+				"[1,31] cannot assign to immutable variable len",
+			},
+		},
+		{
+			code: `let mut x: Int = 1; x = "a"; x += 1.5; let mut xs: List<Int> = [1]; xs[0] = true;`,
+			expected: []string{
+				"[1,23] type mismatch, expected value of type STRING to be of type INTEGER",
+				"[1,32] type mismatch, expected value of type FLOAT to be of type INTEGER",
+				"[1,75] type mismatch, expected value of type BOOLEAN to be of type INTEGER",
+			},
+		},
+		{code: "let mut c: Int = 0; fn inc() { c += 1 }; fn get() Int { c = 1 }", expected: []string{"[1,59] expected return to be of type INTEGER, found NULL"}},
+		{code: "fn f() Int { while (true) { } }", expected: []string{"[1,14] expected return to be of type INTEGER, found NULL"}},
+		{code: "let x: Int = 1?;", expected: []string{"[1,15] operator ? is not defined over INTEGER"}},
+		{
+			code: "fn f(o: Option<Int>) Int { o? }; fn g(o: Option<Int>) Option<String> { let x: String = o?; Some(x) }",
+			expected: []string{
+				"[1,29] expected return to be of type INTEGER, found Option",
+				"[1,72] type mismatch, expected value of type INTEGER to be of type STRING",
+			},
+		},
+		{
+			code:     "fn f(r: Result<Int, String>) Result<Int, Bool> { Ok(r?) }",
+			expected: []string{"[1,54] expected return to be of type Result<Int, Bool>, found Result<_, String>"},
+		},
+		{
+			code: `let o: Option<Int> = Some("a"); let r: Result<Int, String> = Err(1); let s: String = o.unwrap();`,
+			expected: []string{
+				"[1,1] type mismatch, expected value of type Option<String> to be of type Option<Int>",
+				"[1,33] type mismatch, expected value of type Result<_, Int> to be of type Result<Int, String>",
+				"[1,70] type mismatch, expected value of type INTEGER to be of type STRING",
+			},
+		},
+		{
+			code:     `fn f(m: Map<String, Int>, xs: List<Bool>) Int { let b: Bool = m.get("a").unwrap_or(0); xs.get(0).unwrap() }`,
+			expected: []string{"[1,49] type mismatch, expected value of type INTEGER to be of type BOOLEAN", "[1,104] expected return to be of type INTEGER, found BOOLEAN"},
+		},
+		{
+			code:     "fn f(r: Result<Int, String>) Int { match r { Ok(n) => n, Err(e) => e } }",
+			expected: []string{"[1,68] expected return to be of type INTEGER, found STRING"},
+		},
+		{code: "let s: String = catch(fn() Int { 1 }).unwrap_or(1);", expected: []string{}},
+		// tests are checked like the rest of the program, in a scope of their own
+		{
+			code:     `test "a" { let n: Int = assert_error(fn() Int { 1 }); assert_eq(n, "a" - 1); }`,
+			expected: []string{"[1,12] type mismatch, expected value of type STRING to be of type INTEGER", "[1,72] operator - is not defined over STRING and INTEGER"},
+		},
+		{code: `test "a" { let n: Int = 1; } let m: Int = n;`, expected: []string{"[1,43] n is not defined"}},
+		{
+			code: `fn apply(f: Fn(Int) -> Int) Int { f("a") + f(1, 2) } let s: String = apply(fn(x: Int) Int { x });`,
+			expected: []string{
+				"[1,36] f expected argument 1 to be of type INTEGER, got=STRING",
+				"[1,45] function f expected 1 arguments, got 2",
+				"[1,54] type mismatch, expected value of type INTEGER to be of type STRING",
+			},
+		},
+		{
+			code:     `let r: Range = 0..10; let xs: List<Int> = r.step(2).map(fn(x: Int) Int { x * 2 }).collect(); let n: Int = (0..5).len() + r.sum(); let it: Iterator<List<Int>> = r.enumerate();`,
+			expected: []string{},
+		},
+		{
+			code: `let r: Range = 0.."a"; let xs: List<String> = (0..5).map(fn(x: Int) Int { x }).collect(); let it: Iterator<String> = [1].iter(); for x in 0..3 { x + "a"; }`,
+			expected: []string{
+				"[1,17] range bounds must be INTEGERs, got INTEGER and STRING",
+				"[1,24] type mismatch, expected value of type List<Int> to be of type List<String>",
+				"[1,91] type mismatch, expected value of type Iterator<Int> to be of type Iterator<String>",
+				"[1,148] operator + is not defined over INTEGER and STRING",
+			},
+		},
+	}
+
+	for i, test := range tests {
+		_, errors := testCheck(test.code)
+
+		if len(errors) != len(test.expected) {
+			t.Errorf("case %d: expected %d errors, got=%d %q", i, len(test.expected), len(errors), errors)
+			continue
+		}
+
+		for j, msg := range errors {
+			if msg != test.expected[j] {
+				t.Errorf("case %d: \nexpected error\t%s,\ngot\t\t%s", i, test.expected[j], msg)
+			}
+		}
+	}
+}
+
+func TestModules(t *testing.T) {
+	module := NewChecker()
+	module.Check(parser.NewParser(lexer.NewLexer(
+		"pub fn square(x: Int) Int { x * x } fn helper() Int { 1 } pub struct Point { x: Int } impl Point { fn new(x: Int) Point { Point { x: x } } }",
+	)).Parse())
+
+	tests := []struct {
+		code     string
+		expected []string
+	}{
+		{code: "let n: Int = math::square(2) + 1;", expected: []string{}},
+		{code: "let s: String = math::square(2);", expected: []string{"[1,1] type mismatch, expected value of type INTEGER to be of type STRING"}},
+		{code: "math::helper();", expected: []string{"[1,5] module math has no public helper"}},
+		{code: "let p: Point = math::Point::new(1); let x: Int = p.x;", expected: []string{}},
+		// modules the host didn't declare are left to the evaluator
+		{code: "use other; let n: Int = other::anything(1);", expected: []string{}},
+		{code: "use other; let s: Shape = other::Shape::Dot;", expected: []string{}},
+	}
+
+	for i, test := range tests {
+		program := parser.NewParser(lexer.NewLexer(test.code)).Parse()
+		c := NewChecker()
+		c.DeclareModule("math", module, []string{"square", "Point"})
+		c.Check(program)
+		errors := c.Errors()
+
+		if len(errors) != len(test.expected) {
+			t.Errorf("case %d: expected %d errors, got=%d %q", i, len(test.expected), len(errors), errors)
+			continue
+		}
+
+		for j, msg := range errors {
+			if msg != test.expected[j] {
+				t.Errorf("case %d: \nexpected error\t%s,\ngot\t\t%s", i, test.expected[j], msg)
+			}
+		}
+	}
+}
+
+func TestFillsTypes(t *testing.T) {
+	program, errors := testCheck("let x: Int = 1; x + 2 * 3 > 4;")
+	if len(errors) != 0 {
+		t.Fatalf("unexpected errors %q", errors)
+	}
+
+	stmt := program.Statements[1].(*ast.ExpressionStatement)
+	comparison := stmt.Expression.(*ast.InfixExpression)
+	if comparison.ReturnType() != "Bool" {
+		t.Errorf("expected comparison to be Bool, got=%s", comparison.ReturnType())
+	}
+
+	sum := comparison.Left.(*ast.InfixExpression)
+	if sum.ReturnType() != "Int" || sum.Left.ReturnType() != "Int" {
+		t.Errorf("expected sum and x to be Int, got=%s and %s", sum.ReturnType(), sum.Left.ReturnType())
+	}
+}
+
+func TestWarnings(t *testing.T) {
+	definitions := "enum S { A(Int), B, C } "
+	tests := []struct {
+		code     string
+		expected []string
+	}{
+		{code: "match S::B { S::A(n) => n, S::B => 0, S::C => 0 }", expected: []string{}},
+		{code: "match S::B { S::A(_) => 0, _ => 1 }", expected: []string{}},
+		{code: "match S::B { S::A(n) => n }", expected: []string{"[1,25] match over S is not exhaustive, missing S::B, S::C"}},
+		{
+			code:     "match S::B { S::A(1) => 1, S::B => 0, S::C => 0 }",
+			expected: []string{"[1,25] match over S is not exhaustive, missing S::A"},
+		},
+		{
+			code:     "match S::B { S::A(n) if n > 0 => 1, S::B => 0, S::C => 0 }",
+			expected: []string{"[1,25] match over S is not exhaustive, missing S::A"},
+		},
+		{code: "let s: S = S::B; match s { S::B => 0 }", expected: []string{"[1,42] match over S is not exhaustive, missing S::A, S::C"}},
+		{code: "match 1 { 1 => 0 }", expected: []string{}},
+		{code: "match Some(1) { Some(n) => n }", expected: []string{"[1,25] match over Option is not exhaustive, missing None"}},
+		{code: "match Ok(1) { Ok(n) => n, Err(_) => 0 }", expected: []string{}},
+	}
+
+	for i, test := range tests {
+		l := lexer.NewLexer(definitions + test.code)
+		p := parser.NewParser(l)
+		c := NewChecker()
+		c.Check(p.Parse())
+
+		if len(c.Errors()) != 0 {
+			t.Errorf("case %d: unexpected errors %q", i, c.Errors())
+		}
+
+		warnings := c.Warnings()
+		if len(warnings) != len(test.expected) {
+			t.Errorf("case %d: expected %d warnings, got=%d %q", i, len(test.expected), len(warnings), warnings)
+			continue
+		}
+
+		for j, msg := range warnings {
+			if msg != test.expected[j] {
+				t.Errorf("case %d: \nexpected warning\t%s,\ngot\t\t%s", i, test.expected[j], msg)
+			}
+		}
+		for _, d := range c.WarningDiagnostics() {
+			if d.Severity != diagnostic.Warning || d.Code != diagnostic.TypeWarning {
+				t.Errorf("case %d: expected a %s warning, got=%s %s", i, diagnostic.TypeWarning, d.Severity, d.Code)
+			}
+		}
+	}
+}
+
+func TestDiagnostics(t *testing.T) {
+	p := parser.NewParser(lexer.NewLexer("let x: Int = 1;\nlet y: Int = x + \"a\";"))
+	c := NewChecker()
+	c.Check(p.Parse())
+
+	diagnostics := c.Diagnostics()
+	if len(diagnostics) != 1 {
+		t.Fatalf("expected 1 diagnostic, got=%v", diagnostics)
+	}
+
+	expected := diagnostic.New(diagnostic.Error, diagnostic.TypeError, diagnostic.SpanOf(2, 16, 1),
+		"operator + is not defined over INTEGER and STRING")
+	if diagnostics[0].String() != expected.String() || diagnostics[0].Code != expected.Code || diagnostics[0].Span != expected.Span {
+		t.Errorf("expected %+v, got=%+v", expected, diagnostics[0])
+	}
+}
@@ -0,0 +1,184 @@
+package checker
+
+import (
+	"fmt"
+	"lang/ast"
+	"strings"
+)
+
+// variants accessed on the enum, mirrors eval.Variant
+func (c *Checker) checkVariant(node *ast.AccessExpression, def *enumDef) result {
+	variant := def.variant(node.Attribute)
+	if variant == nil {
+		c.setError(node.Token, "enum %s has no variant %s", def.name, node.Attribute)
+		return result{}
+	}
+
+	if len(variant.Fields) == 0 {
+		return result{typ: ast.NewType(def.name)}
+	}
+
+	return result{
+		typ: ast.NewFunctionType(variant.Fields, ast.NewType(def.name)),
+		fn: &signature{
+			name:       def.name + "::" + variant.Name.Value,
+			returnType: ast.NewType(def.name),
+			fields:     variant.Fields,
+		},
+	}
+}
+
+func (c *Checker) checkVariantCall(node *ast.CallExpression, sig *signature, args []*ast.TypeNode) result {
+	if len(sig.fields) != len(args) {
+		c.setError(node.Token, "variant %s expected %d arguments, got %d", sig.name, len(sig.fields), len(args))
+		return result{typ: sig.returnType}
+	}
+
+	for i, arg := range args {
+		format := fmt.Sprintf("expected field %d of %s to be of type %%s, got %%s", i, sig.name)
+		c.expectType(arg, sig.fields[i], node.Token, format)
+	}
+	if sig.infer != nil {
+		return result{typ: sig.infer(args)}
+	}
+	return result{typ: sig.returnType}
+}
+
+func (c *Checker) checkMatchExpression(node *ast.MatchExpression) *ast.TypeNode {
+	subject := c.checkExpression(node.Subject)
+
+	types := []*ast.TypeNode{}
+	for _, arm := range node.Arms {
+		s := newScope(c.scope)
+		c.bindPattern(arm.Pattern, subject.typ, s)
+
+		if arm.Guard != nil {
+			outer := c.scope
+			c.scope = s
+			c.checkExpression(arm.Guard)
+			c.scope = outer
+		}
+		types = append(types, c.checkBlock(arm.Body, s))
+	}
+
+	c.checkExhaustive(node, subject.typ)
+
+	// like if, the value is only known when every arm agrees
+	return commonType(types)
+}
+
+// declares the names bound by pattern in s, typ is the type of the
+// value matched against it, mirrors eval.MatchPattern
+func (c *Checker) bindPattern(pattern ast.Pattern, typ *ast.TypeNode, s *scope) {
+	switch pattern := pattern.(type) {
+	case *ast.BindingPattern:
+		s.set(pattern.Name.Value, binding{typ: typ})
+	case *ast.ListPattern:
+		list := ast.NewType("List")
+		if nameOf(typ) == "List" {
+			list = typ
+		}
+		for _, e := range pattern.Elements {
+			c.bindPattern(e, list.Elem(), s)
+		}
+		if pattern.Rest != nil {
+			s.set(pattern.Rest.Value, binding{typ: list})
+		}
+	case *ast.VariantPattern:
+		def := c.patternEnum(pattern)
+		if def == nil {
+			return
+		}
+
+		variant := def.variant(pattern.Variant.Value)
+		if variant == nil {
+			c.setError(pattern.Variant.Token, "enum %s has no variant %s", def.name, pattern.Variant.Value)
+			return
+		}
+
+		if len(pattern.Fields) != len(variant.Fields) {
+			c.setError(pattern.Token, "pattern %s::%s expected %d fields, got %d",
+				def.name, variant.Name.Value, len(variant.Fields), len(pattern.Fields))
+			return
+		}
+
+		for i, f := range pattern.Fields {
+			field := variant.Fields[i]
+			if def.prelude {
+				field = payloadOf(typ, variant.Name.Value)
+			}
+			c.bindPattern(f, field, s)
+		}
+	}
+}
+
+// the enum a variant pattern names, nil after reporting why there is none
+func (c *Checker) patternEnum(pattern *ast.VariantPattern) *enumDef {
+	b, ok := c.scope.get(pattern.Enum.Value)
+	switch {
+	case !ok:
+		c.setError(pattern.Token, "%s is not defined", pattern.Enum.Value)
+	case b.enum == nil:
+		c.setError(pattern.Token, "%s is not an enum", pattern.Enum.Value)
+	}
+	return b.enum
+}
+
+// warns about the variants of an enum no arm is sure to match. Arms with
+// a guard may not match, and neither may variant patterns that look
+// inside their payload.
+func (c *Checker) checkExhaustive(node *ast.MatchExpression, subject *ast.TypeNode) {
+	def := c.enums[nameOf(subject)]
+	for _, arm := range node.Arms {
+		if p, ok := arm.Pattern.(*ast.VariantPattern); ok && def == nil {
+			b, _ := c.scope.get(p.Enum.Value)
+			def = b.enum
+		}
+	}
+	if def == nil {
+		return
+	}
+
+	covered := map[string]bool{}
+	for _, arm := range node.Arms {
+		if arm.Guard != nil {
+			continue
+		}
+
+		switch p := arm.Pattern.(type) {
+		case *ast.WildcardPattern, *ast.BindingPattern:
+			return
+		case *ast.VariantPattern:
+			if p.Enum.Value == def.name && irrefutable(p.Fields) {
+				covered[p.Variant.Value] = true
+			}
+		}
+	}
+
+	missing := []string{}
+	for _, v := range def.variants {
+		switch {
+		case covered[v.Name.Value]:
+		case def.prelude:
+			missing = append(missing, v.Name.Value)
+		default:
+			missing = append(missing, def.name+"::"+v.Name.Value)
+		}
+	}
+	if len(missing) > 0 {
+		c.setWarning(node.Token, "match over %s is not exhaustive, missing %s",
+			def.name, strings.Join(missing, ", "))
+	}
+}
+
+// patterns that match any value
+func irrefutable(patterns []ast.Pattern) bool {
+	for _, p := range patterns {
+		switch p.(type) {
+		case *ast.WildcardPattern, *ast.BindingPattern:
+		default:
+			return false
+		}
+	}
+	return true
+}
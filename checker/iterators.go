@@ -0,0 +1,100 @@
+package checker
+
+import "lang/ast"
+
+// a..b and a..=b are Ranges of Ints, mirrors evalRangeExpression
+func (c *Checker) checkRangeExpression(node *ast.RangeExpression) result {
+	start := c.checkExpression(node.Start).typ
+	end := c.checkExpression(node.End).typ
+	for _, t := range []*ast.TypeNode{start, end} {
+		if t != nil && nameOf(t) != "Int" {
+			c.setError(node.Token, "range bounds must be INTEGERs, got %s and %s", objectName(start), objectName(end))
+			break
+		}
+	}
+	return result{typ: ast.NewType("Range")}
+}
+
+// List<elem>, or a bare List when elem is unknown
+func listOf(elem *ast.TypeNode) *ast.TypeNode {
+	if elem == nil {
+		return ast.NewType("List")
+	}
+	return ast.NewType("List", elem)
+}
+
+// Iterator<elem>, or a bare Iterator when elem is unknown
+func iteratorOf(elem *ast.TypeNode) *ast.TypeNode {
+	if elem == nil {
+		return ast.NewType("Iterator")
+	}
+	return ast.NewType("Iterator", elem)
+}
+
+// the Lists, Ranges and Iterators the builtins that take a list accept
+func isIterable(t *ast.TypeNode) bool {
+	switch nameOf(t) {
+	case "List", "Range", "Iterator":
+		return true
+	}
+	return false
+}
+
+// the type of the values of a List, Range or Iterator, nil when unknown
+func valuesOf(t *ast.TypeNode) *ast.TypeNode {
+	if nameOf(t) == "Range" {
+		return ast.NewType("Int")
+	}
+	return t.Elem()
+}
+
+// methods of a Range, which are the ones of an Iterator<Int> apart from
+// the few it answers without going through its values
+func refineRangeMethod(sig *signature) {
+	switch sig.name {
+	case "step":
+		sig.returnType = ast.NewType("Range")
+	case "len":
+		sig.returnType = ast.NewType("Int")
+	case "contains":
+		sig.returnType = ast.NewType("Bool")
+	default:
+		refineIteratorMethod(iteratorOf(ast.NewType("Int")), sig)
+	}
+}
+
+// methods of an Iterator<T>, the lazy ones are iterators again and the
+// others are typed like the list method they collect into
+func refineIteratorMethod(it *ast.TypeNode, sig *signature) {
+	elem := it.Elem()
+	switch sig.name {
+	case "iter", "filter", "take", "drop", "take_while", "chain":
+		sig.returnType = it
+	case "collect":
+		sig.returnType = listOf(elem)
+	case "enumerate":
+		sig.returnType = ast.NewType("Iterator")
+		if nameOf(elem) == "Int" {
+			sig.returnType = iteratorOf(listOf(elem))
+		}
+	case "zip":
+		sig.returnType = ast.NewType("Iterator")
+		sig.infer = func(args []*ast.TypeNode) *ast.TypeNode {
+			if len(args) == 1 && elem != nil && args[0].Elem() != nil && elem.String() == args[0].Elem().String() {
+				return iteratorOf(listOf(elem))
+			}
+			return sig.returnType
+		}
+	case "map":
+		sig.returnType = ast.NewType("Iterator")
+		sig.infer = func(args []*ast.TypeNode) *ast.TypeNode {
+			if len(args) == 1 && args[0].IsFunction() && args[0].Return != nil {
+				return iteratorOf(args[0].Return)
+			}
+			return sig.returnType
+		}
+	default:
+		sig.returnType = ast.NewType(methodReturnTypes["List"][sig.name])
+		refineListMethod(listOf(elem), sig)
+	}
+}
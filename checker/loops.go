@@ -0,0 +1,48 @@
+package checker
+
+import "lang/ast"
+
+// checks the body of a loop in s, the result is the type of the values
+// it breaks with, which is the value of a loop expression
+func (c *Checker) checkLoopBody(body *ast.BlockStatement, s *scope) *ast.TypeNode {
+	c.breaks = append(c.breaks, []*ast.TypeNode{})
+	c.checkBlock(body, s)
+
+	breaks := c.breaks[len(c.breaks)-1]
+	c.breaks = c.breaks[:len(c.breaks)-1]
+	return commonType(breaks)
+}
+
+// mirrors eval.ForItems
+func (c *Checker) checkForStatement(node *ast.ForStatement) {
+	iterable := c.checkExpression(node.Iterable)
+
+	var index, value *ast.TypeNode
+	switch nameOf(iterable.typ) {
+	case "List":
+		index, value = ast.NewType("Int"), iterable.typ.Elem()
+	case "String":
+		index, value = ast.NewType("Int"), ast.NewType("String")
+	case "Range":
+		index, value = ast.NewType("Int"), ast.NewType("Int")
+	case "Iterator":
+		index, value = ast.NewType("Int"), iterable.typ.Elem()
+	case "Map":
+		// a single variable takes the keys
+		index, value = iterable.typ.Key(), iterable.typ.Value()
+		if len(node.Variables) == 1 {
+			value = index
+		}
+	case "":
+	default:
+		c.setError(node.Token, "for expected a List, Map, String, Range or Iterator, got %s", objectName(iterable.typ))
+	}
+
+	s := newScope(c.scope)
+	if len(node.Variables) == 2 {
+		s.set(node.Variables[0].Value, binding{typ: index})
+	}
+	s.set(node.Variables[len(node.Variables)-1].Value, binding{typ: value})
+
+	c.checkLoopBody(node.Body, s)
+}
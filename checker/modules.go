@@ -0,0 +1,41 @@
+package checker
+
+import "lang/ast"
+
+// DeclareModule binds name to a module checked by exports, with the
+// public names given. The structs and enums of the module become known
+// by their own names too, which is how the values of their types are
+// named at runtime.
+func (c *Checker) DeclareModule(name string, exports *Checker, public []string) {
+	def := &moduleDef{name: name, exports: make(map[string]binding)}
+	for _, p := range public {
+		if b, ok := exports.scope.get(p); ok {
+			def.exports[p] = b
+		}
+	}
+
+	for n, s := range exports.structs {
+		if c.structs[n] == nil {
+			c.structs[n] = s
+		}
+	}
+	for n, e := range exports.enums {
+		if c.enums[n] == nil {
+			c.enums[n] = e
+		}
+	}
+	c.scope.set(name, binding{module: def})
+}
+
+// math::name, mirrors the access of evalAccessExpression to a module
+func (c *Checker) checkModuleAccess(node *ast.AccessExpression, module *moduleDef) result {
+	if module.exports == nil {
+		return result{}
+	}
+	b, ok := module.exports[node.Attribute]
+	if !ok {
+		c.setError(node.Token, "module %s has no public %s", module.name, node.Attribute)
+		return result{}
+	}
+	return result(b)
+}
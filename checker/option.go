@@ -0,0 +1,133 @@
+package checker
+
+import (
+	"lang/ast"
+	"lang/eval"
+	"lang/object"
+)
+
+// declares Option, Result and their variants, mirrors eval.OptionType
+// and eval.ResultType
+func (c *Checker) declarePrelude() {
+	for _, enum := range []*object.EnumType{eval.OptionType, eval.ResultType} {
+		def := &enumDef{name: enum.Name, variants: enum.Variants, prelude: true}
+		c.enums[def.name] = def
+		c.scope.set(def.name, binding{enum: def})
+	}
+
+	c.scope.set("None", binding{typ: ast.NewType("Option")})
+	c.scope.set("Some", variantBinding("Some", "Option", func(args []*ast.TypeNode) *ast.TypeNode {
+		return optionOf(args[0])
+	}))
+	c.scope.set("Ok", variantBinding("Ok", "Result", func(args []*ast.TypeNode) *ast.TypeNode {
+		return resultOf(args[0], nil)
+	}))
+	c.scope.set("Err", variantBinding("Err", "Result", func(args []*ast.TypeNode) *ast.TypeNode {
+		return resultOf(nil, args[0])
+	}))
+}
+
+// Some, Ok and Err, whose payload refines the type they build
+func variantBinding(name, enum string, infer func(args []*ast.TypeNode) *ast.TypeNode) binding {
+	fields := []*ast.TypeNode{nil}
+	return binding{
+		typ: ast.NewFunctionType(fields, ast.NewType(enum)),
+		fn: &signature{
+			name:       name,
+			returnType: ast.NewType(enum),
+			fields:     fields,
+			infer:      infer,
+		},
+	}
+}
+
+// Option<t>, or a bare Option when t is unknown
+func optionOf(t *ast.TypeNode) *ast.TypeNode {
+	if t == nil {
+		return ast.NewType("Option")
+	}
+	return ast.NewType("Option", t)
+}
+
+// Result<ok, err>, a side that is unknown accepts any type
+func resultOf(ok, err *ast.TypeNode) *ast.TypeNode {
+	if ok == nil && err == nil {
+		return ast.NewType("Result")
+	}
+	return ast.NewType("Result", ok, err)
+}
+
+// the type of the payload of the variant of a value of type t, nil
+// when t doesn't tell
+func payloadOf(t *ast.TypeNode, variant string) *ast.TypeNode {
+	if t == nil || len(t.Parameters) == 0 {
+		return nil
+	}
+
+	switch {
+	case variant == "Some" && t.Name == "Option", variant == "Ok" && t.Name == "Result":
+		return t.Parameters[0]
+	case variant == "Err" && t.Name == "Result" && len(t.Parameters) == 2:
+		return t.Parameters[1]
+	}
+	return nil
+}
+
+// the postfix ? evaluates to the payload of a Some or an Ok, and
+// returns a None or an Err from the enclosing function
+func (c *Checker) checkTryExpression(node *ast.TryExpression) *ast.TypeNode {
+	value := c.checkExpression(node.Value).typ
+
+	var returned *ast.TypeNode
+	switch nameOf(value) {
+	case "":
+		return nil
+	case "Option":
+		returned = ast.NewType("Option")
+	case "Result":
+		returned = resultOf(nil, payloadOf(value, "Err"))
+	default:
+		c.setError(node.Token, "operator ? is not defined over %s", objectName(value))
+		return nil
+	}
+
+	if len(c.returns) > 0 {
+		c.expectType(returned, c.returns[len(c.returns)-1], node.Token,
+			"expected return to be of type %s, found %s")
+	}
+
+	if value.Name == "Option" {
+		return payloadOf(value, "Some")
+	}
+	return payloadOf(value, "Ok")
+}
+
+// methods of an Option<T> or a Result<T, E> that expose T
+func refineOptionMethod(t *ast.TypeNode, sig *signature) {
+	payload := payloadOf(t, "Some")
+	if t.Name == "Result" {
+		payload = payloadOf(t, "Ok")
+	}
+
+	switch sig.name {
+	case "unwrap", "unwrap_or":
+		sig.returnType = payload
+	case "map":
+		sig.infer = func(args []*ast.TypeNode) *ast.TypeNode {
+			if len(args) != 1 || !args[0].IsFunction() || args[0].Return == nil {
+				return ast.NewType(t.Name)
+			}
+			if t.Name == "Option" {
+				return optionOf(args[0].Return)
+			}
+			return resultOf(args[0].Return, payloadOf(t, "Err"))
+		}
+	case "and_then":
+		sig.infer = func(args []*ast.TypeNode) *ast.TypeNode {
+			if len(args) == 1 && args[0].IsFunction() && args[0].Return != nil {
+				return args[0].Return
+			}
+			return ast.NewType(t.Name)
+		}
+	}
+}
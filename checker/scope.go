@@ -0,0 +1,105 @@
+package checker
+
+import "lang/ast"
+
+// the static counterpart of object.Function
+type signature struct {
+	name       string
+	method     bool // bound to an instance, self is not among the parameters
+	parameters []*ast.Identifier
+	returnType *ast.TypeNode
+	// refines the return type from the arguments, e.g. List.map
+	infer func(args []*ast.TypeNode) *ast.TypeNode
+	// the payload of an enum variant, which is built by calling it
+	fields []*ast.TypeNode
+}
+
+// the static counterpart of object.StructType
+type structDef struct {
+	name    string
+	fields  []*ast.Identifier
+	methods map[string]*signature
+}
+
+func (d *structDef) field(name string) *ast.Identifier {
+	for _, f := range d.fields {
+		if f.Value == name {
+			return f
+		}
+	}
+	return nil
+}
+
+// the static counterpart of object.EnumType
+type enumDef struct {
+	name     string
+	variants []*ast.Variant
+	prelude  bool // Option and Result, whose variants are named alone
+}
+
+func (d *enumDef) variant(name string) *ast.Variant {
+	for _, v := range d.variants {
+		if v.Name.Value == name {
+			return v
+		}
+	}
+	return nil
+}
+
+// the static counterpart of object.Module, exports is nil when the
+// module wasn't declared by the host and nothing is known about it
+type moduleDef struct {
+	name    string
+	exports map[string]binding
+}
+
+type binding struct {
+	typ    *ast.TypeNode
+	fn     *signature // known when bound to a function literal or definition
+	def    *structDef // known when bound to a struct declaration
+	enum   *enumDef   // known when bound to an enum declaration
+	module *moduleDef // known when bound by use or import
+}
+
+// mirrors object.Scope, but stores types instead of values
+type scope struct {
+	store map[string]binding
+	// names declared with let mut
+	mutable map[string]bool
+	outer   *scope
+}
+
+func newScope(outer *scope) *scope {
+	return &scope{store: make(map[string]binding), mutable: make(map[string]bool), outer: outer}
+}
+
+func (s *scope) get(name string) (binding, bool) {
+	b, ok := s.store[name]
+	if !ok && s.outer != nil {
+		b, ok = s.outer.get(name)
+	}
+	return b, ok
+}
+
+func (s *scope) set(name string, b binding) {
+	s.store[name] = b
+	delete(s.mutable, name)
+}
+
+func (s *scope) setMutable(name string, b binding) {
+	s.store[name] = b
+	s.mutable[name] = true
+}
+
+// whether the binding name resolves to can be reassigned
+func (s *scope) isMutable(name string) bool {
+	if _, ok := s.store[name]; ok {
+		return s.mutable[name]
+	}
+	return s.outer != nil && s.outer.isMutable(name)
+}
+
+func (s *scope) has(name string) bool {
+	_, ok := s.store[name]
+	return ok
+}
@@ -0,0 +1,272 @@
+package code
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+)
+
+type Instructions []byte
+
+type Opcode byte
+
+const (
+	OpConstant Opcode = iota
+	OpPop
+	OpNull
+	OpTrue
+	OpFalse
+
+	// operators, the operand indexes Operators
+	OpInfix
+	OpPrefix
+
+	OpJump
+	OpJumpNotTruthy
+
+	OpGetGlobal
+	OpSetGlobal
+	OpGetLocal
+	OpSetLocal
+	OpGetBuiltin
+	OpGetFree
+	OpCurrentClosure
+	// an identifier that couldn't be resolved at compile time, errors when reached
+	OpUndefined
+
+	// checks the value on top of the stack against an entry of the type table
+	OpAssertType
+
+	OpList
+	OpMap
+	OpIndex
+	// slices the value below the two bounds on top of the stack, bounds
+	// left out are null
+	OpSlice
+	// builds a range of the two bounds on top of the stack, the operand
+	// is 1 for ..= and 0 for ..
+	OpRange
+	OpAccess
+	// builds a struct instance, the operand is a constant list of field names
+	OpStruct
+	// adds the closure on top of the stack as a method of the struct below it
+	OpImpl
+	// matches the value on top of the stack against a pattern, the operand
+	// indexes the pattern table. Pops the value and the enums the pattern
+	// names, pushes whether it matched and then the values it binds.
+	OpMatch
+	// raises the error of a match no arm matched, pops the value
+	OpNoMatch
+
+	// record and forget the stack height a loop starts at
+	OpEnterLoop
+	OpExitLoop
+	// pop the value broken with, drop what the innermost loop left on the
+	// stack, push the value back and jump past the loop
+	OpBreak
+	// drop what the innermost loop left on the stack and jump to its start
+	OpContinue
+	// starts every iteration of a loop, counted against the step budget
+	OpStep
+	// replaces the value on top of the stack with an iterator over it, the
+	// operand is the number of variables of the for loop
+	OpIter
+	// pops an iterator, pushes whether it had items left and then the
+	// values of the next one
+	OpNext
+
+	// wraps the value on top of the stack in a cell, mutable locals are
+	// kept in cells so closures share them
+	OpCell
+	// replaces the cell on top of the stack with its value
+	OpGetCell
+	// pops a cell and stores the value below it in the cell
+	OpSetCell
+	// computes the value an assignment leaves in its variable, the operand
+	// indexes the assignment table. Pops the current value, the indexes
+	// of the target and the assigned value.
+	OpAssign
+	// an assignment to an immutable name, errors when reached
+	OpImmutable
+	// unwraps the Some or Ok on top of the stack and jumps to the operand,
+	// a None or an Err is left for the OpReturnValue that follows
+	OpTry
+
+	OpClosure
+	OpCall
+	OpReturnValue
+)
+
+// position of the token that produced an instruction, used for
+// "[row,col]" error messages and the span of their diagnostics
+type Position struct {
+	Row    int
+	Column int
+	Length int
+}
+
+// operators understood by OpInfix and OpPrefix
+var Operators = []string{"+", "-", "*", "/", "%", "^", "==", "!=", "<", ">", "<=", ">=", "||", "&&", "!"}
+
+func LookupOperator(operator string) (int, bool) {
+	for i, op := range Operators {
+		if op == operator {
+			return i, true
+		}
+	}
+	return 0, false
+}
+
+type Definition struct {
+	Name          string
+	OperandWidths []int
+}
+
+var definitions = map[Opcode]*Definition{
+	OpConstant:       {"OpConstant", []int{2}},
+	OpPop:            {"OpPop", []int{}},
+	OpNull:           {"OpNull", []int{}},
+	OpTrue:           {"OpTrue", []int{}},
+	OpFalse:          {"OpFalse", []int{}},
+	OpInfix:          {"OpInfix", []int{1}},
+	OpPrefix:         {"OpPrefix", []int{1}},
+	OpJump:           {"OpJump", []int{2}},
+	OpJumpNotTruthy:  {"OpJumpNotTruthy", []int{2}},
+	OpGetGlobal:      {"OpGetGlobal", []int{2}},
+	OpSetGlobal:      {"OpSetGlobal", []int{2}},
+	OpGetLocal:       {"OpGetLocal", []int{1}},
+	OpSetLocal:       {"OpSetLocal", []int{1}},
+	OpGetBuiltin:     {"OpGetBuiltin", []int{1}},
+	OpGetFree:        {"OpGetFree", []int{1}},
+	OpCurrentClosure: {"OpCurrentClosure", []int{}},
+	OpUndefined:      {"OpUndefined", []int{2}},
+	OpAssertType:     {"OpAssertType", []int{2}},
+	OpList:           {"OpList", []int{2}},
+	OpMap:            {"OpMap", []int{2}},
+	OpIndex:          {"OpIndex", []int{}},
+	OpSlice:          {"OpSlice", []int{}},
+	OpRange:          {"OpRange", []int{1}},
+	OpAccess:         {"OpAccess", []int{2}},
+	OpStruct:         {"OpStruct", []int{2}},
+	OpImpl:           {"OpImpl", []int{}},
+	OpMatch:          {"OpMatch", []int{2}},
+	OpNoMatch:        {"OpNoMatch", []int{}},
+	OpEnterLoop:      {"OpEnterLoop", []int{}},
+	OpExitLoop:       {"OpExitLoop", []int{}},
+	OpBreak:          {"OpBreak", []int{2}},
+	OpContinue:       {"OpContinue", []int{2}},
+	OpStep:           {"OpStep", []int{}},
+	OpIter:           {"OpIter", []int{1}},
+	OpNext:           {"OpNext", []int{}},
+	OpCell:           {"OpCell", []int{}},
+	OpGetCell:        {"OpGetCell", []int{}},
+	OpSetCell:        {"OpSetCell", []int{}},
+	OpAssign:         {"OpAssign", []int{2}},
+	OpImmutable:      {"OpImmutable", []int{2}},
+	OpTry:            {"OpTry", []int{2}},
+	// constant index of the function and number of free variables
+	OpClosure:     {"OpClosure", []int{2, 1}},
+	OpCall:        {"OpCall", []int{1}},
+	OpReturnValue: {"OpReturnValue", []int{}},
+}
+
+func Lookup(op byte) (*Definition, error) {
+	def, ok := definitions[Opcode(op)]
+	if !ok {
+		return nil, fmt.Errorf("opcode %d undefined", op)
+	}
+	return def, nil
+}
+
+func Make(op Opcode, operands ...int) []byte {
+	def, ok := definitions[op]
+	if !ok {
+		return []byte{}
+	}
+
+	length := 1
+	for _, w := range def.OperandWidths {
+		length += w
+	}
+
+	instruction := make([]byte, length)
+	instruction[0] = byte(op)
+
+	offset := 1
+	for i, o := range operands {
+		width := def.OperandWidths[i]
+		switch width {
+		case 2:
+			binary.BigEndian.PutUint16(instruction[offset:], uint16(o))
+		case 1:
+			instruction[offset] = byte(o)
+		}
+		offset += width
+	}
+
+	return instruction
+}
+
+func ReadOperands(def *Definition, ins Instructions) ([]int, int) {
+	operands := make([]int, len(def.OperandWidths))
+	offset := 0
+
+	for i, width := range def.OperandWidths {
+		switch width {
+		case 2:
+			operands[i] = int(ReadUint16(ins[offset:]))
+		case 1:
+			operands[i] = int(ReadUint8(ins[offset:]))
+		}
+		offset += width
+	}
+
+	return operands, offset
+}
+
+func ReadUint16(ins Instructions) uint16 {
+	return binary.BigEndian.Uint16(ins)
+}
+
+func ReadUint8(ins Instructions) uint8 {
+	return uint8(ins[0])
+}
+
+// mainly for testing and debugging
+func (ins Instructions) String() string {
+	var out bytes.Buffer
+
+	i := 0
+	for i < len(ins) {
+		def, err := Lookup(ins[i])
+		if err != nil {
+			fmt.Fprintf(&out, "ERROR: %s\n", err)
+			i++
+			continue
+		}
+
+		operands, read := ReadOperands(def, ins[i+1:])
+		fmt.Fprintf(&out, "%04d %s\n", i, ins.fmtInstruction(def, operands))
+		i += 1 + read
+	}
+
+	return out.String()
+}
+
+func (ins Instructions) fmtInstruction(def *Definition, operands []int) string {
+	if len(operands) != len(def.OperandWidths) {
+		return fmt.Sprintf("ERROR: operand len %d does not match defined %d\n",
+			len(operands), len(def.OperandWidths))
+	}
+
+	switch len(operands) {
+	case 0:
+		return def.Name
+	case 1:
+		return fmt.Sprintf("%s %d", def.Name, operands[0])
+	case 2:
+		return fmt.Sprintf("%s %d %d", def.Name, operands[0], operands[1])
+	}
+
+	return fmt.Sprintf("ERROR: unhandled operand count for %s\n", def.Name)
+}
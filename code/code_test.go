@@ -0,0 +1,87 @@
+package code
+
+import "testing"
+
+func TestMake(t *testing.T) {
+	tests := []struct {
+		op       Opcode
+		operands []int
+		expected []byte
+	}{
+		{op: OpConstant, operands: []int{65534}, expected: []byte{byte(OpConstant), 255, 254}},
+		{op: OpGetLocal, operands: []int{255}, expected: []byte{byte(OpGetLocal), 255}},
+		{op: OpClosure, operands: []int{65534, 255}, expected: []byte{byte(OpClosure), 255, 254, 255}},
+		{op: OpPop, operands: []int{}, expected: []byte{byte(OpPop)}},
+	}
+
+	for i, test := range tests {
+		instruction := Make(test.op, test.operands...)
+
+		if len(instruction) != len(test.expected) {
+			t.Fatalf("case %d: instruction has wrong length, expected %d, got=%d",
+				i, len(test.expected), len(instruction))
+		}
+
+		for j, b := range test.expected {
+			if instruction[j] != b {
+				t.Errorf("case %d: wrong byte at pos %d, expected %d, got=%d", i, j, b, instruction[j])
+			}
+		}
+	}
+}
+
+func TestReadOperands(t *testing.T) {
+	tests := []struct {
+		op        Opcode
+		operands  []int
+		bytesRead int
+	}{
+		{op: OpConstant, operands: []int{65535}, bytesRead: 2},
+		{op: OpCall, operands: []int{255}, bytesRead: 1},
+		{op: OpClosure, operands: []int{65535, 255}, bytesRead: 3},
+	}
+
+	for i, test := range tests {
+		instruction := Make(test.op, test.operands...)
+
+		def, err := Lookup(byte(test.op))
+		if err != nil {
+			t.Fatalf("case %d: definition not found: %q", i, err)
+		}
+
+		operandsRead, n := ReadOperands(def, instruction[1:])
+		if n != test.bytesRead {
+			t.Fatalf("case %d: expected %d bytes read, got=%d", i, test.bytesRead, n)
+		}
+
+		for j, expected := range test.operands {
+			if operandsRead[j] != expected {
+				t.Errorf("case %d: expected operand %d, got=%d", i, expected, operandsRead[j])
+			}
+		}
+	}
+}
+
+func TestInstructionsString(t *testing.T) {
+	instructions := []Instructions{
+		Make(OpConstant, 1),
+		Make(OpInfix, 0),
+		Make(OpGetLocal, 1),
+		Make(OpClosure, 65535, 255),
+	}
+
+	expected := `0000 OpConstant 1
+0003 OpInfix 0
+0005 OpGetLocal 1
+0007 OpClosure 65535 255
+`
+
+	concatted := Instructions{}
+	for _, ins := range instructions {
+		concatted = append(concatted, ins...)
+	}
+
+	if concatted.String() != expected {
+		t.Errorf("instructions wrongly formatted, expected %q, got=%q", expected, concatted.String())
+	}
+}
@@ -0,0 +1,377 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"lang/ast"
+	"lang/dap"
+	"lang/format"
+	"lang/lexer"
+	"lang/lsp"
+	"lang/mist"
+	"lang/parser"
+	"lang/repl"
+	"lang/tester"
+	"lang/token"
+	"os"
+	"path/filepath"
+	"regexp"
+	"time"
+)
+
+func replCommand(args []string) int {
+	flags := flag.NewFlagSet("repl", flag.ExitOnError)
+	stage := flags.String("stage", "eval", "how far lines go: lexer, parser, tree or eval")
+	history := flags.String("history", defaultHistory(), "file the history is kept in across sessions, empty for none")
+	flags.Parse(args)
+
+	mode, ok := repl.Stage[*stage]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "unknown stage %s, expected lexer, parser, tree or eval\n", *stage)
+		return exitCompile
+	}
+	repl.Start(os.Stdin, os.Stdout, repl.Options{Stage: mode, History: *history})
+	return exitOK
+}
+
+// ~/.mist_history, none when there is no home
+func defaultHistory() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".mist_history")
+}
+
+func tokensCommand(args []string) int {
+	flags := flag.NewFlagSet("tokens", flag.ExitOnError)
+	flags.Parse(args)
+
+	file, source, err := readSource(flags.Arg(0))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitRuntime
+	}
+
+	l := lexer.NewLexer(source)
+	for tok := l.NextToken(); tok.Type != token.EOF; tok = l.NextToken() {
+		fmt.Printf("%d:%d\t%s\t%q\n", tok.Row, tok.Column, tok.Type, tok.Literal)
+	}
+	for _, d := range l.Diagnostics() {
+		d.File = file
+		printDiagnostic(source, d, "human")
+	}
+	if len(l.Diagnostics()) != 0 {
+		return exitCompile
+	}
+	return exitOK
+}
+
+// parses the program of a command, printing its syntax errors if any
+func parseSource(file, source string) (*ast.Program, bool) {
+	p := parser.NewParser(lexer.NewLexer(source))
+	program := p.Parse()
+	for _, d := range p.Diagnostics() {
+		d.File = file
+		printDiagnostic(source, d, "human")
+	}
+	return program, len(p.Diagnostics()) == 0
+}
+
+func astCommand(args []string) int {
+	flags := flag.NewFlagSet("ast", flag.ExitOnError)
+	astFormat := flags.String("format", "text", "how the tree is printed: text, json or dot")
+	flags.Parse(args)
+
+	if *astFormat != "text" && *astFormat != "json" && *astFormat != "dot" {
+		fmt.Fprintf(os.Stderr, "unknown format %s, expected text, json or dot\n", *astFormat)
+		return exitCompile
+	}
+
+	file, source, err := readSource(flags.Arg(0))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitRuntime
+	}
+	program, ok := parseSource(file, source)
+	if !ok {
+		return exitCompile
+	}
+
+	switch *astFormat {
+	case "json":
+		encoded, err := ast.JSON(program)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return exitRuntime
+		}
+		fmt.Println(string(encoded))
+	case "dot":
+		fmt.Print(ast.Dot(program))
+	default:
+		fmt.Print(ast.Dump(program))
+	}
+	return exitOK
+}
+
+func treeCommand(args []string) int {
+	flags := flag.NewFlagSet("tree", flag.ExitOnError)
+	flags.Parse(args)
+
+	file, source, err := readSource(flags.Arg(0))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitRuntime
+	}
+	program, ok := parseSource(file, source)
+	if !ok {
+		return exitCompile
+	}
+	parser.DrawTree(os.Stdout, program)
+	return exitOK
+}
+
+// checks the files named in args, or stdin when there are none
+func checkCommand(args []string) int {
+	flags := flag.NewFlagSet("check", flag.ExitOnError)
+	errorFormat := flags.String("error-format", "human", "how errors and warnings are printed: human or json")
+	path := flags.String("path", "", "directories searched for modules, separated like PATH, before those of MIST_PATH")
+	flags.Parse(args)
+
+	if *errorFormat != "human" && *errorFormat != "json" {
+		fmt.Fprintf(os.Stderr, "unknown error format %s, expected human or json\n", *errorFormat)
+		return exitCompile
+	}
+
+	files := flags.Args()
+	if len(files) == 0 {
+		files = []string{"-"}
+	}
+
+	code := exitOK
+	for _, name := range files {
+		file, source, err := readSource(name)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			code = exitRuntime
+			continue
+		}
+
+		interpreter := mist.New(mist.Options{File: file, Loader: moduleLoader(*path)})
+		// programs are checked like mist run runs them, with their args
+		interpreter.SetArgs(nil)
+		err = interpreter.Check(source)
+		for _, warning := range interpreter.WarningDiagnostics() {
+			printDiagnostic(source, warning, *errorFormat)
+		}
+		var mistErr *mist.Error
+		if errors.As(err, &mistErr) {
+			for _, d := range mistErr.Diagnostics {
+				printDiagnostic(sourceOf(file, source, d), d, *errorFormat)
+			}
+			code = exitCompile
+		}
+	}
+	return code
+}
+
+// formats the files named in args in place, or stdin to stdout when
+// there are none
+func fmtCommand(args []string) int {
+	flags := flag.NewFlagSet("fmt", flag.ExitOnError)
+	check := flags.Bool("check", false, "list the files that aren't formatted instead of formatting them, and fail if there are any")
+	flags.Parse(args)
+
+	if flags.NArg() == 0 {
+		file, source, err := readSource("-")
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return exitRuntime
+		}
+		formatted, code := formatSource(file, source)
+		if code != exitOK {
+			return code
+		}
+		if *check {
+			if formatted != source {
+				fmt.Println(file)
+				return exitRuntime
+			}
+			return exitOK
+		}
+		fmt.Print(formatted)
+		return exitOK
+	}
+
+	code := exitOK
+	for _, name := range flags.Args() {
+		file, source, err := readSource(name)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			code = exitRuntime
+			continue
+		}
+		formatted, failed := formatSource(file, source)
+		if failed != exitOK {
+			code = failed
+			continue
+		}
+		if formatted == source {
+			continue
+		}
+		if *check {
+			fmt.Println(file)
+			code = exitRuntime
+			continue
+		}
+		if err := os.WriteFile(file, []byte(formatted), 0644); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			code = exitRuntime
+		}
+	}
+	return code
+}
+
+// formats the source of file, printing why it can't be formatted if so
+func formatSource(file, source string) (string, int) {
+	formatted, err := format.Source(source)
+	var formatErr *format.Error
+	if errors.As(err, &formatErr) {
+		for _, d := range formatErr.Diagnostics {
+			d.File = file
+			printDiagnostic(source, d, "human")
+		}
+		return "", exitCompile
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %s\n", file, err)
+		return "", exitRuntime
+	}
+	return formatted, exitOK
+}
+
+// runs the test blocks of the files named in args, and of the programs
+// in the directories named, the current one when there are none
+func testCommand(args []string) int {
+	flags := flag.NewFlagSet("test", flag.ExitOnError)
+	engine := flags.String("engine", "tree", "backend used to run the tests: vm or tree")
+	run := flags.String("run", "", "only run the tests whose name matches this regular expression")
+	verbose := flags.Bool("v", false, "list the tests that pass too, with what they print")
+	junit := flags.String("junit", "", "also write the results as JUnit XML to this file")
+	timeout := flags.Duration("timeout", 0, "stop every test after this long, 0 for no limit")
+	path := flags.String("path", "", "directories searched for modules, separated like PATH, before those of MIST_PATH")
+	flags.Parse(args)
+
+	opts := tester.Options{Engine: *engine, Timeout: *timeout, Loader: moduleLoader(*path)}
+	if *run != "" {
+		pattern, err := regexp.Compile(*run)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "invalid --run: %s\n", err)
+			return exitCompile
+		}
+		opts.Run = pattern
+	}
+
+	paths := flags.Args()
+	if len(paths) == 0 {
+		paths = []string{"."}
+	}
+	files, err := tester.Files(paths)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitRuntime
+	}
+
+	code := exitOK
+	results := []tester.Result{}
+	start := time.Now()
+	for _, name := range files {
+		file, source, err := readSource(name)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			code = exitRuntime
+			continue
+		}
+
+		fileResults, err := tester.RunFile(file, source, opts)
+		var mistErr *mist.Error
+		if errors.As(err, &mistErr) {
+			for _, d := range mistErr.Diagnostics {
+				printDiagnostic(sourceOf(file, source, d), d, "human")
+			}
+			code = exitCompile
+			continue
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %s\n", file, err)
+			code = exitCompile
+			continue
+		}
+
+		for _, r := range fileResults {
+			printResult(file, source, r, *verbose)
+			if !r.Passed() && code == exitOK {
+				code = exitRuntime
+			}
+		}
+		results = append(results, fileResults...)
+	}
+
+	status := "ok"
+	if code != exitOK {
+		status = "FAIL"
+	}
+	fmt.Printf("%s\t%s in %.3fs\n", status, tester.Summary(results), time.Since(start).Seconds())
+
+	if *junit != "" {
+		out, err := os.Create(*junit)
+		if err == nil {
+			err = tester.JUnit(out, results)
+			out.Close()
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return exitRuntime
+		}
+	}
+	return code
+}
+
+// prints how a test went, failures with why and what the test printed
+func printResult(file, source string, r tester.Result, verbose bool) {
+	if r.Passed() {
+		if verbose {
+			fmt.Printf("--- PASS: %s %q (%s)\n", r.File, r.Name, r.Duration.Round(time.Microsecond))
+			fmt.Print(r.Output)
+		}
+		return
+	}
+
+	fmt.Printf("--- FAIL: %s %q (%s)\n", r.File, r.Name, r.Duration.Round(time.Microsecond))
+	fmt.Print(r.Output)
+	var mistErr *mist.Error
+	if errors.As(r.Err, &mistErr) {
+		for _, d := range mistErr.Diagnostics {
+			printDiagnostic(sourceOf(file, source, d), d, "human")
+		}
+		return
+	}
+	fmt.Fprintln(os.Stderr, r.Err)
+}
+
+func lspCommand(args []string) int {
+	if err := lsp.Serve(os.Stdin, os.Stdout); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitRuntime
+	}
+	return exitOK
+}
+
+func dapCommand(args []string) int {
+	if err := dap.Serve(os.Stdin, os.Stdout); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitRuntime
+	}
+	return exitOK
+}
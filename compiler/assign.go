@@ -0,0 +1,45 @@
+package compiler
+
+import (
+	"lang/ast"
+	"lang/code"
+	"lang/eval"
+)
+
+// evaluates like eval's evalAssignStatement: the current value of the
+// variable, the indexes of the target and the value are pushed in that
+// order and OpAssign combines them
+func (c *Compiler) compileAssignStatement(node *ast.AssignStatement) error {
+	name, targets := ast.AssignTarget(node.Target)
+
+	sym, ok := c.symbolTable.Resolve(name.Value)
+	if !ok {
+		c.loadIdentifier(name)
+		return nil
+	}
+	if !sym.Mutable {
+		c.emitAt(name.Token, code.OpImmutable, c.addConstant(eval.NewString(name.Value)))
+		return nil
+	}
+
+	if len(targets) == 0 && node.Operator == "" {
+		if err := c.compileExpression(node.Value); err != nil {
+			return err
+		}
+	} else {
+		c.loadSymbol(sym, name)
+		for _, target := range targets {
+			if err := c.compileExpression(target.Index); err != nil {
+				return err
+			}
+		}
+		if err := c.compileExpression(node.Value); err != nil {
+			return err
+		}
+		c.emitAt(node.Token, code.OpAssign, c.addAssign(node))
+	}
+
+	c.emitAt(node.Token, code.OpAssertType, c.addType(sym.Type))
+	c.storeSymbol(sym)
+	return nil
+}
@@ -0,0 +1,700 @@
+package compiler
+
+import (
+	"fmt"
+	"lang/ast"
+	"lang/code"
+	"lang/eval"
+	"lang/object"
+	"lang/token"
+	"sort"
+)
+
+type CompilationScope struct {
+	instructions code.Instructions
+	positions    map[int]code.Position
+	// loops being compiled, innermost last
+	loops []*loop
+}
+
+type Compiler struct {
+	constants   []object.Object
+	types       []*ast.TypeNode
+	patterns    []ast.Pattern
+	assigns     []*ast.AssignStatement
+	symbolTable *SymbolTable
+	globals     []string
+	// the file the programs are from
+	file string
+
+	scopes     []CompilationScope
+	scopeIndex int
+}
+
+type Bytecode struct {
+	Instructions code.Instructions
+	Positions    map[int]code.Position
+	Constants    []object.Object
+	// type annotations checked by OpAssertType
+	Types []*ast.TypeNode
+	// patterns matched by OpMatch
+	Patterns []ast.Pattern
+	// assignments computed by OpAssign
+	Assigns []*ast.AssignStatement
+	// name of each global slot, used for "is not defined" errors
+	Globals []string
+	// the file the program is from
+	File string
+}
+
+func NewCompiler() *Compiler {
+	symbolTable := NewSymbolTable()
+	for i, name := range eval.BuiltinNames() {
+		symbolTable.DefineBuiltin(i, name)
+	}
+
+	return &Compiler{
+		constants:   []object.Object{},
+		symbolTable: symbolTable,
+		scopes: []CompilationScope{
+			{instructions: code.Instructions{}, positions: map[int]code.Position{}},
+		},
+	}
+}
+
+func (c *Compiler) Bytecode() *Bytecode {
+	return &Bytecode{
+		Instructions: c.currentInstructions(),
+		Positions:    c.scopes[c.scopeIndex].positions,
+		Constants:    c.constants,
+		Types:        c.types,
+		Patterns:     c.patterns,
+		Assigns:      c.assigns,
+		Globals:      c.globals,
+		File:         c.file,
+	}
+}
+
+// SetFile names the file of the programs compiled next, the functions
+// they define carry it
+func (c *Compiler) SetFile(file string) {
+	c.file = file
+}
+
+// entry point, the program leaves the value of its last statement
+// on the stack the same way eval.Eval returns it. Each program gets
+// its own main function, globals and constants are kept so programs
+// compiled one after another run against the same globals.
+func (c *Compiler) Compile(program *ast.Program) error {
+	for c.symbolTable.Outer != nil {
+		c.symbolTable = c.symbolTable.Outer
+	}
+	c.scopes = []CompilationScope{
+		{instructions: code.Instructions{}, positions: map[int]code.Position{}},
+	}
+	c.scopeIndex = 0
+
+	c.declareGlobals(program.Statements)
+
+	if err := c.compileStatements(program.Statements); err != nil {
+		return err
+	}
+
+	c.emit(code.OpReturnValue)
+	return nil
+}
+
+// top level functions can be called before their definition is reached,
+// as long as they are defined by the time the call happens
+func (c *Compiler) declareGlobals(statements []ast.Statement) {
+	for _, s := range statements {
+		switch s := s.(type) {
+		case *ast.LetStatement:
+			c.defineGlobal(s.Name.Value)
+			if s.Mutable {
+				c.symbolTable.MarkMutable(s.Name.Value, s.Name.Type)
+			}
+		case *ast.ExpressionStatement:
+			if fn, ok := s.Expression.(*ast.Function); ok {
+				c.defineGlobal(fn.Name.Value)
+			}
+		case *ast.StructStatement:
+			c.defineGlobal(s.Name.Value)
+		case *ast.EnumStatement:
+			c.defineGlobal(s.Name.Value)
+		}
+	}
+}
+
+// DefineGlobal returns the slot of a global the host sets before a
+// program runs, it is immutable like the ones declared with let
+func (c *Compiler) DefineGlobal(name string) int {
+	return c.defineGlobal(name).Index
+}
+
+// ResolveGlobal returns the slot of a global defined by a previous program
+func (c *Compiler) ResolveGlobal(name string) (int, bool) {
+	sym, ok := c.symbolTable.Resolve(name)
+	if !ok || sym.Scope != GlobalScope {
+		return 0, false
+	}
+	return sym.Index, true
+}
+
+// GlobalNames are the names of the globals defined so far, sorted
+func (c *Compiler) GlobalNames() []string {
+	names := []string{}
+	for name, sym := range c.symbolTable.store {
+		if sym.Scope == GlobalScope {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (c *Compiler) define(name string) Symbol {
+	if c.symbolTable.owner().Outer == nil {
+		return c.defineGlobal(name)
+	}
+	return c.symbolTable.Define(name)
+}
+
+func (c *Compiler) defineGlobal(name string) Symbol {
+	sym := c.symbolTable.Define(name)
+	for len(c.globals) <= sym.Index {
+		c.globals = append(c.globals, "")
+	}
+	c.globals[sym.Index] = name
+	return sym
+}
+
+// compiles statements like evalBlockStatements, only the last one
+// leaves a value on the stack
+func (c *Compiler) compileStatements(statements []ast.Statement) error {
+	if len(statements) == 0 {
+		c.emit(code.OpNull)
+		return nil
+	}
+
+	for i, s := range statements {
+		last := i == len(statements)-1
+		if err := c.compileStatement(s, last); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *Compiler) compileStatement(node ast.Statement, keepValue bool) error {
+	switch node := node.(type) {
+	case *ast.ExpressionStatement:
+		if err := c.compileExpression(node.Expression); err != nil {
+			return err
+		}
+		if !keepValue {
+			c.emit(code.OpPop)
+		}
+	case *ast.LetStatement:
+		if err := c.compileExpression(node.Value); err != nil {
+			return err
+		}
+		c.emitAt(node.Token, code.OpAssertType, c.addType(node.Name.Type))
+
+		sym := c.define(node.Name.Value)
+		if node.Mutable {
+			sym = c.symbolTable.MarkMutable(node.Name.Value, node.Name.Type)
+			if sym.boxed() {
+				c.emit(code.OpCell)
+			}
+		}
+		c.setSymbol(sym)
+		if keepValue {
+			c.emit(code.OpNull)
+		}
+	case *ast.AssignStatement:
+		if err := c.compileAssignStatement(node); err != nil {
+			return err
+		}
+		if keepValue {
+			c.emit(code.OpNull)
+		}
+	case *ast.ReturnStatement:
+		if err := c.compileExpression(node.ReturnValue); err != nil {
+			return err
+		}
+		c.emit(code.OpReturnValue)
+	case *ast.BlockStatement:
+		if err := c.compileBlock(node); err != nil {
+			return err
+		}
+		if !keepValue {
+			c.emit(code.OpPop)
+		}
+	case *ast.StructStatement:
+		def := &object.StructType{Name: node.Name.Value, Fields: node.Fields}
+		c.emit(code.OpConstant, c.addConstant(def))
+		c.setSymbol(c.define(node.Name.Value))
+		if keepValue {
+			c.emit(code.OpNull)
+		}
+	case *ast.EnumStatement:
+		def := &object.EnumType{Name: node.Name.Value, Variants: node.Variants}
+		c.emit(code.OpConstant, c.addConstant(def))
+		c.setSymbol(c.define(node.Name.Value))
+		if keepValue {
+			c.emit(code.OpNull)
+		}
+	case *ast.WhileStatement:
+		if err := c.compileWhileStatement(node); err != nil {
+			return err
+		}
+		if !keepValue {
+			c.emit(code.OpPop)
+		}
+	case *ast.ForStatement:
+		if err := c.compileForStatement(node); err != nil {
+			return err
+		}
+		if !keepValue {
+			c.emit(code.OpPop)
+		}
+	case *ast.BreakStatement:
+		if err := c.compileExpression(node.Value); err != nil {
+			return err
+		}
+		current := c.currentLoop()
+		current.breaks = append(current.breaks, c.emit(code.OpBreak, 9999))
+	case *ast.ContinueStatement:
+		c.emit(code.OpContinue, c.currentLoop().start)
+	case *ast.TestStatement, *ast.UseStatement:
+		// tests only run under mist test, and the host binds modules
+		// before the program runs
+		if keepValue {
+			c.emit(code.OpNull)
+		}
+	case *ast.ImplStatement:
+		c.loadIdentifier(node.Name)
+		for _, m := range node.Methods {
+			// unlike functions, methods can't refer to themselves by name
+			if err := c.compileFunction(m.FunctionLiteral, m.Name, false); err != nil {
+				return err
+			}
+			c.emitAt(node.Name.Token, code.OpImpl)
+		}
+		c.emit(code.OpPop)
+		if keepValue {
+			c.emit(code.OpNull)
+		}
+	default:
+		return fmt.Errorf("compiler: unsupported statement %T", node)
+	}
+	return nil
+}
+
+func (c *Compiler) compileBlock(block *ast.BlockStatement) error {
+	c.symbolTable = NewBlockSymbolTable(c.symbolTable)
+	err := c.compileStatements(block.Statements)
+	c.symbolTable = c.symbolTable.Outer
+	return err
+}
+
+func (c *Compiler) compileExpression(node ast.Expression) error {
+	switch node := node.(type) {
+	case nil:
+		c.emit(code.OpNull)
+	case *ast.IntegerLiteral:
+		c.emit(code.OpConstant, c.addConstant(&object.Integer{Value: node.Value}))
+	case *ast.FloatLiteral:
+		c.emit(code.OpConstant, c.addConstant(&object.Float{Value: node.Value}))
+	case *ast.StringLiteral:
+		c.emit(code.OpConstant, c.addConstant(eval.NewString(node.Value)))
+	case *ast.Boolean:
+		if node.Value {
+			c.emit(code.OpTrue)
+		} else {
+			c.emit(code.OpFalse)
+		}
+	case *ast.Identifier:
+		c.loadIdentifier(node)
+	case *ast.PrefixExpression:
+		if err := c.compileExpression(node.Right); err != nil {
+			return err
+		}
+		return c.emitOperator(node.Token, code.OpPrefix, node.Operator)
+	case *ast.InfixExpression:
+		if err := c.compileExpression(node.Left); err != nil {
+			return err
+		}
+		if err := c.compileExpression(node.Right); err != nil {
+			return err
+		}
+		return c.emitOperator(node.Token, code.OpInfix, node.Operator)
+	case *ast.IfExpression:
+		return c.compileIfExpression(node)
+	case *ast.Function:
+		if err := c.compileFunction(node.FunctionLiteral, node.Name, true); err != nil {
+			return err
+		}
+		sym := c.define(node.Name.Value)
+		c.setSymbol(sym)
+		c.loadSymbol(sym, node.Name)
+	case *ast.FunctionLiteral:
+		return c.compileFunction(node, nil, false)
+	case *ast.CallExpression:
+		if err := c.compileExpression(node.Function); err != nil {
+			return err
+		}
+		for _, arg := range node.Arguments {
+			if err := c.compileExpression(arg); err != nil {
+				return err
+			}
+		}
+		c.emitAt(node.Token, code.OpCall, len(node.Arguments))
+	case *ast.ListLiteral:
+		for _, el := range node.Elements {
+			if err := c.compileExpression(el); err != nil {
+				return err
+			}
+		}
+		c.emitAt(node.Token, code.OpList, len(node.Elements))
+	case *ast.MapLiteral:
+		for _, key := range node.Keys() {
+			if err := c.compileExpression(key); err != nil {
+				return err
+			}
+			if err := c.compileExpression(node.Pairs[key]); err != nil {
+				return err
+			}
+		}
+		c.emitAt(node.Token, code.OpMap, len(node.Pairs))
+	case *ast.IndexExpression:
+		if err := c.compileExpression(node.Left); err != nil {
+			return err
+		}
+		if !node.Slice {
+			if err := c.compileExpression(node.Index); err != nil {
+				return err
+			}
+			c.emitAt(node.Token, code.OpIndex)
+			break
+		}
+		for _, bound := range []ast.Expression{node.Index, node.End} {
+			if bound == nil {
+				c.emit(code.OpNull)
+				continue
+			}
+			if err := c.compileExpression(bound); err != nil {
+				return err
+			}
+		}
+		c.emitAt(node.Token, code.OpSlice)
+	case *ast.RangeExpression:
+		if err := c.compileExpression(node.Start); err != nil {
+			return err
+		}
+		if err := c.compileExpression(node.End); err != nil {
+			return err
+		}
+		inclusive := 0
+		if node.Inclusive {
+			inclusive = 1
+		}
+		c.emitAt(node.Token, code.OpRange, inclusive)
+	case *ast.AccessExpression:
+		if err := c.compileExpression(node.Struct); err != nil {
+			return err
+		}
+		attribute := c.addConstant(eval.NewString(node.Attribute))
+		c.emitAt(node.Token, code.OpAccess, attribute)
+	case *ast.TryExpression:
+		if err := c.compileExpression(node.Value); err != nil {
+			return err
+		}
+		try := c.emitAt(node.Token, code.OpTry, 9999)
+		c.emit(code.OpReturnValue)
+		c.changeOperand(try, len(c.currentInstructions()))
+	case *ast.StructLiteral:
+		c.loadIdentifier(node.Name)
+		fields := []object.Object{}
+		for i, f := range node.Fields {
+			if err := c.compileExpression(node.Values[i]); err != nil {
+				return err
+			}
+			fields = append(fields, eval.NewString(f.Value))
+		}
+		c.emitAt(node.Token, code.OpStruct, c.addConstant(eval.NewList(fields)))
+	case *ast.MatchExpression:
+		return c.compileMatchExpression(node)
+	case *ast.LoopExpression:
+		return c.compileLoopExpression(node)
+	default:
+		return fmt.Errorf("compiler: unsupported expression %T", node)
+	}
+	return nil
+}
+
+func (c *Compiler) compileIfExpression(node *ast.IfExpression) error {
+	if err := c.compileExpression(node.Condition); err != nil {
+		return err
+	}
+
+	// bogus offset, patched once the consequence is compiled
+	jumpNotTruthy := c.emit(code.OpJumpNotTruthy, 9999)
+
+	if err := c.compileBlock(node.Consequence); err != nil {
+		return err
+	}
+
+	jump := c.emit(code.OpJump, 9999)
+	c.changeOperand(jumpNotTruthy, len(c.currentInstructions()))
+
+	switch {
+	case node.Others != nil:
+		if err := c.compileExpression(node.Others); err != nil {
+			return err
+		}
+	case node.Alternative != nil:
+		if err := c.compileBlock(node.Alternative); err != nil {
+			return err
+		}
+	default:
+		c.emit(code.OpNull)
+	}
+
+	c.changeOperand(jump, len(c.currentInstructions()))
+	return nil
+}
+
+// the subject is stored in a hidden variable so every arm can match it,
+// each arm is compiled in its own block holding the names it binds
+func (c *Compiler) compileMatchExpression(node *ast.MatchExpression) error {
+	if err := c.compileExpression(node.Subject); err != nil {
+		return err
+	}
+	// not a valid identifier, so it can't shadow or be shadowed by one
+	subject := c.define("match subject")
+	c.setSymbol(subject)
+
+	jumps := []int{}
+	for _, arm := range node.Arms {
+		c.symbolTable = NewBlockSymbolTable(c.symbolTable)
+
+		for _, enum := range ast.Enums(arm.Pattern) {
+			c.loadIdentifier(enum)
+		}
+		c.loadSymbol(subject, nil)
+		c.emit(code.OpMatch, c.addPattern(arm.Pattern))
+
+		// the bindings are pushed after the result, so they are set first
+		bindings := ast.Bindings(arm.Pattern)
+		for i := len(bindings) - 1; i >= 0; i-- {
+			c.setSymbol(c.define(bindings[i].Value))
+		}
+		nextArm := []int{c.emit(code.OpJumpNotTruthy, 9999)}
+
+		if arm.Guard != nil {
+			if err := c.compileExpression(arm.Guard); err != nil {
+				return err
+			}
+			nextArm = append(nextArm, c.emit(code.OpJumpNotTruthy, 9999))
+		}
+
+		if err := c.compileStatements(arm.Body.Statements); err != nil {
+			return err
+		}
+		jumps = append(jumps, c.emit(code.OpJump, 9999))
+		c.symbolTable = c.symbolTable.Outer
+
+		for _, pos := range nextArm {
+			c.changeOperand(pos, len(c.currentInstructions()))
+		}
+	}
+
+	c.loadSymbol(subject, nil)
+	c.emitAt(node.Token, code.OpNoMatch)
+
+	for _, pos := range jumps {
+		c.changeOperand(pos, len(c.currentInstructions()))
+	}
+	return nil
+}
+
+// selfReference binds name to the closure inside its own body
+func (c *Compiler) compileFunction(node *ast.FunctionLiteral, name *ast.Identifier, selfReference bool) error {
+	c.enterScope()
+
+	if selfReference {
+		c.symbolTable.DefineFunctionName(name.Value)
+	}
+
+	for _, p := range node.Parameters {
+		c.symbolTable.Define(p.Value)
+	}
+
+	if err := c.compileStatements(node.Body.Statements); err != nil {
+		return err
+	}
+	c.emit(code.OpReturnValue)
+
+	freeSymbols := c.symbolTable.FreeSymbols
+	numLocals := c.symbolTable.NumDefinitions()
+	positions := c.scopes[c.scopeIndex].positions
+	instructions := c.leaveScope()
+
+	// captures the cells of mutable locals, not their values
+	for _, s := range freeSymbols {
+		c.loadSlot(s, nil)
+	}
+
+	fn := &object.CompiledFunction{
+		Instructions:  instructions,
+		Positions:     positions,
+		NumLocals:     numLocals,
+		NumParameters: len(node.Parameters),
+		Name:          name,
+		Parameters:    node.Parameters,
+		ReturnType:    node.Type,
+		Position:      code.Position{Row: node.Token.Row, Column: node.Token.Column},
+		File:          c.file,
+	}
+
+	c.emit(code.OpClosure, c.addConstant(fn), len(freeSymbols))
+	return nil
+}
+
+func (c *Compiler) loadIdentifier(node *ast.Identifier) {
+	sym, ok := c.symbolTable.Resolve(node.Value)
+	if !ok {
+		// evalIdentifier only errors once the identifier is reached
+		name := c.addConstant(eval.NewString(node.Value))
+		c.emitAt(node.Token, code.OpUndefined, name)
+		return
+	}
+	c.loadSymbol(sym, node)
+}
+
+func (c *Compiler) loadSymbol(s Symbol, node *ast.Identifier) {
+	c.loadSlot(s, node)
+	if s.boxed() {
+		c.emit(code.OpGetCell)
+	}
+}
+
+func (c *Compiler) loadSlot(s Symbol, node *ast.Identifier) {
+	switch s.Scope {
+	case GlobalScope:
+		if node != nil {
+			c.emitAt(node.Token, code.OpGetGlobal, s.Index)
+		} else {
+			c.emit(code.OpGetGlobal, s.Index)
+		}
+	case LocalScope:
+		c.emit(code.OpGetLocal, s.Index)
+	case BuiltinScope:
+		c.emit(code.OpGetBuiltin, s.Index)
+	case FreeScope:
+		c.emit(code.OpGetFree, s.Index)
+	case FunctionScope:
+		c.emit(code.OpCurrentClosure)
+	}
+}
+
+func (c *Compiler) setSymbol(s Symbol) {
+	if s.Scope == GlobalScope {
+		c.emit(code.OpSetGlobal, s.Index)
+	} else {
+		c.emit(code.OpSetLocal, s.Index)
+	}
+}
+
+// stores the value on top of the stack in an already defined symbol
+func (c *Compiler) storeSymbol(s Symbol) {
+	if s.boxed() {
+		c.loadSlot(s, nil)
+		c.emit(code.OpSetCell)
+		return
+	}
+	c.setSymbol(s)
+}
+
+func (c *Compiler) emitOperator(tok token.Token, op code.Opcode, operator string) error {
+	index, ok := code.LookupOperator(operator)
+	if !ok {
+		return fmt.Errorf("compiler: unknown operator %s", operator)
+	}
+	c.emitAt(tok, op, index)
+	return nil
+}
+
+func (c *Compiler) addConstant(obj object.Object) int {
+	c.constants = append(c.constants, obj)
+	return len(c.constants) - 1
+}
+
+func (c *Compiler) addType(t *ast.TypeNode) int {
+	c.types = append(c.types, t)
+	return len(c.types) - 1
+}
+
+func (c *Compiler) addAssign(a *ast.AssignStatement) int {
+	c.assigns = append(c.assigns, a)
+	return len(c.assigns) - 1
+}
+
+func (c *Compiler) addPattern(p ast.Pattern) int {
+	c.patterns = append(c.patterns, p)
+	return len(c.patterns) - 1
+}
+
+func (c *Compiler) emit(op code.Opcode, operands ...int) int {
+	ins := code.Make(op, operands...)
+	return c.addInstruction(ins)
+}
+
+// emits an instruction that can fail at runtime, its errors point at tok
+func (c *Compiler) emitAt(tok token.Token, op code.Opcode, operands ...int) int {
+	pos := c.emit(op, operands...)
+	c.scopes[c.scopeIndex].positions[pos] = code.Position{Row: tok.Row, Column: tok.Column, Length: len(tok.Literal)}
+	return pos
+}
+
+func (c *Compiler) addInstruction(ins []byte) int {
+	posNewInstruction := len(c.currentInstructions())
+	c.scopes[c.scopeIndex].instructions = append(c.currentInstructions(), ins...)
+	return posNewInstruction
+}
+
+func (c *Compiler) currentInstructions() code.Instructions {
+	return c.scopes[c.scopeIndex].instructions
+}
+
+func (c *Compiler) changeOperand(opPos int, operand int) {
+	op := code.Opcode(c.currentInstructions()[opPos])
+	newInstruction := code.Make(op, operand)
+
+	ins := c.currentInstructions()
+	for i := 0; i < len(newInstruction); i++ {
+		ins[opPos+i] = newInstruction[i]
+	}
+}
+
+func (c *Compiler) enterScope() {
+	scope := CompilationScope{
+		instructions: code.Instructions{},
+		positions:    map[int]code.Position{},
+	}
+	c.scopes = append(c.scopes, scope)
+	c.scopeIndex++
+	c.symbolTable = NewEnclosedSymbolTable(c.symbolTable)
+}
+
+func (c *Compiler) leaveScope() code.Instructions {
+	instructions := c.currentInstructions()
+
+	c.scopes = c.scopes[:len(c.scopes)-1]
+	c.scopeIndex--
+	c.symbolTable = c.symbolTable.Outer
+
+	return instructions
+}
@@ -0,0 +1,262 @@
+package compiler
+
+import (
+	"lang/code"
+	"lang/lexer"
+	"lang/object"
+	"lang/parser"
+	"testing"
+)
+
+func testCompile(t *testing.T, i int, input string) *Bytecode {
+	l := lexer.NewLexer(input)
+	p := parser.NewParser(l)
+	program := p.Parse()
+
+	c := NewCompiler()
+	if err := c.Compile(program); err != nil {
+		t.Fatalf("case %d: compiler error: %s", i, err)
+	}
+	return c.Bytecode()
+}
+
+func concatInstructions(s ...[]byte) code.Instructions {
+	out := code.Instructions{}
+	for _, ins := range s {
+		out = append(out, ins...)
+	}
+	return out
+}
+
+func TestCompilerInstructions(t *testing.T) {
+	tests := []struct {
+		code     string
+		expected code.Instructions
+	}{
+		{
+			code: "1 + 2",
+			expected: concatInstructions(
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpInfix, 0),
+				code.Make(code.OpReturnValue),
+			),
+		},
+		{
+			code: "1; !true",
+			expected: concatInstructions(
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpPop),
+				code.Make(code.OpTrue),
+				code.Make(code.OpPrefix, 14),
+				code.Make(code.OpReturnValue),
+			),
+		},
+		{
+			code: "0..=5",
+			expected: concatInstructions(
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpRange, 1),
+				code.Make(code.OpReturnValue),
+			),
+		},
+		{
+			code: "let x: Int = 1;",
+			expected: concatInstructions(
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpAssertType, 0),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpNull),
+				code.Make(code.OpReturnValue),
+			),
+		},
+		{
+			code: "if (true) {1}",
+			expected: concatInstructions(
+				code.Make(code.OpTrue),
+				code.Make(code.OpJumpNotTruthy, 10),
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpJump, 11),
+				code.Make(code.OpNull),
+				code.Make(code.OpReturnValue),
+			),
+		},
+		{
+			code: "len([1])",
+			expected: concatInstructions(
+				code.Make(code.OpGetBuiltin, 14),
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpList, 1),
+				code.Make(code.OpCall, 1),
+				code.Make(code.OpReturnValue),
+			),
+		},
+		{
+			code: "undefinedName",
+			expected: concatInstructions(
+				code.Make(code.OpUndefined, 0),
+				code.Make(code.OpReturnValue),
+			),
+		},
+		{
+			code: "match 1 { x => x }",
+			expected: concatInstructions(
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpMatch, 0),
+				code.Make(code.OpSetGlobal, 1),
+				code.Make(code.OpJumpNotTruthy, 24),
+				code.Make(code.OpGetGlobal, 1),
+				code.Make(code.OpJump, 28),
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpNoMatch),
+				code.Make(code.OpReturnValue),
+			),
+		},
+		{
+			code: "loop { break 1; }",
+			expected: concatInstructions(
+				code.Make(code.OpEnterLoop),
+				code.Make(code.OpStep),
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpBreak, 12),
+				code.Make(code.OpPop),
+				code.Make(code.OpJump, 1),
+				code.Make(code.OpReturnValue),
+			),
+		},
+		{
+			code: "while (true) { continue; }",
+			expected: concatInstructions(
+				code.Make(code.OpEnterLoop),
+				code.Make(code.OpStep),
+				code.Make(code.OpTrue),
+				code.Make(code.OpJumpNotTruthy, 13),
+				code.Make(code.OpContinue, 1),
+				code.Make(code.OpPop),
+				code.Make(code.OpJump, 1),
+				code.Make(code.OpNull),
+				code.Make(code.OpExitLoop),
+				code.Make(code.OpReturnValue),
+			),
+		},
+		{
+			code: "let mut x: Int = 1; x += 2;",
+			expected: concatInstructions(
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpAssertType, 0),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpAssign, 0),
+				code.Make(code.OpAssertType, 1),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpNull),
+				code.Make(code.OpReturnValue),
+			),
+		},
+		{
+			code: "fn() { let mut x: Int = 1; fn() { x = 2; } }",
+			expected: concatInstructions(
+				code.Make(code.OpClosure, 3, 0),
+				code.Make(code.OpReturnValue),
+			),
+		},
+		{
+			code: "struct P { x: Int } P { x: 1 }",
+			expected: concatInstructions(
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpStruct, 2),
+				code.Make(code.OpReturnValue),
+			),
+		},
+		{
+			code: "None?",
+			expected: concatInstructions(
+				code.Make(code.OpGetBuiltin, 1),
+				code.Make(code.OpTry, 6),
+				code.Make(code.OpReturnValue),
+				code.Make(code.OpReturnValue),
+			),
+		},
+	}
+
+	for i, test := range tests {
+		bytecode := testCompile(t, i, test.code)
+		if bytecode.Instructions.String() != test.expected.String() {
+			t.Errorf("case %d: wrong instructions\nexpected\n%s\ngot\n%s",
+				i, test.expected, bytecode.Instructions)
+		}
+	}
+}
+
+func TestCompilerClosures(t *testing.T) {
+	input := "fn adder(x: Int) Func { fn(y: Int) Int { x + y } }"
+	bytecode := testCompile(t, 0, input)
+
+	// the inner literal is compiled first and captures x
+	inner, ok := bytecode.Constants[0].(*object.CompiledFunction)
+	if !ok {
+		t.Fatalf("constant 0 is not a CompiledFunction, got=%T", bytecode.Constants[0])
+	}
+
+	expected := concatInstructions(
+		code.Make(code.OpGetFree, 0),
+		code.Make(code.OpGetLocal, 0),
+		code.Make(code.OpInfix, 0),
+		code.Make(code.OpReturnValue),
+	)
+	if inner.Instructions.String() != expected.String() {
+		t.Errorf("wrong instructions\nexpected\n%s\ngot\n%s", expected, inner.Instructions)
+	}
+
+	outer, ok := bytecode.Constants[1].(*object.CompiledFunction)
+	if !ok {
+		t.Fatalf("constant 1 is not a CompiledFunction, got=%T", bytecode.Constants[1])
+	}
+
+	expected = concatInstructions(
+		code.Make(code.OpGetLocal, 0),
+		code.Make(code.OpClosure, 0, 1),
+		code.Make(code.OpReturnValue),
+	)
+	if outer.Instructions.String() != expected.String() {
+		t.Errorf("wrong instructions\nexpected\n%s\ngot\n%s", expected, outer.Instructions)
+	}
+}
+
+func TestSymbolTableBlocks(t *testing.T) {
+	global := NewSymbolTable()
+	global.Define("a")
+
+	fn := NewEnclosedSymbolTable(global)
+	fn.Define("b")
+
+	block := NewBlockSymbolTable(fn)
+	c := block.Define("c")
+	if c.Scope != LocalScope || c.Index != 1 {
+		t.Errorf("block symbol should take the next local slot, got=%+v", c)
+	}
+
+	if sym, ok := block.Resolve("a"); !ok || sym.Scope != GlobalScope {
+		t.Errorf("expected a to resolve as global, got=%+v", sym)
+	}
+
+	inner := NewEnclosedSymbolTable(block)
+	if sym, ok := inner.Resolve("c"); !ok || sym.Scope != FreeScope {
+		t.Errorf("expected c to resolve as free, got=%+v", sym)
+	}
+
+	if _, ok := fn.Resolve("c"); ok {
+		t.Errorf("c should not leak out of its block")
+	}
+
+	if fn.NumDefinitions() != 2 {
+		t.Errorf("expected 2 locals, got=%d", fn.NumDefinitions())
+	}
+}
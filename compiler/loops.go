@@ -0,0 +1,109 @@
+package compiler
+
+import (
+	"lang/ast"
+	"lang/code"
+	"lang/token"
+)
+
+// a loop being compiled, its breaks jump past the end of the loop
+// and are patched once it is known
+type loop struct {
+	start  int
+	breaks []int
+}
+
+func (c *Compiler) currentLoop() *loop {
+	loops := c.scopes[c.scopeIndex].loops
+	return loops[len(loops)-1]
+}
+
+// every iteration, including the one that ends the loop, starts with a
+// step at tok like in the tree walker
+func (c *Compiler) enterLoop(tok token.Token) *loop {
+	c.emit(code.OpEnterLoop)
+	l := &loop{start: len(c.currentInstructions())}
+	c.emitAt(tok, code.OpStep)
+	c.scopes[c.scopeIndex].loops = append(c.scopes[c.scopeIndex].loops, l)
+	return l
+}
+
+func (c *Compiler) leaveLoop(l *loop) {
+	for _, pos := range l.breaks {
+		c.changeOperand(pos, len(c.currentInstructions()))
+	}
+
+	loops := c.scopes[c.scopeIndex].loops
+	c.scopes[c.scopeIndex].loops = loops[:len(loops)-1]
+}
+
+func (c *Compiler) compileWhileStatement(node *ast.WhileStatement) error {
+	l := c.enterLoop(node.Token)
+
+	if err := c.compileExpression(node.Condition); err != nil {
+		return err
+	}
+	exit := c.emit(code.OpJumpNotTruthy, 9999)
+
+	if err := c.compileBlock(node.Body); err != nil {
+		return err
+	}
+	c.emit(code.OpPop)
+	c.emit(code.OpJump, l.start)
+
+	c.changeOperand(exit, len(c.currentInstructions()))
+	// ending without a break leaves null on the stack
+	c.emit(code.OpNull)
+	c.emit(code.OpExitLoop)
+	c.leaveLoop(l)
+	return nil
+}
+
+// the iterator is stored in a hidden variable and every iteration
+// sets the loop variables from the next item
+func (c *Compiler) compileForStatement(node *ast.ForStatement) error {
+	c.symbolTable = NewBlockSymbolTable(c.symbolTable)
+	defer func() { c.symbolTable = c.symbolTable.Outer }()
+
+	if err := c.compileExpression(node.Iterable); err != nil {
+		return err
+	}
+	c.emitAt(node.Token, code.OpIter, len(node.Variables))
+	iterator := c.define("for iterator")
+	c.setSymbol(iterator)
+
+	l := c.enterLoop(node.Token)
+	c.loadSymbol(iterator, nil)
+	c.emit(code.OpNext)
+	for i := len(node.Variables) - 1; i >= 0; i-- {
+		c.setSymbol(c.define(node.Variables[i].Value))
+	}
+	exit := c.emit(code.OpJumpNotTruthy, 9999)
+
+	if err := c.compileBlock(node.Body); err != nil {
+		return err
+	}
+	c.emit(code.OpPop)
+	c.emit(code.OpJump, l.start)
+
+	c.changeOperand(exit, len(c.currentInstructions()))
+	// ending without a break leaves null on the stack
+	c.emit(code.OpNull)
+	c.emit(code.OpExitLoop)
+	c.leaveLoop(l)
+	return nil
+}
+
+// only a break leaves the loop, so the value comes from it
+func (c *Compiler) compileLoopExpression(node *ast.LoopExpression) error {
+	l := c.enterLoop(node.Token)
+
+	if err := c.compileBlock(node.Body); err != nil {
+		return err
+	}
+	c.emit(code.OpPop)
+	c.emit(code.OpJump, l.start)
+
+	c.leaveLoop(l)
+	return nil
+}
@@ -0,0 +1,145 @@
+package compiler
+
+import "lang/ast"
+
+type SymbolScope string
+
+const (
+	GlobalScope   SymbolScope = "GLOBAL"
+	LocalScope    SymbolScope = "LOCAL"
+	BuiltinScope  SymbolScope = "BUILTIN"
+	FreeScope     SymbolScope = "FREE"
+	FunctionScope SymbolScope = "FUNCTION"
+)
+
+type Symbol struct {
+	Name  string
+	Scope SymbolScope
+	Index int
+	// declared with let mut, Type is the type it was declared with
+	Mutable bool
+	Type    *ast.TypeNode
+}
+
+// mutable locals live in cells, so closures that capture them share
+// them with the function that defined them
+func (s Symbol) boxed() bool {
+	return s.Mutable && (s.Scope == LocalScope || s.Scope == FreeScope)
+}
+
+// A SymbolTable is either the global table, a function table or a block
+// table. Block tables mirror object.NewInnerScope: names defined in them
+// are only visible inside the block, but their slots are allocated from
+// the enclosing global or function table.
+type SymbolTable struct {
+	Outer *SymbolTable
+
+	store          map[string]Symbol
+	numDefinitions int
+	block          bool
+
+	FreeSymbols []Symbol
+}
+
+func NewSymbolTable() *SymbolTable {
+	return &SymbolTable{store: make(map[string]Symbol)}
+}
+
+func NewEnclosedSymbolTable(outer *SymbolTable) *SymbolTable {
+	s := NewSymbolTable()
+	s.Outer = outer
+	return s
+}
+
+func NewBlockSymbolTable(outer *SymbolTable) *SymbolTable {
+	s := NewEnclosedSymbolTable(outer)
+	s.block = true
+	return s
+}
+
+// the global or function table that owns the slots of s
+func (s *SymbolTable) owner() *SymbolTable {
+	for s.block {
+		s = s.Outer
+	}
+	return s
+}
+
+func (s *SymbolTable) NumDefinitions() int {
+	return s.owner().numDefinitions
+}
+
+// Define reuses the slot of a name already defined in the same table,
+// the same way object.Scope.Set overwrites it.
+func (s *SymbolTable) Define(name string) Symbol {
+	owner := s.owner()
+
+	scope := LocalScope
+	if owner.Outer == nil {
+		scope = GlobalScope
+	}
+
+	if sym, ok := s.store[name]; ok && sym.Scope == scope {
+		sym.Mutable, sym.Type = false, nil
+		s.store[name] = sym
+		return sym
+	}
+
+	sym := Symbol{Name: name, Scope: scope, Index: owner.numDefinitions}
+	owner.numDefinitions++
+	s.store[name] = sym
+	return sym
+}
+
+// MarkMutable lets the symbol just defined as name be reassigned with
+// values of type t
+func (s *SymbolTable) MarkMutable(name string, t *ast.TypeNode) Symbol {
+	sym := s.store[name]
+	sym.Mutable, sym.Type = true, t
+	s.store[name] = sym
+	return sym
+}
+
+func (s *SymbolTable) DefineBuiltin(index int, name string) Symbol {
+	sym := Symbol{Name: name, Scope: BuiltinScope, Index: index}
+	s.store[name] = sym
+	return sym
+}
+
+func (s *SymbolTable) DefineFunctionName(name string) Symbol {
+	sym := Symbol{Name: name, Scope: FunctionScope, Index: 0}
+	s.store[name] = sym
+	return sym
+}
+
+func (s *SymbolTable) defineFree(original Symbol) Symbol {
+	s.FreeSymbols = append(s.FreeSymbols, original)
+
+	sym := Symbol{
+		Name:    original.Name,
+		Scope:   FreeScope,
+		Index:   len(s.FreeSymbols) - 1,
+		Mutable: original.Mutable,
+		Type:    original.Type,
+	}
+	s.store[original.Name] = sym
+	return sym
+}
+
+func (s *SymbolTable) Resolve(name string) (Symbol, bool) {
+	sym, ok := s.store[name]
+	if ok || s.Outer == nil {
+		return sym, ok
+	}
+
+	sym, ok = s.Outer.Resolve(name)
+	if !ok || s.block {
+		return sym, ok
+	}
+
+	if sym.Scope == GlobalScope || sym.Scope == BuiltinScope {
+		return sym, ok
+	}
+
+	return s.defineFree(sym), true
+}
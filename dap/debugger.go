@@ -0,0 +1,474 @@
+package dap
+
+import (
+	"fmt"
+	"lang/ast"
+	"lang/eval"
+	"lang/lexer"
+	"lang/object"
+	"lang/parser"
+	"lang/token"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// how the program goes on after a stop
+type mode int
+
+const (
+	// until a breakpoint or a pause
+	running mode = iota
+	// to the next line
+	stepIn
+	// to the next line of the same call or an outer one
+	stepOver
+	// to the next line of an outer call
+	stepOut
+)
+
+// a call the program is in, the outermost one runs the program itself
+type frame struct {
+	function string
+	// the statement running in it
+	row, column int
+	scope       *object.Scope
+	// the statements run since the frame came to the line of row, nil
+	// before its first one. One that runs again is a loop going back to
+	// the start of the line.
+	ran map[ast.Statement]bool
+}
+
+type breakpoint struct {
+	id   int
+	line int
+	// stops only when true, nil stops always
+	condition ast.Expression
+}
+
+// debugger is the hook a program runs under. It runs in the goroutine of
+// the program and blocks it on every stop, until the server resumes it.
+type debugger struct {
+	mu sync.Mutex
+
+	frames      []*frame
+	breakpoints map[int]*breakpoint
+	mode        mode
+	// the number of frames when the step started
+	depth int
+	// a statement on the line of the last one, in the same frame, is not
+	// a new line to step to
+	lastRow, lastDepth int
+	// the row of the call of main appended to the program
+	appended int
+
+	entry      bool
+	pause      bool
+	terminated bool
+	stopped    bool
+	// set while the server evaluates an expression in a stopped program,
+	// the statements and calls it runs are not the program's
+	evaluating bool
+
+	// values shown by the variables request, valid until the program
+	// resumes, their reference is their index plus one
+	references []func() []Variable
+
+	// sends the stopped event
+	onStop func(reason string, hits []int)
+	resume chan struct{}
+}
+
+func newDebugger(appended int, stopOnEntry bool, onStop func(string, []int)) *debugger {
+	d := &debugger{
+		frames:      []*frame{{function: "<program>"}},
+		breakpoints: map[int]*breakpoint{},
+		appended:    appended,
+		entry:       stopOnEntry,
+		onStop:      onStop,
+		resume:      make(chan struct{}),
+	}
+	if stopOnEntry {
+		d.mode = stepIn
+	}
+	return d
+}
+
+func (d *debugger) Statement(node ast.Statement, scope *object.Scope) *object.Error {
+	tok := statementToken(node)
+
+	d.mu.Lock()
+	if d.evaluating {
+		d.mu.Unlock()
+		return nil
+	}
+	if d.terminated {
+		d.mu.Unlock()
+		return stoppedError(tok)
+	}
+
+	top := d.frames[len(d.frames)-1]
+	// breakpoints stop once each time their line is entered, which a loop
+	// written on a single line does on each pass
+	entered := top.ran == nil || tok.Row != top.row || top.ran[node]
+	if entered {
+		top.ran = map[ast.Statement]bool{}
+	}
+	top.ran[node] = true
+	top.row, top.column, top.scope = tok.Row, tok.Column, scope
+
+	depth := len(d.frames)
+	newLine := tok.Row != d.lastRow || depth != d.lastDepth
+	d.lastRow, d.lastDepth = tok.Row, depth
+	if tok.Row == d.appended {
+		d.mu.Unlock()
+		return nil
+	}
+
+	reason := ""
+	switch {
+	case d.pause:
+		reason = "pause"
+	case d.entry:
+		reason = "entry"
+	case !newLine:
+	case d.mode == stepIn,
+		d.mode == stepOver && depth <= d.depth,
+		d.mode == stepOut && depth < d.depth:
+		reason = "step"
+	}
+
+	var hits []int
+	if bp := d.breakpoints[tok.Row]; bp != nil && entered && d.hit(bp, scope) {
+		reason = "breakpoint"
+		hits = []int{bp.id}
+	}
+
+	if reason == "" {
+		d.mu.Unlock()
+		return nil
+	}
+
+	d.mode, d.entry, d.pause, d.stopped = running, false, false, true
+	d.mu.Unlock()
+
+	d.onStop(reason, hits)
+	<-d.resume
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.terminated {
+		return stoppedError(tok)
+	}
+	return nil
+}
+
+// reports whether the condition of bp holds in scope, called with the
+// lock held. Conditions that fail stop the program too, better than
+// missing the stop.
+func (d *debugger) hit(bp *breakpoint, scope *object.Scope) bool {
+	if bp.condition == nil {
+		return true
+	}
+
+	d.evaluating = true
+	d.mu.Unlock()
+	value := eval.Eval(bp.condition, scope)
+	d.mu.Lock()
+	d.evaluating = false
+
+	boolean, ok := value.(*object.Boolean)
+	return !ok || boolean.Value
+}
+
+func (d *debugger) Call(function string, row, column int) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if !d.evaluating {
+		d.frames = append(d.frames, &frame{function: function, row: row, column: column})
+	}
+}
+
+func (d *debugger) Return() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if !d.evaluating {
+		d.frames = d.frames[:len(d.frames)-1]
+	}
+}
+
+func stoppedError(tok token.Token) *object.Error {
+	return &object.Error{
+		Message: "execution stopped: the debugger disconnected",
+		Row:     tok.Row,
+		Column:  tok.Column,
+		Fatal:   true,
+	}
+}
+
+// resumes a stopped program in mode, fails when it isn't stopped
+func (d *debugger) continueIn(m mode) error {
+	d.mu.Lock()
+	if !d.stopped {
+		d.mu.Unlock()
+		return fmt.Errorf("the program is not stopped")
+	}
+	d.mode, d.depth = m, len(d.frames)
+	d.stopped = false
+	d.references = nil
+	d.mu.Unlock()
+
+	d.resume <- struct{}{}
+	return nil
+}
+
+// stops the program at its next statement
+func (d *debugger) requestPause() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.pause = true
+}
+
+// stops the program for good, the statement it is stopped at or the
+// next one fails
+func (d *debugger) terminate() {
+	d.mu.Lock()
+	d.terminated = true
+	stopped := d.stopped
+	d.stopped = false
+	d.mu.Unlock()
+
+	if stopped {
+		d.resume <- struct{}{}
+	}
+}
+
+func (d *debugger) setBreakpoints(breakpoints []*breakpoint) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.breakpoints = map[int]*breakpoint{}
+	for _, bp := range breakpoints {
+		if d.breakpoints[bp.line] == nil {
+			d.breakpoints[bp.line] = bp
+		}
+	}
+}
+
+// the frames of a stopped program, innermost first. Their ids are their
+// index from the outermost one.
+func (d *debugger) stackTrace(source *Source) ([]StackFrame, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if !d.stopped {
+		return nil, fmt.Errorf("the program is not stopped")
+	}
+
+	frames := []StackFrame{}
+	for i := len(d.frames) - 1; i >= 0; i-- {
+		f := d.frames[i]
+		// the call of main appended to the program has no place in the file
+		if f.row == d.appended {
+			continue
+		}
+		frames = append(frames, StackFrame{ID: i, Name: f.function, Source: source, Line: f.row, Column: f.column})
+	}
+	return frames, nil
+}
+
+func (d *debugger) frame(id int) (*frame, error) {
+	if !d.stopped {
+		return nil, fmt.Errorf("the program is not stopped")
+	}
+	if id < 0 || id >= len(d.frames) || d.frames[id].scope == nil {
+		return nil, fmt.Errorf("no frame %d", id)
+	}
+	return d.frames[id], nil
+}
+
+// the scopes of a frame, from its innermost one to the globals
+func (d *debugger) scopes(id int) ([]Scope, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	f, err := d.frame(id)
+	if err != nil {
+		return nil, err
+	}
+
+	scopes := []Scope{}
+	for s := f.scope; s != nil; s = s.Outer() {
+		name := "Enclosing"
+		switch {
+		case s.Outer() == nil:
+			name = "Globals"
+		case s == f.scope:
+			name = "Locals"
+		case len(s.Names()) == 0:
+			continue
+		}
+
+		s := s
+		scopes = append(scopes, Scope{Name: name, VariablesReference: d.reference(func() []Variable {
+			variables := []Variable{}
+			for _, name := range s.Names() {
+				value, _ := s.Local(name)
+				variables = append(variables, d.variable(name, value))
+			}
+			return variables
+		})})
+	}
+	return scopes, nil
+}
+
+func (d *debugger) variables(reference int) ([]Variable, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if reference < 1 || reference > len(d.references) {
+		return nil, fmt.Errorf("no variables with reference %d", reference)
+	}
+	return d.references[reference-1](), nil
+}
+
+// registers the variables of a scope or a value, called with the lock held
+func (d *debugger) reference(variables func() []Variable) int {
+	d.references = append(d.references, variables)
+	return len(d.references)
+}
+
+// a variable showing value, lists, maps, structs and enum values with a
+// payload expand to what they hold
+func (d *debugger) variable(name string, value object.Object) Variable {
+	v := Variable{Name: name, Value: value.Inspect(), Type: string(value.Type())}
+
+	switch value := value.(type) {
+	case *object.List:
+		if len(value.Elements) > 0 {
+			v.VariablesReference = d.reference(func() []Variable {
+				return d.indexed(value.Elements)
+			})
+		}
+	case *object.EnumValue:
+		if len(value.Values) > 0 {
+			v.VariablesReference = d.reference(func() []Variable {
+				return d.indexed(value.Values)
+			})
+		}
+	case *object.Struct:
+		v.VariablesReference = d.reference(func() []Variable {
+			variables := []Variable{}
+			for _, field := range value.Definition.Fields {
+				variables = append(variables, d.variable(field.Value, value.Fields[field.Value]))
+			}
+			return variables
+		})
+	case *object.Map:
+		if len(value.Pairs) > 0 {
+			v.VariablesReference = d.reference(func() []Variable {
+				variables := []Variable{}
+				for _, pair := range value.Pairs {
+					variables = append(variables, d.variable(pair.Key.Inspect(), pair.Value))
+				}
+				sort.Slice(variables, func(i, j int) bool { return variables[i].Name < variables[j].Name })
+				return variables
+			})
+		}
+	}
+	return v
+}
+
+func (d *debugger) indexed(values []object.Object) []Variable {
+	variables := []Variable{}
+	for i, value := range values {
+		variables = append(variables, d.variable(strconv.Itoa(i), value))
+	}
+	return variables
+}
+
+// evaluates expression in a frame of the stopped program, the innermost
+// one when id is nil
+func (d *debugger) evaluate(expression string, id *int) (Variable, error) {
+	exp, err := parseExpression(expression)
+	if err != nil {
+		return Variable{}, err
+	}
+
+	d.mu.Lock()
+	index := len(d.frames) - 1
+	if id != nil {
+		index = *id
+	}
+	f, err := d.frame(index)
+	if err != nil {
+		d.mu.Unlock()
+		return Variable{}, err
+	}
+	d.evaluating = true
+	d.mu.Unlock()
+
+	value := eval.Eval(exp, f.scope)
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.evaluating = false
+	if err, ok := value.(*object.Error); ok {
+		return Variable{}, fmt.Errorf("%s", err.Inspect())
+	}
+	return d.variable("", value), nil
+}
+
+// parses the expression of a condition or an evaluate request
+func parseExpression(source string) (ast.Expression, error) {
+	p := parser.NewParser(lexer.NewLexer(source))
+	program := p.Parse()
+	if diagnostics := p.Diagnostics(); len(diagnostics) != 0 {
+		return nil, fmt.Errorf("%s", diagnostics[0].Message)
+	}
+
+	if len(program.Statements) == 1 {
+		if statement, ok := program.Statements[0].(*ast.ExpressionStatement); ok {
+			return statement.Expression, nil
+		}
+	}
+	return nil, fmt.Errorf("%q is not an expression", strings.TrimSpace(source))
+}
+
+// the token a statement starts at, breakpoints are on its row
+func statementToken(node ast.Statement) token.Token {
+	switch node := node.(type) {
+	case *ast.LetStatement:
+		return node.Token
+	case *ast.ReturnStatement:
+		return node.Token
+	case *ast.ExpressionStatement:
+		return node.Token
+	case *ast.BlockStatement:
+		return node.Token
+	case *ast.StructStatement:
+		return node.Token
+	case *ast.ImplStatement:
+		return node.Token
+	case *ast.EnumStatement:
+		return node.Token
+	case *ast.WhileStatement:
+		return node.Token
+	case *ast.ForStatement:
+		return node.Token
+	case *ast.BreakStatement:
+		return node.Token
+	case *ast.ContinueStatement:
+		return node.Token
+	case *ast.TestStatement:
+		return node.Token
+	case *ast.UseStatement:
+		return node.Token
+	case *ast.AssignStatement:
+		if target, ok := node.Target.(*ast.Identifier); ok {
+			return target.Token
+		}
+		return node.Token
+	case *ast.BadStatement:
+		return node.From
+	default:
+		return token.Token{}
+	}
+}
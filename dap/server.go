@@ -0,0 +1,318 @@
+// Package dap is a debugger for Mist. It speaks the Debug Adapter
+// Protocol over a pair of streams, usually stdin and stdout, and runs the
+// program it debugs on the tree walker with a hook that stops it at line
+// breakpoints, conditional ones, steps and pauses.
+package dap
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"lang/diagnostic"
+	"lang/mist"
+	"lang/wire"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// the program runs in the one thread there is
+const threadID = 1
+
+type server struct {
+	mu  sync.Mutex // guards out and seq, the program writes events too
+	out io.Writer
+	seq int
+
+	launch     *LaunchArguments
+	source     string
+	debugger   *debugger
+	configured bool
+	// closed once the program ended
+	done   chan struct{}
+	cancel context.CancelFunc
+
+	// by the path of their file
+	breakpoints map[string][]*breakpoint
+	nextID      int
+}
+
+// Serve debugs the program the client launches, answering the requests
+// read from in on out until the client disconnects or closes in
+func Serve(in io.Reader, out io.Writer) error {
+	s := &server{out: out, breakpoints: map[string][]*breakpoint{}}
+	defer s.stop()
+	r := bufio.NewReader(in)
+
+	for {
+		body, err := wire.Read(r)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		var req request
+		if err := json.Unmarshal(body, &req); err != nil {
+			return fmt.Errorf("invalid message: %s", err)
+		}
+
+		result, err := s.handle(&req)
+		if err := s.respond(&req, result, err); err != nil {
+			return err
+		}
+		if req.Command == "initialize" && err == nil {
+			s.event("initialized", nil)
+		}
+		if req.Command == "disconnect" {
+			return nil
+		}
+		if (req.Command == "launch" || req.Command == "configurationDone") && err == nil {
+			s.start()
+		}
+	}
+}
+
+func (s *server) respond(req *request, body interface{}, err error) error {
+	res := response{Type: "response", RequestSeq: req.Seq, Success: err == nil, Command: req.Command, Body: body}
+	if err != nil {
+		res.Message = err.Error()
+	}
+	return s.send(&res, &res.Seq)
+}
+
+func (s *server) event(name string, body interface{}) {
+	e := event{Type: "event", Event: name, Body: body}
+	// a client gone away notices by itself, the program still ends
+	_ = s.send(&e, &e.Seq)
+}
+
+func (s *server) send(message interface{}, seq *int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.seq++
+	*seq = s.seq
+	return wire.Write(s.out, message)
+}
+
+func (s *server) handle(req *request) (interface{}, error) {
+	switch req.Command {
+	case "initialize":
+		return Capabilities{
+			SupportsConfigurationDoneRequest: true,
+			SupportsConditionalBreakpoints:   true,
+			SupportsTerminateRequest:         true,
+		}, nil
+	case "launch":
+		var args LaunchArguments
+		if err := decode(req.Arguments, &args); err != nil {
+			return nil, err
+		}
+		return nil, s.load(&args)
+	case "setBreakpoints":
+		var args SetBreakpointsArguments
+		if err := decode(req.Arguments, &args); err != nil {
+			return nil, err
+		}
+		return SetBreakpointsResponseBody{Breakpoints: s.setBreakpoints(&args)}, nil
+	case "configurationDone":
+		s.configured = true
+		return nil, nil
+	case "threads":
+		return ThreadsResponseBody{Threads: []Thread{{ID: threadID, Name: "main"}}}, nil
+	case "disconnect", "terminate":
+		s.stop()
+		return nil, nil
+	}
+
+	// the rest need a program being debugged
+	if s.debugger == nil {
+		return nil, fmt.Errorf("%s: no program is being debugged", req.Command)
+	}
+	switch req.Command {
+	case "continue":
+		return ContinueResponseBody{AllThreadsContinued: true}, s.debugger.continueIn(running)
+	case "next":
+		return nil, s.debugger.continueIn(stepOver)
+	case "stepIn":
+		return nil, s.debugger.continueIn(stepIn)
+	case "stepOut":
+		return nil, s.debugger.continueIn(stepOut)
+	case "pause":
+		s.debugger.requestPause()
+		return nil, nil
+	case "stackTrace":
+		source := &Source{Name: filepath.Base(s.launch.Program), Path: s.launch.Program}
+		frames, err := s.debugger.stackTrace(source)
+		if err != nil {
+			return nil, err
+		}
+		return StackTraceResponseBody{StackFrames: frames, TotalFrames: len(frames)}, nil
+	case "scopes":
+		var args ScopesArguments
+		if err := decode(req.Arguments, &args); err != nil {
+			return nil, err
+		}
+		scopes, err := s.debugger.scopes(args.FrameID)
+		if err != nil {
+			return nil, err
+		}
+		return ScopesResponseBody{Scopes: scopes}, nil
+	case "variables":
+		var args VariablesArguments
+		if err := decode(req.Arguments, &args); err != nil {
+			return nil, err
+		}
+		variables, err := s.debugger.variables(args.VariablesReference)
+		if err != nil {
+			return nil, err
+		}
+		return VariablesResponseBody{Variables: variables}, nil
+	case "evaluate":
+		var args EvaluateArguments
+		if err := decode(req.Arguments, &args); err != nil {
+			return nil, err
+		}
+		v, err := s.debugger.evaluate(args.Expression, args.FrameID)
+		if err != nil {
+			return nil, err
+		}
+		return EvaluateResponseBody{Result: v.Value, Type: v.Type, VariablesReference: v.VariablesReference}, nil
+	}
+	return nil, fmt.Errorf("unknown command %q", req.Command)
+}
+
+func decode(arguments json.RawMessage, v interface{}) error {
+	if len(arguments) == 0 {
+		return nil
+	}
+	if err := json.Unmarshal(arguments, v); err != nil {
+		return fmt.Errorf("invalid arguments: %s", err)
+	}
+	return nil
+}
+
+// reads the program to debug, it starts once the client is configured
+func (s *server) load(args *LaunchArguments) error {
+	if s.launch != nil {
+		return errors.New("a program is already being debugged")
+	}
+	source, err := os.ReadFile(args.Program)
+	if err != nil {
+		return err
+	}
+
+	s.launch, s.source = args, string(source)
+	if !args.NoDebug {
+		appended := strings.Count(s.source, "\n") + 2
+		s.debugger = newDebugger(appended, args.StopOnEntry, func(reason string, hits []int) {
+			s.event("stopped", StoppedEventBody{Reason: reason, ThreadID: threadID, AllThreadsStopped: true, HitBreakpointIDs: hits})
+		})
+		s.debugger.setBreakpoints(s.breakpoints[filepath.Clean(args.Program)])
+	}
+	return nil
+}
+
+// sets the breakpoints of a file. Clients may set them before launching
+// the program, so they are kept for every file and the ones of other
+// files never hit.
+func (s *server) setBreakpoints(args *SetBreakpointsArguments) []Breakpoint {
+	kept := []*breakpoint{}
+	breakpoints := []Breakpoint{}
+	for _, sb := range args.Breakpoints {
+		s.nextID++
+		bp := Breakpoint{ID: s.nextID, Verified: true, Line: sb.Line, Source: &args.Source}
+
+		b := &breakpoint{id: bp.ID, line: sb.Line}
+		if sb.Condition != "" {
+			condition, err := parseExpression(sb.Condition)
+			if err != nil {
+				bp.Verified, bp.Message = false, "invalid condition: "+err.Error()
+				breakpoints = append(breakpoints, bp)
+				continue
+			}
+			b.condition = condition
+		}
+
+		kept = append(kept, b)
+		breakpoints = append(breakpoints, bp)
+	}
+
+	path := filepath.Clean(args.Source.Path)
+	s.breakpoints[path] = kept
+	if s.debugger != nil && path == filepath.Clean(s.launch.Program) {
+		s.debugger.setBreakpoints(kept)
+	}
+	return breakpoints
+}
+
+// runs the program once it is launched and the client configured it
+func (s *server) start() {
+	if s.launch == nil || !s.configured || s.done != nil {
+		return
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	s.cancel, s.done = cancel, make(chan struct{})
+	opts := mist.Options{
+		Stdout: &output{s, "stdout"},
+		Stderr: &output{s, "stderr"},
+		File:   s.launch.Program,
+	}
+	if s.debugger != nil {
+		opts.Hook = s.debugger
+	}
+
+	go func() {
+		defer close(s.done)
+		// like the command line, the program runs by calling main
+		code := s.source + "\nmain();"
+		_, err := mist.New(opts).Run(ctx, code)
+
+		exitCode := 0
+		if err != nil {
+			exitCode = 1
+			var buf bytes.Buffer
+			var mistErr *mist.Error
+			if errors.As(err, &mistErr) {
+				for _, d := range mistErr.Diagnostics {
+					diagnostic.Render(&buf, d, code, false)
+				}
+			} else {
+				fmt.Fprintln(&buf, err)
+			}
+			s.event("output", OutputEventBody{Category: "stderr", Output: buf.String()})
+		}
+		s.event("exited", ExitedEventBody{ExitCode: exitCode})
+		s.event("terminated", nil)
+	}()
+}
+
+// stops the program and waits for it to end
+func (s *server) stop() {
+	if s.done == nil {
+		return
+	}
+	s.cancel()
+	if s.debugger != nil {
+		s.debugger.terminate()
+	}
+	<-s.done
+}
+
+// the output of the program, sent as output events
+type output struct {
+	s        *server
+	category string
+}
+
+func (o *output) Write(p []byte) (int, error) {
+	o.s.event("output", OutputEventBody{Category: o.category, Output: string(p)})
+	return len(p), nil
+}
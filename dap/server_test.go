@@ -0,0 +1,436 @@
+package dap
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"lang/wire"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// a scripted client, talking to a server running Serve over pipes
+type client struct {
+	t        *testing.T
+	in       *io.PipeWriter
+	messages chan map[string]json.RawMessage
+	done     chan error
+	seq      int
+	// events received while waiting for something else
+	events []map[string]json.RawMessage
+}
+
+func newClient(t *testing.T) *client {
+	serverIn, in := io.Pipe()
+	out, serverOut := io.Pipe()
+	c := &client{t: t, in: in, messages: make(chan map[string]json.RawMessage, 100), done: make(chan error, 1)}
+
+	go func() {
+		err := Serve(serverIn, serverOut)
+		serverOut.Close()
+		c.done <- err
+	}()
+	// the program sends events while the client waits for responses, so
+	// they are read as soon as they are written
+	go func() {
+		r := bufio.NewReader(out)
+		for {
+			body, err := wire.Read(r)
+			if err != nil {
+				close(c.messages)
+				return
+			}
+			var message map[string]json.RawMessage
+			if err := json.Unmarshal(body, &message); err != nil {
+				t.Errorf("invalid message %s: %s", body, err)
+			}
+			c.messages <- message
+		}
+	}()
+	return c
+}
+
+func (c *client) next() map[string]json.RawMessage {
+	c.t.Helper()
+	select {
+	case message, ok := <-c.messages:
+		if !ok {
+			c.t.Fatal("server closed the connection")
+		}
+		return message
+	case <-time.After(5 * time.Second):
+		c.t.Fatal("timed out waiting for the server")
+		return nil
+	}
+}
+
+// sends a request and returns its response, failing unless it succeeded
+func (c *client) request(command string, arguments interface{}) map[string]json.RawMessage {
+	c.t.Helper()
+	response := c.try(command, arguments)
+	if string(response["success"]) != "true" {
+		c.t.Fatalf("%s failed: %s", command, response["message"])
+	}
+	return response
+}
+
+// sends a request and returns its response
+func (c *client) try(command string, arguments interface{}) map[string]json.RawMessage {
+	c.t.Helper()
+	c.seq++
+	message := map[string]interface{}{"seq": c.seq, "type": "request", "command": command, "arguments": arguments}
+	if err := wire.Write(c.in, message); err != nil {
+		c.t.Fatalf("send: %s", err)
+	}
+
+	for {
+		message := c.next()
+		if string(message["type"]) == `"response"` && string(message["request_seq"]) == jsonString(c.seq) {
+			return message
+		}
+		if string(message["type"]) == `"event"` {
+			c.events = append(c.events, message)
+		}
+	}
+}
+
+// sends a request and decodes the body of its response into v
+func (c *client) call(command string, arguments interface{}, v interface{}) {
+	c.t.Helper()
+	response := c.request(command, arguments)
+	if err := json.Unmarshal(response["body"], v); err != nil {
+		c.t.Fatalf("%s: %s", command, err)
+	}
+}
+
+// waits for the event name and decodes its body into v, v may be nil
+func (c *client) event(name string, v interface{}) {
+	c.t.Helper()
+	for {
+		var message map[string]json.RawMessage
+		if len(c.events) > 0 {
+			message, c.events = c.events[0], c.events[1:]
+		} else {
+			message = c.next()
+		}
+		if string(message["type"]) != `"event"` || string(message["event"]) != jsonString(name) {
+			continue
+		}
+		if v != nil {
+			if err := json.Unmarshal(message["body"], v); err != nil {
+				c.t.Fatal(err)
+			}
+		}
+		return
+	}
+}
+
+func jsonString(v interface{}) string {
+	bytes, _ := json.Marshal(v)
+	return string(bytes)
+}
+
+// writes program to a file and launches it with breakpoints
+func (c *client) launch(program string, stopOnEntry bool, breakpoints ...SourceBreakpoint) string {
+	c.t.Helper()
+	path := filepath.Join(c.t.TempDir(), "main.rs")
+	if err := os.WriteFile(path, []byte(program), 0o644); err != nil {
+		c.t.Fatal(err)
+	}
+
+	c.request("initialize", map[string]interface{}{"adapterID": "mist"})
+	c.event("initialized", nil)
+	c.request("launch", LaunchArguments{Program: path, StopOnEntry: stopOnEntry})
+	c.request("setBreakpoints", SetBreakpointsArguments{Source: Source{Path: path}, Breakpoints: breakpoints})
+	c.request("configurationDone", nil)
+	return path
+}
+
+// waits for the program to stop and returns why and where
+func (c *client) stopped() (string, StackFrame) {
+	c.t.Helper()
+	var stopped StoppedEventBody
+	c.event("stopped", &stopped)
+
+	var trace StackTraceResponseBody
+	c.call("stackTrace", map[string]int{"threadId": threadID}, &trace)
+	if len(trace.StackFrames) == 0 {
+		c.t.Fatal("stopped without frames")
+	}
+	return stopped.Reason, trace.StackFrames[0]
+}
+
+// the variables of a frame by name, from every scope of it
+func (c *client) variables(frame int) map[string]Variable {
+	c.t.Helper()
+	var scopes ScopesResponseBody
+	c.call("scopes", ScopesArguments{FrameID: frame}, &scopes)
+
+	variables := map[string]Variable{}
+	for i := len(scopes.Scopes) - 1; i >= 0; i-- {
+		var body VariablesResponseBody
+		c.call("variables", VariablesArguments{VariablesReference: scopes.Scopes[i].VariablesReference}, &body)
+		for _, v := range body.Variables {
+			variables[v.Name] = v
+		}
+	}
+	return variables
+}
+
+// the output of the program until it exits, and its exit code
+func (c *client) exited() (string, int) {
+	c.t.Helper()
+	var output strings.Builder
+	for {
+		var message map[string]json.RawMessage
+		if len(c.events) > 0 {
+			message, c.events = c.events[0], c.events[1:]
+		} else {
+			message = c.next()
+		}
+
+		switch string(message["event"]) {
+		case `"output"`:
+			var body OutputEventBody
+			json.Unmarshal(message["body"], &body)
+			output.WriteString(body.Output)
+		case `"exited"`:
+			var body ExitedEventBody
+			json.Unmarshal(message["body"], &body)
+			return output.String(), body.ExitCode
+		}
+	}
+}
+
+func (c *client) disconnect() {
+	c.t.Helper()
+	c.request("disconnect", nil)
+	select {
+	case err := <-c.done:
+		if err != nil {
+			c.t.Errorf("serve: %s", err)
+		}
+	case <-time.After(5 * time.Second):
+		c.t.Fatal("timed out waiting for the server to end")
+	}
+}
+
+const program = `fn add(a: Int, b: Int) Int {
+    let sum: Int = a + b;
+    return sum;
+}
+
+fn main() {
+    let xs: List<Int> = [1, 2];
+    let mut i: Int = 0;
+    while (i < 3) {
+        i = add(i, 1);
+    }
+    println(i);
+}
+`
+
+func TestBreakpoints(t *testing.T) {
+	c := newClient(t)
+	c.launch(program, false, SourceBreakpoint{Line: 10, Condition: "i == 2"}, SourceBreakpoint{Line: 12})
+
+	reason, frame := c.stopped()
+	if reason != "breakpoint" || frame.Name != "main" || frame.Line != 10 {
+		t.Fatalf("expected to stop at the breakpoint in main on line 10, got %s in %s on line %d", reason, frame.Name, frame.Line)
+	}
+
+	variables := c.variables(frame.ID)
+	if variables["i"].Value != "2" || variables["i"].Type != "INTEGER" {
+		t.Errorf("expected i to be 2, got %+v", variables["i"])
+	}
+	if variables["xs"].Value != "[1, 2]" || variables["xs"].VariablesReference == 0 {
+		t.Errorf("expected xs to be an expandable [1, 2], got %+v", variables["xs"])
+	}
+	if _, ok := variables["add"]; !ok {
+		t.Errorf("expected the globals to have add, got %+v", variables)
+	}
+
+	var elements VariablesResponseBody
+	c.call("variables", VariablesArguments{VariablesReference: variables["xs"].VariablesReference}, &elements)
+	expected := []Variable{{Name: "0", Value: "1", Type: "INTEGER"}, {Name: "1", Value: "2", Type: "INTEGER"}}
+	if !reflect.DeepEqual(elements.Variables, expected) {
+		t.Errorf("expected the elements of xs %+v, got %+v", expected, elements.Variables)
+	}
+
+	var result EvaluateResponseBody
+	c.call("evaluate", EvaluateArguments{Expression: "add(i, 10) * 2"}, &result)
+	if result.Result != "24" {
+		t.Errorf("expected add(i, 10) * 2 to be 24, got %q", result.Result)
+	}
+	if response := c.try("evaluate", EvaluateArguments{Expression: "nope + 1"}); string(response["success"]) != "false" {
+		t.Errorf("expected evaluating an unknown name to fail, got %s", response["body"])
+	}
+
+	c.request("continue", map[string]int{"threadId": threadID})
+	reason, frame = c.stopped()
+	if reason != "breakpoint" || frame.Line != 12 {
+		t.Fatalf("expected to stop at the breakpoint on line 12, got %s on line %d", reason, frame.Line)
+	}
+
+	c.request("continue", map[string]int{"threadId": threadID})
+	output, code := c.exited()
+	if output != "3\n" || code != 0 {
+		t.Errorf("expected the program to print 3 and exit with 0, got %q and %d", output, code)
+	}
+	c.event("terminated", nil)
+	c.disconnect()
+}
+
+// the statements of a loop on a single line run again on every pass,
+// and so do the breakpoints on that line
+func TestBreakpointInLoop(t *testing.T) {
+	c := newClient(t)
+	c.launch("fn main() {\n    let mut i: Int = 0;\n    while (i < 3) { i += 1; }\n    println(i);\n}\n", false,
+		SourceBreakpoint{Line: 3, Condition: "i == 2"})
+
+	reason, frame := c.stopped()
+	if reason != "breakpoint" || frame.Line != 3 {
+		t.Fatalf("expected to stop at the breakpoint on line 3, got %s on line %d", reason, frame.Line)
+	}
+	if variables := c.variables(frame.ID); variables["i"].Value != "2" {
+		t.Errorf("expected i to be 2, got %+v", variables["i"])
+	}
+
+	c.request("continue", map[string]int{"threadId": threadID})
+	if output, code := c.exited(); output != "3\n" || code != 0 {
+		t.Errorf("expected the program to print 3 and exit with 0, got %q and %d", output, code)
+	}
+	c.disconnect()
+}
+
+// a breakpoint stops once for its line, not once for each statement on
+// it, unless the line runs again
+func TestBreakpointStopsOncePerLine(t *testing.T) {
+	c := newClient(t)
+	c.launch("fn main() {\n    let a: Int = 1; let b: Int = 2;\n    let mut i: Int = 0;\n    while (i < 2) { i += 1; }\n    println(a + b + i);\n}\n", false,
+		SourceBreakpoint{Line: 2}, SourceBreakpoint{Line: 4})
+
+	for _, line := range []int{2, 4, 4} {
+		reason, frame := c.stopped()
+		if reason != "breakpoint" || frame.Line != line {
+			t.Fatalf("expected to stop at the breakpoint on line %d, got %s on line %d", line, reason, frame.Line)
+		}
+		c.request("continue", map[string]int{"threadId": threadID})
+	}
+	if output, code := c.exited(); output != "5\n" || code != 0 {
+		t.Errorf("expected the program to print 5 and exit with 0, got %q and %d", output, code)
+	}
+	c.disconnect()
+}
+
+func TestStepping(t *testing.T) {
+	type step struct {
+		command  string
+		reason   string
+		function string
+		line     int
+		depth    int
+	}
+	steps := []step{
+		{"", "entry", "<program>", 1, 1},
+		{"stepIn", "step", "<program>", 6, 1},
+		// the call of main appended to the program has no frame
+		{"stepIn", "step", "main", 7, 1},
+		{"next", "step", "main", 8, 1},
+		{"next", "step", "main", 9, 1},
+		{"next", "step", "main", 10, 1},
+		{"stepIn", "step", "add", 2, 2},
+		{"next", "step", "add", 3, 2},
+		{"stepOut", "step", "main", 10, 1},
+		{"next", "step", "main", 10, 1},
+		{"next", "step", "main", 12, 1},
+	}
+
+	c := newClient(t)
+	c.launch(program, true)
+	for i, s := range steps {
+		if s.command != "" {
+			c.request(s.command, map[string]int{"threadId": threadID})
+		}
+
+		reason, frame := c.stopped()
+		var trace StackTraceResponseBody
+		c.call("stackTrace", map[string]int{"threadId": threadID}, &trace)
+		if reason != s.reason || frame.Name != s.function || frame.Line != s.line || len(trace.StackFrames) != s.depth {
+			t.Fatalf("case %d: expected %s in %s on line %d with %d frames, got %s in %s on line %d with %d frames",
+				i, s.reason, s.function, s.line, s.depth, reason, frame.Name, frame.Line, len(trace.StackFrames))
+		}
+	}
+
+	c.request("continue", map[string]int{"threadId": threadID})
+	if output, code := c.exited(); output != "3\n" || code != 0 {
+		t.Errorf("expected the program to print 3 and exit with 0, got %q and %d", output, code)
+	}
+	c.disconnect()
+}
+
+func TestPause(t *testing.T) {
+	c := newClient(t)
+	c.launch("fn main() {\n    println(\"started\");\n    let mut i: Int = 0;\n    while (true) {\n        i += 1;\n    }\n}\n", false)
+
+	// once it printed, the program is in the loop or about to be
+	c.event("output", nil)
+	c.request("pause", map[string]int{"threadId": threadID})
+	reason, frame := c.stopped()
+	if reason != "pause" || frame.Name != "main" || frame.Line < 3 {
+		t.Fatalf("expected to pause in main after line 2, got %s in %s on line %d", reason, frame.Name, frame.Line)
+	}
+	if response := c.try("continue", nil); string(response["success"]) != "true" {
+		t.Errorf("continue failed: %s", response["message"])
+	}
+	if response := c.try("stepIn", nil); string(response["success"]) != "false" {
+		t.Error("expected stepping a running program to fail")
+	}
+
+	// disconnecting stops the program, even one that never ends
+	c.disconnect()
+}
+
+func TestErrors(t *testing.T) {
+	c := newClient(t)
+	c.launch("fn main() {\n    let xs: List<Int> = [1];\n    println(xs[5]);\n}\n", false, SourceBreakpoint{Line: 2, Condition: "xs +"})
+
+	output, code := c.exited()
+	if code != 1 || !strings.Contains(output, "out of range") {
+		t.Errorf("expected the program to fail with an index out of range, got %q and %d", output, code)
+	}
+	c.disconnect()
+}
+
+func TestInvalidCondition(t *testing.T) {
+	c := newClient(t)
+	c.request("initialize", nil)
+
+	var body SetBreakpointsResponseBody
+	c.call("setBreakpoints", SetBreakpointsArguments{
+		Source:      Source{Path: "main.rs"},
+		Breakpoints: []SourceBreakpoint{{Line: 1, Condition: "x +"}, {Line: 2, Condition: "x > 1"}},
+	}, &body)
+	if len(body.Breakpoints) != 2 || body.Breakpoints[0].Verified || !body.Breakpoints[1].Verified {
+		t.Errorf("expected only the breakpoint with a valid condition to be verified, got %+v", body.Breakpoints)
+	}
+	if response := c.try("stackTrace", nil); string(response["success"]) != "false" {
+		t.Error("expected a stack trace without a program to fail")
+	}
+	c.disconnect()
+}
+
+// a header the server can't trust ends it with an error, instead of a
+// crash or a huge allocation
+func TestInvalidContentLength(t *testing.T) {
+	for _, length := range []string{"-5", "99999999999"} {
+		err := Serve(strings.NewReader("Content-Length: "+length+"\r\n\r\n{}"), io.Discard)
+		if err == nil {
+			t.Errorf("expected an error for Content-Length %s", length)
+		}
+	}
+}
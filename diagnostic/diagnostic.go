@@ -0,0 +1,123 @@
+// Package diagnostic describes the problems found in a program, from a
+// character the lexer doesn't know to an error raised while it runs. The
+// lexer, parser, checker and evaluator all report them, and Render prints
+// them the way rustc does.
+package diagnostic
+
+import (
+	"fmt"
+	"sort"
+)
+
+type Severity string
+
+const (
+	Error   Severity = "error"
+	Warning Severity = "warning"
+)
+
+// codes of the diagnostics, grouped by the stage that reports them
+const (
+	// lexer
+	UnexpectedCharacter = "E0001"
+	UnterminatedString  = "E0002"
+
+	// parser
+	UnexpectedToken       = "E0100"
+	InvalidAssignment     = "E0101"
+	InvalidNumber         = "E0102"
+	TypeParameters        = "E0103"
+	LowercaseName         = "E0104"
+	DuplicateVariant      = "E0105"
+	ExpectedPattern       = "E0106"
+	OutsideLoop           = "E0107"
+	BreakValueOutsideLoop = "E0108"
+	ExpectedExpression    = "E0109"
+	NestedTest            = "E0110"
+	NestedDeclaration     = "E0111"
+	ExpectedDeclaration   = "E0112"
+	InvalidModuleName     = "E0113"
+
+	// checker
+	TypeError   = "E0200"
+	TypeWarning = "W0200"
+
+	// evaluator
+	RuntimeError  = "E0300"
+	LimitExceeded = "E0301"
+
+	// module loader
+	ModuleNotFound = "E0400"
+	ImportCycle    = "E0401"
+)
+
+// Position in the source, rows and columns start at 1
+type Position struct {
+	Row    int `json:"row"`
+	Column int `json:"column"`
+}
+
+// Span is the source from Start up to, but not including, End. A span
+// whose End is not after Start points at the single character at Start.
+type Span struct {
+	Start Position `json:"start"`
+	End   Position `json:"end"`
+}
+
+// SpanOf is the span of the length characters at row and column
+func SpanOf(row, column, length int) Span {
+	if length < 1 {
+		length = 1
+	}
+	return Span{Start: Position{row, column}, End: Position{row, column + length}}
+}
+
+// Fix suggests replacing the source of Span with Replacement, an empty
+// span inserts it at Span.Start
+type Fix struct {
+	Message     string `json:"message"`
+	Span        Span   `json:"span"`
+	Replacement string `json:"replacement"`
+}
+
+type Diagnostic struct {
+	File     string   `json:"file,omitempty"`
+	Span     Span     `json:"span"`
+	Severity Severity `json:"severity"`
+	Code     string   `json:"code"`
+	Message  string   `json:"message"`
+	Notes    []string `json:"notes,omitempty"`
+	Fixes    []Fix    `json:"fixes,omitempty"`
+}
+
+func New(severity Severity, code string, span Span, format string, a ...interface{}) Diagnostic {
+	return Diagnostic{
+		Span:     span,
+		Severity: severity,
+		Code:     code,
+		Message:  fmt.Sprintf(format, a...),
+	}
+}
+
+// String is the "[row,col] message" form errors had before diagnostics
+func (d Diagnostic) String() string {
+	return fmt.Sprintf("[%d,%d] %s", d.Span.Start.Row, d.Span.Start.Column, d.Message)
+}
+
+// Sort orders diagnostics by where they start, keeping the order of
+// the ones that start at the same place
+func Sort(diagnostics []Diagnostic) {
+	sort.SliceStable(diagnostics, func(i, j int) bool {
+		a, b := diagnostics[i].Span.Start, diagnostics[j].Span.Start
+		return a.Row < b.Row || a.Row == b.Row && a.Column < b.Column
+	})
+}
+
+// Strings are the "[row,col] message" forms of diagnostics
+func Strings(diagnostics []Diagnostic) []string {
+	msgs := []string{}
+	for _, d := range diagnostics {
+		msgs = append(msgs, d.String())
+	}
+	return msgs
+}
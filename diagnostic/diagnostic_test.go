@@ -0,0 +1,140 @@
+package diagnostic
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestRender(t *testing.T) {
+	source := "fn main() {\n  let x: Int = (1;\n  let y = [\n    1,\n  ];\n}"
+
+	tests := []struct {
+		diagnostic Diagnostic
+		expected   string
+	}{
+		{
+			Diagnostic{
+				File:     "main.rs",
+				Span:     SpanOf(2, 17, 1),
+				Severity: Error,
+				Code:     UnexpectedToken,
+				Message:  "expected next token to be ), got ;",
+				Fixes:    []Fix{{Message: "insert `)`", Span: Span{Position{2, 18}, Position{2, 18}}, Replacement: ")"}},
+			},
+			`error[E0100]: expected next token to be ), got ;
+ --> main.rs:2:17
+  |
+2 |   let x: Int = (1;
+  |                 ^
+  = help: insert ` + "`)`" + `
+`,
+		},
+		{
+			Diagnostic{
+				Span:     Span{Position{3, 11}, Position{5, 4}},
+				Severity: Warning,
+				Code:     TypeWarning,
+				Message:  "list without a type",
+				Notes:    []string{"lists spanning lines are underlined on every line"},
+			},
+			`warning[W0200]: list without a type
+ --> 3:11
+  |
+3 |   let y = [
+  |           ^
+4 |     1,
+  | ^^^^^^
+5 |   ];
+  | ^^^
+  = note: lists spanning lines are underlined on every line
+`,
+		},
+		{
+			// spans past the end of the source are cut to it
+			Diagnostic{Span: SpanOf(9, 1, 1), Severity: Error, Message: "unexpected end"},
+			`error: unexpected end
+ --> 9:1
+`,
+		},
+	}
+
+	for i, test := range tests {
+		var out strings.Builder
+		Render(&out, test.diagnostic, source, false)
+		if out.String() != test.expected {
+			t.Errorf("case %d: expected\n%s\ngot\n%s", i, test.expected, out.String())
+		}
+	}
+}
+
+// carets go under characters, not bytes, and keep the tabs of the line
+func TestRenderCharacters(t *testing.T) {
+	tests := []struct {
+		source   string
+		span     Span
+		expected string
+	}{
+		{`let s: String = "üüü"; println(s + 1);`, SpanOf(1, 37, 1), "1 | " + `let s: String = "üüü"; println(s + 1);` + "\n  | " + strings.Repeat(" ", 33) + "^\n"},
+		{`"üü" + 1`, SpanOf(1, 1, 6), "1 | " + `"üü" + 1` + "\n  | ^^^^\n"},
+		{"\tx + 1", SpanOf(1, 4, 1), "1 | \tx + 1\n  | \t  ^\n"},
+		{"é", SpanOf(1, 3, 2), "1 | é\n  |  ^^\n"},
+	}
+
+	for i, test := range tests {
+		var out strings.Builder
+		Render(&out, Diagnostic{Span: test.span, Severity: Error, Message: "failed"}, test.source, false)
+		if lines := strings.SplitN(out.String(), "\n", 4); lines[3] != test.expected {
+			t.Errorf("case %d: expected\n%s\ngot\n%s", i, test.expected, lines[3])
+		}
+	}
+}
+
+func TestRenderColor(t *testing.T) {
+	var out strings.Builder
+	Render(&out, New(Error, RuntimeError, SpanOf(1, 1, 1), "failed"), "x", true)
+	if !strings.HasPrefix(out.String(), red+"error[E0300]"+reset) {
+		t.Errorf("expected a red header, got %q", out.String())
+	}
+}
+
+func TestJSON(t *testing.T) {
+	d := New(Error, LowercaseName, SpanOf(1, 8, 5), "struct names must start with an uppercase letter, got %s", "point")
+	d.File = "main.rs"
+	d.Fixes = []Fix{{Message: "rename it to `Point`", Span: d.Span, Replacement: "Point"}}
+
+	bytes, err := json.Marshal(d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `{"file":"main.rs","span":{"start":{"row":1,"column":8},"end":{"row":1,"column":13}},` +
+		`"severity":"error","code":"E0104","message":"struct names must start with an uppercase letter, got point",` +
+		`"fixes":[{"message":"rename it to ` + "`Point`" + `","span":{"start":{"row":1,"column":8},"end":{"row":1,"column":13}},"replacement":"Point"}]}`
+	if string(bytes) != expected {
+		t.Errorf("expected %s, got=%s", expected, bytes)
+	}
+
+	var decoded Diagnostic
+	if err := json.Unmarshal(bytes, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if decoded.String() != d.String() || decoded.Fixes[0] != d.Fixes[0] {
+		t.Errorf("expected %v, got=%v", d, decoded)
+	}
+}
+
+func TestSort(t *testing.T) {
+	diagnostics := []Diagnostic{
+		New(Error, TypeError, SpanOf(2, 1, 1), "c"),
+		New(Error, TypeError, SpanOf(1, 5, 1), "b"),
+		New(Error, TypeError, SpanOf(1, 1, 1), "a"),
+		New(Error, TypeError, SpanOf(2, 1, 1), "d"),
+	}
+	Sort(diagnostics)
+
+	expected := []string{"[1,1] a", "[1,5] b", "[2,1] c", "[2,1] d"}
+	got := Strings(diagnostics)
+	if strings.Join(got, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("expected %q, got=%q", expected, got)
+	}
+}
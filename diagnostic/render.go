@@ -0,0 +1,136 @@
+package diagnostic
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// ansi escapes used when rendering in color
+const (
+	reset  = "\033[0m"
+	bold   = "\033[1m"
+	red    = "\033[1;31m"
+	yellow = "\033[1;33m"
+	blue   = "\033[1;34m"
+)
+
+// Render prints d with the lines of source it points at, like rustc:
+//
+//	error[E0100]: expected next token to be ), got ;
+//	 --> main.rs:1:9
+//	  |
+//	1 | let x = (1;
+//	  |          ^
+//	  = help: insert `)`
+func Render(w io.Writer, d Diagnostic, source string, color bool) {
+	paint := func(style, text string) string {
+		if !color {
+			return text
+		}
+		return style + text + reset
+	}
+
+	accent := red
+	if d.Severity == Warning {
+		accent = yellow
+	}
+
+	header := string(d.Severity)
+	if d.Code != "" {
+		header += "[" + d.Code + "]"
+	}
+	fmt.Fprintf(w, "%s%s\n", paint(accent, header), paint(bold, ": "+d.Message))
+
+	start, end := d.Span.Start, d.Span.End
+	lines := strings.Split(source, "\n")
+	if end.Row < start.Row || end.Row == start.Row && end.Column <= start.Column {
+		end = Position{start.Row, start.Column + 1}
+	}
+	if end.Row > len(lines) {
+		end = Position{len(lines), len(lines[len(lines)-1]) + 1}
+	}
+
+	gutter := strings.Repeat(" ", len(strconv.Itoa(end.Row)))
+	bar := paint(blue, gutter+" |")
+
+	location := fmt.Sprintf("%d:%d", start.Row, start.Column)
+	if d.File != "" {
+		location = d.File + ":" + location
+	}
+	fmt.Fprintf(w, "%s %s\n", paint(blue, gutter+"-->"), location)
+
+	if start.Row >= 1 && start.Row <= len(lines) {
+		fmt.Fprintln(w, bar)
+		for row := start.Row; row <= end.Row; row++ {
+			line := lines[row-1]
+			fmt.Fprintf(w, "%s %s\n", paint(blue, fmt.Sprintf("%*d |", len(gutter), row)), line)
+
+			// every line of the span is underlined, from where the span
+			// starts on the first one up to where it ends on the last one
+			from, to := 1, len(line)+1
+			if row == start.Row {
+				from = start.Column
+			}
+			if row == end.Row {
+				to = end.Column
+			}
+			if to <= from {
+				to = from + 1
+			}
+			if from < 1 {
+				from = 1
+			}
+			fmt.Fprintf(w, "%s %s%s\n", bar, indent(line, from), paint(accent, strings.Repeat("^", width(line, from, to))))
+		}
+	}
+
+	for _, note := range d.Notes {
+		fmt.Fprintf(w, "%s %s\n", paint(blue, gutter+" ="), paint(bold, "note: ")+note)
+	}
+	for _, fix := range d.Fixes {
+		fmt.Fprintf(w, "%s %s\n", paint(blue, gutter+" ="), paint(bold, "help: ")+fix.Message)
+	}
+}
+
+// the blanks that put a caret under the character at byte column of
+// line, one per character before it and tabs kept as tabs so the caret
+// lines up however wide the terminal shows them
+func indent(line string, column int) string {
+	var b strings.Builder
+	for _, r := range clip(line, column) {
+		if r == '\t' {
+			b.WriteRune('\t')
+		} else {
+			b.WriteRune(' ')
+		}
+	}
+	if column-1 > len(line) {
+		b.WriteString(strings.Repeat(" ", column-1-len(line)))
+	}
+	return b.String()
+}
+
+// the number of characters from byte column from up to column to of
+// line, counting the columns past its end as one each
+func width(line string, from, to int) int {
+	n := utf8.RuneCountInString(clip(line, to)) - utf8.RuneCountInString(clip(line, from))
+	past := from - 1
+	if past < len(line) {
+		past = len(line)
+	}
+	if to-1 > past {
+		n += to - 1 - past
+	}
+	return n
+}
+
+// line up to byte column, not included
+func clip(line string, column int) string {
+	if column-1 > len(line) {
+		return line
+	}
+	return line[:column-1]
+}
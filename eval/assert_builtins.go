@@ -0,0 +1,169 @@
+package eval
+
+import (
+	"lang/object"
+	"strconv"
+	"strings"
+)
+
+// assertions fail with the values they compared on the lines after the
+// message, Diagnostic turns those lines into notes
+
+// assert(cond) and assert(cond, message)
+func assertFn(budget *object.Budget, row *int, column *int, args ...object.Object) object.Object {
+	if len(args) != 1 && len(args) != 2 {
+		return newError(*row, *column, "assert expected 1 or 2 arguments, got %d", len(args))
+	}
+
+	cond, ok := args[0].(*object.Boolean)
+	if !ok {
+		return newError(*row, *column, "assert expected a BOOLEAN, got %s", args[0].Type())
+	}
+	if cond.Value {
+		return NULL
+	}
+	return newError(*row, *column, "%s", assertionMessage(args[1:], ""))
+}
+
+// assert_eq(left, right) and assert_eq(left, right, message)
+func assertEqFn(budget *object.Budget, row *int, column *int, args ...object.Object) object.Object {
+	return assertCompare(row, column, "assert_eq", "==", true, args)
+}
+
+// assert_ne(left, right) and assert_ne(left, right, message)
+func assertNeFn(budget *object.Budget, row *int, column *int, args ...object.Object) object.Object {
+	return assertCompare(row, column, "assert_ne", "!=", false, args)
+}
+
+func assertCompare(row *int, column *int, name, operator string, equal bool, args []object.Object) object.Object {
+	if len(args) != 2 && len(args) != 3 {
+		return newError(*row, *column, "%s expected 2 or 3 arguments, got %d", name, len(args))
+	}
+
+	left, right := args[0], args[1]
+	if valuesEqual(left, right) == equal {
+		return NULL
+	}
+	return newError(*row, *column, "%s\n  left: %s\n right: %s",
+		assertionMessage(args[2:], "left "+operator+" right"), showValue(left), showValue(right))
+}
+
+// assert_error(fn) calls fn and fails unless fn fails, returning the
+// error message. assert_error(fn, text) also expects the message to
+// contain text.
+func assertErrorFn(budget *object.Budget, row *int, column *int, args ...object.Object) object.Object {
+	if len(args) != 1 && len(args) != 2 {
+		return newError(*row, *column, "assert_error expected 1 or 2 arguments, got %d", len(args))
+	}
+
+	var contains *object.String
+	if len(args) == 2 {
+		text, ok := args[1].(*object.String)
+		if !ok {
+			return newError(*row, *column, "assert_error expected a STRING, got %s", args[1].Type())
+		}
+		contains = text
+	}
+
+	result := callFunction(budget, args[0], []object.Object{}, row, column)
+	err, ok := result.(*object.Error)
+	if !ok {
+		return newError(*row, *column, "assertion failed: expected an error\n   got: %s", showValue(result))
+	}
+	// errors that stop the program aren't for tests to expect
+	if err.Fatal {
+		return err
+	}
+	if contains != nil && !strings.Contains(err.Inspect(), contains.Value) {
+		return newError(*row, *column, "assertion failed: expected an error containing %s\n   got: %s",
+			strconv.Quote(contains.Value), strconv.Quote(err.Inspect()))
+	}
+	return newString(err.Inspect())
+}
+
+// what a failed assertion says, the message given to it or else what it
+// expected
+func assertionMessage(message []object.Object, expected string) string {
+	if len(message) == 1 {
+		if text, ok := message[0].(*object.String); ok {
+			expected = text.Value
+		} else {
+			expected = message[0].Inspect()
+		}
+	}
+	if expected == "" {
+		return "assertion failed"
+	}
+	return "assertion failed: " + expected
+}
+
+// values as written in a program, strings are quoted so "1" and 1 or
+// trailing spaces are told apart
+func showValue(value object.Object) string {
+	if s, ok := value.(*object.String); ok {
+		return strconv.Quote(s.Value)
+	}
+	return value.Inspect()
+}
+
+// structural equality, lists, maps, structs and enum values are equal
+// when their elements are
+func valuesEqual(left, right object.Object) bool {
+	switch left := left.(type) {
+	case *object.Integer, *object.Float, *object.String:
+		return literalEquals(left, right)
+	case *object.Boolean:
+		r, ok := right.(*object.Boolean)
+		return ok && r.Value == left.Value
+	case *object.Null:
+		_, ok := right.(*object.Null)
+		return ok
+	case *object.List:
+		r, ok := right.(*object.List)
+		if !ok || len(r.Elements) != len(left.Elements) {
+			return false
+		}
+		for i, element := range left.Elements {
+			if !valuesEqual(element, r.Elements[i]) {
+				return false
+			}
+		}
+		return true
+	case *object.Map:
+		r, ok := right.(*object.Map)
+		if !ok || len(r.Pairs) != len(left.Pairs) {
+			return false
+		}
+		for key, pair := range left.Pairs {
+			other, ok := r.Pairs[key]
+			if !ok || !valuesEqual(pair.Value, other.Value) {
+				return false
+			}
+		}
+		return true
+	case *object.Struct:
+		r, ok := right.(*object.Struct)
+		if !ok || r.Definition.Name != left.Definition.Name {
+			return false
+		}
+		for name, value := range left.Fields {
+			if !valuesEqual(value, r.Fields[name]) {
+				return false
+			}
+		}
+		return true
+	case *object.EnumValue:
+		r, ok := right.(*object.EnumValue)
+		if !ok || r.Definition.Name != left.Definition.Name || r.Variant != left.Variant || len(r.Values) != len(left.Values) {
+			return false
+		}
+		for i, value := range left.Values {
+			if !valuesEqual(value, r.Values[i]) {
+				return false
+			}
+		}
+		return true
+	default:
+		return left == right
+	}
+}
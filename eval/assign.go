@@ -0,0 +1,127 @@
+package eval
+
+import (
+	"lang/ast"
+	"lang/object"
+)
+
+func evalAssignStatement(node *ast.AssignStatement, scope *object.Scope) object.Object {
+	name, targets := ast.AssignTarget(node.Target)
+
+	declared, mutable, ok := scope.Mutability(name.Value)
+	if !ok {
+		if _, builtin := scope.Builtin(name.Value); !builtin {
+			return newError(name.Token.Row, name.Token.Column, "%s is not defined", name.Value)
+		}
+	}
+	if !mutable {
+		return ImmutableError(name.Value, &name.Token.Row, &name.Token.Column)
+	}
+
+	current, _ := scope.Get(name.Value)
+	indexes := []object.Object{}
+	for _, target := range targets {
+		index := Eval(target.Index, scope)
+		if isAbrupt(index) {
+			return index
+		}
+		indexes = append(indexes, index)
+	}
+
+	value := Eval(node.Value, scope)
+	if isAbrupt(value) {
+		return value
+	}
+
+	value = Assign(scope.Budget(), node, current, indexes, value)
+	if isAbrupt(value) {
+		return value
+	}
+
+	if err := LetTypeError(value, declared, &node.Token.Row, &node.Token.Column); err != nil {
+		return err
+	}
+
+	scope.Assign(name.Value, value)
+	return NULL
+}
+
+func ImmutableError(name string, row, column *int) *object.Error {
+	return newError(*row, *column, "cannot assign to immutable variable %s", name)
+}
+
+// Assign is the value an assignment leaves in its variable, given the
+// variable's current value and the evaluated indexes of the target.
+// Collections are copied rather than changed in place, so other
+// variables holding them keep their elements.
+func Assign(budget *object.Budget, node *ast.AssignStatement, current object.Object, indexes []object.Object, value object.Object) object.Object {
+	_, targets := ast.AssignTarget(node.Target)
+	return assign(budget, node, targets, current, indexes, value)
+}
+
+func assign(
+	budget *object.Budget,
+	node *ast.AssignStatement,
+	targets []*ast.IndexExpression,
+	current object.Object,
+	indexes []object.Object,
+	value object.Object,
+) object.Object {
+	if len(targets) == 0 {
+		if node.Operator == "" {
+			return value
+		}
+		return evalInfixExpression(budget, node.Operator, current, value, &node.Token.Row, &node.Token.Column)
+	}
+
+	target := targets[0]
+	var element object.Object = NULL
+	// x[i] = v doesn't read x[i], so it can add keys to maps
+	if len(targets) > 1 || node.Operator != "" {
+		element = evalIndexExpression(current, indexes[0], &target.Token.Row, &target.Token.Column)
+		if isAbrupt(element) {
+			return element
+		}
+	}
+
+	element = assign(budget, node, targets[1:], element, indexes[1:], value)
+	if isAbrupt(element) {
+		return element
+	}
+	return setIndex(current, indexes[0], element, &target.Token.Row, &target.Token.Column)
+}
+
+func setIndex(container, index, value object.Object, row, column *int) object.Object {
+	switch container := container.(type) {
+	case *object.List:
+		idx, ok := index.(*object.Integer)
+		if !ok {
+			break
+		}
+
+		if idx.Value < 0 || idx.Value >= int64(len(container.Elements)) {
+			return newError(*row, *column, "index %d out of range, len = %d", idx.Value, len(container.Elements))
+		}
+
+		elements := make([]object.Object, len(container.Elements))
+		copy(elements, container.Elements)
+		elements[idx.Value] = value
+		return newList(elements)
+	case *object.Map:
+		key, ok := index.(object.Hashable)
+		if !ok {
+			return newError(*row, *column, "can't use %s as hash key", index.Type())
+		}
+
+		pairs := make(map[object.MapKey]object.MapPair, len(container.Pairs)+1)
+		for k, pair := range container.Pairs {
+			pairs[k] = pair
+		}
+		pairs[key.MapKey()] = object.MapPair{Key: index, Value: value}
+		return newMap(pairs)
+	case *object.String:
+		return newError(*row, *column, "strings are immutable, their characters can't be assigned to")
+	}
+
+	return newError(*row, *column, "index operator is not defined over %ss", container.Type())
+}
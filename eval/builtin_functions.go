@@ -2,45 +2,45 @@ package eval
 
 import (
 	"fmt"
-	"io/ioutil"
+	"io"
 	"lang/object"
 	"math"
-	"os"
+	"unicode/utf8"
 )
 
-var Stdout *os.File
-
-type singleton struct {
-	builtins map[string]*object.BuiltinFunc
-}
-
-var single singleton
-
-func initBuiltins() map[string]*object.BuiltinFunc {
-	if single.builtins == nil {
-		single.builtins = map[string]*object.BuiltinFunc{
-			"len":     {Fn: lenFn},
-			"max":     {Fn: maxFn},
-			"print":   {Fn: printFn},
-			"println": {Fn: printlnFn},
-			"range":   {Fn: rangeFn},
-			"string":  {Fn: convertToStringFn},
-		}
-	}
-	return single.builtins
-}
-
-func SetupStdout() *os.File {
-	if Stdout == nil {
-		Stdout, _ = ioutil.TempFile("/tmp", "")
+// NewBuiltins returns a fresh table of the builtin functions, print and
+// println write to stdout, eprint and eprintln to stderr. Every
+// interpreter owns its table, so programs running side by side don't
+// share their output.
+func NewBuiltins(stdout, stderr io.Writer) map[string]object.Object {
+	return map[string]object.Object{
+		"len":          &object.BuiltinFunc{Fn: lenFn},
+		"max":          &object.BuiltinFunc{Fn: maxFn},
+		"print":        &object.BuiltinFunc{Fn: printFn(stdout)},
+		"println":      &object.BuiltinFunc{Fn: printlnFn(stdout)},
+		"eprint":       &object.BuiltinFunc{Fn: printFn(stderr)},
+		"eprintln":     &object.BuiltinFunc{Fn: printlnFn(stderr)},
+		"range":        &object.BuiltinFunc{Fn: rangeFn},
+		"string":       &object.BuiltinFunc{Fn: convertToStringFn},
+		"catch":        &object.BuiltinFunc{Fn: catchFn},
+		"from_entries": &object.BuiltinFunc{Fn: fromEntriesFn},
+		"assert":       &object.BuiltinFunc{Fn: assertFn},
+		"assert_eq":    &object.BuiltinFunc{Fn: assertEqFn},
+		"assert_ne":    &object.BuiltinFunc{Fn: assertNeFn},
+		"assert_error": &object.BuiltinFunc{Fn: assertErrorFn},
+		"Option":       OptionType,
+		"Result":       ResultType,
+		"Some":         &object.BuiltinFunc{Fn: someFn},
+		"None":         NONE,
+		"Ok":           &object.BuiltinFunc{Fn: okFn},
+		"Err":          &object.BuiltinFunc{Fn: errFn},
 	}
-	return Stdout
 }
 
-func maxFn(row *int, column *int, args ...object.Object) object.Object {
+func maxFn(budget *object.Budget, row *int, column *int, args ...object.Object) object.Object {
 	if len(args) == 0 {
 		return newError(
-			"[%d,%d] max expected at least 1 argument, got=%d", *row, *column, len(args))
+			*row, *column, "max expected at least 1 argument, got=%d", len(args))
 	}
 
 	currentType := args[0].Type()
@@ -51,23 +51,27 @@ func maxFn(row *int, column *int, args ...object.Object) object.Object {
 		case *object.Integer:
 			if obj.Type() != currentType {
 				return newError(
-					"[%d,%d] max expected all arguments to be of same type, found %s and %s", *row, *column, currentType, obj.Type())
+					*row, *column, "max expected all arguments to be of same type, found %s and %s", currentType, obj.Type())
 			}
 			if obj.Value > int64(maxValue) {
 				maxValue = float64(obj.Value)
 			}
 		case *object.Float:
 			if obj.Type() != currentType {
-				return newError("[%d,%d] max expected all arguments to be of same type, found %s and %s", *row, *column, currentType, obj.Type())
+				return newError(*row, *column, "max expected all arguments to be of same type, found %s and %s", currentType, obj.Type())
 			}
 			if obj.Value > maxValue {
 				maxValue = obj.Value
 			}
-		case *object.List:
-			return maxFn(row, column, obj.Elements...)
+		case *object.List, *object.Range, *object.Iterator:
+			elements, err, _ := listValues(budget, obj, row, column)
+			if err != nil {
+				return err
+			}
+			return maxFn(budget, row, column, elements...)
 		default:
 			return newError(
-				"[%d,%d] max expected arguments to be of type INTEGER or FLOAT, found %s", *row, *column, obj.Type())
+				*row, *column, "max expected arguments to be of type INTEGER or FLOAT, found %s", obj.Type())
 		}
 	}
 	if currentType == object.INTEGER_OBJ {
@@ -77,63 +81,74 @@ func maxFn(row *int, column *int, args ...object.Object) object.Object {
 	}
 }
 
-func lenFn(row *int, column *int, args ...object.Object) object.Object {
+func lenFn(budget *object.Budget, row *int, column *int, args ...object.Object) object.Object {
 	if len(args) != 1 {
-		return newError("[%d,%d] expected %d arguments, got %d", *row, *column, 1, len(args))
+		return newError(*row, *column, "expected %d arguments, got %d", 1, len(args))
 	}
 	switch arg := args[0].(type) {
 	case *object.List:
 		return &object.Integer{Value: int64(len(arg.Elements))}
 	case *object.String:
-		return &object.Integer{Value: int64(len(arg.Value))}
+		return &object.Integer{Value: int64(utf8.RuneCountInString(arg.Value))}
 	case *object.Map:
 		return &object.Integer{Value: int64(len(arg.Pairs))}
+	case *object.Range:
+		return &object.Integer{Value: rangeCount(arg)}
+	case *object.Iterator:
+		n, err := countValues(budget, arg, row, column)
+		if err != nil {
+			return err
+		}
+		return &object.Integer{Value: n}
 	default:
-		return newError("[%d,%d] built-in function `len` is not defined on %ss", *row, *column, arg.Type())
+		return newError(*row, *column, "built-in function `len` is not defined on %ss", arg.Type())
 	}
 }
 
-func printFn(row *int, column *int, args ...object.Object) object.Object {
-	for _, arg := range args {
-		Stdout.WriteString(arg.Inspect())
+func printFn(out io.Writer) object.BuiltinFunction {
+	return func(budget *object.Budget, row *int, column *int, args ...object.Object) object.Object {
+		for _, arg := range args {
+			io.WriteString(out, arg.Inspect())
+		}
+		return NULL
 	}
-	return NULL
 }
 
-func printlnFn(row *int, column *int, args ...object.Object) object.Object {
-	printFn(row, column, args...)
-	Stdout.Write([]byte{'\n'})
-	return NULL
+func printlnFn(out io.Writer) object.BuiltinFunction {
+	write := printFn(out)
+	return func(budget *object.Budget, row *int, column *int, args ...object.Object) object.Object {
+		write(budget, row, column, args...)
+		io.WriteString(out, "\n")
+		return NULL
+	}
 }
 
-func rangeFn(row *int, column *int, args ...object.Object) object.Object {
-	if len(args) == 0 {
+// range(a, b) is the integers from a to b, b included, like a..=b but
+// with the eager map and filter of the list it used to return
+func rangeFn(budget *object.Budget, row *int, column *int, args ...object.Object) object.Object {
+	if len(args) != 2 {
 		return newError(
-			"[%d,%d] range expected 2 arguments, got=%d", *row, *column, len(args))
+			*row, *column, "range expected 2 arguments, got=%d", len(args))
 	}
 
 	arg1, ok1 := args[0].(*object.Integer)
 	arg2, ok2 := args[1].(*object.Integer)
 	if !ok1 || !ok2 {
 		return newError(
-			"[%d,%d] range expected arguments to be of type INTEGER, got=%s and %s",
 			*row,
 			*column,
+			"range expected arguments to be of type INTEGER, got=%s and %s",
 			args[0].Type(),
 			args[1].Type(),
 		)
 	}
 
-	var newElements []object.Object
-	for i := arg1.Value; i <= arg2.Value; i++ {
-		newElements = append(newElements, &object.Integer{Value: i})
-	}
-	return newList(newElements)
+	return newListRange(arg1.Value, arg2.Value)
 }
 
-func convertToStringFn(row *int, column *int, args ...object.Object) object.Object {
+func convertToStringFn(budget *object.Budget, row *int, column *int, args ...object.Object) object.Object {
 	if len(args) != 1 {
-		return newError("[%d,%d] string expected %d argument, got %d", *row, *column, 1, len(args))
+		return newError(*row, *column, "string expected %d argument, got %d", 1, len(args))
 	}
 	switch arg := args[0].(type) {
 	case *object.Integer:
@@ -143,6 +158,6 @@ func convertToStringFn(row *int, column *int, args ...object.Object) object.Obje
 	case *object.Boolean:
 		return newString(fmt.Sprintf("%t", arg.Value))
 	default:
-		return newError("[%d,%d] string can't convert value of type %s", *row, *column, arg.Type())
+		return newError(*row, *column, "string can't convert value of type %s", arg.Type())
 	}
 }
@@ -4,21 +4,101 @@ import (
 	"lang/object"
 )
 
+// the methods of lists, maps and strings, shared by all of them
+var (
+	listMethods   = map[string]object.BuiltinMethod{}
+	mapMethods    = map[string]object.BuiltinMethod{}
+	stringMethods = map[string]object.BuiltinMethod{}
+)
+
+func init() {
+	listMethods["map"] = listMap
+	listMethods["max"] = listMax
+	listMethods["len"] = listLen
+	listMethods["reverse"] = listReverse
+	listMethods["slice"] = listSlice
+	listMethods["filter"] = listFilter
+	listMethods["update"] = listUpdate
+	listMethods["get"] = listGet
+	listMethods["join"] = listJoin
+	listMethods["fold"] = listFold
+	listMethods["reduce"] = listReduce
+	listMethods["sum"] = listSum
+	listMethods["min"] = listMin
+	listMethods["sort"] = listSort
+	listMethods["sort_by"] = listSortBy
+	listMethods["zip"] = listZip
+	listMethods["iter"] = iteratorIter
+	listMethods["enumerate"] = listEnumerate
+	listMethods["flat_map"] = listFlatMap
+	listMethods["flatten"] = listFlatten
+	listMethods["find"] = listFind
+	listMethods["index_of"] = listIndexOf
+	listMethods["contains"] = listContains
+	listMethods["any"] = listAny
+	listMethods["all"] = listAll
+	listMethods["count"] = listCount
+	listMethods["take"] = listTake
+	listMethods["drop"] = listDrop
+	listMethods["take_while"] = listTakeWhile
+	listMethods["chunk"] = listChunk
+	listMethods["window"] = listWindow
+	listMethods["group_by"] = listGroupBy
+	listMethods["unique"] = listUnique
+	listMethods["push"] = listPush
+	listMethods["pop"] = listPop
+	listMethods["first"] = listFirst
+	listMethods["last"] = listLast
+
+	mapMethods["len"] = mapLen
+	mapMethods["keys"] = mapKeys
+	mapMethods["values"] = mapValues
+	mapMethods["entries"] = mapEntries
+	mapMethods["to_list"] = mapToList
+	mapMethods["has"] = mapHas
+	mapMethods["get"] = mapGet
+	mapMethods["set"] = mapSet
+	mapMethods["insert"] = mapInsert
+	mapMethods["remove"] = mapRemove
+	mapMethods["merge"] = mapMerge
+	mapMethods["map_values"] = mapMapValues
+	mapMethods["filter"] = mapFilter
+	mapMethods["iter"] = iteratorIter
+
+	stringMethods["otherwise"] = stringOtherwise
+	stringMethods["len"] = stringLen
+	stringMethods["chars"] = stringChars
+	stringMethods["bytes"] = stringBytes
+	stringMethods["split"] = stringSplit
+	stringMethods["lines"] = stringLines
+	stringMethods["trim"] = stringTrim
+	stringMethods["trim_start"] = stringTrimStart
+	stringMethods["trim_end"] = stringTrimEnd
+	stringMethods["upper"] = stringUpper
+	stringMethods["lower"] = stringLower
+	stringMethods["contains"] = stringContains
+	stringMethods["starts_with"] = stringStartsWith
+	stringMethods["ends_with"] = stringEndsWith
+	stringMethods["find"] = stringFind
+	stringMethods["replace"] = stringReplace
+	stringMethods["repeat"] = stringRepeat
+	stringMethods["pad_left"] = stringPadLeft
+	stringMethods["pad_right"] = stringPadRight
+	stringMethods["parse_int"] = stringParseInt
+	stringMethods["parse_float"] = stringParseFloat
+	stringMethods["iter"] = iteratorIter
+
+	registerIteratorMethods()
+}
+
 func newList(elements []object.Object) *object.List {
-	l := &object.List{Elements: elements}
-	l.SetMethods("map", listMap)
-	l.SetMethods("max", listMax)
-	l.SetMethods("len", listLen)
-	l.SetMethods("reverse", listReverse)
-	l.SetMethods("slice", listSlice)
-	l.SetMethods("filter", listFilter)
-	l.SetMethods("update", listUpdate)
-	return l
+	return &object.List{Elements: elements, Methods: listMethods}
+}
+
+func newMap(pairs map[object.MapKey]object.MapPair) *object.Map {
+	return &object.Map{Pairs: pairs, Methods: mapMethods}
 }
 
 func newString(value string) *object.String {
-	s := &object.String{Value: value}
-	// s.SetMethods("len", stringLen)
-	s.SetMethods("otherwise", stringOtherwise)
-	return s
+	return &object.String{Value: value, Methods: stringMethods}
 }
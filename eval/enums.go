@@ -0,0 +1,196 @@
+package eval
+
+import (
+	"lang/ast"
+	"lang/object"
+	"strconv"
+)
+
+func evalEnumStatement(node *ast.EnumStatement, scope *object.Scope) object.Object {
+	scope.Set(node.Name.Value, &object.EnumType{Name: node.Name.Value, Variants: node.Variants})
+	return NULL
+}
+
+// Variant is the value of Shape::Circle, unit variants are values of
+// the enum, variants with a payload are functions that build them
+func Variant(def *object.EnumType, name string, row, column *int) object.Object {
+	variant := def.Variant(name)
+	if variant == nil {
+		return newError(*row, *column, "enum %s has no variant %s", def.Name, name)
+	}
+
+	if len(variant.Fields) == 0 {
+		return &object.EnumValue{Definition: def, Variant: name}
+	}
+
+	path := def.Name + "::" + name
+	return &object.BuiltinFunc{Fn: func(budget *object.Budget, row, column *int, args ...object.Object) object.Object {
+		if len(args) != len(variant.Fields) {
+			return newError(*row, *column, "variant %s expected %d arguments, got %d",
+				path, len(variant.Fields), len(args))
+		}
+
+		for i, arg := range args {
+			field := &ast.Identifier{Value: strconv.Itoa(i), Type: variant.Fields[i]}
+			if err := FieldTypeError(arg, field, path, row, column); err != nil {
+				return err
+			}
+		}
+		return &object.EnumValue{Definition: def, Variant: name, Values: args}
+	}}
+}
+
+func evalMatchExpression(node *ast.MatchExpression, scope *object.Scope) object.Object {
+	subject := Eval(node.Subject, scope)
+	if isAbrupt(subject) {
+		return subject
+	}
+
+	for _, arm := range node.Arms {
+		enums := map[string]object.Object{}
+		for _, name := range ast.Enums(arm.Pattern) {
+			enum := evalIdentifier(name, scope, &name.Token.Row, &name.Token.Column)
+			if isAbrupt(enum) {
+				return enum
+			}
+			enums[name.Value] = enum
+		}
+
+		bindings, ok, err := MatchPattern(arm.Pattern, subject, enums)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			continue
+		}
+
+		armScope := object.NewInnerScope(scope)
+		for i, name := range ast.Bindings(arm.Pattern) {
+			armScope.Set(name.Value, bindings[i])
+		}
+
+		if arm.Guard != nil {
+			guard := Eval(arm.Guard, armScope)
+			if isAbrupt(guard) {
+				return guard
+			}
+			if !isTruthy(guard) {
+				continue
+			}
+		}
+
+		if result := evalBlockStatements(arm.Body, armScope); result != nil {
+			return result
+		}
+		return NULL
+	}
+
+	return NoMatchError(subject, &node.Token.Row, &node.Token.Column)
+}
+
+func NoMatchError(subject object.Object, row, column *int) *object.Error {
+	return newError(*row, *column, "no match arm matches %s", subject.Inspect())
+}
+
+// MatchPattern matches value against pattern, returning the values of
+// the names the pattern binds in the order of ast.Bindings. enums holds
+// the value of every enum named by the pattern.
+func MatchPattern(pattern ast.Pattern, value object.Object, enums map[string]object.Object) ([]object.Object, bool, *object.Error) {
+	switch pattern := pattern.(type) {
+	case *ast.WildcardPattern:
+		return []object.Object{}, true, nil
+	case *ast.BindingPattern:
+		return []object.Object{value}, true, nil
+	case *ast.LiteralPattern:
+		expected := Eval(pattern.Value, nil)
+		if err, ok := expected.(*object.Error); ok {
+			return nil, false, err
+		}
+		return []object.Object{}, literalEquals(expected, value), nil
+	case *ast.ListPattern:
+		return matchListPattern(pattern, value, enums)
+	case *ast.VariantPattern:
+		return matchVariantPattern(pattern, value, enums)
+	default:
+		return nil, false, nil
+	}
+}
+
+func matchListPattern(pattern *ast.ListPattern, value object.Object, enums map[string]object.Object) ([]object.Object, bool, *object.Error) {
+	list, ok := value.(*object.List)
+	if !ok {
+		return nil, false, nil
+	}
+
+	n := len(pattern.Elements)
+	if len(list.Elements) < n || !pattern.HasRest && len(list.Elements) != n {
+		return nil, false, nil
+	}
+
+	bindings := []object.Object{}
+	for i, element := range pattern.Elements {
+		values, ok, err := MatchPattern(element, list.Elements[i], enums)
+		if err != nil || !ok {
+			return nil, false, err
+		}
+		bindings = append(bindings, values...)
+	}
+
+	if pattern.Rest != nil {
+		rest := make([]object.Object, len(list.Elements)-n)
+		copy(rest, list.Elements[n:])
+		bindings = append(bindings, newList(rest))
+	}
+	return bindings, true, nil
+}
+
+func matchVariantPattern(pattern *ast.VariantPattern, value object.Object, enums map[string]object.Object) ([]object.Object, bool, *object.Error) {
+	def, ok := enums[pattern.Enum.Value].(*object.EnumType)
+	if !ok {
+		return nil, false, newError(pattern.Token.Row, pattern.Token.Column, "%s is not an enum",
+			pattern.Enum.Value)
+	}
+
+	variant := def.Variant(pattern.Variant.Value)
+	if variant == nil {
+		return nil, false, newError(pattern.Variant.Token.Row, pattern.Variant.Token.Column, "enum %s has no variant %s",
+			def.Name, pattern.Variant.Value)
+	}
+
+	if len(pattern.Fields) != len(variant.Fields) {
+		return nil, false, newError(pattern.Token.Row, pattern.Token.Column, "pattern %s::%s expected %d fields, got %d",
+			def.Name, variant.Name.Value,
+			len(variant.Fields), len(pattern.Fields))
+	}
+
+	instance, ok := value.(*object.EnumValue)
+	if !ok || instance.Definition != def || instance.Variant != variant.Name.Value {
+		return nil, false, nil
+	}
+
+	bindings := []object.Object{}
+	for i, field := range pattern.Fields {
+		values, ok, err := MatchPattern(field, instance.Values[i], enums)
+		if err != nil || !ok {
+			return nil, false, err
+		}
+		bindings = append(bindings, values...)
+	}
+	return bindings, true, nil
+}
+
+func literalEquals(expected, value object.Object) bool {
+	switch expected := expected.(type) {
+	case *object.Integer:
+		v, ok := value.(*object.Integer)
+		return ok && v.Value == expected.Value
+	case *object.Float:
+		v, ok := value.(*object.Float)
+		return ok && v.Value == expected.Value
+	case *object.String:
+		v, ok := value.(*object.String)
+		return ok && v.Value == expected.Value
+	default:
+		return expected == value
+	}
+}
@@ -3,9 +3,11 @@ package eval
 import (
 	"fmt"
 	"lang/ast"
+	"lang/code"
 	"lang/object"
 	"lang/token"
 	"math"
+	"unicode/utf8"
 )
 
 var (
@@ -15,31 +17,48 @@ var (
 )
 
 func Eval(node ast.Node, scope *object.Scope) object.Object {
+	result := evalNode(node, scope)
+	if err, ok := result.(*object.Error); ok && err.Length == 0 {
+		spanError(err, node)
+	}
+	return result
+}
+
+func evalNode(node ast.Node, scope *object.Scope) object.Object {
 	switch node := node.(type) {
 	case *ast.Program:
 		return evalProgram(node, scope)
 	case *ast.LetStatement:
 		return evalLetStatement(node, scope, &node.Token.Row, &node.Token.Column)
+	case *ast.AssignStatement:
+		return evalAssignStatement(node, scope)
 	case *ast.Function:
 		params := node.Parameters
 		body := node.Body
-		function := &object.Function{Name: node.Name, Parameters: params, Scope: scope, Body: body, ReturnType: node.ReturnType()}
+		function := &object.Function{Name: node.Name, Parameters: params, Scope: scope, Body: body, ReturnType: node.Type}
 		scope.Set(node.Name.Value, function)
 		return function
 	case *ast.FunctionLiteral:
 		params := node.Parameters
 		body := node.Body
-		return &object.Function{Parameters: params, Scope: scope, Body: body, ReturnType: node.ReturnType()}
+		return &object.Function{
+			Parameters: params,
+			Scope:      scope,
+			Body:       body,
+			ReturnType: node.Type,
+			Position:   code.Position{Row: node.Token.Row, Column: node.Token.Column},
+		}
 	case *ast.CallExpression:
 		function := Eval(node.Function, scope)
-		if isError(function) {
+		if isAbrupt(function) {
 			return function
 		}
 		args := evalExpressions(node.Arguments, scope)
-		if len(args) == 1 && isError(args[0]) {
+		if len(args) == 1 && isAbrupt(args[0]) {
 			return args[0]
 		}
-		return callFunction(function, args, &node.Token.Row, &node.Token.Column)
+		result := callFunction(scope.Budget(), function, args, &node.Token.Row, &node.Token.Column)
+		return checkSize(scope, result, node.Token.Row, node.Token.Column)
 	case *ast.Identifier:
 		return evalIdentifier(node, scope, &node.Token.Row, &node.Token.Column)
 	case *ast.ExpressionStatement:
@@ -54,51 +73,104 @@ func Eval(node ast.Node, scope *object.Scope) object.Object {
 		return &object.Float{Value: node.Value}
 	case *ast.PrefixExpression:
 		right := Eval(node.Right, scope)
-		if isError(right) {
+		if isAbrupt(right) {
 			return right
 		}
 		return evalPrefixExpression(node.Operator, right, &node.Token.Row, &node.Token.Column)
 	case *ast.InfixExpression:
 		left := Eval(node.Left, scope)
-		if isError(left) {
+		if isAbrupt(left) {
 			return left
 		}
 		right := Eval(node.Right, scope)
-		if isError(right) {
+		if isAbrupt(right) {
 			return right
 		}
-		return evalInfixExpression(node.Operator, left, right, &node.Token.Row, &node.Token.Column)
+		result := evalInfixExpression(scope.Budget(), node.Operator, left, right, &node.Token.Row, &node.Token.Column)
+		return checkSize(scope, result, node.Token.Row, node.Token.Column)
 	case *ast.IfExpression:
 		return evalIfExpression(node, scope)
 	case *ast.BlockStatement:
 		return evalBlockStatements(node, object.NewInnerScope(scope))
 	case *ast.ListLiteral:
 		elements := evalExpressions(node.Elements, scope)
-		if len(elements) == 1 && isError(elements[0]) {
+		if len(elements) == 1 && isAbrupt(elements[0]) {
 			return elements[0]
 		}
-		return newList(elements)
+		return checkSize(scope, newList(elements), node.Token.Row, node.Token.Column)
 	case *ast.ReturnStatement:
 		val := Eval(node.ReturnValue, scope)
-		if isError(val) {
+		if isAbrupt(val) {
 			return val
 		}
 		return &object.ReturnValue{Value: val}
 	case *ast.IndexExpression:
 		left := Eval(node.Left, scope)
-		if isError(left) {
+		if isAbrupt(left) {
 			return left
 		}
+		if node.Slice {
+			return evalSlice(node, left, scope)
+		}
 		index := Eval(node.Index, scope)
-		if isError(index) {
+		if isAbrupt(index) {
 			return index
 		}
 		return evalIndexExpression(left, index, &node.Token.Row, &node.Token.Column)
+	case *ast.RangeExpression:
+		start := Eval(node.Start, scope)
+		if isAbrupt(start) {
+			return start
+		}
+		end := Eval(node.End, scope)
+		if isAbrupt(end) {
+			return end
+		}
+		return evalRangeExpression(start, end, node.Inclusive, &node.Token.Row, &node.Token.Column)
 	case *ast.AccessExpression:
 		structure := Eval(node.Struct, scope)
+		if isAbrupt(structure) {
+			return structure
+		}
 		return evalAccessExpression(structure, node.Attribute, &node.Token.Row, &node.Token.Column)
+	case *ast.TryExpression:
+		return evalTryExpression(node, scope)
 	case *ast.MapLiteral:
-		return evalMapLiteral(node, scope, &node.Token.Row, &node.Token.Column)
+		result := evalMapLiteral(node, scope, &node.Token.Row, &node.Token.Column)
+		return checkSize(scope, result, node.Token.Row, node.Token.Column)
+	case *ast.StructStatement:
+		return evalStructStatement(node, scope)
+	case *ast.ImplStatement:
+		return evalImplStatement(node, scope)
+	case *ast.StructLiteral:
+		return evalStructLiteral(node, scope)
+	case *ast.EnumStatement:
+		return evalEnumStatement(node, scope)
+	case *ast.MatchExpression:
+		return evalMatchExpression(node, scope)
+	case *ast.WhileStatement:
+		return evalWhileStatement(node, scope)
+	case *ast.ForStatement:
+		return evalForStatement(node, scope)
+	case *ast.LoopExpression:
+		return evalLoopExpression(node, scope)
+	case *ast.BreakStatement:
+		if node.Value == nil {
+			return &object.Break{Value: NULL}
+		}
+		val := Eval(node.Value, scope)
+		if isAbrupt(val) {
+			return val
+		}
+		return &object.Break{Value: val}
+	case *ast.ContinueStatement:
+		return &object.Continue{}
+	case *ast.TestStatement:
+		// tests only run under mist test
+		return NULL
+	case *ast.UseStatement:
+		// the host binds modules before the program runs
+		return NULL
 	default:
 		return NULL
 	}
@@ -107,6 +179,11 @@ func Eval(node ast.Node, scope *object.Scope) object.Object {
 func evalProgram(program *ast.Program, scope *object.Scope) object.Object {
 	var result object.Object
 	for _, statement := range program.Statements {
+		if hook := scope.Hook(); hook != nil {
+			if err := hook.Statement(statement, scope); err != nil {
+				return err
+			}
+		}
 		result = Eval(statement, scope)
 
 		switch result := result.(type) {
@@ -132,17 +209,19 @@ func evalLetStatement(
 	column *int,
 ) object.Object {
 	val := Eval(node.Value, scope)
-	if isError(val) {
+	if isAbrupt(val) {
 		return val
 	}
 
-	t := object.MapTypeToObject(node.Name.ReturnType())
-	if t != val.Type() {
-		return newError("[%d,%d] type mismatch, expected value of type %s to be of type %s",
-			*row, *column, val.Type(), t)
+	if err := LetTypeError(val, node.Name.Type, row, column); err != nil {
+		return err
 	}
 
-	scope.Set(node.Name.Value, val)
+	if node.Mutable {
+		scope.SetMutable(node.Name.Value, val, node.Name.Type)
+	} else {
+		scope.Set(node.Name.Value, val)
+	}
 	return NULL
 }
 
@@ -150,11 +229,16 @@ func evalBlockStatements(block *ast.BlockStatement, scope *object.Scope) object.
 	var result object.Object
 
 	for _, statement := range block.Statements {
+		if hook := scope.Hook(); hook != nil {
+			if err := hook.Statement(statement, scope); err != nil {
+				return err
+			}
+		}
 		result = Eval(statement, scope)
 
 		if result != nil {
 			rt := result.Type()
-			if rt == object.RETURN_OBJ || rt == object.ERROR_OBJ {
+			if rt == object.RETURN_OBJ || rt == object.ERROR_OBJ || rt == object.BREAK_OBJ || rt == object.CONTINUE_OBJ {
 				return result
 			}
 		}
@@ -184,9 +268,9 @@ func evalPrefixExpression(
 		return evalMinusOperatorExpression(right, row, column)
 	default:
 		return newError(
-			"[%d,%d] operator %s is not recognized as a prefix",
 			*row,
 			*column,
+			"operator %s is not recognized as a prefix",
 			operator,
 		)
 	}
@@ -204,6 +288,7 @@ func evalBangOperatorExpression(right object.Object) object.Object {
 }
 
 func evalInfixExpression(
+	budget *object.Budget,
 	operator string,
 	left object.Object,
 	right object.Object,
@@ -229,12 +314,12 @@ func evalInfixExpression(
 		return evalFloatInfixExpression(operator, left, right, row, column)
 	// string and string
 	case left.Type() == object.STRING_OBJ && right.Type() == object.STRING_OBJ:
-		return evalStringInfixExpression(operator, left, right, row, column)
+		return evalStringInfixExpression(budget, operator, left, right, row, column)
 		// string and int
 	case left.Type() == object.STRING_OBJ && right.Type() == object.INTEGER_OBJ:
-		return evalStringIntInfixExpression(operator, left, right, row, column)
+		return evalStringIntInfixExpression(budget, operator, left, right, row, column)
 	case left.Type() == object.INTEGER_OBJ && right.Type() == object.STRING_OBJ:
-		return evalStringIntInfixExpression(operator, left, right, row, column)
+		return evalStringIntInfixExpression(budget, operator, left, right, row, column)
 	// string and bool
 	case left.Type() == object.STRING_OBJ && right.Type() == object.BOOLEAN_OBJ:
 		return evalStringBoolInfixExpression(operator, left, right, row, column)
@@ -242,11 +327,11 @@ func evalInfixExpression(
 		return evalStringBoolInfixExpression(operator, left, right, row, column)
 	// list and list
 	case left.Type() == object.LIST_OBJ && right.Type() == object.LIST_OBJ:
-		return evalListInfixExpression(operator, left, right, row, column)
+		return evalListInfixExpression(budget, operator, left, right, row, column)
 	// error on other
 	default:
-		return newError("[%d,%d] operator %s is not defined over %s and %s",
-			*row, *column, operator, left.Type(), right.Type())
+		return newError(*row, *column, "operator %s is not defined over %s and %s",
+			operator, left.Type(), right.Type())
 	}
 }
 
@@ -266,9 +351,13 @@ func evalIntegerInfixExpression(
 		return &object.Integer{Value: leftVal - rightVal}
 	case token.ASTERISK:
 		return &object.Integer{Value: leftVal * rightVal}
-	case token.SLASH:
-		return &object.Integer{Value: leftVal / rightVal}
-	case token.MOD:
+	case token.SLASH, token.MOD:
+		if rightVal == 0 {
+			return newError(*row, *column, "division by zero")
+		}
+		if operator == token.SLASH {
+			return &object.Integer{Value: leftVal / rightVal}
+		}
 		return &object.Integer{Value: leftVal % rightVal}
 	case token.POWER:
 		return &object.Integer{Value: intPow(leftVal, rightVal)}
@@ -285,9 +374,7 @@ func evalIntegerInfixExpression(
 	case token.GE:
 		return evalBoolean(leftVal >= rightVal)
 	default:
-		return newError("[%d,%d] operator %s is not defined over INTEGERs",
-			*row,
-			*column,
+		return newError(*row, *column, "operator %s is not defined over INTEGERs",
 			operator,
 		)
 	}
@@ -326,9 +413,7 @@ func evalFloatInfixExpression(
 	case token.GE:
 		return evalBoolean(leftVal >= rightVal)
 	default:
-		return newError("[%d,%d] operator %s is not defined over FLOATs",
-			*row,
-			*column,
+		return newError(*row, *column, "operator %s is not defined over FLOATs",
 			operator,
 		)
 	}
@@ -345,7 +430,7 @@ func evalMinusOperatorExpression(right object.Object, row *int, column *int) obj
 	case *object.Float:
 		return &object.Float{Value: -(right.(*object.Float).Value)}
 	default:
-		return newError("[%d,%d] operator %s is not defined over %s", *row, *column, "-", right.Type())
+		return newError(*row, *column, "operator %s is not defined over %s", "-", right.Type())
 	}
 }
 
@@ -368,11 +453,12 @@ func evalBooleanInfixExpression(
 	case "==":
 		return evalBoolean(leftVal == rightVal)
 	default:
-		return newError("[%d,%d] %s is not defined over BOOLEANs", *row, *column, operator)
+		return newError(*row, *column, "%s is not defined over BOOLEANs", operator)
 	}
 }
 
 func evalStringInfixExpression(
+	budget *object.Budget,
 	operator string,
 	left object.Object,
 	right object.Object,
@@ -387,13 +473,17 @@ func evalStringInfixExpression(
 	case "!=":
 		return evalBoolean(leftVal != rightVal)
 	case "+":
+		if err := growthError(budget, object.STRING_OBJ, int64(len(leftVal)+len(rightVal)), *row, *column); err != nil {
+			return err
+		}
 		return newString(leftVal + rightVal)
 	default:
-		return newError("[%d,%d] %s is not defined over STRINGs", *row, *column, operator)
+		return newError(*row, *column, "%s is not defined over STRINGs", operator)
 	}
 }
 
 func evalListInfixExpression(
+	budget *object.Budget,
 	operator string,
 	left object.Object,
 	right object.Object,
@@ -409,13 +499,17 @@ func evalListInfixExpression(
 	// case "!=":
 	// 	return evalBoolean(leftVal != rightVal)
 	case "+":
+		if err := growthError(budget, object.LIST_OBJ, int64(len(leftVal)+len(rightVal)), *row, *column); err != nil {
+			return err
+		}
 		return newList(append(leftVal, rightVal...))
 	default:
-		return newError("[%d,%d] %s is not defined over LISTs", *row, *column, operator)
+		return newError(*row, *column, "%s is not defined over LISTs", operator)
 	}
 }
 
 func evalStringIntInfixExpression(
+	budget *object.Budget,
 	operator string,
 	left object.Object,
 	right object.Object,
@@ -425,26 +519,21 @@ func evalStringIntInfixExpression(
 	leftVal := left.(*object.String).Value
 	rightVal := right.(*object.Integer).Value
 	if rightVal < 0 {
-		return newError("[%d,%d] integer can't be less than 0", *row, *column)
+		return newError(*row, *column, "integer can't be less than 0")
 	}
 
 	if operator != "*" {
 		return newError(
-			"[%d,%d] operator %s is not defined over %s and %s",
 			*row,
 			*column,
+			"operator %s is not defined over %s and %s",
 			operator,
 			left.Type(),
 			right.Type(),
 		)
 	}
 
-	var intermediate string
-	for i := rightVal; i > 0; i-- {
-		intermediate += leftVal
-	}
-
-	return newString(intermediate)
+	return repeatString(budget, leftVal, rightVal, row, column)
 }
 
 func evalStringBoolInfixExpression(
@@ -458,9 +547,9 @@ func evalStringBoolInfixExpression(
 	rightVal := right.(*object.Boolean).Value
 	if operator != "*" {
 		return newError(
-			"[%d,%d] operator %s is not defined over %s and %s",
 			*row,
 			*column,
+			"operator %s is not defined over %s and %s",
 			operator,
 			left.Type(),
 			right.Type(),
@@ -483,15 +572,15 @@ func evalIdentifier(
 	if val, ok := scope.Get(node.Value); ok {
 		return val
 	}
-	if builtin, ok := initBuiltins()[node.Value]; ok {
+	if builtin, ok := scope.Builtin(node.Value); ok {
 		return builtin
 	}
-	return newError("[%d,%d] %s is not defined", *row, *column, node.Value)
+	return newError(*row, *column, "%s is not defined", node.Value)
 }
 
 func evalIfExpression(node *ast.IfExpression, scope *object.Scope) object.Object {
 	condition := Eval(node.Condition, scope)
-	if isError(condition) {
+	if isAbrupt(condition) {
 		return condition
 	}
 
@@ -511,7 +600,7 @@ func evalExpressions(exps []ast.Expression, scope *object.Scope) []object.Object
 
 	for _, e := range exps {
 		evaluated := Eval(e, scope)
-		if isError(evaluated) {
+		if isAbrupt(evaluated) {
 			return []object.Object{evaluated}
 		}
 		result = append(result, evaluated)
@@ -528,13 +617,17 @@ func evalIndexExpression(
 	switch {
 	case left.Type() == object.LIST_OBJ && index.Type() == object.INTEGER_OBJ:
 		return evalListIndexExpression(left, index, row, column)
+	case left.Type() == object.STRING_OBJ && index.Type() == object.INTEGER_OBJ:
+		return evalStringIndexExpression(left, index, row, column)
+	case left.Type() == object.RANGE_OBJ && index.Type() == object.INTEGER_OBJ:
+		return evalRangeIndexExpression(left, index, row, column)
 	case left.Type() == object.MAP_OBJ:
 		return evalMapIndexExpression(left, index, row, column)
 	default:
 		return newError(
-			"[%d,%d] index operator is not defined over %ss",
 			*row,
 			*column,
+			"index operator is not defined over %ss",
 			left.Type(),
 		)
 	}
@@ -548,14 +641,105 @@ func evalListIndexExpression(
 ) object.Object {
 	arrayObject := list.(*object.List)
 	idx := index.(*object.Integer).Value
-	max := int64(len(arrayObject.Elements) - 1)
-
-	if idx < 0 || idx > max {
-		return newError("[%d,%d] index %d out of range, len = %d", *row, *column, idx, max)
+	if idx < 0 || idx >= int64(len(arrayObject.Elements)) {
+		return newError(*row, *column, "index %d out of range, len = %d", idx, len(arrayObject.Elements))
 	}
 	return arrayObject.Elements[idx]
 }
 
+// r[i] is the i-th value of r, found without going through the others
+func evalRangeIndexExpression(
+	r object.Object,
+	index object.Object,
+	row *int,
+	column *int,
+) object.Object {
+	rangeObject := r.(*object.Range)
+	idx := index.(*object.Integer).Value
+	count := rangeCount(rangeObject)
+	if idx < 0 || idx >= count {
+		return newError(*row, *column, "index %d out of range, len = %d", idx, count)
+	}
+	return &object.Integer{Value: rangeObject.Start + idx*rangeObject.Step}
+}
+
+// s[i] is the i-th character of s, not its i-th byte
+func evalStringIndexExpression(
+	str object.Object,
+	index object.Object,
+	row *int,
+	column *int,
+) object.Object {
+	runes := []rune(str.(*object.String).Value)
+	idx := index.(*object.Integer).Value
+
+	if idx < 0 || idx >= int64(len(runes)) {
+		return newError(*row, *column, "index %d out of range, len = %d", idx, len(runes))
+	}
+	return newString(string(runes[idx]))
+}
+
+// evaluates the bounds of xs[start:end], those left out are NULL
+func evalSlice(node *ast.IndexExpression, left object.Object, scope *object.Scope) object.Object {
+	bounds := []object.Object{NULL, NULL}
+	for i, bound := range []ast.Expression{node.Index, node.End} {
+		if bound == nil {
+			continue
+		}
+		bounds[i] = Eval(bound, scope)
+		if isAbrupt(bounds[i]) {
+			return bounds[i]
+		}
+	}
+	return evalSliceExpression(left, bounds[0], bounds[1], &node.Token.Row, &node.Token.Column)
+}
+
+// xs[start:end] copies the elements of a list and s[start:end] the
+// characters of a string from start up to end, which isn't included
+func evalSliceExpression(left, start, end object.Object, row, column *int) object.Object {
+	var length int64
+	switch left := left.(type) {
+	case *object.List:
+		length = int64(len(left.Elements))
+	case *object.String:
+		length = int64(utf8.RuneCountInString(left.Value))
+	default:
+		return newError(*row, *column, "slice operator is not defined over %ss", left.Type())
+	}
+
+	from, err := sliceBound(start, 0, row, column)
+	if err != nil {
+		return err
+	}
+	to, err := sliceBound(end, length, row, column)
+	if err != nil {
+		return err
+	}
+	if from < 0 || to > length || from > to {
+		return newError(*row, *column, "slice [%d:%d] out of range, len = %d", from, to, length)
+	}
+
+	if list, ok := left.(*object.List); ok {
+		elements := make([]object.Object, to-from)
+		copy(elements, list.Elements[from:to])
+		return newList(elements)
+	}
+	runes := []rune(left.(*object.String).Value)
+	return newString(string(runes[from:to]))
+}
+
+// a bound of a slice, missing when it was left out
+func sliceBound(bound object.Object, missing int64, row, column *int) (int64, *object.Error) {
+	switch bound := bound.(type) {
+	case *object.Null:
+		return missing, nil
+	case *object.Integer:
+		return bound.Value, nil
+	default:
+		return 0, newError(*row, *column, "slice bounds must be INTEGERs, got %s", bound.Type())
+	}
+}
+
 func evalAccessExpression(
 	exp object.Object,
 	method string,
@@ -567,9 +751,9 @@ func evalAccessExpression(
 	case *object.List:
 		if fn, ok := t.Methods[method]; !ok {
 			return newError(
-				"[%d,%d] type %s has no method %s",
 				*row,
 				*column,
+				"type %s has no method %s",
 				exp.Type(),
 				method,
 			)
@@ -579,79 +763,113 @@ func evalAccessExpression(
 	case *object.String:
 		if fn, ok := t.Methods[method]; !ok {
 			return newError(
-				"[%d,%d] type %s has no method %s",
 				*row,
 				*column,
+				"type %s has no method %s",
 				exp.Type(),
 				method,
 			)
 		} else {
 			return &object.BuiltinMeth{Fn: fn, Caller: exp}
 		}
+	case *object.Struct:
+		if value, ok := t.Fields[method]; ok {
+			return value
+		}
+		if fn, ok := t.Definition.Methods[method]; ok {
+			return &object.BuiltinMeth{Fn: fn, Caller: exp}
+		}
+		return newError(*row, *column, "type %s has no field or method %s", exp.Type(), method)
+	case *object.StructType:
+		if fn, ok := t.Methods[method]; ok {
+			return &object.BuiltinMeth{Fn: fn, Caller: exp}
+		}
+		return newError(*row, *column, "struct %s has no method %s", t.Name, method)
+	case *object.EnumType:
+		return Variant(t, method, row, column)
+	case *object.Module:
+		if value, ok := t.Exports[method]; ok {
+			return value
+		}
+		return newError(*row, *column, "module %s has no public %s", t.Name, method)
+	case *object.EnumValue:
+		if fn, ok := t.Definition.Methods[method]; ok {
+			return &object.BuiltinMeth{Fn: fn, Caller: exp}
+		}
+		return newError(*row, *column, "type %s has no method %s", exp.Type(), method)
+	case *object.Map:
+		if fn, ok := t.Methods[method]; ok {
+			return &object.BuiltinMeth{Fn: fn, Caller: exp}
+		}
+		return newError(*row, *column, "type %s has no method %s", exp.Type(), method)
+	case *object.Range:
+		if fn, ok := t.Methods[method]; ok {
+			return &object.BuiltinMeth{Fn: fn, Caller: exp}
+		}
+		return newError(*row, *column, "type %s has no method %s", exp.Type(), method)
+	case *object.Iterator:
+		if fn, ok := t.Methods[method]; ok {
+			return &object.BuiltinMeth{Fn: fn, Caller: exp}
+		}
+		return newError(*row, *column, "type %s has no method %s", exp.Type(), method)
 	default:
 		return newError(
-			"[%d,%d] type %s has no method %s",
 			*row,
 			*column,
+			"type %s has no method %s",
 			exp.Type(),
 			method,
 		)
 	}
 }
 
-func callFunction(fn object.Object, args []object.Object, row *int, column *int) object.Object {
+func callFunction(budget *object.Budget, fn object.Object, args []object.Object, row *int, column *int) object.Object {
 	switch function := fn.(type) {
 	case *object.Function:
 		// check number of arguments
 		if len(function.Parameters) != len(args) {
-			return newError("[%d,%d] function %s expected %d arguments, got %d",
-				*row,
-				*column,
+			return newError(*row, *column, "function %s expected %d arguments, got %d",
 				function.Name.Value,
 				len(function.Parameters),
 				len(args))
 		}
 
+		if err := enterCall(function.Scope.Budget(), *row, *column); err != nil {
+			return err
+		}
+		defer leaveCall(function.Scope.Budget())
+
+		if hook := function.Scope.Hook(); hook != nil {
+			hook.Call(FrameName(function.Name, function.Position), *row, *column)
+			defer hook.Return()
+		}
+
 		// check type of each argument
 		extendedScope := newFunctionScope(function, args)
 		for argId, arg := range args {
-			t := object.MapTypeToObject(function.Parameters[argId].ReturnType())
-			if t != arg.Type() {
-				return newError(
-					"[%d,%d] expected argument %d (%s) to be of type %s, got %s",
-					*row,
-					*column,
-					argId,
-					function.Parameters[argId],
-					t,
-					arg.Type(),
-				)
+			if err := ArgumentTypeError(arg, argId, function.Parameters[argId], row, column); err != nil {
+				return err
 			}
 		}
 
 		evaluated := Eval(function.Body, extendedScope)
-		expectedReturn := object.MapTypeToObject(function.ReturnType)
 		returnValue := unWrapReturnValue(evaluated)
-		if isError(returnValue) {
-			return returnValue
+		if err, ok := returnValue.(*object.Error); ok {
+			return WithFrame(err, function.Name, function.Position, function.Scope.File(), *row, *column)
 		}
 
-		if expectedReturn != returnValue.Type() {
-			return newError(
-				"[%d,%d] expected return to be of type %s, found %s",
-				*row,
-				*column,
-				expectedReturn,
-				returnValue.Type(),
-			)
+		if err := ReturnTypeError(returnValue, function.ReturnType, row, column); err != nil {
+			return err
 		}
 		return returnValue
+	case *object.Closure:
+		return function.Call(row, column, args...)
 	case *object.BuiltinFunc:
-		return function.Fn(row, column, args...)
+		return function.Fn(budget, row, column, args...)
 	case *object.BuiltinMeth:
-		return function.Fn(row, column, function.Caller, args...)
+		return function.Fn(budget, row, column, function.Caller, args...)
 	default:
-		return newError("[%d,%d] not a function: %s", *row, *column, fn.Type())
+		return newError(*row, *column, "not a function: %s", fn.Type())
 	}
 }
 
@@ -663,26 +881,26 @@ func evalMapLiteral(
 ) object.Object {
 	pairs := make(map[object.MapKey]object.MapPair)
 
-	for keyNode, valueNode := range node.Pairs {
+	for _, keyNode := range node.Keys() {
 		key := Eval(keyNode, scope)
-		if isError(key) {
+		if isAbrupt(key) {
 			return key
 		}
 
 		mapKey, ok := key.(object.Hashable)
 		if !ok {
-			return newError("[%d,%d] can't use %s as hash key", *row, *column, key.Type())
+			return newError(*row, *column, "can't use %s as hash key", key.Type())
 		}
 
-		value := Eval(valueNode, scope)
-		if isError(value) {
+		value := Eval(node.Pairs[keyNode], scope)
+		if isAbrupt(value) {
 			return value
 		}
 
 		hashed := mapKey.MapKey()
 		pairs[hashed] = object.MapPair{Key: key, Value: value}
 	}
-	return &object.Map{Pairs: pairs}
+	return newMap(pairs)
 }
 
 func evalMapIndexExpression(
@@ -694,7 +912,7 @@ func evalMapIndexExpression(
 	mapObject, _ := mapObj.(*object.Map)
 	key, ok := index.(object.Hashable)
 	if !ok {
-		return newError("[%d,%d] can't use %s as hash key", *row, *column, index.Type())
+		return newError(*row, *column, "can't use %s as hash key", index.Type())
 	}
 
 	pair, ok := mapObject.Pairs[key.MapKey()]
@@ -716,8 +934,9 @@ func isTruthy(condition object.Object) bool {
 	}
 }
 
-func newError(format string, a ...interface{}) *object.Error {
-	return &object.Error{Message: fmt.Sprintf(format, a...)}
+// an error at the token at row and column
+func newError(row, column int, format string, a ...interface{}) *object.Error {
+	return &object.Error{Message: fmt.Sprintf(format, a...), Row: row, Column: column}
 }
 
 func isError(obj object.Object) bool {
@@ -727,6 +946,17 @@ func isError(obj object.Object) bool {
 	return false
 }
 
+// errors and the return, break and continue signals stop evaluating the
+// expressions around them, until the function or loop they target
+func isAbrupt(obj object.Object) bool {
+	switch obj.(type) {
+	case *object.Error, *object.ReturnValue, *object.Break, *object.Continue:
+		return true
+	default:
+		return false
+	}
+}
+
 func newFunctionScope(fn *object.Function, args []object.Object) *object.Scope {
 	scope := object.NewInnerScope(fn.Scope)
 	for paramIndex, param := range fn.Parameters {
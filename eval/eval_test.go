@@ -1,9 +1,12 @@
 package eval
 
 import (
+	"fmt"
+	"io"
 	"lang/lexer"
 	"lang/object"
 	"lang/parser"
+	"strings"
 	"testing"
 )
 
@@ -11,7 +14,7 @@ func testEval(input string) object.Object {
 	l := lexer.NewLexer(input)
 	p := parser.NewParser(l)
 	program := p.Parse()
-	return Eval(program, object.NewScope())
+	return Eval(program, object.NewGlobalScope(NewBuiltins(io.Discard, io.Discard)))
 }
 
 func testInterface(t *testing.T, i int, expected interface{}, obj object.Object) {
@@ -234,6 +237,10 @@ func TestErrorHandling(t *testing.T) {
 		{code: "3 || 8; return 0;", expected: "[1,3] operator || is not defined over INTEGERs"},
 		{code: "someVar;", expected: "[1,1] someVar is not defined"},
 		{code: "len(4)", expected: "[1,4] built-in function `len` is not defined on INTEGERs"},
+		{code: "1 / 0", expected: "[1,3] division by zero"},
+		{code: "let n: Int = 0; 7 % n", expected: "[1,19] division by zero"},
+		{code: "let mut x: Int = 1; x /= 0;", expected: "[1,23] division by zero"},
+		{code: "let mut x: Int = 1; x %= 0;", expected: "[1,23] division by zero"},
 	}
 
 	for i, test := range tests {
@@ -244,8 +251,481 @@ func TestErrorHandling(t *testing.T) {
 			continue
 		}
 
-		if err.Message != test.expected {
-			t.Errorf("case %d: \nexpected error\t%s,\ngot\t\t%s", i, test.expected, err.Message)
+		if err.Inspect() != test.expected {
+			t.Errorf("case %d: \nexpected error\t%s,\ngot\t\t%s", i, test.expected, err.Inspect())
+		}
+	}
+}
+
+func TestParameterizedTypes(t *testing.T) {
+	tests := []struct {
+		code     string
+		expected string
+	}{
+		{
+			code:     `let xs: List<Int> = [1, 2, "three"];`,
+			expected: "[1,1] type mismatch, expected element 2 of type STRING to be of type INTEGER",
+		},
+		{
+			code:     "let xss: List<List<Int>> = [[1], [2, true]];",
+			expected: "[1,1] type mismatch, expected element 1 of element 1 of type BOOLEAN to be of type INTEGER",
+		},
+		{
+			code:     `let m: Map<String, Int> = {"a": 1, "b": 2.5};`,
+			expected: `[1,1] type mismatch, expected value at key "b" of type FLOAT to be of type INTEGER`,
+		},
+		{
+			code:     `let m: Map<String, Int> = {"a": 1, 2: 2};`,
+			expected: "[1,1] type mismatch, expected key 2 of type INTEGER to be of type STRING",
+		},
+		{
+			code:     "let f: Fn(Int) -> Bool = fn(x: String) Bool { true };",
+			expected: "[1,1] type mismatch, expected value of type Fn(String) -> Bool to be of type Fn(Int) -> Bool",
+		},
+		{
+			code:     "fn sum(xs: List<Int>) Int { 0 }; sum([1, 1.5]);",
+			expected: "[1,37] expected element 1 of argument 0 (xs) to be of type INTEGER, got FLOAT",
+		},
+		{
+			code:     `fn names() List<String> { ["a", 1] }; names();`,
+			expected: "[1,44] expected element 1 of return to be of type STRING, found INTEGER",
+		},
+		{
+			code:     `[1, "a"].map(fn(x: Int) Int { x * 2 })`,
+			expected: "[1,13] map expected element 1 to be of type INTEGER, got STRING",
+		},
+		{
+			code:     `[[1], ["a"]].filter(fn(x: List<Int>) Bool { true })`,
+			expected: "[1,20] filter expected element 0 of element 1 to be of type INTEGER, got STRING",
+		},
+	}
+
+	for i, test := range tests {
+		evaluated := testEval(test.code)
+		err, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Errorf("case %d: no error object returned, got=%T (%+v)", i, evaluated, evaluated)
+			continue
+		}
+
+		if err.Inspect() != test.expected {
+			t.Errorf("case %d: \nexpected error\t%s,\ngot\t\t%s", i, test.expected, err.Inspect())
+		}
+	}
+
+	valid := []struct {
+		code     string
+		expected interface{}
+	}{
+		{code: "let xs: List<Int> = [1, 2, 3]; len(xs)", expected: 3},
+		{code: `let m: Map<String, List<Float>> = {"a": [.5]}; m["a"][0]`, expected: 0.5},
+		{code: "let f: Fn(Int) -> Int = fn(x: Int) Int { x + 1 }; f(1)", expected: 2},
+		{code: "fn apply(f: Fn(Int) -> Int, x: Int) Int { f(x) }; apply(fn(x: Int) Int { x * 3 }, 2)", expected: 6},
+		{code: "let xs: List = [1, \"a\"]; len(xs)", expected: 2},
+	}
+
+	for i, test := range valid {
+		evaluated := testEval(test.code)
+		testInterface(t, i, test.expected, evaluated)
+	}
+}
+
+func TestStructs(t *testing.T) {
+	definitions := `
+struct Point { x: Int, y: Int }
+impl Point {
+    fn new(x: Int, y: Int) Point { Point { x: x, y: y } }
+    fn sum(self) Int { self.x + self.y }
+    fn scale(self, by: Int) Point { Point { x: self.x * by, y: self.y * by } }
+}
+struct Path { points: List<Point> }
+`
+	tests := []struct {
+		code     string
+		expected interface{}
+	}{
+		{code: "Point { x: 1, y: 2 }.x", expected: 1},
+		{code: "Point { y: 2, x: 1 }.y", expected: 2},
+		{code: "Point.new(3, 4).sum()", expected: 7},
+		{code: "let p: Point = Point { x: 1, y: 2 }; p.scale(3).sum()", expected: 9},
+		{code: "Path { points: [Point.new(1, 1), Point.new(2, 2)] }.points[1].x", expected: 2},
+		{code: "fn origin() Point { Point.new(0, 0) }; origin().sum()", expected: 0},
+	}
+
+	for i, test := range tests {
+		evaluated := testEval(definitions + test.code)
+		testInterface(t, i, test.expected, evaluated)
+	}
+
+	inspected := testEval(definitions + "Point { y: 2, x: 1 }").Inspect()
+	if inspected != "Point { x: 1, y: 2 }" {
+		t.Errorf("expected Point { x: 1, y: 2 }, got=%s", inspected)
+	}
+
+	errors := []struct {
+		code     string
+		expected string
+	}{
+		{code: "Point { x: 1 }", expected: "[9,1] missing field y in Point"},
+		{code: "Point { x: 1, y: 2, z: 3 }", expected: "[9,1] struct Point has no field z"},
+		{code: "Point { x: 1, x: 2, y: 3 }", expected: "[9,1] field x of Point is set twice"},
+		{code: "Point { x: 1.5, y: 2 }", expected: "[9,1] expected field x of Point to be of type INTEGER, got FLOAT"},
+		{
+			code:     "Path { points: [Point.new(1, 1), 2] }",
+			expected: "[9,1] expected element 1 of field points of Path to be of type Point, got INTEGER",
+		},
+		{code: "Point.new(1, 2).z", expected: "[9,16] type Point has no field or method z"},
+		{code: "Point.new(1, 2).scale()", expected: "[9,22] method scale expected 1 arguments, got 0"},
+		{code: "Point.new(1, 2).new(1, 2)", expected: "[9,20] Point.new takes no self, call it on the struct instead"},
+		{code: "fn f(p: Point) Int { p.x }; f(1)", expected: "[9,30] expected argument 0 (p) to be of type Point, got INTEGER"},
+		{code: "impl Line { fn f() {} }", expected: "[9,6] Line is not defined"},
+		{code: "Point.origin()", expected: "[9,6] struct Point has no method origin"},
+	}
+
+	for i, test := range errors {
+		evaluated := testEval(definitions + test.code)
+		err, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Errorf("case %d: no error object returned, got=%T (%+v)", i, evaluated, evaluated)
+			continue
+		}
+
+		if err.Inspect() != test.expected {
+			t.Errorf("case %d: \nexpected error\t%s,\ngot\t\t%s", i, test.expected, err.Inspect())
+		}
+	}
+}
+
+func TestEnumsAndMatch(t *testing.T) {
+	definitions := `
+enum Shape { Circle(Float), Rect(Float, Float), Empty }
+fn area(s: Shape) Float {
+    match s {
+        Shape::Circle(r) => 3.0 * r * r,
+        Shape::Rect(w, h) => w * h,
+        Shape::Empty => 0.0,
+    }
+}
+`
+	tests := []struct {
+		code     string
+		expected interface{}
+	}{
+		{code: "area(Shape::Circle(2.0))", expected: 12.0},
+		{code: "area(Shape::Rect(2.0, 3.0))", expected: 6.0},
+		{code: "area(Shape::Empty)", expected: 0.0},
+		{code: `match 3 { 1 => "one", 3 => "three", _ => "many" }`, expected: "three"},
+		{code: `match 7 { 1 => "one", _ => "many" }`, expected: "many"},
+		{code: "match -1.5 { -1.5 => true, _ => false }", expected: true},
+		{code: `match "b" { "a" => 1, "b" => 2 }`, expected: 2},
+		{code: "match 5 { n if n < 0 => -1, n if n > 0 => 1, _ => 0 }", expected: 1},
+		{code: "match [1, 2, 3] { [] => 0, [a] => a, [a, b] => a + b, [a, ..rest] => a + rest.len() }", expected: 3},
+		{code: "match [4] { [a, ..] => a }", expected: 4},
+		{code: "match [Shape::Rect(1.0, 2.0)] { [Shape::Rect(w, _)] => w }", expected: 1.0},
+		{code: "match 1 { 1 => { let x: Int = 2; x * 10 } }", expected: 20},
+		{code: "let x: Int = 1; match 2 { x => x }; x", expected: 1},
+		{code: "fn sign(n: Int) Int { match n { 0 => 0, n if n > 0 => 1, _ => -1 } }; sign(-3)", expected: -1},
+	}
+
+	for i, test := range tests {
+		evaluated := testEval(definitions + test.code)
+		testInterface(t, i, test.expected, evaluated)
+	}
+
+	inspected := testEval(definitions + "Shape::Rect(1.0, 2.0)").Inspect()
+	if inspected != "Shape::Rect(1.000000, 2.000000)" {
+		t.Errorf("expected Shape::Rect(1.000000, 2.000000), got=%s", inspected)
+	}
+
+	errors := []struct {
+		code     string
+		expected string
+	}{
+		{code: "match 3 { 1 => 1, 2 => 2 }", expected: "[10,1] no match arm matches 3"},
+		{code: "match Shape::Circle(1.0) { Shape::Empty => 0 }", expected: "[10,1] no match arm matches Shape::Circle(1.000000)"},
+		{code: "Shape::Triangle", expected: "[10,6] enum Shape has no variant Triangle"},
+		{code: "Shape::Circle(1)", expected: "[10,14] expected field 0 of Shape::Circle to be of type FLOAT, got INTEGER"},
+		{code: "Shape::Rect(1.0)", expected: "[10,12] variant Shape::Rect expected 2 arguments, got 1"},
+		{code: "match 1 { Shape::Rect(w) => w }", expected: "[10,11] pattern Shape::Rect expected 2 fields, got 1"},
+		{code: "match 1 { Shape::Square => 0 }", expected: "[10,18] enum Shape has no variant Square"},
+		{code: "match 1 { area::Circle => 0 }", expected: "[10,11] area is not an enum"},
+		{code: "area(1.0)", expected: "[10,5] expected argument 0 (s) to be of type Shape, got FLOAT"},
+	}
+
+	for i, test := range errors {
+		evaluated := testEval(definitions + test.code)
+		err, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Errorf("case %d: no error object returned, got=%T (%+v)", i, evaluated, evaluated)
+			continue
+		}
+
+		if err.Inspect() != test.expected {
+			t.Errorf("case %d: \nexpected error\t%s,\ngot\t\t%s", i, test.expected, err.Inspect())
+		}
+	}
+}
+
+func TestLoops(t *testing.T) {
+	definitions := `
+fn find(xs: List<Int>, n: Int) Int {
+    for i, x in xs {
+        if (x == n) { return i; }
+    }
+    -1
+}
+fn depth(n: Int) Int {
+    while (n > 0) { return depth(n - 1) + 1; }
+    0
+}
+`
+	tests := []struct {
+		code     string
+		expected interface{}
+	}{
+		{code: "find([4, 5, 6], 6)", expected: 2},
+		{code: "find([4, 5, 6], 7)", expected: -1},
+		{code: "depth(3)", expected: 3},
+		{code: "loop { break 3; }", expected: 3},
+		{code: "loop { break; }", expected: nil},
+		{code: "while (false) { 1; }", expected: nil},
+		{code: "for x in [] { x; }", expected: nil},
+		{code: "loop { for x in [1, 2, 3] { if (x == 2) { continue; }; if (x == 3) { break; } }; break 10; }", expected: 10},
+		{code: "fn f() Int { for x in [1, 2, 3] { if (x > 1) { return loop { break x * 10; }; } }; 0 }; f()", expected: 20},
+		{code: `fn last(s: String) String { for c in s { if (c == "!") { return c; } }; "" }; last("hi!")`, expected: "!"},
+		{code: `fn key(m: Map<String, Int>) String { for k, v in m { if (v == 2) { return k; } }; "" }; key({"a": 1, "b": 2})`, expected: "b"},
+		{code: "fn g() Int { loop { match 1 { 1 => { break; }, _ => 0 } }; 5 }; g()", expected: 5},
+	}
+
+	for i, test := range tests {
+		evaluated := testEval(definitions + test.code)
+		testInterface(t, i, test.expected, evaluated)
+	}
+
+	errors := []struct {
+		code     string
+		expected string
+	}{
+		{code: "for x in 5 { x; }", expected: "[12,1] for expected a List, Map, String, Range or Iterator, got INTEGER"},
+		{code: "for k, v in true { k; }", expected: "[12,1] for expected a List, Map, String, Range or Iterator, got BOOLEAN"},
+	}
+
+	for i, test := range errors {
+		evaluated := testEval(definitions + test.code)
+		err, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Errorf("case %d: no error object returned, got=%T (%+v)", i, evaluated, evaluated)
+			continue
+		}
+
+		if err.Inspect() != test.expected {
+			t.Errorf("case %d: \nexpected error\t%s,\ngot\t\t%s", i, test.expected, err.Inspect())
+		}
+	}
+}
+
+func TestAssignments(t *testing.T) {
+	tests := []struct {
+		code     string
+		expected interface{}
+	}{
+		{code: "let mut x: Int = 1; x = x + 1; x", expected: 2},
+		{code: "let mut x: Int = 10; x += 5; x -= 1; x *= 2; x /= 4; x %= 4; x", expected: 3},
+		{code: `let mut s: String = "a"; s += "b"; s`, expected: "ab"},
+		{code: "let mut x: Int = 1; if (true) { x = 2; }; x", expected: 2},
+		{code: "let mut x: Int = 1; if (true) { let x: Int = 5; }; x", expected: 1},
+		{code: "let mut n: Int = 0; for x in [1, 2, 3] { n += x; }; n", expected: 6},
+		{code: "let mut i: Int = 0; while (i < 5) { i += 1; }; i", expected: 5},
+		{code: "let mut xs: List<Int> = [1, 2]; xs[1] = 5; xs[0] + xs[1]", expected: 6},
+		{code: "let mut xs: List<Int> = [1, 2]; let ys: List<Int> = xs; xs[0] = 9; ys[0]", expected: 1},
+		{code: `let mut m: Map<String, Int> = {"a": 1}; m["b"] = 2; m["a"] += 10; m["a"] + m["b"]`, expected: 13},
+		{code: "let mut xs: List<List<Int>> = [[1], [2, 3]]; xs[1][0] *= 7; xs[1][0]", expected: 14},
+		{code: "let mut c: Int = 0; fn inc() Int { c += 1; c }; inc(); inc()", expected: 2},
+		{code: "let mut c: Int = 0; let f: Func = fn() { c = 5; }; f(); c", expected: 5},
+		{code: "let mut x: Int = 1; let x: Int = 2; x", expected: 2},
+	}
+
+	for i, test := range tests {
+		evaluated := testEval(test.code)
+		testInterface(t, i, test.expected, evaluated)
+	}
+
+	errors := []struct {
+		code     string
+		expected string
+	}{
+		{code: "let x: Int = 1; x = 2;", expected: "[1,17] cannot assign to immutable variable x"},
+		{code: "let mut x: Int = 1; let x: Int = 2; x = 3;", expected: "[1,37] cannot assign to immutable variable x"},
+		{code: "y = 2;", expected: "[1,1] y is not defined"},
+		{code: "len = 2;", expected: "[1,1] cannot assign to immutable variable len"},
+		{code: "fn f() Int { 1 }; f = 2;", expected: "[1,19] cannot assign to immutable variable f"},
+		{code: "let mut x: Int = 1; x = 1.5;", expected: "[1,23] type mismatch, expected value of type FLOAT to be of type INTEGER"},
+		{code: "let mut x: Int = 1; x += true;", expected: "[1,23] operator + is not defined over INTEGER and BOOLEAN"},
+		{code: "let mut xs: List<Int> = [1]; xs[3] = 1;", expected: "[1,32] index 3 out of range, len = 1"},
+		{code: `let mut xs: List<Int> = [1]; xs[0] = "a";`, expected: "[1,36] type mismatch, expected element 0 of type STRING to be of type INTEGER"},
+		{code: `let mut m: Map<String, Int> = {"a": 1}; m["b"] += 1;`, expected: "[1,48] operator + is not defined over NULL and INTEGER"},
+		{code: "let mut n: Int = 1; n[0] = 2;", expected: "[1,22] index operator is not defined over INTEGERs"},
+	}
+
+	for i, test := range errors {
+		evaluated := testEval(test.code)
+		err, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Errorf("case %d: no error object returned, got=%T (%+v)", i, evaluated, evaluated)
+			continue
+		}
+
+		if err.Inspect() != test.expected {
+			t.Errorf("case %d: \nexpected error\t%s,\ngot\t\t%s", i, test.expected, err.Inspect())
+		}
+	}
+}
+
+func TestOptionsAndResults(t *testing.T) {
+	definitions := `
+fn half(n: Int) Option<Int> {
+    if (n % 2 == 0) { Some(n / 2) } else { None }
+}
+fn quarter(n: Int) Option<Int> {
+    let h: Int = half(n)?;
+    half(h)
+}
+fn parse(s: String) Result<Int, String> {
+    if (s == "1") { Ok(1) } else { Err("bad " + s) }
+}
+fn sum(xs: List<String>) Result<Int, String> {
+    let mut n: Int = 0;
+    for x in xs { n += parse(x)?; }
+    Ok(n)
+}
+`
+	tests := []struct {
+		code     string
+		expected interface{}
+	}{
+		{code: "quarter(8).unwrap()", expected: 2},
+		{code: "quarter(6).is_none()", expected: true},
+		{code: "half(3).unwrap_or(7)", expected: 7},
+		{code: "half(4).map(fn(x: Int) Int { x * 10 }).unwrap()", expected: 20},
+		{code: "half(8).and_then(half).and_then(half).unwrap()", expected: 1},
+		{code: "half(2).and_then(half).is_some()", expected: false},
+		{code: `sum(["1", "1", "1"]).unwrap()`, expected: 3},
+		{code: `match sum(["1", "x", "y"]) { Ok(n) => "sum", Err(e) => e }`, expected: "bad x"},
+		{code: `parse("x").map(fn(x: Int) Int { x + 1 }).is_err()`, expected: true},
+		{code: `let m: Map<String, Int> = {"a": 1}; m.get("a").unwrap() + m.get("b").unwrap_or(5)`, expected: 6},
+		{code: "let xs: List<Int> = [1, 2]; xs.get(1).unwrap() + xs.get(2).unwrap_or(0)", expected: 2},
+		{code: "match Some([1, 2]) { Some([a, ..]) => a, None => 0 }", expected: 1},
+		{code: "match None { Option::Some(x) => x, Option::None => 0 }", expected: 0},
+		{code: "catch(fn() Int { 1 / 1 }).unwrap()", expected: 1},
+		{code: "match catch(fn() Int { [1][3] }) { Ok(x) => x, Err(e) => e }", expected: "[17,27] index 3 out of range, len = 1"},
+		{code: "let o: Option<Int> = Some(1); o.is_some()", expected: true},
+		{code: "match catch(fn() Int { 1 / 0 }) { Ok(x) => x, Err(e) => e }", expected: "[17,26] division by zero"},
+	}
+
+	for i, test := range tests {
+		evaluated := testEval(definitions + test.code)
+		testInterface(t, i, test.expected, evaluated)
+	}
+
+	inspected := testEval(definitions + `let xs: List = [quarter(8), quarter(2), parse("1"), parse("2")]; xs`).Inspect()
+	if inspected != "[Some(2), None, Ok(1), Err(bad 2)]" {
+		t.Errorf("expected [Some(2), None, Ok(1), Err(bad 2)], got=%s", inspected)
+	}
+
+	errors := []struct {
+		code     string
+		expected string
+	}{
+		{code: "half(3).unwrap()", expected: "[17,15] called unwrap on None"},
+		{code: `parse("2").unwrap()`, expected: "[17,18] called unwrap on Err(bad 2)"},
+		{code: "1?", expected: "[17,2] operator ? is not defined over INTEGER"},
+		{code: "half(2).and_then(fn(x: Int) Int { x })", expected: "[17,17] and_then expected its argument to return Option, got INTEGER"},
+		{code: `let o: Option<Int> = Some("a");`, expected: "[17,1] type mismatch, expected payload of Some of type STRING to be of type INTEGER"},
+		{code: `let r: Result<Int, String> = Err(1);`, expected: "[17,1] type mismatch, expected payload of Err of type INTEGER to be of type STRING"},
+		{code: "Some(1, 2)", expected: "[17,5] variant Some expected 1 arguments, got 2"},
+		{code: "half(2).len()", expected: "[17,8] type Option has no method len"},
+	}
+
+	for i, test := range errors {
+		evaluated := testEval(definitions + test.code)
+		err, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Errorf("case %d: no error object returned, got=%T (%+v)", i, evaluated, evaluated)
+			continue
+		}
+
+		if err.Inspect() != test.expected {
+			t.Errorf("case %d: \nexpected error\t%s,\ngot\t\t%s", i, test.expected, err.Inspect())
+		}
+	}
+}
+
+func TestStrings(t *testing.T) {
+	tests := []struct {
+		code     string
+		expected interface{}
+	}{
+		{code: `"héllo".len()`, expected: 5},
+		{code: `len("héllo")`, expected: 5},
+		{code: `"héllo"[1]`, expected: "é"},
+		{code: `"héllo"[1:3]`, expected: "él"},
+		{code: `"héllo"[:2] + "héllo"[3:] + "héllo"[:]`, expected: "hélohéllo"},
+		{code: `"héllo"[5:]`, expected: ""},
+		{code: `"a,b,,c".split(",").len()`, expected: 4},
+		{code: `"héllo".split("").join("-")`, expected: "h-é-l-l-o"},
+		{code: `"héllo".chars()[1]`, expected: "é"},
+		{code: `"é".bytes()[0] * 1000 + "é".bytes()[1]`, expected: 195169},
+		{code: "\"one\ntwo\r\nthree\n\".lines().join(\"|\")", expected: "one|two|three"},
+		{code: `"".lines().len()`, expected: 0},
+		{code: `"  a b  ".trim() + "|" + "  a ".trim_start() + "|" + " a  ".trim_end() + "|"`, expected: "a b|a | a|"},
+		{code: `"héllo".upper() + "ÀB".lower()`, expected: "HÉLLOàb"},
+		{code: `"hello".contains("ell") && "hello".starts_with("he") && "hello".ends_with("lo")`, expected: true},
+		{code: `"hello".contains("xyz")`, expected: false},
+		{code: `"héllo".find("l").unwrap()`, expected: 2},
+		{code: `"héllo".find("x").is_none()`, expected: true},
+		{code: `"a-b-c".replace("-", "+")`, expected: "a+b+c"},
+		{code: `"ab".repeat(3) + "x".repeat(0)`, expected: "ababab"},
+		{code: `"7".pad_left(3, "0") + "|" + "é".pad_right(3) + "|" + "long".pad_left(2)`, expected: "007|é  |long"},
+		{code: `"-42".parse_int().unwrap() + 1`, expected: -41},
+		{code: `"4x".parse_int().is_err()`, expected: true},
+		{code: `match "4x".parse_int() { Ok(n) => "", Err(e) => e }`, expected: `"4x" is not a valid Int`},
+		{code: `"2.5".parse_float().unwrap() * 2.0`, expected: 5.0},
+		{code: `["a", "b"].join(", ")`, expected: "a, b"},
+		{code: `let xs: List<Int> = [1, 2, 3, 4]; xs[1:3].len() + xs[:1][0]`, expected: 3},
+	}
+
+	for i, test := range tests {
+		evaluated := testEval(test.code)
+		testInterface(t, i, test.expected, evaluated)
+	}
+
+	errors := []struct {
+		code     string
+		expected string
+	}{
+		{code: `"héllo"[5]`, expected: "[1,9] index 5 out of range, len = 5"},
+		{code: `"héllo"[2:9]`, expected: "[1,9] slice [2:9] out of range, len = 5"},
+		{code: `"héllo"[3:1]`, expected: "[1,9] slice [3:1] out of range, len = 5"},
+		{code: `[1, 2][-1:]`, expected: "[1,7] slice [-1:2] out of range, len = 2"},
+		{code: `1[1:]`, expected: "[1,2] slice operator is not defined over INTEGERs"},
+		{code: `"abc".split(1)`, expected: "[1,12] split expected argument 1 to be of type STRING, got=INTEGER"},
+		{code: `"abc".trim(1)`, expected: "[1,11] trim expected 0 arguments, got 1"},
+		{code: `"abc".repeat(-1)`, expected: "[1,13] repeat expected a count of at least 0, got -1"},
+		{code: `"abc".pad_left(5, "ab")`, expected: `[1,15] pad_left expected a single character to pad with, got "ab"`},
+		{code: `[1, 2].join(",")`, expected: "[1,12] join expected a list of STRINGs, found INTEGER"},
+		{code: `let mut s: String = "abc"; s[0] = "x";`, expected: "[1,29] strings are immutable, their characters can't be assigned to"},
+	}
+
+	for i, test := range errors {
+		evaluated := testEval(test.code)
+		err, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Errorf("case %d: no error object returned, got=%T (%+v)", i, evaluated, evaluated)
+			continue
+		}
+
+		if err.Inspect() != test.expected {
+			t.Errorf("case %d: \nexpected error\t%s,\ngot\t\t%s", i, test.expected, err.Inspect())
 		}
 	}
 }
@@ -335,6 +815,65 @@ func TestBuiltinFunctions(t *testing.T) {
 	}
 }
 
+func TestAssertions(t *testing.T) {
+	definitions := `
+struct Point { x: Int, y: Int }
+fn fail() Int { [1][3] }
+`
+	tests := []struct {
+		code     string
+		expected interface{}
+	}{
+		{code: "assert(1 < 2);", expected: nil},
+		{code: "assert_eq([1, 2], [1, 2]);", expected: nil},
+		{code: `assert_eq({"a": [1]}, {"a": [1]});`, expected: nil},
+		{code: "assert_eq(Point { x: 1, y: 2 }, Point { x: 1, y: 2 });", expected: nil},
+		{code: "assert_eq(Some([1]), Some([1]));", expected: nil},
+		{code: "assert_ne(Some(1), None);", expected: nil},
+		{code: "assert_ne(1.5, 2.5);", expected: nil},
+		{code: `assert_error(fail, "out of range")`, expected: "[3,20] index 3 out of range, len = 1"},
+	}
+
+	for i, test := range tests {
+		evaluated := testEval(definitions + test.code)
+		testInterface(t, i, test.expected, evaluated)
+	}
+
+	errors := []struct {
+		code     string
+		expected string
+	}{
+		{code: "assert(1 > 2)", expected: "[4,7] assertion failed"},
+		{code: `assert(false, "never")`, expected: "[4,7] assertion failed: never"},
+		{code: "assert_eq([1, 2], [1, 3])", expected: "[4,10] assertion failed: left == right\n  left: [1, 2]\n right: [1, 3]"},
+		{code: `assert_eq("1", 1)`, expected: "[4,10] assertion failed: left == right\n  left: \"1\"\n right: 1"},
+		{code: `assert_eq(1, 2, "sums")`, expected: "[4,10] assertion failed: sums\n  left: 1\n right: 2"},
+		{code: "assert_ne(Point { x: 1, y: 2 }, Point { x: 1, y: 2 })", expected: "[4,10] assertion failed: left != right\n  left: Point { x: 1, y: 2 }\n right: Point { x: 1, y: 2 }"},
+		{code: "assert_error(fn() Int { 1 })", expected: "[4,13] assertion failed: expected an error\n   got: 1"},
+		{code: `assert_error(fail, "missing")`, expected: "[4,13] assertion failed: expected an error containing \"missing\"\n   got: \"[3,20] index 3 out of range, len = 1\""},
+		{code: "assert(1)", expected: "[4,7] assert expected a BOOLEAN, got INTEGER"},
+		{code: "assert_eq(1)", expected: "[4,10] assert_eq expected 2 or 3 arguments, got 1"},
+	}
+
+	for i, test := range errors {
+		evaluated := testEval(definitions + test.code)
+		err, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Errorf("case %d: no error object returned, got=%T (%+v)", i, evaluated, evaluated)
+			continue
+		}
+
+		if err.Inspect() != test.expected {
+			t.Errorf("case %d: \nexpected error\t%s,\ngot\t\t%s", i, test.expected, err.Inspect())
+		}
+	}
+
+	d := Diagnostic(testEval(definitions + "assert_eq(1, 2)").(*object.Error))
+	if d.Message != "assertion failed: left == right" || strings.Join(d.Notes, "; ") != "left: 1; right: 2" {
+		t.Errorf("expected the values of a failed assertion as notes, got %q %q", d.Message, d.Notes)
+	}
+}
+
 // TODO: testArrayLiteral
 
 func TestMapLiterals(t *testing.T) {
@@ -375,3 +914,311 @@ func TestMapLiterals(t *testing.T) {
 		}
 	}
 }
+
+func TestListMethods(t *testing.T) {
+	xs := "let xs: List<Int> = [3, 1, 4, 1, 5]; "
+	tests := []struct {
+		code     string
+		expected string
+	}{
+		{xs + "xs.fold(10, fn(acc: Int, x: Int) Int { acc + x })", "24"},
+		{xs + "xs.reduce(fn(a: Int, b: Int) Int { a * b })", "Some(60)"},
+		{"[].reduce(fn(a: Int, b: Int) Int { a * b })", "None"},
+		{xs + "xs.sum()", "14"},
+		{"[0.5, 1.5].sum()", "2.000000"},
+		{"[].sum()", "0"},
+		// Ints and Floats mix like they do in 1.5 + 2 and 1.5 < 2
+		{"[1.5, 2].sum()", "3.500000"},
+		{"[3, 1.5, 2].sort()", "[1.500000, 2, 3]"},
+		{"[3, 1.5, 2].min()", "Some(1.500000)"},
+		{xs + "xs.min()", "Some(1)"},
+		{`["b", "a", "c"].min()`, "Some(a)"},
+		// methods that take an element out of an empty list are None
+		{"[].min()", "None"},
+		{"[].first()", "None"},
+		{"[].reduce(fn(a: Int, b: Int) Int { a + b })", "None"},
+		{"[].pop()", "[]"},
+		{xs + "xs.sort()", "[1, 1, 3, 4, 5]"},
+		{`["b", "C", "a"].sort()`, "[C, a, b]"},
+		{"[[2, 1], [1, 2], [1]].sort()", "[[1], [1, 2], [2, 1]]"},
+		// equal keys keep their order
+		{`["bb", "a", "cc", "d"].sort_by(fn(s: String) Int { s.len() })`, "[a, d, bb, cc]"},
+		{xs + `xs.zip(["a", "b"])`, "[[3, a], [1, b]]"},
+		{`["a", "b"].enumerate()`, "[[0, a], [1, b]]"},
+		{xs + "xs.flat_map(fn(x: Int) List<Int> { [x, -x] }).take(4)", "[3, -3, 1, -1]"},
+		{"[[1], [], [2, 3]].flatten()", "[1, 2, 3]"},
+		{xs + "xs.find(fn(x: Int) Bool { x > 3 })", "Some(4)"},
+		{xs + "xs.find(fn(x: Int) Bool { x > 5 })", "None"},
+		{xs + "xs.index_of(1)", "Some(1)"},
+		{`[[1], [2]].index_of([2])`, "Some(1)"},
+		{xs + "xs.contains(5)", "true"},
+		{xs + "xs.contains(2)", "false"},
+		{xs + "xs.any(fn(x: Int) Bool { x > 4 })", "true"},
+		{xs + "xs.all(fn(x: Int) Bool { x > 1 })", "false"},
+		{xs + "xs.count(fn(x: Int) Bool { x < 4 })", "3"},
+		{xs + "xs.take(2)", "[3, 1]"},
+		{xs + "xs.take(9)", "[3, 1, 4, 1, 5]"},
+		{xs + "xs.drop(3)", "[1, 5]"},
+		{xs + "xs.drop(9)", "[]"},
+		{xs + "xs.take_while(fn(x: Int) Bool { x != 4 })", "[3, 1]"},
+		{xs + "xs.chunk(2)", "[[3, 1], [4, 1], [5]]"},
+		{xs + "xs.window(4)", "[[3, 1, 4, 1], [1, 4, 1, 5]]"},
+		{xs + "xs.window(6)", "[]"},
+		{xs + "xs.group_by(fn(x: Int) Int { x % 2 })", "{0: [4], 1: [3, 1, 1, 5]}"},
+		{xs + "xs.unique()", "[3, 1, 4, 5]"},
+		{"[[1], [2], [1]].unique()", "[[1], [2]]"},
+		{xs + "xs.push(9)", "[3, 1, 4, 1, 5, 9]"},
+		{xs + "xs.pop()", "[3, 1, 4, 1]"},
+		// push and pop return new lists and leave xs as it was
+		{xs + "xs.push(9); xs.pop(); xs", "[3, 1, 4, 1, 5]"},
+		{xs + "xs.first()", "Some(3)"},
+		{xs + "xs.last()", "Some(5)"},
+		{"[].last()", "None"},
+		// builtin functions are callbacks too
+		{"[[1, 2], [3]].sort_by(len)", "[[3], [1, 2]]"},
+	}
+
+	for i, test := range tests {
+		evaluated := testEval(test.code)
+		if evaluated.Inspect() != test.expected {
+			t.Errorf("case %d: expected %s, got %s", i, test.expected, evaluated.Inspect())
+		}
+	}
+
+	errors := []struct {
+		code     string
+		expected string
+	}{
+		{xs + "xs.fold(0, fn(x: Int) Int { x })", "[1,45] fold expected its argument to take 2 arguments, got=1"},
+		{xs + "xs.find(fn(x: Int) Int { x })", "[1,45] find expected its argument to return Bool, got=Int"},
+		{xs + "xs.any(1)", "[1,44] any expected its argument to be a function, got=INTEGER"},
+		{"[[1]].count(len)", "[1,12] count expected its argument to return a Boolean, got=INTEGER"},
+		{xs + `xs.sort_by(fn(x: String) Int { 1 })`, "[1,48] sort_by expected element 0 to be of type STRING, got INTEGER"},
+		{`[1, "a"].sort()`, "[1,14] sort can't compare STRING and INTEGER"},
+		{`[1, true].sum()`, "[1,14] sum expected elements of type INTEGER or FLOAT, found BOOLEAN"},
+		{xs + "xs.take(-1)", "[1,45] take expected a count of at least 0, got -1"},
+		{xs + "xs.chunk(0)", "[1,46] chunk expected a count of at least 1, got 0"},
+		{"[1].flatten()", "[1,12] flatten expected a list of LISTs, found INTEGER"},
+		{xs + "xs.group_by(fn(x: Int) List<Int> { [x] })", "[1,49] can't use LIST as hash key"},
+		// the errors of builtin callbacks stop map and filter too
+		{"[1, 2].map(len)", "[1,11] built-in function `len` is not defined on INTEGERs"},
+		{"[1, 2].filter(len)", "[1,14] built-in function `len` is not defined on INTEGERs"},
+		{`["a"].filter(len)`, "[1,13] filter expected its argument to return a Boolean, got=INTEGER"},
+	}
+
+	for i, test := range errors {
+		evaluated := testEval(test.code)
+		err, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Errorf("case %d: no error object returned, got=%T (%+v)", i, evaluated, evaluated)
+			continue
+		}
+
+		if err.Inspect() != test.expected {
+			t.Errorf("case %d: \nexpected error\t%s,\ngot\t\t%s", i, test.expected, err.Inspect())
+		}
+	}
+}
+
+func TestMapMethods(t *testing.T) {
+	m := `let m: Map<String, Int> = {"b": 2, "a": 1, "c": 3}; `
+	tests := []struct {
+		code     string
+		expected string
+	}{
+		{m + "m", "{a: 1, b: 2, c: 3}"},
+		{m + "m.keys()", "[a, b, c]"},
+		{m + "m.values()", "[1, 2, 3]"},
+		{m + "m.entries()", "[[a, 1], [b, 2], [c, 3]]"},
+		{m + "m.to_list()", "[[a, 1], [b, 2], [c, 3]]"},
+		{m + "m.len()", "3"},
+		{m + `m.has("a")`, "true"},
+		{m + `m.has("z")`, "false"},
+		{m + `m.get("a")`, "Some(1)"},
+		{m + `m.get("z", 0)`, "0"},
+		{m + `m.get("c", 0)`, "3"},
+		{m + `m.set("d", 4)`, "{a: 1, b: 2, c: 3, d: 4}"},
+		{m + `m.insert("a", 10)`, "{a: 10, b: 2, c: 3}"},
+		{m + `m.remove("b")`, "{a: 1, c: 3}"},
+		{m + `m.remove("z")`, "{a: 1, b: 2, c: 3}"},
+		// the methods return new maps and leave m as it was
+		{m + `m.set("d", 4); m.remove("a"); m`, "{a: 1, b: 2, c: 3}"},
+		{m + `m.merge({"a": 100, "e": 5})`, "{a: 100, b: 2, c: 3, e: 5}"},
+		{m + "m.map_values(fn(v: Int) Int { v * 10 })", "{a: 10, b: 20, c: 30}"},
+		{m + "m.filter(fn(k: String, v: Int) Bool { k != \"b\" && v < 3 })", "{a: 1}"},
+		{"from_entries([[2, 20], [1, 10], [2, 30]])", "{1: 10, 2: 30}"},
+		{"from_entries([])", "{}"},
+		// keys are ordered by value, not by how they print
+		{"{10: 1, 2: 2, -1: 3}.keys()", "[-1, 2, 10]"},
+		{"{true: 1, false: 0}", "{false: 0, true: 1}"},
+	}
+
+	for i, test := range tests {
+		evaluated := testEval(test.code)
+		if evaluated.Inspect() != test.expected {
+			t.Errorf("case %d: expected %s, got %s", i, test.expected, evaluated.Inspect())
+		}
+	}
+
+	errors := []struct {
+		code     string
+		expected string
+	}{
+		{m + `m.get()`, "[1,58] get expected 1 or 2 arguments, got 0"},
+		{m + `m.has([1])`, "[1,58] can't use LIST as hash key"},
+		{m + `m.set("a")`, "[1,58] set expected 2 arguments, got 1"},
+		{m + `m.merge([1])`, "[1,60] merge expected argument 1 to be of type MAP, got=LIST"},
+		{m + "m.filter(fn(k: String, v: Int) Int { v })", "[1,61] filter expected its argument to return a Boolean, got=INTEGER"},
+		{"from_entries([[1, 2], [3]])", "[1,13] from_entries expected entry 1 to be a [key, value] list, got [3]"},
+	}
+
+	for i, test := range errors {
+		evaluated := testEval(test.code)
+		err, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Errorf("case %d: no error object returned, got=%T (%+v)", i, evaluated, evaluated)
+			continue
+		}
+
+		if err.Inspect() != test.expected {
+			t.Errorf("case %d: \nexpected error\t%s,\ngot\t\t%s", i, test.expected, err.Inspect())
+		}
+	}
+}
+
+func TestIterators(t *testing.T) {
+	tests := []struct {
+		code     string
+		expected string
+	}{
+		{"0..5", "0..5"},
+		{"(0..5).collect()", "[0, 1, 2, 3, 4]"},
+		{"(0..=5).collect()", "[0, 1, 2, 3, 4, 5]"},
+		{"(5..0).collect()", "[]"},
+		{"(0..10).step(3).collect()", "[0, 3, 6, 9]"},
+		{"(10..=0).step(-5).collect()", "[10, 5, 0]"},
+		{"(0..10).len()", "10"},
+		{"(0..=10).step(3).len()", "4"},
+		{"len(5..0)", "0"},
+		{"(0..10).step(2).contains(4)", "true"},
+		{"(0..10).step(2).contains(5)", "false"},
+		{"(0..10).contains(10)", "false"},
+		// only as many values as take asks for are computed
+		{"(0..1000000000).filter(fn(x: Int) Bool { x % 7 == 0 }).take(3).collect()", "[0, 7, 14]"},
+		{"(1..4).map(fn(x: Int) Int { x * x }).collect()", "[1, 4, 9]"},
+		{"(0..10).drop(7).collect()", "[7, 8, 9]"},
+		{"(0..10).take_while(fn(x: Int) Bool { x < 3 }).collect()", "[0, 1, 2]"},
+		{"(0..3).chain([7, 8]).collect()", "[0, 1, 2, 7, 8]"},
+		{`(0..5).zip("ab").collect()`, "[[0, a], [1, b]]"},
+		{`["a", "b"].iter().enumerate().collect()`, "[[0, a], [1, b]]"},
+		{`"hé".iter().collect()`, "[h, é]"},
+		{`{"b": 2, "a": 1}.iter().collect()`, "[[a, 1], [b, 2]]"},
+		{"[1, 2].iter()", "<iterator>"},
+		// the methods with a single result stop at the value that decides it
+		{"(0..1000000000).any(fn(x: Int) Bool { x == 3 })", "true"},
+		{"(0..1000000000).all(fn(x: Int) Bool { x < 3 })", "false"},
+		{"(0..1000000000).first()", "Some(0)"},
+		{"(0..1000000000).iter().find(fn(x: Int) Bool { x > 4 })", "Some(5)"},
+		{"(0..1000000000).iter().contains(7)", "true"},
+		{"(5..1000000000).iter().index_of(7)", "Some(2)"},
+		{"(0..0).first()", "None"},
+		{"(0..10).iter().index_of(20)", "None"},
+		{"(0..10).count(fn(x: Int) Bool { x % 3 == 0 })", "4"},
+		{"(0..10).iter().len()", "10"},
+		{"[1.5, 2.5].iter().sum()", "4.000000"},
+		{"(0..0).sum()", "0"},
+		{"(1..4).fold(1, fn(acc: Int, x: Int) Int { acc * x })", "6"},
+		// the list methods work on the values
+		{"(1..=100).sum()", "5050"},
+		{"(0..5).map(fn(x: Int) Int { 0 - x }).sort()", "[-4, -3, -2, -1, 0]"},
+		{"(0..5).fold(0, fn(acc: Int, x: Int) Int { acc + x })", "10"},
+		{"[1, 2, 3].zip(10..20)", "[[1, 10], [2, 11], [3, 12]]"},
+		{"range(1, 3)", "1..=3"},
+		// range(a, b) still has the list methods it had when it returned a list
+		{"range(1, 3).map(fn(x: Int) Int { x * 2 })", "[2, 4, 6]"},
+		{"range(1, 5).filter(fn(x: Int) Bool { x % 2 == 0 })", "[2, 4]"},
+		{"range(0, 10).step(5).take(5)", "[0, 5, 10]"},
+		{"(1..3).map(fn(x: Int) Int { x * 2 })", "<iterator>"},
+		{"let xs: List<Int> = range(0, 9); xs[4] + (0..10).step(3)[3]", "13"},
+		{"fn f(xs: List) List { xs } f(2..4)", "2..4"},
+		{"max(0..3)", "2"},
+		{"max([4, 9].iter())", "9"},
+		{"len([1, 2, 3].iter())", "3"},
+		{"[1, 2].flat_map(fn(x: Int) Iterator<Int> { (0..x).iter() })", "[0, 0, 1]"},
+		{"[1, 3].flat_map(fn(x: Int) Range { x..=x + 1 })", "[1, 2, 3, 4]"},
+		{"[0..2, 5..=6].flatten()", "[0, 1, 5, 6]"},
+		{"from_entries([[1, 10]].iter())", "{1: 10}"},
+		{"let mut s: Int = 0; for i in 0..4 { s += i; } s", "6"},
+		{"let mut s: Int = 0; for i, x in (10..13).iter() { s += i * x; } s", "35"},
+		// an iterator is used up once its values are taken
+		{"let it: Iterator<Int> = [1, 2].iter(); it.collect(); it.collect()", "[]"},
+	}
+
+	for i, test := range tests {
+		evaluated := testEval(test.code)
+		if evaluated.Inspect() != test.expected {
+			t.Errorf("case %d: expected %s, got %s", i, test.expected, evaluated.Inspect())
+		}
+	}
+
+	errors := []struct {
+		code     string
+		expected string
+	}{
+		{"1.5..2", "[1,4] range bounds must be INTEGERs, got FLOAT and INTEGER"},
+		{"(0..5).step(0)", "[1,12] step expected a step other than 0"},
+		{"(0..5)[5]", "[1,7] index 5 out of range, len = 5"},
+		{`let xs: List<String> = 0..2;`, "[1,1] type mismatch, expected element 0 of type INTEGER to be of type STRING"},
+		{"(0..5).take(-1)", "[1,12] take expected a count of at least 0, got -1"},
+		{"(0..5).zip(1)", "[1,11] zip expected argument 1 to be a List, Map, String, Range or Iterator, got=INTEGER"},
+		{`["a"].iter().map(fn(x: Int) Int { x }).collect()`, "[1,17] map expected element 0 to be of type INTEGER, got STRING"},
+		{"(0..5).filter(fn(x: Int) Int { x }).collect()", "[1,14] filter expected its argument to return Bool, got=Int"},
+		{`["a"].iter().any(fn(x: Int) Bool { true })`, "[1,17] any expected element 0 to be of type INTEGER, got STRING"},
+		{`[1, "a"].iter().fold(0, fn(acc: Int, x: Int) Int { acc + x })`, "[1,21] fold expected element 1 to be of type INTEGER, got STRING"},
+		{`[1, "a"].iter().sum()`, "[1,20] sum expected elements of type INTEGER or FLOAT, found STRING"},
+	}
+
+	for i, test := range errors {
+		evaluated := testEval(test.code)
+		err, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Errorf("case %d: no error object returned, got=%T (%+v)", i, evaluated, evaluated)
+			continue
+		}
+
+		if err.Inspect() != test.expected {
+			t.Errorf("case %d: \nexpected error\t%s,\ngot\t\t%s", i, test.expected, err.Inspect())
+		}
+	}
+}
+
+func TestBacktraces(t *testing.T) {
+	tests := []struct {
+		code     string
+		expected string
+	}{
+		{"[1][2]", ""},
+		{"fn f() Int { [1][2] }; f()", "f 1:25"},
+		{"fn f(n: Int) Int { if (n == 0) { [1][2] } else { f(n - 1) } }; fn g() Int { f(2) }; g()", "f 1:51, f 1:51, f 1:78, g 1:86"},
+		{"[1, 2].map(fn(x: Int) Int { [x][5] })", "<closure at 1:12> 1:11"},
+		{"fn f() Int { 1 }; f(true)", ""},
+		{`fn f() Int { "a" }; fn g() Int { f() }; g()`, "g 1:42"},
+	}
+
+	for i, test := range tests {
+		result := testEval(test.code)
+		err, ok := result.(*object.Error)
+		if !ok {
+			t.Errorf("case %d: expected an error, got=%T (%+v)", i, result, result)
+			continue
+		}
+
+		frames := []string{}
+		for _, frame := range err.Stack {
+			frames = append(frames, fmt.Sprintf("%s %d:%d", frame.Function, frame.Row, frame.Column))
+		}
+		if actual := strings.Join(frames, ", "); actual != test.expected {
+			t.Errorf("case %d: expected backtrace %q, got %q", i, test.expected, actual)
+		}
+	}
+}
@@ -0,0 +1,784 @@
+package eval
+
+import (
+	"lang/object"
+	"math"
+)
+
+// ranges and iterators compute their values when a loop or collect asks
+// for them, so (0..1000000).filter(f).take(3) calls f until it found 3.
+// They also have every method of lists, called on the list of their
+// values, apart from the ones that can stop before the last value.
+
+var (
+	rangeMethods    = map[string]object.BuiltinMethod{}
+	iteratorMethods = map[string]object.BuiltinMethod{}
+	// the methods of the ranges range(a, b) returns, which returned lists
+	// before there were ranges and still map and filter into one
+	listRangeMethods = map[string]object.BuiltinMethod{}
+)
+
+// the methods of ranges and iterators, registered once the list methods
+// they fall back to are
+func registerIteratorMethods() {
+	for name := range listMethods {
+		iteratorMethods[name] = collected(name)
+	}
+
+	iteratorMethods["iter"] = iteratorIter
+	iteratorMethods["collect"] = iteratorCollect
+	iteratorMethods["map"] = iteratorMap
+	iteratorMethods["filter"] = iteratorFilter
+	iteratorMethods["take"] = iteratorTake
+	iteratorMethods["drop"] = iteratorDrop
+	iteratorMethods["take_while"] = iteratorTakeWhile
+	iteratorMethods["zip"] = iteratorZip
+	iteratorMethods["enumerate"] = iteratorEnumerate
+	iteratorMethods["chain"] = iteratorChain
+	iteratorMethods["len"] = iteratorLen
+	iteratorMethods["first"] = iteratorFirst
+	iteratorMethods["contains"] = iteratorContains
+	iteratorMethods["index_of"] = iteratorIndexOf
+	iteratorMethods["find"] = iteratorFind
+	iteratorMethods["any"] = iteratorAny
+	iteratorMethods["all"] = iteratorAll
+	iteratorMethods["count"] = iteratorCount
+	iteratorMethods["sum"] = iteratorSum
+	iteratorMethods["fold"] = iteratorFold
+	for name, method := range iteratorMethods {
+		rangeMethods[name] = onIterator(method)
+	}
+
+	rangeMethods["step"] = rangeStep
+	rangeMethods["len"] = rangeLen
+	rangeMethods["contains"] = rangeContains
+
+	for name, method := range rangeMethods {
+		listRangeMethods[name] = method
+	}
+	for _, name := range []string{"map", "filter", "take", "drop", "take_while", "zip", "enumerate"} {
+		listRangeMethods[name] = collected(name)
+	}
+}
+
+func newIterator(next func() object.Object) *object.Iterator {
+	return &object.Iterator{Next: next, Methods: iteratorMethods}
+}
+
+func newRange(start, end, step int64, inclusive bool) *object.Range {
+	return &object.Range{Start: start, End: end, Step: step, Inclusive: inclusive, Methods: rangeMethods}
+}
+
+// range(a, b) is a..=b with the methods of a list
+func newListRange(start, end int64) *object.Range {
+	r := newRange(start, end, 1, true)
+	r.Methods = listRangeMethods
+	return r
+}
+
+func evalRangeExpression(start, end object.Object, inclusive bool, row, column *int) object.Object {
+	s, ok1 := start.(*object.Integer)
+	e, ok2 := end.(*object.Integer)
+	if !ok1 || !ok2 {
+		return newError(*row, *column, "range bounds must be INTEGERs, got %s and %s",
+			start.Type(), end.Type())
+	}
+	return newRange(s.Value, e.Value, 1, inclusive)
+}
+
+// an iterator over the elements of a list, the characters of a string,
+// the [key, value] entries of a map or the integers of a range
+func iterate(value object.Object) (*object.Iterator, bool) {
+	var elements []object.Object
+	switch value := value.(type) {
+	case *object.Iterator:
+		return value, true
+	case *object.Range:
+		return rangeIterator(value), true
+	case *object.List:
+		elements = value.Elements
+	case *object.String:
+		for _, char := range value.Value {
+			elements = append(elements, newString(string(char)))
+		}
+	case *object.Map:
+		elements = entriesOf(value).Elements
+	default:
+		return nil, false
+	}
+
+	i := 0
+	return newIterator(func() object.Object {
+		if i == len(elements) {
+			return nil
+		}
+		i++
+		return elements[i-1]
+	}), true
+}
+
+func rangeIterator(r *object.Range) *object.Iterator {
+	next, done := r.Start, !beforeEnd(r, r.Start)
+	return newIterator(func() object.Object {
+		if done {
+			return nil
+		}
+		value := next
+		// stop rather than wrap around at the ends of Int
+		if (r.Step > 0 && next > math.MaxInt64-r.Step) || (r.Step < 0 && next < math.MinInt64-r.Step) {
+			done = true
+		} else {
+			next += r.Step
+			done = !beforeEnd(r, next)
+		}
+		return &object.Integer{Value: value}
+	})
+}
+
+// reports whether v hasn't gone past the end of r, in the direction of
+// its step
+func beforeEnd(r *object.Range, v int64) bool {
+	switch {
+	case v == r.End:
+		return r.Inclusive
+	case r.Step > 0:
+		return v < r.End
+	default:
+		return v > r.End
+	}
+}
+
+// the values of an iterator in a list, each one a step and checked
+// against the size limit before the list grows past it
+func collect(budget *object.Budget, it *object.Iterator, row, column *int) object.Object {
+	elements := []object.Object{}
+	for {
+		if err := Step(budget, *row, *column); err != nil {
+			return err
+		}
+		value := it.Next()
+		if value == nil {
+			return newList(elements)
+		}
+		if isError(value) {
+			return value
+		}
+		if err := growthError(budget, object.LIST_OBJ, int64(len(elements)+1), *row, *column); err != nil {
+			return err
+		}
+		elements = append(elements, value)
+	}
+}
+
+// the elements of a list or the values of a range or an iterator, for
+// the builtins that take a list. ok is false for any other value.
+func listValues(budget *object.Budget, value object.Object, row, column *int) (elements []object.Object, err object.Object, ok bool) {
+	switch value := value.(type) {
+	case *object.List:
+		return value.Elements, nil, true
+	case *object.Range, *object.Iterator:
+		it, _ := iterate(value)
+		list := collect(budget, it, row, column)
+		if isError(list) {
+			return nil, list, true
+		}
+		return list.(*object.List).Elements, nil, true
+	default:
+		return nil, nil, false
+	}
+}
+
+// the list method name called on the values of a range or an iterator
+func collected(name string) object.BuiltinMethod {
+	return func(budget *object.Budget, row *int, column *int, structure object.Object, args ...object.Object) object.Object {
+		it, _ := iterate(structure)
+		list := collect(budget, it, row, column)
+		if isError(list) {
+			return list
+		}
+		return listMethods[name](budget, row, column, list, args...)
+	}
+}
+
+// an iterator method called on an iterator over a range
+func onIterator(method object.BuiltinMethod) object.BuiltinMethod {
+	return func(budget *object.Budget, row *int, column *int, structure object.Object, args ...object.Object) object.Object {
+		it, _ := iterate(structure)
+		return method(budget, row, column, it, args...)
+	}
+}
+
+// xs.iter() is an iterator over the values of xs
+func iteratorIter(budget *object.Budget, row *int, column *int, structure object.Object, args ...object.Object) object.Object {
+	if len(args) != 0 {
+		return newError(*row, *column, "iter expected %d arguments, got %d", 0, len(args))
+	}
+	it, _ := iterate(structure)
+	return it
+}
+
+func iteratorCollect(budget *object.Budget, row *int, column *int, structure object.Object, args ...object.Object) object.Object {
+	if len(args) != 0 {
+		return newError(*row, *column, "collect expected %d arguments, got %d", 0, len(args))
+	}
+	return collect(budget, structure.(*object.Iterator), row, column)
+}
+
+// the receiver of a lazy method, which takes count arguments and a
+// callback when it takes a function, checked like the ones of lists
+func lazyMethod(name string, row, column *int, structure object.Object, args []object.Object, count int) (*object.Iterator, *object.Error) {
+	if len(args) != count {
+		return nil, newError(*row, *column, "%s expected %d arguments, got %d", name, count, len(args))
+	}
+	return structure.(*object.Iterator), nil
+}
+
+func lazyCallback(budget *object.Budget, name string, row, column *int, structure object.Object, args []object.Object, returns string) (*object.Iterator, *callback, *object.Error) {
+	it, err := lazyMethod(name, row, column, structure, args, 1)
+	if err != nil {
+		return nil, nil, err
+	}
+	// the values are only computed later, when the position the method
+	// was called at may have changed
+	r, c := *row, *column
+	fn, err := newCallback(budget, name, args[0], 1, returns, &r, &c)
+	if err != nil {
+		return nil, nil, err
+	}
+	return it, fn, nil
+}
+
+// checks value i of an iterator against the parameter of the function,
+// like checkElements does for lists
+func (c *callback) acceptsValue(i int, value object.Object) *object.Error {
+	if c.params == nil {
+		return nil
+	}
+	return elementError(c.method, i, value, c.params[0], c.row, c.column)
+}
+
+func iteratorMap(budget *object.Budget, row *int, column *int, structure object.Object, args ...object.Object) object.Object {
+	it, c, err := lazyCallback(budget, "map", row, column, structure, args, "")
+	if err != nil {
+		return err
+	}
+	i := 0
+	return newIterator(func() object.Object {
+		value := it.Next()
+		if value == nil || isError(value) {
+			return value
+		}
+		if err := c.acceptsValue(i, value); err != nil {
+			return err
+		}
+		i++
+		return c.call(value)
+	})
+}
+
+func iteratorFilter(budget *object.Budget, row *int, column *int, structure object.Object, args ...object.Object) object.Object {
+	it, c, err := lazyCallback(budget, "filter", row, column, structure, args, "Bool")
+	if err != nil {
+		return err
+	}
+	i := 0
+	return newIterator(func() object.Object {
+		for {
+			if err := Step(budget, *c.row, *c.column); err != nil {
+				return err
+			}
+			value := it.Next()
+			if value == nil || isError(value) {
+				return value
+			}
+			if err := c.acceptsValue(i, value); err != nil {
+				return err
+			}
+			i++
+			keep, err := c.test(value)
+			if err != nil {
+				return err
+			}
+			if keep {
+				return value
+			}
+		}
+	})
+}
+
+func iteratorTake(budget *object.Budget, row *int, column *int, structure object.Object, args ...object.Object) object.Object {
+	it, err := lazyMethod("take", row, column, structure, args, 1)
+	if err != nil {
+		return err
+	}
+	n, err := countArgument("take", row, column, args, 0)
+	if err != nil {
+		return err
+	}
+	return newIterator(func() object.Object {
+		if n == 0 {
+			return nil
+		}
+		n--
+		return it.Next()
+	})
+}
+
+func iteratorDrop(budget *object.Budget, row *int, column *int, structure object.Object, args ...object.Object) object.Object {
+	it, err := lazyMethod("drop", row, column, structure, args, 1)
+	if err != nil {
+		return err
+	}
+	n, err := countArgument("drop", row, column, args, 0)
+	if err != nil {
+		return err
+	}
+	r, c := *row, *column
+	return newIterator(func() object.Object {
+		for ; n > 0; n-- {
+			if err := Step(budget, r, c); err != nil {
+				return err
+			}
+			if value := it.Next(); value == nil || isError(value) {
+				return value
+			}
+		}
+		return it.Next()
+	})
+}
+
+func iteratorTakeWhile(budget *object.Budget, row *int, column *int, structure object.Object, args ...object.Object) object.Object {
+	it, c, err := lazyCallback(budget, "take_while", row, column, structure, args, "Bool")
+	if err != nil {
+		return err
+	}
+	i, done := 0, false
+	return newIterator(func() object.Object {
+		if done {
+			return nil
+		}
+		value := it.Next()
+		if value == nil || isError(value) {
+			return value
+		}
+		if err := c.acceptsValue(i, value); err != nil {
+			return err
+		}
+		i++
+		keep, err := c.test(value)
+		if err != nil {
+			return err
+		}
+		if !keep {
+			done = true
+			return nil
+		}
+		return value
+	})
+}
+
+// the lists, strings, maps, ranges and iterators zip and chain take
+func iterableArgument(name string, row, column *int, arg object.Object) (*object.Iterator, *object.Error) {
+	it, ok := iterate(arg)
+	if !ok {
+		return nil, newError(*row, *column, "%s expected argument 1 to be a List, Map, String, Range or Iterator, got=%s",
+			name, arg.Type())
+	}
+	return it, nil
+}
+
+// it.zip(other) pairs the values of both in [a, b] lists until one of
+// them runs out
+func iteratorZip(budget *object.Budget, row *int, column *int, structure object.Object, args ...object.Object) object.Object {
+	it, err := lazyMethod("zip", row, column, structure, args, 1)
+	if err != nil {
+		return err
+	}
+	other, err := iterableArgument("zip", row, column, args[0])
+	if err != nil {
+		return err
+	}
+	return newIterator(func() object.Object {
+		a := it.Next()
+		if a == nil || isError(a) {
+			return a
+		}
+		b := other.Next()
+		if b == nil || isError(b) {
+			return b
+		}
+		return newList([]object.Object{a, b})
+	})
+}
+
+func iteratorEnumerate(budget *object.Budget, row *int, column *int, structure object.Object, args ...object.Object) object.Object {
+	it, err := lazyMethod("enumerate", row, column, structure, args, 0)
+	if err != nil {
+		return err
+	}
+	i := int64(0)
+	return newIterator(func() object.Object {
+		value := it.Next()
+		if value == nil || isError(value) {
+			return value
+		}
+		i++
+		return newList([]object.Object{&object.Integer{Value: i - 1}, value})
+	})
+}
+
+// it.chain(other) is the values of it and then the ones of other
+func iteratorChain(budget *object.Budget, row *int, column *int, structure object.Object, args ...object.Object) object.Object {
+	it, err := lazyMethod("chain", row, column, structure, args, 1)
+	if err != nil {
+		return err
+	}
+	other, err := iterableArgument("chain", row, column, args[0])
+	if err != nil {
+		return err
+	}
+	return newIterator(func() object.Object {
+		if value := it.Next(); value != nil {
+			return value
+		}
+		return other.Next()
+	})
+}
+
+// (a..b).step(n) takes every n-th integer, counting down from a when n
+// is negative
+// The methods below go through the values of an iterator one at a time
+// instead of collecting them into a list first, and stop as soon as they
+// know their result.
+
+// calls f with each value of it and its index until f returns false,
+// each value a step. The result is the first error, if any.
+func eachValue(budget *object.Budget, it *object.Iterator, row, column *int, f func(i int, value object.Object) (bool, object.Object)) object.Object {
+	for i := 0; ; i++ {
+		if err := Step(budget, *row, *column); err != nil {
+			return err
+		}
+		value := it.Next()
+		if value == nil {
+			return nil
+		}
+		if isError(value) {
+			return value
+		}
+		more, err := f(i, value)
+		if err != nil {
+			return err
+		}
+		if !more {
+			return nil
+		}
+	}
+}
+
+// the number of values of it, which uses them up
+func countValues(budget *object.Budget, it *object.Iterator, row, column *int) (int64, object.Object) {
+	var n int64
+	err := eachValue(budget, it, row, column, func(int, object.Object) (bool, object.Object) {
+		n++
+		return true, nil
+	})
+	return n, err
+}
+
+// the index of the first value of it equal to x, -1 when there is none
+func indexOfValue(budget *object.Budget, it *object.Iterator, x object.Object, row, column *int) (int, object.Object) {
+	index := -1
+	err := eachValue(budget, it, row, column, func(i int, value object.Object) (bool, object.Object) {
+		if valuesEqual(value, x) {
+			index = i
+			return false, nil
+		}
+		return true, nil
+	})
+	return index, err
+}
+
+// the first value of it for which c is want, nil when there is none
+func findValue(budget *object.Budget, it *object.Iterator, c *callback, want bool, row, column *int) (object.Object, object.Object) {
+	var found object.Object
+	err := eachValue(budget, it, row, column, func(i int, value object.Object) (bool, object.Object) {
+		if err := c.acceptsValue(i, value); err != nil {
+			return false, err
+		}
+		ok, err := c.test(value)
+		if err != nil {
+			return false, err
+		}
+		if ok == want {
+			found = value
+			return false, nil
+		}
+		return true, nil
+	})
+	return found, err
+}
+
+func iteratorLen(budget *object.Budget, row *int, column *int, structure object.Object, args ...object.Object) object.Object {
+	it, err := lazyMethod("len", row, column, structure, args, 0)
+	if err != nil {
+		return err
+	}
+	n, failed := countValues(budget, it, row, column)
+	if failed != nil {
+		return failed
+	}
+	return &object.Integer{Value: n}
+}
+
+func iteratorFirst(budget *object.Budget, row *int, column *int, structure object.Object, args ...object.Object) object.Object {
+	it, err := lazyMethod("first", row, column, structure, args, 0)
+	if err != nil {
+		return err
+	}
+	value := it.Next()
+	if value == nil {
+		return NONE
+	}
+	if isError(value) {
+		return value
+	}
+	return NewSome(value)
+}
+
+func iteratorContains(budget *object.Budget, row *int, column *int, structure object.Object, args ...object.Object) object.Object {
+	it, err := lazyMethod("contains", row, column, structure, args, 1)
+	if err != nil {
+		return err
+	}
+	index, failed := indexOfValue(budget, it, args[0], row, column)
+	if failed != nil {
+		return failed
+	}
+	return evalBoolean(index >= 0)
+}
+
+func iteratorIndexOf(budget *object.Budget, row *int, column *int, structure object.Object, args ...object.Object) object.Object {
+	it, err := lazyMethod("index_of", row, column, structure, args, 1)
+	if err != nil {
+		return err
+	}
+	index, failed := indexOfValue(budget, it, args[0], row, column)
+	if failed != nil {
+		return failed
+	}
+	if index < 0 {
+		return NONE
+	}
+	return NewSome(&object.Integer{Value: int64(index)})
+}
+
+func iteratorFind(budget *object.Budget, row *int, column *int, structure object.Object, args ...object.Object) object.Object {
+	it, c, err := lazyCallback(budget, "find", row, column, structure, args, "Bool")
+	if err != nil {
+		return err
+	}
+	found, failed := findValue(budget, it, c, true, row, column)
+	if failed != nil {
+		return failed
+	}
+	if found == nil {
+		return NONE
+	}
+	return NewSome(found)
+}
+
+func iteratorAny(budget *object.Budget, row *int, column *int, structure object.Object, args ...object.Object) object.Object {
+	it, c, err := lazyCallback(budget, "any", row, column, structure, args, "Bool")
+	if err != nil {
+		return err
+	}
+	found, failed := findValue(budget, it, c, true, row, column)
+	if failed != nil {
+		return failed
+	}
+	return evalBoolean(found != nil)
+}
+
+func iteratorAll(budget *object.Budget, row *int, column *int, structure object.Object, args ...object.Object) object.Object {
+	it, c, err := lazyCallback(budget, "all", row, column, structure, args, "Bool")
+	if err != nil {
+		return err
+	}
+	found, failed := findValue(budget, it, c, false, row, column)
+	if failed != nil {
+		return failed
+	}
+	return evalBoolean(found == nil)
+}
+
+func iteratorCount(budget *object.Budget, row *int, column *int, structure object.Object, args ...object.Object) object.Object {
+	it, c, err := lazyCallback(budget, "count", row, column, structure, args, "Bool")
+	if err != nil {
+		return err
+	}
+	var count int64
+	failed := eachValue(budget, it, row, column, func(i int, value object.Object) (bool, object.Object) {
+		if err := c.acceptsValue(i, value); err != nil {
+			return false, err
+		}
+		ok, err := c.test(value)
+		if ok {
+			count++
+		}
+		return true, err
+	})
+	if failed != nil {
+		return failed
+	}
+	return &object.Integer{Value: count}
+}
+
+// the sum of the values like the one of lists, 0 without values
+func iteratorSum(budget *object.Budget, row *int, column *int, structure object.Object, args ...object.Object) object.Object {
+	it, err := lazyMethod("sum", row, column, structure, args, 0)
+	if err != nil {
+		return err
+	}
+	total := &sum{}
+	failed := eachValue(budget, it, row, column, func(i int, value object.Object) (bool, object.Object) {
+		if err := total.add(value, row, column); err != nil {
+			return false, err
+		}
+		return true, nil
+	})
+	if failed != nil {
+		return failed
+	}
+	return total.result()
+}
+
+// it.fold(init, f) is the fold of lists, over the values as they come
+func iteratorFold(budget *object.Budget, row *int, column *int, structure object.Object, args ...object.Object) object.Object {
+	it, err := lazyMethod("fold", row, column, structure, args, 2)
+	if err != nil {
+		return err
+	}
+	c, err := newCallback(budget, "fold", args[1], 2, "", row, column)
+	if err != nil {
+		return err
+	}
+	acc := args[0]
+	failed := eachValue(budget, it, row, column, func(i int, value object.Object) (bool, object.Object) {
+		if c.params != nil {
+			if err := elementError(c.method, i, value, c.params[1], c.row, c.column); err != nil {
+				return false, err
+			}
+		}
+		acc = c.call(acc, value)
+		if isError(acc) {
+			return false, acc
+		}
+		return true, nil
+	})
+	if failed != nil {
+		return failed
+	}
+	return acc
+}
+
+func rangeStep(budget *object.Budget, row *int, column *int, structure object.Object, args ...object.Object) object.Object {
+	r := structure.(*object.Range)
+	if len(args) != 1 {
+		return newError(*row, *column, "step expected %d arguments, got %d", 1, len(args))
+	}
+	step, ok := args[0].(*object.Integer)
+	if !ok {
+		return newError(*row, *column, "step expected argument 1 to be of type INTEGER, got=%s", args[0].Type())
+	}
+	if step.Value == 0 {
+		return newError(*row, *column, "step expected a step other than 0")
+	}
+	stepped := newRange(r.Start, r.End, step.Value, r.Inclusive)
+	stepped.Methods = r.Methods
+	return stepped
+}
+
+// the number of integers in a range, without going through them
+func rangeLen(budget *object.Budget, row *int, column *int, structure object.Object, args ...object.Object) object.Object {
+	if len(args) != 0 {
+		return newError(*row, *column, "len expected %d arguments, got %d", 0, len(args))
+	}
+	return &object.Integer{Value: rangeCount(structure.(*object.Range))}
+}
+
+func rangeCount(r *object.Range) int64 {
+	if !beforeEnd(r, r.Start) {
+		return 0
+	}
+	last := r.End
+	if !r.Inclusive {
+		last -= sign(r.Step)
+	}
+	return (last-r.Start)/r.Step + 1
+}
+
+func sign(n int64) int64 {
+	if n < 0 {
+		return -1
+	}
+	return 1
+}
+
+func rangeContains(budget *object.Budget, row *int, column *int, structure object.Object, args ...object.Object) object.Object {
+	r := structure.(*object.Range)
+	if len(args) != 1 {
+		return newError(*row, *column, "contains expected %d arguments, got %d", 1, len(args))
+	}
+	n, ok := args[0].(*object.Integer)
+	if !ok {
+		return FALSE
+	}
+	started := n.Value >= r.Start
+	if r.Step < 0 {
+		started = n.Value <= r.Start
+	}
+	return evalBoolean(started && beforeEnd(r, n.Value) && (n.Value-r.Start)%r.Step == 0)
+}
+
+// ForItems returns the values bound by each iteration of a for loop with
+// n variables, one at a time and nil once there are none left. One
+// variable takes the elements of a list, the characters of a string,
+// the keys of a map or the values of a range or an iterator, two take
+// the index or key as well. Maps are iterated in the order of their
+// keys.
+func ForItems(iterable object.Object, n int, row, column *int) (func() ([]object.Object, *object.Error), *object.Error) {
+	if m, ok := iterable.(*object.Map); ok {
+		pairs, i := m.SortedPairs(), 0
+		return func() ([]object.Object, *object.Error) {
+			if i == len(pairs) {
+				return nil, nil
+			}
+			i++
+			if n == 1 {
+				return []object.Object{pairs[i-1].Key}, nil
+			}
+			return []object.Object{pairs[i-1].Key, pairs[i-1].Value}, nil
+		}, nil
+	}
+
+	it, ok := iterate(iterable)
+	if !ok {
+		return nil, newError(*row, *column, "for expected a List, Map, String, Range or Iterator, got %s",
+			iterable.Type())
+	}
+	index := int64(0)
+	return func() ([]object.Object, *object.Error) {
+		value := it.Next()
+		if value == nil {
+			return nil, nil
+		}
+		if err, ok := value.(*object.Error); ok {
+			return nil, err
+		}
+		index++
+		if n == 1 {
+			return []object.Object{value}, nil
+		}
+		return []object.Object{&object.Integer{Value: index - 1}, value}, nil
+	}, nil
+}
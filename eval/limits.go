@@ -0,0 +1,110 @@
+package eval
+
+import (
+	"lang/object"
+	"math"
+)
+
+// the context is checked once every that many steps, it's too slow to
+// check on every one
+const contextInterval = 256
+
+func newFatalError(row, column int, format string, a ...interface{}) *object.Error {
+	err := newError(row, column, format, a...)
+	err.Fatal = true
+	return err
+}
+
+// Step counts a function call or a loop iteration against the budget, it
+// fails once the steps run out or the context is done
+func Step(b *object.Budget, row, column int) *object.Error {
+	if b == nil {
+		return nil
+	}
+
+	b.Steps++
+	if b.MaxSteps > 0 && b.Steps > b.MaxSteps {
+		return newFatalError(row, column, "step limit of %d exceeded", b.MaxSteps)
+	}
+	if b.Context != nil && b.Steps%contextInterval == 1 {
+		if err := b.Context.Err(); err != nil {
+			return newFatalError(row, column, "execution stopped: %s", err)
+		}
+	}
+	return nil
+}
+
+// DepthError fails a call that would nest depth function calls
+func DepthError(b *object.Budget, depth int, row, column int) *object.Error {
+	if b == nil || b.MaxDepth <= 0 || depth <= b.MaxDepth {
+		return nil
+	}
+	return newFatalError(row, column, "call depth limit of %d exceeded", b.MaxDepth)
+}
+
+// SizeError fails a list, map or string larger than the budget allows
+func SizeError(b *object.Budget, value object.Object, row, column int) *object.Error {
+	if b == nil || b.MaxSize <= 0 {
+		return nil
+	}
+
+	size := 0
+	switch value := value.(type) {
+	case *object.List:
+		size = len(value.Elements)
+	case *object.Map:
+		size = len(value.Pairs)
+	case *object.String:
+		size = len(value.Value)
+	}
+	return growthError(b, value.Type(), int64(size), row, column)
+}
+
+// growthError fails a value of type typ and the given size before it is
+// built, so a single huge string or list can't run out of memory before
+// SizeError gets to see it
+func growthError(b *object.Budget, typ object.ObjectType, size int64, row, column int) *object.Error {
+	if b == nil || b.MaxSize <= 0 || size <= int64(b.MaxSize) {
+		return nil
+	}
+	return newFatalError(row, column, "size limit of %d exceeded by a %s of size %d",
+		b.MaxSize, typ, size)
+}
+
+// the size of count copies of something of size n, saturated rather than
+// overflowing
+func repeatedSize(n int, count int64) int64 {
+	if n > 0 && count > math.MaxInt64/int64(n) {
+		return math.MaxInt64
+	}
+	return int64(n) * count
+}
+
+// a call in the tree walker, counted as a step and one level deeper
+func enterCall(b *object.Budget, row, column int) *object.Error {
+	if b == nil {
+		return nil
+	}
+	if err := Step(b, row, column); err != nil {
+		return err
+	}
+	if err := DepthError(b, b.Depth+1, row, column); err != nil {
+		return err
+	}
+	b.Depth++
+	return nil
+}
+
+func leaveCall(b *object.Budget) {
+	if b != nil {
+		b.Depth--
+	}
+}
+
+// the value of an expression that built a list, map or string
+func checkSize(scope *object.Scope, value object.Object, row, column int) object.Object {
+	if err := SizeError(scope.Budget(), value, row, column); err != nil {
+		return err
+	}
+	return value
+}
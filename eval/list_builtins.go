@@ -1,11 +1,14 @@
 package eval
 
 import (
+	"lang/ast"
 	"lang/object"
 	"math"
+	"sort"
+	"strings"
 )
 
-func listMax(row *int, column *int, structure object.Object, args ...object.Object) object.Object {
+func listMax(budget *object.Budget, row *int, column *int, structure object.Object, args ...object.Object) object.Object {
 	list, _ := structure.(*object.List)
 	elements := list.Elements
 	currentType := elements[0].Type()
@@ -16,23 +19,23 @@ func listMax(row *int, column *int, structure object.Object, args ...object.Obje
 		case *object.Integer:
 			if obj.Type() != currentType {
 				return newError(
-					"[%d,%d] max expected all arguments to be of same type, found %s and %s", *row, *column, currentType, obj.Type())
+					*row, *column, "max expected all arguments to be of same type, found %s and %s", currentType, obj.Type())
 			}
 			if obj.Value > int64(maxValue) {
 				maxValue = float64(obj.Value)
 			}
 		case *object.Float:
 			if obj.Type() != currentType {
-				return newError("[%d,%d] max expected all arguments to be of same type, found %s and %s", *row, *column, currentType, obj.Type())
+				return newError(*row, *column, "max expected all arguments to be of same type, found %s and %s", currentType, obj.Type())
 			}
 			if obj.Value > maxValue {
 				maxValue = obj.Value
 			}
 		case *object.List:
-			return maxFn(row, column, obj.Elements...)
+			return maxFn(budget, row, column, obj.Elements...)
 		default:
 			return newError(
-				"[%d,%d] max expected arguments to be of type INTEGER or FLOAT, found %s", *row, *column, obj.Type())
+				*row, *column, "max expected arguments to be of type INTEGER or FLOAT, found %s", obj.Type())
 		}
 	}
 	if currentType == object.INTEGER_OBJ {
@@ -42,104 +45,62 @@ func listMax(row *int, column *int, structure object.Object, args ...object.Obje
 	}
 }
 
-func listMap(row *int, column *int, list object.Object, args ...object.Object) object.Object {
-	var newElements []object.Object
-	l, _ := list.(*object.List)
-
-	if len(args) != 1 {
-		return newError("[%d,%d] map expected 1 argument, got=%d", *row, *column, len(args))
+// xs.map(f) is the list of f(x) for each x of xs
+func listMap(budget *object.Budget, row *int, column *int, list object.Object, args ...object.Object) object.Object {
+	l, c, err := listCallback(budget, "map", row, column, list, args, "")
+	if err != nil {
+		return err
 	}
-
-	switch fn := args[0].(type) {
-	case *object.Function:
-		if len(fn.Parameters) != 1 {
-			return newError(
-				"[%d,%d] map expected its argument to have a single argument, got=%d", *row, *column, len(fn.Parameters))
-		}
-		for _, elem := range l.Elements {
-			newElements = append(newElements, callFunction(fn, []object.Object{elem}, row, column))
+	elements := make([]object.Object, 0, len(l.Elements))
+	for _, elem := range l.Elements {
+		result := c.call(elem)
+		if isError(result) {
+			return result
 		}
-		return newList(newElements)
-	case *object.BuiltinFunc:
-		for _, elem := range l.Elements {
-			newElements = append(newElements, callFunction(fn, []object.Object{elem}, row, column))
-		}
-		return newList(newElements)
-	default:
-		return newError(
-			"[%d,%d] map expected its argument to be a function, got=%s",
-			*row,
-			*column,
-			args[0].Type(),
-		)
+		elements = append(elements, result)
 	}
+	return newList(elements)
 }
 
-func listFilter(row *int, column *int, list object.Object, args ...object.Object) object.Object {
-	var newElements []object.Object
-	l, _ := list.(*object.List)
-	if len(args) != 1 {
-		return newError("[%d,%d] filter expected 1 argument, got=%d", *row, *column, len(args))
+// xs.filter(f) is the elements x of xs for which f(x) is true
+func listFilter(budget *object.Budget, row *int, column *int, list object.Object, args ...object.Object) object.Object {
+	l, c, err := listCallback(budget, "filter", row, column, list, args, "Bool")
+	if err != nil {
+		return err
 	}
-	switch fn := args[0].(type) {
-	case *object.Function:
-		if len(fn.Parameters) != 1 {
-			return newError(
-				"[%d,%d] filter expected its argument to have a single argument, got=%d", *row, *column, len(fn.Parameters))
+	elements := []object.Object{}
+	for _, elem := range l.Elements {
+		keep, err := c.test(elem)
+		if err != nil {
+			return err
 		}
-		if fn.ReturnType != "Bool" {
-			return newError(
-				"[%d,%d] filter expected its argument to return a Boolean, got=%s", *row, *column, fn.ReturnType)
+		if keep {
+			elements = append(elements, elem)
 		}
-		for _, elem := range l.Elements {
-			if callFunction(fn, []object.Object{elem}, row, column).(*object.Boolean).Value {
-				newElements = append(newElements, elem)
-			}
-		}
-		return newList(newElements)
-	case *object.BuiltinFunc:
-		for _, elem := range l.Elements {
-			ret := callFunction(fn, []object.Object{elem}, row, column)
-			val, ok := ret.(*object.Boolean)
-			if !ok {
-				return newError(
-					"[%d,%d] filter expected its argument to return a Boolean, got=%s", *row, *column, ret.Type())
-			}
-			if val.Value {
-				newElements = append(newElements, elem)
-			}
-		}
-		return newList(newElements)
-	default:
-		return newError(
-			"[%d,%d] map expected its argument to be a function, got=%s",
-			*row,
-			*column,
-			args[0].Type(),
-		)
 	}
+	return newList(elements)
 }
 
-func listLen(row *int, column *int, list object.Object, args ...object.Object) object.Object {
+func listLen(budget *object.Budget, row *int, column *int, list object.Object, args ...object.Object) object.Object {
 	l, _ := list.(*object.List)
 	if len(args) != 0 {
-		return newError("[%d,%d] len expected %d arguments, got %d", *row, *column, 0, len(args))
+		return newError(*row, *column, "len expected %d arguments, got %d", 0, len(args))
 	}
 	return &object.Integer{Value: int64(len(l.Elements))}
 }
 
-func listSlice(row *int, column *int, list object.Object, args ...object.Object) object.Object {
+func listSlice(budget *object.Budget, row *int, column *int, list object.Object, args ...object.Object) object.Object {
 	l, _ := list.(*object.List)
 	if len(args) != 2 {
-		return newError("[%d,%d] slice expected %d arguments, got %d", *row, *column, 2, len(args))
+		return newError(*row, *column, "slice expected %d arguments, got %d", 2, len(args))
 	}
 	arg1, ok1 := args[0].(*object.Integer)
 	arg2, ok2 := args[1].(*object.Integer)
 	if !ok1 || !ok2 {
 		return newError(
-			"[%d,%d] slice expected arguments to be of type INTEGER, got=%s and %s",
 			*row,
 			*column,
+			"slice expected arguments to be of type INTEGER, got=%s and %s",
 			args[0].Type(),
 			args[1].Type(),
 		)
@@ -151,10 +112,10 @@ func listSlice(row *int, column *int, list object.Object, args ...object.Object)
 	return newList(newElements)
 }
 
-func listReverse(row *int, column *int, list object.Object, args ...object.Object) object.Object {
+func listReverse(budget *object.Budget, row *int, column *int, list object.Object, args ...object.Object) object.Object {
 	l, _ := list.(*object.List)
 	if len(args) != 0 {
-		return newError("[%d,%d] slice expected %d arguments, got %d", *row, *column, 0, len(args))
+		return newError(*row, *column, "slice expected %d arguments, got %d", 0, len(args))
 	}
 	var newElements []object.Object
 	for i := len(l.Elements) - 1; i >= 0; i-- {
@@ -163,17 +124,17 @@ func listReverse(row *int, column *int, list object.Object, args ...object.Objec
 	return newList(newElements)
 }
 
-func listUpdate(row *int, column *int, list object.Object, args ...object.Object) object.Object {
+func listUpdate(budget *object.Budget, row *int, column *int, list object.Object, args ...object.Object) object.Object {
 	l, _ := list.(*object.List)
 	if len(args) != 2 {
-		return newError("[%d,%d] update expected %d arguments, got %d", *row, *column, 2, len(args))
+		return newError(*row, *column, "update expected %d arguments, got %d", 2, len(args))
 	}
 	arg1, ok := args[0].(*object.Integer)
 	if !ok {
 		return newError(
-			"[%d,%d] update expected first argument to be of type INTEGER, got=%s",
 			*row,
 			*column,
+			"update expected first argument to be of type INTEGER, got=%s",
 			args[0].Type(),
 		)
 	}
@@ -187,3 +148,808 @@ func listUpdate(row *int, column *int, list object.Object, args ...object.Object
 	}
 	return newList(newElements)
 }
+
+// checks the elements of the list against the parameter of the callback
+func checkElements(name string, l *object.List, param *ast.Identifier, row *int, column *int) object.Object {
+	for i, elem := range l.Elements {
+		if err := elementError(name, i, elem, param, row, column); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func elementError(name string, i int, elem object.Object, param *ast.Identifier, row *int, column *int) *object.Error {
+	m := matchType(elem, param.Type)
+	if m == nil {
+		return nil
+	}
+
+	if m.path == "" {
+		return newError(*row, *column, "%s expected element %d to be of type %s, got %s",
+			name, i, m.expected, m.actual)
+	}
+	return newError(*row, *column, "%s expected %s of element %d to be of type %s, got %s",
+		name, m.path, i, m.expected, m.actual)
+}
+
+// get is the index operator without the out of range error
+func listGet(budget *object.Budget, row *int, column *int, list object.Object, args ...object.Object) object.Object {
+	l, _ := list.(*object.List)
+	if len(args) != 1 {
+		return newError(*row, *column, "get expected %d arguments, got %d", 1, len(args))
+	}
+
+	index, ok := args[0].(*object.Integer)
+	if !ok {
+		return newError(*row, *column, "get expected argument to be of type INTEGER, got=%s", args[0].Type())
+	}
+
+	if index.Value < 0 || index.Value >= int64(len(l.Elements)) {
+		return NONE
+	}
+	return NewSome(l.Elements[index.Value])
+}
+
+// xs.join(sep) puts sep between the strings of xs
+func listJoin(budget *object.Budget, row *int, column *int, list object.Object, args ...object.Object) object.Object {
+	l, _ := list.(*object.List)
+	if len(args) != 1 {
+		return newError(*row, *column, "join expected %d arguments, got %d", 1, len(args))
+	}
+	sep, err := stringArgument("join", row, column, args, 0)
+	if err != nil {
+		return err
+	}
+
+	values := make([]string, len(l.Elements))
+	for i, element := range l.Elements {
+		s, ok := element.(*object.String)
+		if !ok {
+			return newError(*row, *column, "join expected a list of STRINGs, found %s", element.Type())
+		}
+		values[i] = s.Value
+	}
+	return newString(strings.Join(values, sep))
+}
+
+// a function passed to a list method, checked once like listMap checks
+// its argument before calling it on the elements
+type callback struct {
+	method      string
+	fn          object.Object
+	budget      *object.Budget
+	params      []*ast.Identifier // nil for builtin functions
+	row, column *int
+}
+
+// the function argument of method, which must take arity arguments and,
+// when returns is set and the function declares its result, return it
+func newCallback(budget *object.Budget, method string, arg object.Object, arity int, returns string, row, column *int) (*callback, *object.Error) {
+	c := &callback{method: method, fn: arg, budget: budget, row: row, column: column}
+	var returnType *ast.TypeNode
+	switch fn := arg.(type) {
+	case *object.Function:
+		c.params, returnType = fn.Parameters, fn.ReturnType
+	case *object.Closure:
+		c.params, returnType = fn.Fn.Parameters, fn.Fn.ReturnType
+	case *object.BuiltinFunc, *object.BuiltinMeth:
+		return c, nil
+	default:
+		return nil, newError(*row, *column, "%s expected its argument to be a function, got=%s", method, arg.Type())
+	}
+
+	if len(c.params) != arity {
+		return nil, newError(*row, *column, "%s expected its argument to take %d arguments, got=%d",
+			method, arity, len(c.params))
+	}
+	if returns != "" && returnType != nil && returnType.String() != returns {
+		return nil, newError(*row, *column, "%s expected its argument to return %s, got=%s",
+			method, returns, returnType)
+	}
+	return c, nil
+}
+
+// checks the elements of l against the parameter i of the function
+func (c *callback) accepts(l *object.List, i int) *object.Error {
+	if c.params == nil {
+		return nil
+	}
+	if err := checkElements(c.method, l, c.params[i], c.row, c.column); err != nil {
+		return err.(*object.Error)
+	}
+	return nil
+}
+
+func (c *callback) call(args ...object.Object) object.Object {
+	return callFunction(c.budget, c.fn, args, c.row, c.column)
+}
+
+// calls a predicate, the result is an error when it doesn't return a Bool
+func (c *callback) test(args ...object.Object) (bool, object.Object) {
+	result := c.call(args...)
+	if isError(result) {
+		return false, result
+	}
+	b, ok := result.(*object.Boolean)
+	if !ok {
+		return false, newError(*c.row, *c.column, "%s expected its argument to return a Boolean, got=%s",
+			c.method, result.Type())
+	}
+	return b.Value, nil
+}
+
+// the receiver of a list method, which takes count arguments
+func listMethod(name string, row, column *int, list object.Object, args []object.Object, count int) (*object.List, *object.Error) {
+	if len(args) != count {
+		return nil, newError(*row, *column, "%s expected %d arguments, got %d", name, count, len(args))
+	}
+	l, _ := list.(*object.List)
+	return l, nil
+}
+
+// a list method that calls its only argument with each element, which
+// must return returns when set
+func listCallback(budget *object.Budget, name string, row, column *int, list object.Object, args []object.Object, returns string) (*object.List, *callback, *object.Error) {
+	l, err := listMethod(name, row, column, list, args, 1)
+	if err != nil {
+		return nil, nil, err
+	}
+	c, err := newCallback(budget, name, args[0], 1, returns, row, column)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := c.accepts(l, 0); err != nil {
+		return nil, nil, err
+	}
+	return l, c, nil
+}
+
+// the count argument of take, drop, chunk and window, at least min
+func countArgument(name string, row, column *int, args []object.Object, min int64) (int, *object.Error) {
+	n, ok := args[0].(*object.Integer)
+	if !ok {
+		return 0, newError(*row, *column, "%s expected argument 1 to be of type INTEGER, got=%s", name, args[0].Type())
+	}
+	if n.Value < min {
+		return 0, newError(*row, *column, "%s expected a count of at least %d, got %d", name, min, n.Value)
+	}
+	if n.Value > math.MaxInt32 {
+		return math.MaxInt32, nil
+	}
+	return int(n.Value), nil
+}
+
+// xs.fold(init, f) is f(...f(f(init, xs[0]), xs[1])..., xs[n-1])
+func listFold(budget *object.Budget, row *int, column *int, list object.Object, args ...object.Object) object.Object {
+	l, err := listMethod("fold", row, column, list, args, 2)
+	if err != nil {
+		return err
+	}
+	c, err := newCallback(budget, "fold", args[1], 2, "", row, column)
+	if err != nil {
+		return err
+	}
+	if err := c.accepts(l, 1); err != nil {
+		return err
+	}
+
+	acc := args[0]
+	for _, elem := range l.Elements {
+		if err := Step(budget, *row, *column); err != nil {
+			return err
+		}
+		acc = c.call(acc, elem)
+		if isError(acc) {
+			return acc
+		}
+	}
+	return acc
+}
+
+// xs.reduce(f) folds xs starting from its first element, and is None
+// when xs is empty
+func listReduce(budget *object.Budget, row *int, column *int, list object.Object, args ...object.Object) object.Object {
+	l, err := listMethod("reduce", row, column, list, args, 1)
+	if err != nil {
+		return err
+	}
+	c, err := newCallback(budget, "reduce", args[0], 2, "", row, column)
+	if err != nil {
+		return err
+	}
+	if err := c.accepts(l, 1); err != nil {
+		return err
+	}
+	if len(l.Elements) == 0 {
+		return NONE
+	}
+
+	acc := l.Elements[0]
+	for _, elem := range l.Elements[1:] {
+		if err := Step(budget, *row, *column); err != nil {
+			return err
+		}
+		acc = c.call(acc, elem)
+		if isError(acc) {
+			return acc
+		}
+	}
+	return NewSome(acc)
+}
+
+// the sum of a list of numbers, 0 when it's empty
+func listSum(budget *object.Budget, row *int, column *int, list object.Object, args ...object.Object) object.Object {
+	l, err := listMethod("sum", row, column, list, args, 0)
+	if err != nil {
+		return err
+	}
+
+	total := &sum{}
+	for _, elem := range l.Elements {
+		if err := total.add(elem, row, column); err != nil {
+			return err
+		}
+	}
+	return total.result()
+}
+
+// a sum that mixes Ints and Floats like + does, it is a Float once one
+// of the numbers is
+type sum struct {
+	ints    int64
+	floats  float64
+	isFloat bool
+}
+
+func (s *sum) add(value object.Object, row, column *int) *object.Error {
+	switch value := value.(type) {
+	case *object.Integer:
+		s.ints += value.Value
+	case *object.Float:
+		s.floats += value.Value
+		s.isFloat = true
+	default:
+		return newError(*row, *column, "sum expected elements of type INTEGER or FLOAT, found %s", value.Type())
+	}
+	return nil
+}
+
+func (s *sum) result() object.Object {
+	if s.isFloat {
+		return &object.Float{Value: float64(s.ints) + s.floats}
+	}
+	return &object.Integer{Value: s.ints}
+}
+
+// the smallest element in the order of sort, None when xs is empty like
+// for reduce, first and last
+func listMin(budget *object.Budget, row *int, column *int, list object.Object, args ...object.Object) object.Object {
+	l, err := listMethod("min", row, column, list, args, 0)
+	if err != nil {
+		return err
+	}
+	if len(l.Elements) == 0 {
+		return NONE
+	}
+
+	least := l.Elements[0]
+	for _, elem := range l.Elements[1:] {
+		order, ok := compareValues(elem, least)
+		if !ok {
+			return newError(*row, *column, "min can't compare %s and %s", least.Type(), elem.Type())
+		}
+		if order < 0 {
+			least = elem
+		}
+	}
+	return NewSome(least)
+}
+
+// xs.sort() orders numbers, strings, booleans and lists of them, equal
+// elements keep their order
+func listSort(budget *object.Budget, row *int, column *int, list object.Object, args ...object.Object) object.Object {
+	l, err := listMethod("sort", row, column, list, args, 0)
+	if err != nil {
+		return err
+	}
+	return sortedBy(budget, "sort", row, column, l.Elements, l.Elements)
+}
+
+// xs.sort_by(f) orders xs like sort orders the keys f(x)
+func listSortBy(budget *object.Budget, row *int, column *int, list object.Object, args ...object.Object) object.Object {
+	l, c, err := listCallback(budget, "sort_by", row, column, list, args, "")
+	if err != nil {
+		return err
+	}
+	keys := make([]object.Object, len(l.Elements))
+	for i, elem := range l.Elements {
+		keys[i] = c.call(elem)
+		if isError(keys[i]) {
+			return keys[i]
+		}
+	}
+	return sortedBy(budget, "sort_by", row, column, l.Elements, keys)
+}
+
+// the elements in the order of their keys
+func sortedBy(budget *object.Budget, name string, row, column *int, elements, keys []object.Object) object.Object {
+	order := make([]int, len(elements))
+	for i := range order {
+		order[i] = i
+	}
+
+	var err object.Object
+	sort.SliceStable(order, func(i, j int) bool {
+		// every comparison is a step, the rest of the sort is cheap once
+		// one of them failed
+		if err != nil {
+			return false
+		}
+		if stepErr := Step(budget, *row, *column); stepErr != nil {
+			err = stepErr
+			return false
+		}
+		a, b := keys[order[i]], keys[order[j]]
+		cmp, ok := compareValues(a, b)
+		if !ok {
+			err = newError(*row, *column, "%s can't compare %s and %s", name, a.Type(), b.Type())
+		}
+		return cmp < 0
+	})
+	if err != nil {
+		return err
+	}
+
+	sorted := make([]object.Object, len(elements))
+	for i, index := range order {
+		sorted[i] = elements[index]
+	}
+	return newList(sorted)
+}
+
+// the natural order of two values of the same type, or of two numbers,
+// false when they can't be compared
+func compareValues(a, b object.Object) (int, bool) {
+	switch a := a.(type) {
+	case *object.Integer:
+		switch b := b.(type) {
+		case *object.Integer:
+			return compareOrdered(a.Value < b.Value, a.Value > b.Value), true
+		case *object.Float:
+			// Ints and Floats compare like < does, as Floats
+			return compareValues(&object.Float{Value: float64(a.Value)}, b)
+		}
+		return 0, false
+	case *object.Float:
+		switch b := b.(type) {
+		case *object.Float:
+			return compareOrdered(a.Value < b.Value, a.Value > b.Value), true
+		case *object.Integer:
+			return compareValues(a, &object.Float{Value: float64(b.Value)})
+		}
+		return 0, false
+	case *object.String:
+		b, ok := b.(*object.String)
+		if !ok {
+			return 0, false
+		}
+		return strings.Compare(a.Value, b.Value), true
+	case *object.Boolean:
+		b, ok := b.(*object.Boolean)
+		if !ok {
+			return 0, false
+		}
+		return compareOrdered(!a.Value && b.Value, a.Value && !b.Value), true
+	case *object.List:
+		b, ok := b.(*object.List)
+		if !ok {
+			return 0, false
+		}
+		for i := 0; i < len(a.Elements) && i < len(b.Elements); i++ {
+			if cmp, ok := compareValues(a.Elements[i], b.Elements[i]); !ok || cmp != 0 {
+				return cmp, ok
+			}
+		}
+		return compareOrdered(len(a.Elements) < len(b.Elements), len(a.Elements) > len(b.Elements)), true
+	default:
+		return 0, false
+	}
+}
+
+func compareOrdered(less, greater bool) int {
+	switch {
+	case less:
+		return -1
+	case greater:
+		return 1
+	default:
+		return 0
+	}
+}
+
+// xs.zip(ys) pairs the elements of xs and ys in [x, y] lists, as many as
+// the shorter one has. ys can be anything a for loop goes through.
+func listZip(budget *object.Budget, row *int, column *int, list object.Object, args ...object.Object) object.Object {
+	l, err := listMethod("zip", row, column, list, args, 1)
+	if err != nil {
+		return err
+	}
+	other, err := iterableArgument("zip", row, column, args[0])
+	if err != nil {
+		return err
+	}
+
+	pairs := []object.Object{}
+	for _, elem := range l.Elements {
+		value := other.Next()
+		if value == nil {
+			break
+		}
+		if isError(value) {
+			return value
+		}
+		pairs = append(pairs, newList([]object.Object{elem, value}))
+	}
+	return newList(pairs)
+}
+
+// xs.enumerate() pairs the elements with their indexes in [i, x] lists
+func listEnumerate(budget *object.Budget, row *int, column *int, list object.Object, args ...object.Object) object.Object {
+	l, err := listMethod("enumerate", row, column, list, args, 0)
+	if err != nil {
+		return err
+	}
+	pairs := make([]object.Object, len(l.Elements))
+	for i, elem := range l.Elements {
+		pairs[i] = newList([]object.Object{&object.Integer{Value: int64(i)}, elem})
+	}
+	return newList(pairs)
+}
+
+// xs.flat_map(f) concatenates the lists f(x)
+func listFlatMap(budget *object.Budget, row *int, column *int, list object.Object, args ...object.Object) object.Object {
+	l, c, err := listCallback(budget, "flat_map", row, column, list, args, "")
+	if err != nil {
+		return err
+	}
+	elements := []object.Object{}
+	for _, elem := range l.Elements {
+		result := c.call(elem)
+		if isError(result) {
+			return result
+		}
+		inner, err, ok := listValues(budget, result, row, column)
+		if !ok {
+			return newError(*row, *column, "flat_map expected its argument to return a LIST, RANGE or ITERATOR, got=%s", result.Type())
+		}
+		if err != nil {
+			return err
+		}
+		if err := growthError(budget, object.LIST_OBJ, int64(len(elements)+len(inner)), *row, *column); err != nil {
+			return err
+		}
+		elements = append(elements, inner...)
+	}
+	return newList(elements)
+}
+
+// xs.flatten() concatenates the lists in xs
+func listFlatten(budget *object.Budget, row *int, column *int, list object.Object, args ...object.Object) object.Object {
+	l, err := listMethod("flatten", row, column, list, args, 0)
+	if err != nil {
+		return err
+	}
+	elements := []object.Object{}
+	for _, elem := range l.Elements {
+		inner, err, ok := listValues(budget, elem, row, column)
+		if !ok {
+			return newError(*row, *column, "flatten expected a list of LISTs, found %s", elem.Type())
+		}
+		if err != nil {
+			return err
+		}
+		if err := growthError(budget, object.LIST_OBJ, int64(len(elements)+len(inner)), *row, *column); err != nil {
+			return err
+		}
+		elements = append(elements, inner...)
+	}
+	return newList(elements)
+}
+
+// xs.find(f) is Some of the first x for which f(x) is true, or None
+func listFind(budget *object.Budget, row *int, column *int, list object.Object, args ...object.Object) object.Object {
+	l, c, err := listCallback(budget, "find", row, column, list, args, "Bool")
+	if err != nil {
+		return err
+	}
+	for _, elem := range l.Elements {
+		found, err := c.test(elem)
+		if err != nil {
+			return err
+		}
+		if found {
+			return NewSome(elem)
+		}
+	}
+	return NONE
+}
+
+// xs.index_of(x) is Some of the index of the first element equal to x,
+// or None
+func listIndexOf(budget *object.Budget, row *int, column *int, list object.Object, args ...object.Object) object.Object {
+	l, err := listMethod("index_of", row, column, list, args, 1)
+	if err != nil {
+		return err
+	}
+	for i, elem := range l.Elements {
+		if valuesEqual(elem, args[0]) {
+			return NewSome(&object.Integer{Value: int64(i)})
+		}
+	}
+	return NONE
+}
+
+func listContains(budget *object.Budget, row *int, column *int, list object.Object, args ...object.Object) object.Object {
+	l, err := listMethod("contains", row, column, list, args, 1)
+	if err != nil {
+		return err
+	}
+	for _, elem := range l.Elements {
+		if valuesEqual(elem, args[0]) {
+			return TRUE
+		}
+	}
+	return FALSE
+}
+
+// xs.any(f) is true when f(x) is for some x, it stops at the first
+func listAny(budget *object.Budget, row *int, column *int, list object.Object, args ...object.Object) object.Object {
+	l, c, err := listCallback(budget, "any", row, column, list, args, "Bool")
+	if err != nil {
+		return err
+	}
+	for _, elem := range l.Elements {
+		found, err := c.test(elem)
+		if err != nil {
+			return err
+		}
+		if found {
+			return TRUE
+		}
+	}
+	return FALSE
+}
+
+// xs.all(f) is true when f(x) is for every x, it stops at the first
+// that isn't
+func listAll(budget *object.Budget, row *int, column *int, list object.Object, args ...object.Object) object.Object {
+	l, c, err := listCallback(budget, "all", row, column, list, args, "Bool")
+	if err != nil {
+		return err
+	}
+	for _, elem := range l.Elements {
+		ok, err := c.test(elem)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return FALSE
+		}
+	}
+	return TRUE
+}
+
+// xs.count(f) is the number of elements for which f(x) is true
+func listCount(budget *object.Budget, row *int, column *int, list object.Object, args ...object.Object) object.Object {
+	l, c, err := listCallback(budget, "count", row, column, list, args, "Bool")
+	if err != nil {
+		return err
+	}
+	count := 0
+	for _, elem := range l.Elements {
+		ok, err := c.test(elem)
+		if err != nil {
+			return err
+		}
+		if ok {
+			count++
+		}
+	}
+	return &object.Integer{Value: int64(count)}
+}
+
+// xs.take(n) is the first n elements of xs, or xs when it is shorter
+func listTake(budget *object.Budget, row *int, column *int, list object.Object, args ...object.Object) object.Object {
+	l, err := listMethod("take", row, column, list, args, 1)
+	if err != nil {
+		return err
+	}
+	n, err := countArgument("take", row, column, args, 0)
+	if err != nil {
+		return err
+	}
+	if n > len(l.Elements) {
+		n = len(l.Elements)
+	}
+	return newList(append([]object.Object{}, l.Elements[:n]...))
+}
+
+// xs.drop(n) is xs without its first n elements
+func listDrop(budget *object.Budget, row *int, column *int, list object.Object, args ...object.Object) object.Object {
+	l, err := listMethod("drop", row, column, list, args, 1)
+	if err != nil {
+		return err
+	}
+	n, err := countArgument("drop", row, column, args, 0)
+	if err != nil {
+		return err
+	}
+	if n > len(l.Elements) {
+		n = len(l.Elements)
+	}
+	return newList(append([]object.Object{}, l.Elements[n:]...))
+}
+
+// xs.take_while(f) is the elements of xs up to the first for which f(x)
+// is false
+func listTakeWhile(budget *object.Budget, row *int, column *int, list object.Object, args ...object.Object) object.Object {
+	l, c, err := listCallback(budget, "take_while", row, column, list, args, "Bool")
+	if err != nil {
+		return err
+	}
+	elements := []object.Object{}
+	for _, elem := range l.Elements {
+		ok, err := c.test(elem)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			break
+		}
+		elements = append(elements, elem)
+	}
+	return newList(elements)
+}
+
+// xs.chunk(n) splits xs in lists of n elements, the last may be shorter
+func listChunk(budget *object.Budget, row *int, column *int, list object.Object, args ...object.Object) object.Object {
+	l, err := listMethod("chunk", row, column, list, args, 1)
+	if err != nil {
+		return err
+	}
+	n, err := countArgument("chunk", row, column, args, 1)
+	if err != nil {
+		return err
+	}
+	chunks := []object.Object{}
+	for start := 0; start < len(l.Elements); start += n {
+		end := start + n
+		if end > len(l.Elements) {
+			end = len(l.Elements)
+		}
+		chunks = append(chunks, newList(append([]object.Object{}, l.Elements[start:end]...)))
+	}
+	return newList(chunks)
+}
+
+// xs.window(n) is every run of n consecutive elements of xs, in order
+func listWindow(budget *object.Budget, row *int, column *int, list object.Object, args ...object.Object) object.Object {
+	l, err := listMethod("window", row, column, list, args, 1)
+	if err != nil {
+		return err
+	}
+	n, err := countArgument("window", row, column, args, 1)
+	if err != nil {
+		return err
+	}
+	windows := []object.Object{}
+	for start := 0; start+n <= len(l.Elements); start++ {
+		windows = append(windows, newList(append([]object.Object{}, l.Elements[start:start+n]...)))
+	}
+	return newList(windows)
+}
+
+// xs.group_by(f) maps each key f(x) to the elements that have it, in
+// the order of xs
+func listGroupBy(budget *object.Budget, row *int, column *int, list object.Object, args ...object.Object) object.Object {
+	l, c, err := listCallback(budget, "group_by", row, column, list, args, "")
+	if err != nil {
+		return err
+	}
+	pairs := make(map[object.MapKey]object.MapPair)
+	for _, elem := range l.Elements {
+		key := c.call(elem)
+		if isError(key) {
+			return key
+		}
+		hashed, err := hashKey(row, column, key)
+		if err != nil {
+			return err
+		}
+		group, ok := pairs[hashed]
+		if !ok {
+			group = object.MapPair{Key: key, Value: newList(nil)}
+		}
+		values := group.Value.(*object.List)
+		values.Elements = append(values.Elements, elem)
+		pairs[hashed] = group
+	}
+	return newMap(pairs)
+}
+
+// xs.unique() keeps the first of the elements that are equal
+func listUnique(budget *object.Budget, row *int, column *int, list object.Object, args ...object.Object) object.Object {
+	l, err := listMethod("unique", row, column, list, args, 0)
+	if err != nil {
+		return err
+	}
+	seen := make(map[object.MapKey]bool)
+	elements := []object.Object{}
+	for _, elem := range l.Elements {
+		if key, ok := elem.(object.Hashable); ok {
+			if seen[key.MapKey()] {
+				continue
+			}
+			seen[key.MapKey()] = true
+		} else if containsValue(elements, elem) {
+			continue
+		}
+		elements = append(elements, elem)
+	}
+	return newList(elements)
+}
+
+func containsValue(elements []object.Object, value object.Object) bool {
+	for _, elem := range elements {
+		if valuesEqual(elem, value) {
+			return true
+		}
+	}
+	return false
+}
+
+// xs.push(x) is xs with x at its end
+func listPush(budget *object.Budget, row *int, column *int, list object.Object, args ...object.Object) object.Object {
+	l, err := listMethod("push", row, column, list, args, 1)
+	if err != nil {
+		return err
+	}
+	elements := make([]object.Object, 0, len(l.Elements)+1)
+	return newList(append(append(elements, l.Elements...), args[0]))
+}
+
+// xs.pop() is xs without its last element, last() is the element. An
+// empty list has none to take off and stays empty.
+func listPop(budget *object.Budget, row *int, column *int, list object.Object, args ...object.Object) object.Object {
+	l, err := listMethod("pop", row, column, list, args, 0)
+	if err != nil {
+		return err
+	}
+	if len(l.Elements) == 0 {
+		return newList([]object.Object{})
+	}
+	return newList(append([]object.Object{}, l.Elements[:len(l.Elements)-1]...))
+}
+
+func listFirst(budget *object.Budget, row *int, column *int, list object.Object, args ...object.Object) object.Object {
+	l, err := listMethod("first", row, column, list, args, 0)
+	if err != nil {
+		return err
+	}
+	if len(l.Elements) == 0 {
+		return NONE
+	}
+	return NewSome(l.Elements[0])
+}
+
+func listLast(budget *object.Budget, row *int, column *int, list object.Object, args ...object.Object) object.Object {
+	l, err := listMethod("last", row, column, list, args, 0)
+	if err != nil {
+		return err
+	}
+	if len(l.Elements) == 0 {
+		return NONE
+	}
+	return NewSome(l.Elements[len(l.Elements)-1])
+}
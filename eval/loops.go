@@ -0,0 +1,84 @@
+package eval
+
+import (
+	"lang/ast"
+	"lang/object"
+)
+
+func evalWhileStatement(node *ast.WhileStatement, scope *object.Scope) object.Object {
+	for {
+		if err := Step(scope.Budget(), node.Token.Row, node.Token.Column); err != nil {
+			return err
+		}
+		condition := Eval(node.Condition, scope)
+		if isAbrupt(condition) {
+			return condition
+		}
+		if !isTruthy(condition) {
+			return NULL
+		}
+
+		if result, done := loopSignal(Eval(node.Body, scope)); done {
+			return result
+		}
+	}
+}
+
+func evalForStatement(node *ast.ForStatement, scope *object.Scope) object.Object {
+	iterable := Eval(node.Iterable, scope)
+	if isAbrupt(iterable) {
+		return iterable
+	}
+
+	next, err := ForItems(iterable, len(node.Variables), &node.Token.Row, &node.Token.Column)
+	if err != nil {
+		return err
+	}
+
+	// like the vm, the check that finds no items left is a step too
+	for {
+		if err := Step(scope.Budget(), node.Token.Row, node.Token.Column); err != nil {
+			return err
+		}
+		values, err := next()
+		if err != nil {
+			return err
+		}
+		if values == nil {
+			return NULL
+		}
+
+		inner := object.NewInnerScope(scope)
+		for j, v := range node.Variables {
+			inner.Set(v.Value, values[j])
+		}
+
+		if result, done := loopSignal(evalBlockStatements(node.Body, inner)); done {
+			return result
+		}
+	}
+}
+
+func evalLoopExpression(node *ast.LoopExpression, scope *object.Scope) object.Object {
+	for {
+		if err := Step(scope.Budget(), node.Token.Row, node.Token.Column); err != nil {
+			return err
+		}
+		if result, done := loopSignal(Eval(node.Body, scope)); done {
+			return result
+		}
+	}
+}
+
+// what a loop does after running its body once: it stops on break,
+// return and errors and goes on otherwise
+func loopSignal(result object.Object) (object.Object, bool) {
+	switch result := result.(type) {
+	case *object.Break:
+		return result.Value, true
+	case *object.ReturnValue, *object.Error:
+		return result, true
+	default:
+		return nil, false
+	}
+}
@@ -1,3 +1,256 @@
 package eval
 
-// TODO: method to update map
+import "lang/object"
+
+// the methods of maps never change them, set, remove and the others
+// return a new map like listUpdate returns a new list. Keys, values and
+// entries come out ordered by key, see object.Map.SortedPairs.
+
+func mapLen(budget *object.Budget, row *int, column *int, structure object.Object, args ...object.Object) object.Object {
+	m, err := mapMethod("len", row, column, structure, args, 0)
+	if err != nil {
+		return err
+	}
+	return &object.Integer{Value: int64(len(m.Pairs))}
+}
+
+func mapKeys(budget *object.Budget, row *int, column *int, structure object.Object, args ...object.Object) object.Object {
+	m, err := mapMethod("keys", row, column, structure, args, 0)
+	if err != nil {
+		return err
+	}
+	keys := []object.Object{}
+	for _, pair := range m.SortedPairs() {
+		keys = append(keys, pair.Key)
+	}
+	return newList(keys)
+}
+
+func mapValues(budget *object.Budget, row *int, column *int, structure object.Object, args ...object.Object) object.Object {
+	m, err := mapMethod("values", row, column, structure, args, 0)
+	if err != nil {
+		return err
+	}
+	values := []object.Object{}
+	for _, pair := range m.SortedPairs() {
+		values = append(values, pair.Value)
+	}
+	return newList(values)
+}
+
+// m.entries() is a list of [key, value] lists, from_entries builds the
+// map back
+func mapEntries(budget *object.Budget, row *int, column *int, structure object.Object, args ...object.Object) object.Object {
+	m, err := mapMethod("entries", row, column, structure, args, 0)
+	if err != nil {
+		return err
+	}
+	return entriesOf(m)
+}
+
+// to_list is entries, named like the conversions of the other types
+func mapToList(budget *object.Budget, row *int, column *int, structure object.Object, args ...object.Object) object.Object {
+	m, err := mapMethod("to_list", row, column, structure, args, 0)
+	if err != nil {
+		return err
+	}
+	return entriesOf(m)
+}
+
+func entriesOf(m *object.Map) *object.List {
+	entries := []object.Object{}
+	for _, pair := range m.SortedPairs() {
+		entries = append(entries, newList([]object.Object{pair.Key, pair.Value}))
+	}
+	return newList(entries)
+}
+
+func mapHas(budget *object.Budget, row *int, column *int, structure object.Object, args ...object.Object) object.Object {
+	m, err := mapMethod("has", row, column, structure, args, 1)
+	if err != nil {
+		return err
+	}
+	key, err := hashKey(row, column, args[0])
+	if err != nil {
+		return err
+	}
+	_, ok := m.Pairs[key]
+	return evalBoolean(ok)
+}
+
+// get is the index operator that tells a missing key apart from NULL,
+// m.get(key) is an Option and m.get(key, default) the value or default
+func mapGet(budget *object.Budget, row *int, column *int, structure object.Object, args ...object.Object) object.Object {
+	m, _ := structure.(*object.Map)
+	if len(args) != 1 && len(args) != 2 {
+		return newError(*row, *column, "get expected 1 or 2 arguments, got %d", len(args))
+	}
+
+	key, err := hashKey(row, column, args[0])
+	if err != nil {
+		return err
+	}
+
+	pair, ok := m.Pairs[key]
+	switch {
+	case ok && len(args) == 2:
+		return pair.Value
+	case ok:
+		return NewSome(pair.Value)
+	case len(args) == 2:
+		return args[1]
+	default:
+		return NONE
+	}
+}
+
+func mapSet(budget *object.Budget, row *int, column *int, structure object.Object, args ...object.Object) object.Object {
+	return mapWith("set", row, column, structure, args)
+}
+
+func mapInsert(budget *object.Budget, row *int, column *int, structure object.Object, args ...object.Object) object.Object {
+	return mapWith("insert", row, column, structure, args)
+}
+
+// m.set(key, value) and m.insert(key, value) are m with key set to value
+func mapWith(name string, row, column *int, structure object.Object, args []object.Object) object.Object {
+	m, err := mapMethod(name, row, column, structure, args, 2)
+	if err != nil {
+		return err
+	}
+	key, err := hashKey(row, column, args[0])
+	if err != nil {
+		return err
+	}
+	pairs := copyPairs(m, 1)
+	pairs[key] = object.MapPair{Key: args[0], Value: args[1]}
+	return newMap(pairs)
+}
+
+// m.remove(key) is m without key, or m when it doesn't have key
+func mapRemove(budget *object.Budget, row *int, column *int, structure object.Object, args ...object.Object) object.Object {
+	m, err := mapMethod("remove", row, column, structure, args, 1)
+	if err != nil {
+		return err
+	}
+	key, err := hashKey(row, column, args[0])
+	if err != nil {
+		return err
+	}
+	pairs := copyPairs(m, 0)
+	delete(pairs, key)
+	return newMap(pairs)
+}
+
+// m.merge(other) has the pairs of both, the values of other win
+func mapMerge(budget *object.Budget, row *int, column *int, structure object.Object, args ...object.Object) object.Object {
+	m, err := mapMethod("merge", row, column, structure, args, 1)
+	if err != nil {
+		return err
+	}
+	other, ok := args[0].(*object.Map)
+	if !ok {
+		return newError(*row, *column, "merge expected argument 1 to be of type MAP, got=%s", args[0].Type())
+	}
+	pairs := copyPairs(m, len(other.Pairs))
+	for key, pair := range other.Pairs {
+		pairs[key] = pair
+	}
+	return newMap(pairs)
+}
+
+// m.map_values(f) has the keys of m and f of their values
+func mapMapValues(budget *object.Budget, row *int, column *int, structure object.Object, args ...object.Object) object.Object {
+	m, err := mapMethod("map_values", row, column, structure, args, 1)
+	if err != nil {
+		return err
+	}
+	pairs := make(map[object.MapKey]object.MapPair, len(m.Pairs))
+	for _, pair := range m.SortedPairs() {
+		value := callFunction(budget, args[0], []object.Object{pair.Value}, row, column)
+		if isError(value) {
+			return value
+		}
+		pairs[pair.Key.(object.Hashable).MapKey()] = object.MapPair{Key: pair.Key, Value: value}
+	}
+	return newMap(pairs)
+}
+
+// m.filter(f) keeps the pairs for which f(key, value) is true
+func mapFilter(budget *object.Budget, row *int, column *int, structure object.Object, args ...object.Object) object.Object {
+	m, err := mapMethod("filter", row, column, structure, args, 1)
+	if err != nil {
+		return err
+	}
+	pairs := make(map[object.MapKey]object.MapPair)
+	for _, pair := range m.SortedPairs() {
+		keep := callFunction(budget, args[0], []object.Object{pair.Key, pair.Value}, row, column)
+		if isError(keep) {
+			return keep
+		}
+		b, ok := keep.(*object.Boolean)
+		if !ok {
+			return newError(*row, *column, "filter expected its argument to return a Boolean, got=%s", keep.Type())
+		}
+		if b.Value {
+			pairs[pair.Key.(object.Hashable).MapKey()] = pair
+		}
+	}
+	return newMap(pairs)
+}
+
+// from_entries([[key, value], ...]) is the map of the entries, later
+// entries win over earlier ones with the same key
+func fromEntriesFn(budget *object.Budget, row *int, column *int, args ...object.Object) object.Object {
+	if len(args) != 1 {
+		return newError(*row, *column, "from_entries expected %d arguments, got %d", 1, len(args))
+	}
+	entries, err, ok := listValues(budget, args[0], row, column)
+	if !ok {
+		return newError(*row, *column, "from_entries expected argument 1 to be of type LIST, got=%s", args[0].Type())
+	}
+	if err != nil {
+		return err
+	}
+
+	pairs := make(map[object.MapKey]object.MapPair, len(entries))
+	for i, element := range entries {
+		entry, ok := element.(*object.List)
+		if !ok || len(entry.Elements) != 2 {
+			return newError(*row, *column, "from_entries expected entry %d to be a [key, value] list, got %s",
+				i, element.Inspect())
+		}
+		key, err := hashKey(row, column, entry.Elements[0])
+		if err != nil {
+			return err
+		}
+		pairs[key] = object.MapPair{Key: entry.Elements[0], Value: entry.Elements[1]}
+	}
+	return newMap(pairs)
+}
+
+// the receiver of a map method, which takes count arguments
+func mapMethod(name string, row, column *int, structure object.Object, args []object.Object, count int) (*object.Map, *object.Error) {
+	if len(args) != count {
+		return nil, newError(*row, *column, "%s expected %d arguments, got %d", name, count, len(args))
+	}
+	m, _ := structure.(*object.Map)
+	return m, nil
+}
+
+func hashKey(row, column *int, key object.Object) (object.MapKey, *object.Error) {
+	hashable, ok := key.(object.Hashable)
+	if !ok {
+		return object.MapKey{}, newError(*row, *column, "can't use %s as hash key", key.Type())
+	}
+	return hashable.MapKey(), nil
+}
+
+// the pairs of m in a new map with room for extra more
+func copyPairs(m *object.Map, extra int) map[object.MapKey]object.MapPair {
+	pairs := make(map[object.MapKey]object.MapPair, len(m.Pairs)+extra)
+	for key, pair := range m.Pairs {
+		pairs[key] = pair
+	}
+	return pairs
+}
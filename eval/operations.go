@@ -0,0 +1,91 @@
+package eval
+
+import (
+	"io"
+	"lang/object"
+	"sort"
+)
+
+// The functions below expose the semantics of the tree walker to the
+// other backends (see package vm), so both report the same results
+// and the same errors.
+
+func Infix(budget *object.Budget, operator string, left, right object.Object, row, column *int) object.Object {
+	return evalInfixExpression(budget, operator, left, right, row, column)
+}
+
+func Prefix(operator string, right object.Object, row, column *int) object.Object {
+	return evalPrefixExpression(operator, right, row, column)
+}
+
+func Index(left, index object.Object, row, column *int) object.Object {
+	return evalIndexExpression(left, index, row, column)
+}
+
+// Slice is xs[start:end], with NULL for the bounds left out
+func Slice(left, start, end object.Object, row, column *int) object.Object {
+	return evalSliceExpression(left, start, end, row, column)
+}
+
+func Range(start, end object.Object, inclusive bool, row, column *int) object.Object {
+	return evalRangeExpression(start, end, inclusive, row, column)
+}
+
+func NewRange(start, end int64, inclusive bool) *object.Range {
+	return newRange(start, end, 1, inclusive)
+}
+
+func NewIterator(next func() object.Object) *object.Iterator {
+	return newIterator(next)
+}
+
+func Access(structure object.Object, attribute string, row, column *int) object.Object {
+	return evalAccessExpression(structure, attribute, row, column)
+}
+
+func Call(budget *object.Budget, fn object.Object, args []object.Object, row, column *int) object.Object {
+	return callFunction(budget, fn, args, row, column)
+}
+
+func MapLiteral(keys, values []object.Object, row, column *int) object.Object {
+	pairs := make(map[object.MapKey]object.MapPair)
+
+	for i, key := range keys {
+		mapKey, ok := key.(object.Hashable)
+		if !ok {
+			return newError(*row, *column, "can't use %s as hash key", key.Type())
+		}
+		pairs[mapKey.MapKey()] = object.MapPair{Key: key, Value: values[i]}
+	}
+	return newMap(pairs)
+}
+
+func IsTruthy(obj object.Object) bool {
+	return isTruthy(obj)
+}
+
+func NewList(elements []object.Object) *object.List {
+	return newList(elements)
+}
+
+func NewString(value string) *object.String {
+	return newString(value)
+}
+
+func NewMap(pairs map[object.MapKey]object.MapPair) *object.Map {
+	return newMap(pairs)
+}
+
+func NewError(row, column int, format string, a ...interface{}) *object.Error {
+	return newError(row, column, format, a...)
+}
+
+// names of the builtin functions, sorted so their index is stable
+func BuiltinNames() []string {
+	names := []string{}
+	for name := range NewBuiltins(io.Discard, io.Discard) {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,228 @@
+package eval
+
+import (
+	"lang/ast"
+	"lang/object"
+	"lang/token"
+)
+
+// the builtin enums, their variants are in scope without the enum
+// name and their payload accepts values of any type
+var (
+	OptionType = &object.EnumType{
+		Name:     "Option",
+		Variants: []*ast.Variant{variant("Some", 1), variant("None", 0)},
+		Prelude:  true,
+	}
+	ResultType = &object.EnumType{
+		Name:     "Result",
+		Variants: []*ast.Variant{variant("Ok", 1), variant("Err", 1)},
+		Prelude:  true,
+	}
+
+	NONE = &object.EnumValue{Definition: OptionType, Variant: "None"}
+)
+
+func init() {
+	OptionType.SetMethods("unwrap", optionUnwrap)
+	OptionType.SetMethods("unwrap_or", optionUnwrapOr)
+	OptionType.SetMethods("map", optionMap)
+	OptionType.SetMethods("and_then", optionAndThen)
+	OptionType.SetMethods("is_some", optionIsSuccess)
+	OptionType.SetMethods("is_none", optionIsFailure)
+
+	ResultType.SetMethods("unwrap", optionUnwrap)
+	ResultType.SetMethods("unwrap_or", optionUnwrapOr)
+	ResultType.SetMethods("map", optionMap)
+	ResultType.SetMethods("and_then", optionAndThen)
+	ResultType.SetMethods("is_ok", optionIsSuccess)
+	ResultType.SetMethods("is_err", optionIsFailure)
+}
+
+func variant(name string, fields int) *ast.Variant {
+	v := &ast.Variant{
+		Name:   &ast.Identifier{Token: token.Token{Type: token.ID, Literal: name}, Value: name},
+		Fields: []*ast.TypeNode{},
+	}
+	for i := 0; i < fields; i++ {
+		v.Fields = append(v.Fields, nil)
+	}
+	return v
+}
+
+func NewSome(value object.Object) *object.EnumValue {
+	return &object.EnumValue{Definition: OptionType, Variant: "Some", Values: []object.Object{value}}
+}
+
+func NewOk(value object.Object) *object.EnumValue {
+	return &object.EnumValue{Definition: ResultType, Variant: "Ok", Values: []object.Object{value}}
+}
+
+func NewErr(value object.Object) *object.EnumValue {
+	return &object.EnumValue{Definition: ResultType, Variant: "Err", Values: []object.Object{value}}
+}
+
+// Some and Ok hold a value, None and Err stop the computation
+func isSuccess(value *object.EnumValue) bool {
+	return value.Variant == "Some" || value.Variant == "Ok"
+}
+
+// Try unwraps the operand of ?, ok is false when value is a None or an
+// Err that must be returned from the current function
+func Try(value object.Object, row, column *int) (object.Object, bool, *object.Error) {
+	ev, isEnum := value.(*object.EnumValue)
+	if !isEnum || !ev.Definition.Prelude {
+		return nil, false, newError(*row, *column, "operator ? is not defined over %s", value.Type())
+	}
+
+	if !isSuccess(ev) {
+		return value, false, nil
+	}
+	return ev.Values[0], true, nil
+}
+
+func evalTryExpression(node *ast.TryExpression, scope *object.Scope) object.Object {
+	value := Eval(node.Value, scope)
+	if isAbrupt(value) {
+		return value
+	}
+
+	payload, ok, err := Try(value, &node.Token.Row, &node.Token.Column)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return &object.ReturnValue{Value: value}
+	}
+	return payload
+}
+
+// the type of the payload of value within t, e.g. Int for Some(1)
+// checked against Option<Int>
+func payloadType(value *object.EnumValue, t *ast.TypeNode) *ast.TypeNode {
+	if !value.Definition.Prelude || len(t.Parameters) == 0 {
+		return nil
+	}
+
+	switch value.Variant {
+	case "Some", "Ok":
+		return t.Parameters[0]
+	case "Err":
+		if len(t.Parameters) == 2 {
+			return t.Parameters[1]
+		}
+	}
+	return nil
+}
+
+// catch calls a function, turning the error it fails with into an Err.
+// Errors that stop the program, such as an exceeded limit, go through.
+func catchFn(budget *object.Budget, row *int, column *int, args ...object.Object) object.Object {
+	if len(args) != 1 {
+		return newError(*row, *column, "catch expected %d argument, got %d", 1, len(args))
+	}
+
+	result := callFunction(budget, args[0], []object.Object{}, row, column)
+	if err, ok := result.(*object.Error); ok {
+		if err.Fatal {
+			return err
+		}
+		return NewErr(newString(err.Inspect()))
+	}
+	return NewOk(result)
+}
+
+func someFn(budget *object.Budget, row *int, column *int, args ...object.Object) object.Object {
+	if len(args) != 1 {
+		return newError(*row, *column, "variant Some expected %d arguments, got %d", 1, len(args))
+	}
+	return NewSome(args[0])
+}
+
+func okFn(budget *object.Budget, row *int, column *int, args ...object.Object) object.Object {
+	if len(args) != 1 {
+		return newError(*row, *column, "variant Ok expected %d arguments, got %d", 1, len(args))
+	}
+	return NewOk(args[0])
+}
+
+func errFn(budget *object.Budget, row *int, column *int, args ...object.Object) object.Object {
+	if len(args) != 1 {
+		return newError(*row, *column, "variant Err expected %d arguments, got %d", 1, len(args))
+	}
+	return NewErr(args[0])
+}
+
+func optionUnwrap(budget *object.Budget, row *int, column *int, option object.Object, args ...object.Object) object.Object {
+	o, _ := option.(*object.EnumValue)
+	if len(args) != 0 {
+		return newError(*row, *column, "unwrap expected %d arguments, got %d", 0, len(args))
+	}
+	if !isSuccess(o) {
+		return newError(*row, *column, "called unwrap on %s", o.Inspect())
+	}
+	return o.Values[0]
+}
+
+func optionUnwrapOr(budget *object.Budget, row *int, column *int, option object.Object, args ...object.Object) object.Object {
+	o, _ := option.(*object.EnumValue)
+	if len(args) != 1 {
+		return newError(*row, *column, "unwrap_or expected %d arguments, got %d", 1, len(args))
+	}
+	if !isSuccess(o) {
+		return args[0]
+	}
+	return o.Values[0]
+}
+
+func optionMap(budget *object.Budget, row *int, column *int, option object.Object, args ...object.Object) object.Object {
+	o, _ := option.(*object.EnumValue)
+	if len(args) != 1 {
+		return newError(*row, *column, "map expected %d arguments, got %d", 1, len(args))
+	}
+	if !isSuccess(o) {
+		return o
+	}
+
+	value := callFunction(budget, args[0], o.Values, row, column)
+	if isError(value) {
+		return value
+	}
+	return &object.EnumValue{Definition: o.Definition, Variant: o.Variant, Values: []object.Object{value}}
+}
+
+func optionAndThen(budget *object.Budget, row *int, column *int, option object.Object, args ...object.Object) object.Object {
+	o, _ := option.(*object.EnumValue)
+	if len(args) != 1 {
+		return newError(*row, *column, "and_then expected %d arguments, got %d", 1, len(args))
+	}
+	if !isSuccess(o) {
+		return o
+	}
+
+	value := callFunction(budget, args[0], o.Values, row, column)
+	if isError(value) {
+		return value
+	}
+	if v, ok := value.(*object.EnumValue); !ok || v.Definition != o.Definition {
+		return newError(*row, *column, "and_then expected its argument to return %s, got %s",
+			o.Definition.Name, value.Type())
+	}
+	return value
+}
+
+func optionIsSuccess(budget *object.Budget, row *int, column *int, option object.Object, args ...object.Object) object.Object {
+	o, _ := option.(*object.EnumValue)
+	if len(args) != 0 {
+		return newError(*row, *column, "expected %d arguments, got %d", 0, len(args))
+	}
+	return evalBoolean(isSuccess(o))
+}
+
+func optionIsFailure(budget *object.Budget, row *int, column *int, option object.Object, args ...object.Object) object.Object {
+	o, _ := option.(*object.EnumValue)
+	if len(args) != 0 {
+		return newError(*row, *column, "expected %d arguments, got %d", 0, len(args))
+	}
+	return evalBoolean(!isSuccess(o))
+}
@@ -0,0 +1,91 @@
+package eval
+
+import (
+	"fmt"
+	"lang/ast"
+	"lang/code"
+	"lang/diagnostic"
+	"lang/object"
+	"lang/token"
+	"strings"
+)
+
+// WithFrame records that err escaped from a call to the function name,
+// made at row and column. The function is in file, so the error, or the
+// call recorded before, is in file too.
+func WithFrame(err *object.Error, name *ast.Identifier, position code.Position, file string, row, column int) *object.Error {
+	if len(err.Stack) == 0 {
+		err.File = file
+	} else {
+		err.Stack[len(err.Stack)-1].File = file
+	}
+	err.Stack = append(err.Stack, object.Frame{Function: FrameName(name, position), Row: row, Column: column})
+	return err
+}
+
+// FrameName is the name of a function in backtraces. Function literals
+// have no name and are named after the position they are written at.
+func FrameName(name *ast.Identifier, position code.Position) string {
+	if name != nil {
+		return name.Value
+	}
+	return fmt.Sprintf("<closure at %d:%d>", position.Row, position.Column)
+}
+
+// gives err the length of the token of node when it points at it, the
+// innermost node an error escapes from is the first one to try
+func spanError(err *object.Error, node ast.Node) {
+	var tok token.Token
+	switch node := node.(type) {
+	case *ast.Identifier:
+		tok = node.Token
+	case *ast.LetStatement:
+		tok = node.Token
+	case *ast.AssignStatement:
+		tok = node.Token
+	case *ast.CallExpression:
+		tok = node.Token
+	case *ast.PrefixExpression:
+		tok = node.Token
+	case *ast.InfixExpression:
+		tok = node.Token
+	case *ast.IndexExpression:
+		tok = node.Token
+	case *ast.RangeExpression:
+		tok = node.Token
+	case *ast.AccessExpression:
+		tok = node.Token
+	case *ast.TryExpression:
+		tok = node.Token
+	case *ast.MapLiteral:
+		tok = node.Token
+	case *ast.StructLiteral:
+		tok = node.Token
+	case *ast.MatchExpression:
+		tok = node.Token
+	case *ast.ForStatement:
+		tok = node.Token
+	default:
+		return
+	}
+	if tok.Row == err.Row && tok.Column == err.Column {
+		err.Length = len(tok.Literal)
+	}
+}
+
+// Diagnostic of a runtime error, errors that stop the program are
+// reported as exceeded limits. The lines after the first one of the
+// message, like the values of a failed assertion, are its notes.
+func Diagnostic(err *object.Error) diagnostic.Diagnostic {
+	code := diagnostic.RuntimeError
+	if err.Fatal {
+		code = diagnostic.LimitExceeded
+	}
+
+	lines := strings.Split(err.Message, "\n")
+	d := diagnostic.New(diagnostic.Error, code, diagnostic.SpanOf(err.Row, err.Column, err.Length), "%s", lines[0])
+	for _, line := range lines[1:] {
+		d.Notes = append(d.Notes, strings.TrimSpace(line))
+	}
+	return d
+}
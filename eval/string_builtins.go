@@ -1,8 +1,19 @@
 package eval
 
-import "lang/object"
+import (
+	"lang/object"
+	"math"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// the methods of strings count and index characters, not bytes, so
+// "héllo".len() is 5 and "héllo"[1] is "é"
 
 func stringOtherwise(
+	budget *object.Budget,
 	row *int,
 	column *int,
 	str object.Object,
@@ -11,9 +22,9 @@ func stringOtherwise(
 	s, _ := str.(*object.String)
 	if len(args) != 1 {
 		return newError(
-			"[%d,%d] otherwise expected %d, got=%d",
 			*row,
 			*column,
+			"otherwise expected %d, got=%d",
 			1,
 			len(args),
 		)
@@ -22,9 +33,9 @@ func stringOtherwise(
 	arg, ok := args[0].(*object.String)
 	if !ok {
 		return newError(
-			"[%d,%d] otherwise expected it argument to be a STRING, got=%s",
 			*row,
 			*column,
+			"otherwise expected it argument to be a STRING, got=%s",
 			args[0].Type(),
 		)
 	}
@@ -35,3 +46,318 @@ func stringOtherwise(
 		return s
 	}
 }
+
+func stringLen(budget *object.Budget, row *int, column *int, str object.Object, args ...object.Object) object.Object {
+	s, err := stringMethod("len", row, column, str, args, 0)
+	if err != nil {
+		return err
+	}
+	return &object.Integer{Value: int64(utf8.RuneCountInString(s))}
+}
+
+func stringChars(budget *object.Budget, row *int, column *int, str object.Object, args ...object.Object) object.Object {
+	s, err := stringMethod("chars", row, column, str, args, 0)
+	if err != nil {
+		return err
+	}
+	chars := []object.Object{}
+	for _, c := range s {
+		chars = append(chars, newString(string(c)))
+	}
+	return newList(chars)
+}
+
+// the UTF-8 encoding of the string
+func stringBytes(budget *object.Budget, row *int, column *int, str object.Object, args ...object.Object) object.Object {
+	s, err := stringMethod("bytes", row, column, str, args, 0)
+	if err != nil {
+		return err
+	}
+	bytes := []object.Object{}
+	for i := 0; i < len(s); i++ {
+		bytes = append(bytes, &object.Integer{Value: int64(s[i])})
+	}
+	return newList(bytes)
+}
+
+// s.split(sep), an empty sep splits s into its characters
+func stringSplit(budget *object.Budget, row *int, column *int, str object.Object, args ...object.Object) object.Object {
+	s, err := stringMethod("split", row, column, str, args, 1)
+	if err != nil {
+		return err
+	}
+	sep, err := stringArgument("split", row, column, args, 0)
+	if err != nil {
+		return err
+	}
+	return stringList(strings.Split(s, sep))
+}
+
+// s.lines() splits s at line breaks, \n or \r\n, and a break at the end
+// doesn't start another line
+func stringLines(budget *object.Budget, row *int, column *int, str object.Object, args ...object.Object) object.Object {
+	s, err := stringMethod("lines", row, column, str, args, 0)
+	if err != nil {
+		return err
+	}
+	lines := []string{}
+	for s != "" {
+		line := s
+		if i := strings.IndexByte(s, '\n'); i >= 0 {
+			line, s = s[:i], s[i+1:]
+		} else {
+			s = ""
+		}
+		lines = append(lines, strings.TrimSuffix(line, "\r"))
+	}
+	return stringList(lines)
+}
+
+func stringTrim(budget *object.Budget, row *int, column *int, str object.Object, args ...object.Object) object.Object {
+	s, err := stringMethod("trim", row, column, str, args, 0)
+	if err != nil {
+		return err
+	}
+	return newString(strings.TrimSpace(s))
+}
+
+func stringTrimStart(budget *object.Budget, row *int, column *int, str object.Object, args ...object.Object) object.Object {
+	s, err := stringMethod("trim_start", row, column, str, args, 0)
+	if err != nil {
+		return err
+	}
+	return newString(strings.TrimLeftFunc(s, unicode.IsSpace))
+}
+
+func stringTrimEnd(budget *object.Budget, row *int, column *int, str object.Object, args ...object.Object) object.Object {
+	s, err := stringMethod("trim_end", row, column, str, args, 0)
+	if err != nil {
+		return err
+	}
+	return newString(strings.TrimRightFunc(s, unicode.IsSpace))
+}
+
+func stringUpper(budget *object.Budget, row *int, column *int, str object.Object, args ...object.Object) object.Object {
+	s, err := stringMethod("upper", row, column, str, args, 0)
+	if err != nil {
+		return err
+	}
+	return newString(strings.ToUpper(s))
+}
+
+func stringLower(budget *object.Budget, row *int, column *int, str object.Object, args ...object.Object) object.Object {
+	s, err := stringMethod("lower", row, column, str, args, 0)
+	if err != nil {
+		return err
+	}
+	return newString(strings.ToLower(s))
+}
+
+func stringContains(budget *object.Budget, row *int, column *int, str object.Object, args ...object.Object) object.Object {
+	return stringTest("contains", strings.Contains, row, column, str, args)
+}
+
+func stringStartsWith(budget *object.Budget, row *int, column *int, str object.Object, args ...object.Object) object.Object {
+	return stringTest("starts_with", strings.HasPrefix, row, column, str, args)
+}
+
+func stringEndsWith(budget *object.Budget, row *int, column *int, str object.Object, args ...object.Object) object.Object {
+	return stringTest("ends_with", strings.HasSuffix, row, column, str, args)
+}
+
+func stringTest(
+	name string,
+	test func(s, sub string) bool,
+	row, column *int,
+	str object.Object,
+	args []object.Object,
+) object.Object {
+	s, err := stringMethod(name, row, column, str, args, 1)
+	if err != nil {
+		return err
+	}
+	sub, err := stringArgument(name, row, column, args, 0)
+	if err != nil {
+		return err
+	}
+	return evalBoolean(test(s, sub))
+}
+
+// s.find(sub) is Some of the index of the first character of the first
+// sub in s, or None
+func stringFind(budget *object.Budget, row *int, column *int, str object.Object, args ...object.Object) object.Object {
+	s, err := stringMethod("find", row, column, str, args, 1)
+	if err != nil {
+		return err
+	}
+	sub, err := stringArgument("find", row, column, args, 0)
+	if err != nil {
+		return err
+	}
+	i := strings.Index(s, sub)
+	if i < 0 {
+		return NONE
+	}
+	return NewSome(&object.Integer{Value: int64(utf8.RuneCountInString(s[:i]))})
+}
+
+// s.replace(old, new) replaces every old in s
+func stringReplace(budget *object.Budget, row *int, column *int, str object.Object, args ...object.Object) object.Object {
+	s, err := stringMethod("replace", row, column, str, args, 2)
+	if err != nil {
+		return err
+	}
+	old, err := stringArgument("replace", row, column, args, 0)
+	if err != nil {
+		return err
+	}
+	replacement, err := stringArgument("replace", row, column, args, 1)
+	if err != nil {
+		return err
+	}
+	return newString(strings.ReplaceAll(s, old, replacement))
+}
+
+func stringRepeat(budget *object.Budget, row *int, column *int, str object.Object, args ...object.Object) object.Object {
+	s, err := stringMethod("repeat", row, column, str, args, 1)
+	if err != nil {
+		return err
+	}
+	count, ok := args[0].(*object.Integer)
+	if !ok {
+		return newError(*row, *column, "repeat expected argument 1 to be of type INTEGER, got=%s", args[0].Type())
+	}
+	if count.Value < 0 {
+		return newError(*row, *column, "repeat expected a count of at least 0, got %d", count.Value)
+	}
+	if len(s) > 0 && count.Value > int64(math.MaxInt32/len(s)) {
+		return newError(*row, *column, "repeat count %d is too large", count.Value)
+	}
+	return repeatString(budget, s, count.Value, row, column)
+}
+
+// count copies of s, checked against the budget before they are built
+// and counted as a step each
+func repeatString(budget *object.Budget, s string, count int64, row, column *int) object.Object {
+	if err := growthError(budget, object.STRING_OBJ, repeatedSize(len(s), count), *row, *column); err != nil {
+		return err
+	}
+	if s == "" {
+		return newString(s)
+	}
+	var out strings.Builder
+	for i := int64(0); i < count; i++ {
+		if err := Step(budget, *row, *column); err != nil {
+			return err
+		}
+		out.WriteString(s)
+	}
+	return newString(out.String())
+}
+
+// s.pad_left(width) and s.pad_left(width, char) pad s with spaces, or
+// char, up to width characters
+func stringPadLeft(budget *object.Budget, row *int, column *int, str object.Object, args ...object.Object) object.Object {
+	return stringPad(budget, "pad_left", true, row, column, str, args)
+}
+
+func stringPadRight(budget *object.Budget, row *int, column *int, str object.Object, args ...object.Object) object.Object {
+	return stringPad(budget, "pad_right", false, row, column, str, args)
+}
+
+func stringPad(budget *object.Budget, name string, left bool, row, column *int, str object.Object, args []object.Object) object.Object {
+	s, _ := str.(*object.String)
+	if len(args) != 1 && len(args) != 2 {
+		return newError(*row, *column, "%s expected 1 or 2 arguments, got %d", name, len(args))
+	}
+	width, ok := args[0].(*object.Integer)
+	if !ok {
+		return newError(*row, *column, "%s expected argument 1 to be of type INTEGER, got=%s", name, args[0].Type())
+	}
+	if width.Value > math.MaxInt32 {
+		return newError(*row, *column, "%s width %d is too large", name, width.Value)
+	}
+	pad := " "
+	if len(args) == 2 {
+		arg, err := stringArgument(name, row, column, args, 1)
+		if err != nil {
+			return err
+		}
+		if utf8.RuneCountInString(arg) != 1 {
+			return newError(*row, *column, "%s expected a single character to pad with, got %q", name, arg)
+		}
+		pad = arg
+	}
+
+	missing := int(width.Value) - utf8.RuneCountInString(s.Value)
+	if missing <= 0 {
+		return s
+	}
+	size := int64(len(s.Value)) + repeatedSize(len(pad), int64(missing))
+	if err := growthError(budget, object.STRING_OBJ, size, *row, *column); err != nil {
+		return err
+	}
+	if left {
+		return newString(strings.Repeat(pad, missing) + s.Value)
+	}
+	return newString(s.Value + strings.Repeat(pad, missing))
+}
+
+// s.parse_int() is Ok of the integer s is written as, or an Err saying
+// why it isn't one
+func stringParseInt(budget *object.Budget, row *int, column *int, str object.Object, args ...object.Object) object.Object {
+	s, err := stringMethod("parse_int", row, column, str, args, 0)
+	if err != nil {
+		return err
+	}
+	value, parseErr := strconv.ParseInt(s, 10, 64)
+	if parseErr != nil {
+		return NewErr(newString(parseError(s, "Int", parseErr)))
+	}
+	return NewOk(&object.Integer{Value: value})
+}
+
+func stringParseFloat(budget *object.Budget, row *int, column *int, str object.Object, args ...object.Object) object.Object {
+	s, err := stringMethod("parse_float", row, column, str, args, 0)
+	if err != nil {
+		return err
+	}
+	value, parseErr := strconv.ParseFloat(s, 64)
+	if parseErr != nil {
+		return NewErr(newString(parseError(s, "Float", parseErr)))
+	}
+	return NewOk(&object.Float{Value: value})
+}
+
+func parseError(s, typ string, err error) string {
+	if numErr, ok := err.(*strconv.NumError); ok && numErr.Err == strconv.ErrRange {
+		return strconv.Quote(s) + " is out of range for " + typ
+	}
+	return strconv.Quote(s) + " is not a valid " + typ
+}
+
+// the receiver of a string method, which takes count arguments
+func stringMethod(name string, row, column *int, str object.Object, args []object.Object, count int) (string, *object.Error) {
+	if len(args) != count {
+		return "", newError(*row, *column, "%s expected %d arguments, got %d", name, count, len(args))
+	}
+	s, _ := str.(*object.String)
+	return s.Value, nil
+}
+
+// the i-th argument of a method that expects a string there
+func stringArgument(name string, row, column *int, args []object.Object, i int) (string, *object.Error) {
+	arg, ok := args[i].(*object.String)
+	if !ok {
+		return "", newError(*row, *column, "%s expected argument %d to be of type STRING, got=%s", name, i+1, args[i].Type())
+	}
+	return arg.Value, nil
+}
+
+func stringList(values []string) *object.List {
+	elements := make([]object.Object, len(values))
+	for i, value := range values {
+		elements[i] = newString(value)
+	}
+	return newList(elements)
+}
@@ -0,0 +1,134 @@
+package eval
+
+import (
+	"lang/ast"
+	"lang/object"
+)
+
+func evalStructStatement(node *ast.StructStatement, scope *object.Scope) object.Object {
+	scope.Set(node.Name.Value, &object.StructType{Name: node.Name.Value, Fields: node.Fields})
+	return NULL
+}
+
+func evalImplStatement(node *ast.ImplStatement, scope *object.Scope) object.Object {
+	row, column := &node.Name.Token.Row, &node.Name.Token.Column
+	target := evalIdentifier(node.Name, scope, row, column)
+	if isAbrupt(target) {
+		return target
+	}
+
+	for _, m := range node.Methods {
+		method := &object.Function{
+			Name:       m.Name,
+			Parameters: m.Parameters,
+			Scope:      scope,
+			Body:       m.Body,
+			ReturnType: m.Type,
+		}
+		if err := Implement(target, method, row, column); err != nil {
+			return err
+		}
+	}
+
+	return NULL
+}
+
+func evalStructLiteral(node *ast.StructLiteral, scope *object.Scope) object.Object {
+	row, column := &node.Token.Row, &node.Token.Column
+	target := evalIdentifier(node.Name, scope, row, column)
+	if isAbrupt(target) {
+		return target
+	}
+
+	values := evalExpressions(node.Values, scope)
+	if len(values) == 1 && isAbrupt(values[0]) {
+		return values[0]
+	}
+
+	fields := []string{}
+	for _, f := range node.Fields {
+		fields = append(fields, f.Value)
+	}
+	return StructLiteral(target, fields, values, row, column)
+}
+
+// Implement adds a method to the struct target. Methods are dispatched
+// like builtin methods, called on an instance the instance is passed as
+// self, called on the struct itself (Point.new(1, 2)) it is not.
+func Implement(target object.Object, method object.Object, row, column *int) object.Object {
+	def, ok := target.(*object.StructType)
+	if !ok {
+		return newError(*row, *column, "impl expected a struct, got %s", target.Type())
+	}
+
+	var name string
+	var params []*ast.Identifier
+	switch fn := method.(type) {
+	case *object.Function:
+		name, params = fn.Name.Value, fn.Parameters
+	case *object.Closure:
+		name, params = fn.Fn.Name.Value, fn.Fn.Parameters
+	default:
+		return newError(*row, *column, "impl expected a function, got %s", method.Type())
+	}
+
+	hasSelf := len(params) > 0 && params[0].Value == "self"
+	def.SetMethods(name, func(budget *object.Budget, row, column *int, receiver object.Object, args ...object.Object) object.Object {
+		if _, ok := receiver.(*object.Struct); ok {
+			if !hasSelf {
+				return newError(*row, *column, "%s.%s takes no self, call it on the struct instead",
+					def.Name, name)
+			}
+			if len(args) != len(params)-1 {
+				return newError(*row, *column, "method %s expected %d arguments, got %d",
+					name, len(params)-1, len(args))
+			}
+			args = append([]object.Object{receiver}, args...)
+		}
+		return callFunction(budget, method, args, row, column)
+	})
+	return nil
+}
+
+// StructLiteral builds an instance of the struct target, fields are
+// the names of values in the order they were written
+func StructLiteral(target object.Object, fields []string, values []object.Object, row, column *int) object.Object {
+	def, ok := target.(*object.StructType)
+	if !ok {
+		return newError(*row, *column, "expected a struct, got %s", target.Type())
+	}
+
+	instance := &object.Struct{Definition: def, Fields: make(map[string]object.Object)}
+	for i, name := range fields {
+		field := lookupField(def, name)
+		if field == nil {
+			return newError(*row, *column, "struct %s has no field %s", def.Name, name)
+		}
+
+		if _, ok := instance.Fields[name]; ok {
+			return newError(*row, *column, "field %s of %s is set twice", name, def.Name)
+		}
+
+		if err := FieldTypeError(values[i], field, def.Name, row, column); err != nil {
+			return err
+		}
+		instance.Fields[name] = values[i]
+	}
+
+	for _, f := range def.Fields {
+		if _, ok := instance.Fields[f.Value]; !ok {
+			return newError(*row, *column, "missing field %s in %s", f.Value, def.Name)
+		}
+	}
+
+	return instance
+}
+
+func lookupField(def *object.StructType, name string) *ast.Identifier {
+	for _, f := range def.Fields {
+		if f.Value == name {
+			return f
+		}
+	}
+	return nil
+}
@@ -0,0 +1,214 @@
+package eval
+
+import (
+	"fmt"
+	"lang/ast"
+	"lang/object"
+)
+
+// a value that does not match its declared type
+type mismatch struct {
+	path     string // the offending element or entry, empty for the value itself
+	expected string
+	actual   string
+}
+
+// checks value against t, descending into the elements of lists, the
+// keys and values of maps, the payload of options and results and the
+// signatures of functions
+func matchType(value object.Object, t *ast.TypeNode) *mismatch {
+	if t == nil {
+		return nil
+	}
+
+	expected := object.MapTypeToObject(t.Name)
+	// a range stands for the list of its integers, which range(a, b)
+	// used to return
+	if r, ok := value.(*object.Range); ok && expected == object.LIST_OBJ {
+		if m := matchType(&object.Integer{Value: r.Start}, t.Elem()); m != nil && rangeCount(r) > 0 {
+			return m.within("element 0")
+		}
+		return nil
+	}
+	if expected != value.Type() {
+		return &mismatch{expected: string(expected), actual: string(value.Type())}
+	}
+
+	switch value := value.(type) {
+	case *object.List:
+		elem := t.Elem()
+		for i, e := range value.Elements {
+			if m := matchType(e, elem); m != nil {
+				return m.within(fmt.Sprintf("element %d", i))
+			}
+		}
+	case *object.Map:
+		key, val := t.Key(), t.Value()
+		for _, pair := range value.SortedPairs() {
+			if m := matchType(pair.Key, key); m != nil {
+				return m.within(fmt.Sprintf("key %s", quote(pair.Key)))
+			}
+			if m := matchType(pair.Value, val); m != nil {
+				return m.within(fmt.Sprintf("value at key %s", quote(pair.Key)))
+			}
+		}
+	case *object.EnumValue:
+		if payload := payloadType(value, t); payload != nil {
+			if m := matchType(value.Values[0], payload); m != nil {
+				return m.within("payload of " + value.Variant)
+			}
+		}
+	default:
+		if !t.IsFunction() {
+			return nil
+		}
+		if actual := FunctionType(value); !t.Accepts(actual) {
+			return &mismatch{expected: t.String(), actual: actual.String()}
+		}
+	}
+
+	return nil
+}
+
+func (m *mismatch) within(path string) *mismatch {
+	if m.path != "" {
+		path = m.path + " of " + path
+	}
+	return &mismatch{path: path, expected: m.expected, actual: m.actual}
+}
+
+// FunctionType is the signature of a function value, nil for builtins
+// which accept any arguments
+func FunctionType(fn object.Object) *ast.TypeNode {
+	var params []*ast.Identifier
+	var ret *ast.TypeNode
+
+	switch fn := fn.(type) {
+	case *object.Function:
+		params, ret = fn.Parameters, fn.ReturnType
+	case *object.Closure:
+		params, ret = fn.Fn.Parameters, fn.Fn.ReturnType
+	default:
+		return nil
+	}
+
+	types := []*ast.TypeNode{}
+	for _, p := range params {
+		types = append(types, p.Type)
+	}
+	return ast.NewFunctionType(types, ret)
+}
+
+// TypeOf is the static type of a value, collections are left bare
+// since their elements may differ
+func TypeOf(value object.Object) *ast.TypeNode {
+	switch value := value.(type) {
+	case *object.Integer:
+		return ast.NewType("Int")
+	case *object.Float:
+		return ast.NewType("Float")
+	case *object.String:
+		return ast.NewType("String")
+	case *object.Boolean:
+		return ast.NewType("Bool")
+	case *object.Null:
+		return ast.NewType("Void")
+	case *object.List:
+		return ast.NewType("List")
+	case *object.Map:
+		return ast.NewType("Map")
+	case *object.Struct:
+		return ast.NewType(value.Definition.Name)
+	case *object.EnumValue:
+		return ast.NewType(value.Definition.Name)
+	default:
+		if value.Type() == object.FUNCTION_OBJ {
+			if t := FunctionType(value); t != nil {
+				return t
+			}
+			return ast.NewType("Func")
+		}
+		return nil
+	}
+}
+
+func quote(key object.Object) string {
+	if key.Type() == object.STRING_OBJ {
+		return fmt.Sprintf("%q", key.Inspect())
+	}
+	return key.Inspect()
+}
+
+// The errors below are shared with the vm.
+
+func LetTypeError(value object.Object, t *ast.TypeNode, row, column *int) *object.Error {
+	m := matchType(value, t)
+	if m == nil {
+		return nil
+	}
+
+	if m.path == "" {
+		return newError(*row, *column, "type mismatch, expected value of type %s to be of type %s",
+			m.actual, m.expected)
+	}
+	return newError(*row, *column, "type mismatch, expected %s of type %s to be of type %s",
+		m.path, m.actual, m.expected)
+}
+
+func ArgumentTypeError(arg object.Object, argId int, param *ast.Identifier, row, column *int) *object.Error {
+	m := matchType(arg, param.Type)
+	if m == nil {
+		return nil
+	}
+
+	if m.path == "" {
+		return newError(*row, *column, "expected argument %d (%s) to be of type %s, got %s",
+			argId, param, m.expected, m.actual)
+	}
+	return newError(*row, *column, "expected %s of argument %d (%s) to be of type %s, got %s",
+		m.path, argId, param, m.expected, m.actual)
+}
+
+// the error of a builtin, or a registered Go function, called with an
+// argument of the wrong type, counted from 1 like the list methods do
+func BuiltinArgumentTypeError(name string, arg object.Object, argId int, t *ast.TypeNode, row, column *int) *object.Error {
+	m := matchType(arg, t)
+	if m == nil {
+		return nil
+	}
+
+	if m.path == "" {
+		return newError(*row, *column, "%s expected argument %d to be of type %s, got=%s",
+			name, argId+1, m.expected, m.actual)
+	}
+	return newError(*row, *column, "%s expected %s of argument %d to be of type %s, got=%s",
+		name, m.path, argId+1, m.expected, m.actual)
+}
+
+func ReturnTypeError(value object.Object, t *ast.TypeNode, row, column *int) *object.Error {
+	m := matchType(value, t)
+	if m == nil {
+		return nil
+	}
+
+	if m.path == "" {
+		return newError(*row, *column, "expected return to be of type %s, found %s",
+			m.expected, m.actual)
+	}
+	return newError(*row, *column, "expected %s of return to be of type %s, found %s",
+		m.path, m.expected, m.actual)
+}
+
+func FieldTypeError(value object.Object, field *ast.Identifier, structName string, row, column *int) *object.Error {
+	m := matchType(value, field.Type)
+	if m == nil {
+		return nil
+	}
+
+	if m.path == "" {
+		return newError(*row, *column, "expected field %s of %s to be of type %s, got %s",
+			field.Value, structName, m.expected, m.actual)
+	}
+	return newError(*row, *column, "expected %s of field %s of %s to be of type %s, got %s",
+		m.path, field.Value, structName, m.expected, m.actual)
+}
@@ -0,0 +1,33 @@
+enum Shape {
+    Circle(Float),
+    Rect(Float, Float),
+    Empty,
+}
+
+fn area(s: Shape) Float {
+    match s {
+        Shape::Circle(r) => 3.14 * r * r,
+        Shape::Rect(w, h) => w * h,
+        Shape::Empty => 0.0,
+    }
+}
+
+fn describe(xs: List<Int>) String {
+    match xs {
+        [] => "empty",
+        [x] if x < 0 => "one negative number",
+        [_] => "one number",
+        [_, ..rest] => "many numbers",
+    }
+}
+
+fn main() {
+    let shapes: List<Shape> = [Shape::Circle(1.0), Shape::Rect(2.0, 3.0), Shape::Empty];
+    println(shapes);
+    println(shapes.map(area));
+
+    println(describe([]));
+    println(describe([-1]));
+    println(describe([1, 2, 3]));
+    return;
+}
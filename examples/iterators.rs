@@ -0,0 +1,30 @@
+// the first n primes, found without building a list of candidates
+fn primes(n: Int) List<Int> {
+    (2..1000000)
+        .filter(fn(x: Int) Bool { (2..x).take_while(fn(d: Int) Bool { d * d <= x }).all(fn(d: Int) Bool { x % d != 0 }) })
+        .take(n)
+        .collect()
+}
+
+fn main() {
+    println(primes(10));
+
+    for i in 0..3 {
+        print(i, " ");
+    }
+    println("");
+    for n in (10..=0).step(-5) {
+        print(n, " ");
+    }
+    println("");
+
+    let squares: Iterator<Int> = (1..=5).map(fn(x: Int) Int { x * x });
+    println(squares.collect());
+    println((1..=100).sum(), " ", (0..1000000000).len(), " ", (0..10).step(3).contains(9));
+
+    for i, c in "mist".iter() {
+        print(i, c, " ");
+    }
+    println("");
+    println(["a", "b", "c"].iter().zip(1..100).collect());
+}
@@ -0,0 +1,43 @@
+fn indexOf(xs: List<String>, target: String) Int {
+    for i, x in xs {
+        if (x == target) {
+            return i;
+        }
+    }
+    -1
+}
+
+fn firstEven(xs: List<Int>) Int {
+    loop {
+        for x in xs {
+            if (x % 2 == 1) {
+                continue;
+            }
+            return x;
+        }
+        break -1;
+    }
+}
+
+fn main() {
+    for c in "loop" {
+        print(c);
+        print(" ");
+    }
+    println("");
+
+    let ages: Map<String, Int> = {"bob": 31, "alice": 27};
+    for name, age in ages {
+        println(name + " is " + string(age));
+    }
+
+    println(indexOf(["a", "b", "c"], "c"));
+    println(firstEven([3, 5, 8, 9]));
+    println(firstEven([1]));
+
+    while (indexOf(["a"], "z") < 0) {
+        println("z is missing");
+        break;
+    }
+    return;
+}
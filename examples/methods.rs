@@ -1,6 +1,7 @@
 fn main() {
-    let list: List = [1, 2, 1];
-    let list: List = list.map(fn(x:Int)Int{if (x == 1) {10} else {x}});
-    let list: List = list.update(1,5);
+    let mut list: List = [1, 2, 1];
+    list = list.map(fn(x:Int)Int{if (x == 1) {10} else {x}});
+    list = list.update(1,5);
+    list[2] += 1;
     println(list);
 }
@@ -0,0 +1,10 @@
+// use lib::shapes; loads lib/shapes.mist next to this file, once
+use lib::shapes;
+import "lib/shapes.mist" as sh;
+
+fn main() {
+    let r: Rect = shapes::Rect::new(2, 3);
+    println(r.area());
+    println(shapes::square(4).area());
+    println(sh::UNIT + shapes::UNIT);
+}
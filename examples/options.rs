@@ -0,0 +1,35 @@
+fn parse_digit(s: String) Result<Int, String> {
+    let digits: Map<String, Int> = {"0": 0, "1": 1, "2": 2, "3": 3, "4": 4, "5": 5, "6": 6, "7": 7, "8": 8, "9": 9};
+    match digits.get(s) {
+        Some(d) => Ok(d),
+        None => Err("not a digit: " + s),
+    }
+}
+
+// stops at the first character that is not a digit
+fn parse_number(s: String) Result<Int, String> {
+    let mut n: Int = 0;
+    for c in s {
+        n = n * 10 + parse_digit(c)?;
+    }
+    Ok(n)
+}
+
+fn second(xs: List<Int>) Option<Int> {
+    let x: Int = xs.get(1)?;
+    Some(x * 10)
+}
+
+fn main() {
+    println(parse_number("2024"));
+    println(parse_number("20x4"));
+    println(parse_number("7").map(fn(n: Int) Int { n + 1 }).unwrap_or(0));
+
+    println(second([1, 2, 3]));
+    println(second([1]));
+    println(second([1]).unwrap_or(-1));
+
+    let failed: Result<Int, String> = catch(fn() Int { [1, 2][5] });
+    println(failed.is_err());
+    return;
+}
@@ -0,0 +1,29 @@
+// prints the number of words of each line, skipping blank ones
+fn count_words(text: String) {
+    for line in text.lines() {
+        let trimmed: String = line.trim();
+        if (trimmed != "") {
+            println(trimmed.pad_right(16, "."), trimmed.split(" ").len());
+        }
+    }
+}
+
+fn main() {
+    let name: String = "Grüße, Mist";
+    println(name.len());
+    println(name[2] + " " + name[:5] + " " + name[7:]);
+    println(name.upper() + " " + name.lower());
+    println(name.find("Mist"));
+    println(name.find("Rust"));
+    println(name.replace("Grüße", "Hello").starts_with("Hello"));
+
+    count_words("  one two
+three
+
+four five six  ");
+
+    println("42".parse_int().unwrap() + 1);
+    println("forty".parse_int());
+    println("ab".repeat(3) + " " + "7".pad_left(3, "0"));
+    println(["a", "b", "c"].join(", "));
+}
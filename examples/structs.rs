@@ -0,0 +1,34 @@
+struct Point {
+    x: Int,
+    y: Int,
+}
+
+impl Point {
+    fn new(x: Int, y: Int) Point {
+        Point { x: x, y: y }
+    }
+
+    fn norm(self) Float {
+        ((self.x ^ 2 + self.y ^ 2) * 1.0) ^ 0.5
+    }
+
+    fn add(self, other: Point) Point {
+        Point { x: self.x + other.x, y: self.y + other.y }
+    }
+}
+
+struct Line {
+    from: Point,
+    to: Point,
+}
+
+fn main() {
+    let p: Point = Point { x: 3, y: 4 };
+    println(p);
+    println(p.norm());
+
+    let line: Line = Line { from: p, to: p.add(Point.new(1, -1)) };
+    println(line.to);
+    println(line.to.x);
+    return;
+}
@@ -0,0 +1,485 @@
+// Package format prints Mist programs the one way they are written:
+// four spaces of indentation, operators between single spaces, long
+// method chains one call per line, at most one blank line in a row and
+// every comment where it was. It works on the tokens of a program, so
+// the line breaks it doesn't add are the ones of the source.
+package format
+
+import (
+	"fmt"
+	"lang/diagnostic"
+	"lang/lexer"
+	"lang/parser"
+	"lang/token"
+	"strings"
+	"unicode"
+)
+
+const indentation = "    "
+
+// method chains with that many calls are broken one call per line, the
+// ones broken in the source are too
+const chainCalls = 4
+
+// Error is returned for programs that don't parse, formatting them
+// could change what they mean
+type Error struct {
+	Diagnostics []diagnostic.Diagnostic
+}
+
+func (e *Error) Error() string {
+	return strings.Join(diagnostic.Strings(e.Diagnostics), "\n")
+}
+
+// Source formats a program. Formatting the result again gives it back.
+func Source(source string) (string, error) {
+	p := parser.NewParser(lexer.NewLexer(source))
+	p.Parse()
+	if len(p.Diagnostics()) != 0 {
+		return "", &Error{Diagnostics: p.Diagnostics()}
+	}
+
+	tokens := tokenize(source)
+	pr := &printer{tokens: tokens, breaks: chainBreaks(tokens), start: true}
+	pr.print()
+	formatted := pr.out.String()
+
+	// a formatter that changes programs is worse than none, only the
+	// space between the tokens may change
+	if !sameTokens(tokens, tokenize(formatted)) {
+		return "", fmt.Errorf("formatting changed the program, please report it with the source")
+	}
+	return formatted, nil
+}
+
+// the tokens of source with their trivia, up to and with EOF
+func tokenize(source string) []token.Token {
+	l := lexer.NewLexer(source)
+	l.KeepTrivia()
+	tokens := []token.Token{}
+	for {
+		tok := l.NextToken()
+		tokens = append(tokens, *tok)
+		if tok.Type == token.EOF {
+			return tokens
+		}
+	}
+}
+
+// reports whether a and b are the same tokens with the same comments
+func sameTokens(a, b []token.Token) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i].Type != b[i].Type || a[i].Literal != b[i].Literal {
+			return false
+		}
+		if !equal(comments(a[i]), comments(b[i])) {
+			return false
+		}
+	}
+	return true
+}
+
+func comments(tok token.Token) []string {
+	out := []string{}
+	for _, trivia := range tok.Leading {
+		if trivia.Type == token.COMMENT {
+			out = append(out, trivia.Literal)
+		}
+	}
+	return out
+}
+
+func equal(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// a bracket that isn't closed yet
+type open struct {
+	tok token.Token
+	// of the line it was opened on, the lines inside are one deeper
+	indent int
+	// map literals have no spaces inside their braces, blocks and
+	// struct literals do
+	isMap bool
+	// a line break follows it, its closer gets a line of its own
+	broken bool
+}
+
+type printer struct {
+	out    strings.Builder
+	tokens []token.Token
+	// the dots starting a line of their own
+	breaks map[int]bool
+
+	opens []open
+	// type parameters the < of which is not closed yet
+	generics int
+	// indentation of the current line
+	indent int
+
+	prev *token.Token
+	// prev is a prefix operator
+	prevUnary bool
+	// at the start of the output, nothing is printed yet
+	start bool
+	// a line comment was printed, the next token needs a line of its own
+	mustBreak bool
+}
+
+func (p *printer) print() {
+	for i := range p.tokens {
+		tok := &p.tokens[i]
+
+		newlines := 0
+		for _, trivia := range tok.Leading {
+			switch trivia.Type {
+			case token.NEWLINE:
+				newlines++
+			case token.COMMENT:
+				if newlines == 0 && !p.start {
+					// a comment at the end of a line stays there
+					p.out.WriteString(" " + trivia.Literal)
+				} else {
+					p.newline(newlines, p.indentOf(tok, true))
+					p.out.WriteString(trivia.Literal)
+				}
+				p.start, p.mustBreak, newlines = false, true, 0
+			}
+		}
+
+		if tok.Type == token.EOF {
+			if !p.start {
+				p.out.WriteString("\n")
+			}
+			return
+		}
+
+		switch {
+		case p.start:
+		case tok.Type == token.ELSE && p.prev.Type == token.RBRACE && !p.mustBreak:
+			// } else { always share a line
+			p.out.WriteString(" ")
+		case newlines > 0 || p.mustBreak || p.breaks[i] || p.closesBroken(tok):
+			p.newline(newlines, p.indentOf(tok, false))
+		case p.space(tok):
+			p.out.WriteString(" ")
+		}
+
+		p.write(tok)
+		p.start, p.mustBreak = false, false
+	}
+}
+
+// reports whether tok closes a bracket a line break followed
+func (p *printer) closesBroken(tok *token.Token) bool {
+	if len(p.opens) == 0 {
+		return false
+	}
+	top := p.opens[len(p.opens)-1]
+	return top.broken && closes(tok.Type, top.tok.Type)
+}
+
+// ends the line, keeping a blank line of the source unless it follows
+// an opening bracket or comes before a closing one
+func (p *printer) newline(newlines, indent int) {
+	if p.start {
+		p.indent = indent
+		p.out.WriteString(strings.Repeat(indentation, indent))
+		return
+	}
+
+	p.out.WriteString("\n")
+	if p.prev != nil && isOpening(p.prev.Type) && len(p.opens) > 0 {
+		p.opens[len(p.opens)-1].broken = true
+	}
+	opening := p.prev != nil && !p.mustBreak && isOpening(p.prev.Type)
+	if newlines > 1 && !opening && indent >= p.innerIndent() {
+		p.out.WriteString("\n")
+	}
+	p.indent = indent
+	p.out.WriteString(strings.Repeat(indentation, indent))
+}
+
+// the indentation of lines inside the innermost bracket
+func (p *printer) innerIndent() int {
+	if len(p.opens) == 0 {
+		return 0
+	}
+	return p.opens[len(p.opens)-1].indent + 1
+}
+
+// the indentation of a line starting with tok, or of a comment on its
+// own line before it
+func (p *printer) indentOf(tok *token.Token, comment bool) int {
+	if len(p.opens) > 0 && !comment && closes(tok.Type, p.opens[len(p.opens)-1].tok.Type) {
+		return p.opens[len(p.opens)-1].indent
+	}
+	indent := p.innerIndent()
+	if !comment && p.continues(tok) {
+		indent++
+	}
+	return indent
+}
+
+// reports whether a line starting with tok continues the expression of
+// the line before, like the calls of a broken method chain
+func (p *printer) continues(tok *token.Token) bool {
+	if p.prev == nil {
+		return false
+	}
+	switch tok.Type {
+	case token.DOT, token.QUESTION, token.FATARROW, token.ARROW:
+		return true
+	}
+	if isBinary(tok.Type) && (tok.Type != token.MINUS || isOperand(p.prev.Type)) {
+		return true
+	}
+	switch p.prev.Type {
+	case token.DOT, token.PATH, token.COLON, token.FATARROW, token.ARROW:
+		return true
+	}
+	return isBinary(p.prev.Type) && !p.prevUnary
+}
+
+func (p *printer) write(tok *token.Token) {
+	unary := (tok.Type == token.MINUS || tok.Type == token.BANG) && !p.binaryMinus(tok)
+
+	switch tok.Type {
+	case token.STRING:
+		p.out.WriteString(`"` + tok.Literal + `"`)
+	default:
+		p.out.WriteString(tok.Literal)
+	}
+
+	switch {
+	case isOpening(tok.Type):
+		p.opens = append(p.opens, open{tok: *tok, indent: p.indent, isMap: tok.Type == token.LBRACE && p.mapContext()})
+	case tok.Type == token.RPAREN || tok.Type == token.RBRACKET || tok.Type == token.RBRACE:
+		if len(p.opens) > 0 {
+			p.opens = p.opens[:len(p.opens)-1]
+		}
+	case tok.Type == token.LT && p.isGeneric():
+		p.generics++
+	case tok.Type == token.GT && p.generics > 0:
+		p.generics--
+	}
+	p.prev, p.prevUnary = tok, unary
+}
+
+// reports whether tok, a - or a !, is the operator between two operands
+func (p *printer) binaryMinus(tok *token.Token) bool {
+	return tok.Type == token.MINUS && p.prev != nil && isOperand(p.prev.Type)
+}
+
+// reports whether the < about to be printed opens type parameters,
+// they follow the name of a type like List<Int> or Result<Int, String>
+func (p *printer) isGeneric() bool {
+	if p.prev == nil {
+		return false
+	}
+	if p.prev.Type == token.TYPE {
+		return true
+	}
+	return p.prev.Type == token.ID && unicode.IsUpper(rune(p.prev.Literal[0]))
+}
+
+// reports whether a { about to be printed opens a map literal, which
+// can only be where an expression starts
+func (p *printer) mapContext() bool {
+	if p.prev == nil {
+		return false
+	}
+	switch p.prev.Type {
+	case token.ASSIGN, token.LPAREN, token.LBRACKET, token.COMMA, token.COLON, token.RETURN, token.BREAK:
+		return true
+	}
+	return isBinary(p.prev.Type) || isAssign(p.prev.Type) || p.prevUnary
+}
+
+// reports whether tok, on the line of the last token, is apart from it
+func (p *printer) space(tok *token.Token) bool {
+	prev := p.prev
+
+	switch tok.Type {
+	case token.RPAREN, token.RBRACKET, token.COMMA, token.SEMICOLON, token.DOT,
+		token.QUESTION, token.COLON, token.PATH:
+		return false
+	case token.RBRACE:
+		return prev.Type != token.LBRACE && len(p.opens) > 0 && !p.opens[len(p.opens)-1].isMap
+	case token.DOTDOT, token.DOTDOTEQ:
+		return prev.Type == token.COMMA
+	}
+
+	switch {
+	case p.prevUnary:
+		return false
+	case prev.Type == token.LPAREN, prev.Type == token.LBRACKET, prev.Type == token.DOT,
+		prev.Type == token.PATH, prev.Type == token.DOTDOT, prev.Type == token.DOTDOTEQ:
+		return false
+	case prev.Type == token.LBRACE:
+		return len(p.opens) == 0 || !p.opens[len(p.opens)-1].isMap
+	case prev.Type == token.COLON && p.inSlice():
+		return false
+	case prev.Type == token.LT && p.generics > 0:
+		return false
+	}
+
+	switch tok.Type {
+	case token.LPAREN:
+		// calls and function types
+		switch prev.Type {
+		case token.ID, token.TYPE, token.RPAREN, token.RBRACKET, token.FUNC:
+			return false
+		}
+	case token.LBRACKET:
+		// indexing
+		switch prev.Type {
+		case token.ID, token.RPAREN, token.RBRACKET, token.STRING:
+			return false
+		}
+	case token.LT:
+		return !p.isGeneric()
+	case token.GT:
+		return p.generics == 0
+	}
+	return true
+}
+
+// reports whether the innermost bracket is a [, where a : separates the
+// bounds of a slice like xs[1:3]
+func (p *printer) inSlice() bool {
+	return len(p.opens) > 0 && p.opens[len(p.opens)-1].tok.Type == token.LBRACKET
+}
+
+func isOpening(t token.TokenType) bool {
+	return t == token.LPAREN || t == token.LBRACKET || t == token.LBRACE
+}
+
+func closes(t, opening token.TokenType) bool {
+	switch opening {
+	case token.LPAREN:
+		return t == token.RPAREN
+	case token.LBRACKET:
+		return t == token.RBRACKET
+	case token.LBRACE:
+		return t == token.RBRACE
+	}
+	return false
+}
+
+// reports whether a - after a token of type t subtracts instead of negates
+func isOperand(t token.TokenType) bool {
+	switch t {
+	case token.ID, token.TYPE, token.INT, token.FLOAT, token.STRING, token.TRUE, token.FALSE,
+		token.RPAREN, token.RBRACKET, token.QUESTION:
+		return true
+	}
+	return false
+}
+
+func isBinary(t token.TokenType) bool {
+	switch t {
+	case token.PLUS, token.MINUS, token.ASTERISK, token.SLASH, token.MOD, token.POWER,
+		token.EQ, token.NE, token.LT, token.GT, token.LE, token.GE, token.AND, token.OR:
+		return true
+	}
+	return false
+}
+
+func isAssign(t token.TokenType) bool {
+	switch t {
+	case token.ASSIGN, token.PLUS_ASSIGN, token.MINUS_ASSIGN, token.ASTERISK_ASSIGN,
+		token.SLASH_ASSIGN, token.MOD_ASSIGN:
+		return true
+	}
+	return false
+}
+
+// the rows a token starts and ends on, strings may span several
+func startRow(tok token.Token) int {
+	if tok.Type == token.STRING {
+		return tok.Row - strings.Count(tok.Literal, "\n")
+	}
+	return tok.Row
+}
+
+// a method chain being read, the dots between its calls
+type chain struct {
+	dots  []int
+	calls int
+	// the source broke it before one of its dots
+	broken bool
+	// the last token is the name after a dot
+	afterName bool
+	// in braces that open and close on one line, like the body of a
+	// short function literal, which stays on it
+	inline bool
+}
+
+// chainBreaks finds the dots of the method chains broken one call per
+// line, the long ones and the ones the source broke already
+func chainBreaks(tokens []token.Token) map[int]bool {
+	breaks := map[int]bool{}
+	// one chain for each bracket the tokens are in
+	chains := []*chain{{}}
+
+	finish := func(c *chain) {
+		if len(c.dots) > 0 && (c.broken || c.calls >= chainCalls && !c.inline) {
+			for _, dot := range c.dots {
+				breaks[dot] = true
+			}
+		}
+		*c = chain{inline: c.inline}
+	}
+
+	for i, tok := range tokens {
+		c := chains[len(chains)-1]
+		switch tok.Type {
+		case token.DOT:
+			c.dots = append(c.dots, i)
+			c.afterName = false
+			if i > 0 && startRow(tok) > tokens[i-1].Row {
+				c.broken = true
+			}
+			continue
+		case token.ID:
+			if i > 0 && tokens[i-1].Type == token.DOT {
+				c.afterName = true
+				continue
+			}
+		case token.LPAREN, token.LBRACKET:
+			if c.afterName && tok.Type == token.LPAREN {
+				c.calls++
+			}
+			c.afterName = false
+			chains = append(chains, &chain{inline: c.inline})
+			continue
+		case token.RPAREN, token.RBRACKET, token.RBRACE:
+			finish(c)
+			if len(chains) > 1 {
+				chains = chains[:len(chains)-1]
+			}
+			continue
+		case token.LBRACE:
+			finish(c)
+			inline := c.inline || i+1 < len(tokens) && startRow(tokens[i+1]) == tok.Row
+			chains = append(chains, &chain{inline: inline})
+			continue
+		case token.QUESTION:
+			continue
+		}
+		finish(c)
+	}
+	return breaks
+}
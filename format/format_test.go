@@ -0,0 +1,146 @@
+package format
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSource(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		// spacing
+		{"let x:Int=1+2*-3;", "let x: Int = 1 + 2 * -3;\n"},
+		{"fn add(a:Int,b:Int) Int {a+b}", "fn add(a: Int, b: Int) Int { a + b }\n"},
+		{"let m: Map<String, List<Int>> = {\"a\":[1,2], \"b\": [ ] };", "let m: Map<String, List<Int>> = {\"a\": [1, 2], \"b\": []};\n"},
+		{"let f: Fn(Int) -> Int = fn(x:Int)Int{ -x };", "let f: Fn(Int) -> Int = fn(x: Int) Int { -x };\n"},
+		{"let p: Point = Point{x:1,y:2};", "let p: Point = Point { x: 1, y: 2 };\n"},
+		{"let b: Bool = !(1<2) && 3>=2;", "let b: Bool = !(1 < 2) && 3 >= 2;\n"},
+		{"println(xs[0], [1,2][1], 3 - -1, Shape::Circle(2), f(x)?);", "println(xs[0], [1, 2][1], 3 - -1, Shape::Circle(2), f(x)?);\n"},
+		{"i+=1;", "i += 1;\n"},
+		{"println(s[1 : 3], s[:n+1], xs[2:]);", "println(s[1:3], s[:n + 1], xs[2:]);\n"},
+		{"for i in 0 ..= n-1 { println((0 .. -5).step( -1 )); }", "for i in 0..=n - 1 { println((0..-5).step(-1)); }\n"},
+		// indentation
+		{
+			"fn main() {\nif (true) {\n\tprintln(1);\n  }\nelse {\nprintln(2);}\n}",
+			"fn main() {\n    if (true) {\n        println(1);\n    } else {\n        println(2);\n    }\n}\n",
+		},
+		{
+			"match s {\nA => 1,\nB => {\n2\n}\n}",
+			"match s {\n    A => 1,\n    B => {\n        2\n    }\n}\n",
+		},
+		{
+			"let x: Int = 1 +\n2 +\n3;",
+			"let x: Int = 1 +\n    2 +\n    3;\n",
+		},
+		{
+			"let m: Map<String, Int> = {\n\"a\": 1,\n\"b\": 2\n};",
+			"let m: Map<String, Int> = {\n    \"a\": 1,\n    \"b\": 2\n};\n",
+		},
+		// comments
+		{"let x: Int = 1;   // one\t\nlet y: Int = 2;//two", "let x: Int = 1; // one\nlet y: Int = 2; //two\n"},
+		{
+			"fn main() {\n// first\n  println(1);\n        // last\n}",
+			"fn main() {\n    // first\n    println(1);\n    // last\n}\n",
+		},
+		{"// only a comment", "// only a comment\n"},
+		{"#!/usr/bin/env mist\nfn main() {}", "#!/usr/bin/env mist\nfn main() {}\n"},
+		{"\n\n// header\n\nfn main() {}\n// end", "// header\n\nfn main() {}\n// end\n"},
+		{"let x: Int = 1 + // one\n2;", "let x: Int = 1 + // one\n    2;\n"},
+		{"fn main() { // c\nprintln(1); }", "fn main() { // c\n    println(1);\n}\n"},
+		// blank lines
+		{
+			"let x: Int = 1;\n\n\n\nlet y: Int = 2;\n\n",
+			"let x: Int = 1;\n\nlet y: Int = 2;\n",
+		},
+		{
+			"fn main() {\n\n    println(1);\n\n}",
+			"fn main() {\n    println(1);\n}\n",
+		},
+		{"", ""},
+		// method chains
+		{"range(0,3).map(f).map(g);", "range(0, 3).map(f).map(g);\n"},
+		{
+			"range(1,100).map(f).filter(g).map(h).map(println);",
+			"range(1, 100)\n    .map(f)\n    .filter(g)\n    .map(h)\n    .map(println);\n",
+		},
+		{
+			"fn main() {\n    range(0,3).map(f)\n    .map(g);\n}",
+			"fn main() {\n    range(0, 3)\n        .map(f)\n        .map(g);\n}\n",
+		},
+		{"xs.map(fn(x: Int) Int { x.a().b().c().d() });", "xs.map(fn(x: Int) Int { x.a().b().c().d() });\n"},
+		{
+			"xs.map(fn(x: Int) Int {\nx.a().b().c().d()\n});",
+			"xs.map(fn(x: Int) Int {\n    x\n        .a()\n        .b()\n        .c()\n        .d()\n});\n",
+		},
+	}
+
+	for i, test := range tests {
+		actual, err := Source(test.input)
+		if err != nil {
+			t.Errorf("case %d: unexpected error %s", i, err)
+			continue
+		}
+		if actual != test.expected {
+			t.Errorf("case %d: expected\n%s\ngot\n%s", i, test.expected, actual)
+		}
+	}
+}
+
+func TestSyntaxErrors(t *testing.T) {
+	tests := []string{
+		"let x: Int = (1;",
+		"fn main() { println(\"open); }",
+		"let x: Int = 1 $ 2;",
+	}
+
+	for i, test := range tests {
+		_, err := Source(test)
+		var formatErr *Error
+		if !errors.As(err, &formatErr) || len(formatErr.Diagnostics) == 0 {
+			t.Errorf("case %d: expected syntax errors, got %v", i, err)
+		}
+	}
+}
+
+func TestExamples(t *testing.T) {
+	files, err := filepath.Glob("../examples/*.rs")
+	if err != nil || len(files) == 0 {
+		t.Fatalf("no examples: %v", err)
+	}
+
+	for _, file := range files {
+		source, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		formatted, err := Source(string(source))
+		if err != nil {
+			t.Errorf("%s: %s", file, err)
+			continue
+		}
+		again, err := Source(formatted)
+		if err != nil {
+			t.Errorf("%s: formatted source: %s", file, err)
+			continue
+		}
+		if again != formatted {
+			t.Errorf("%s: formatting is not idempotent, got\n%s\nthen\n%s", file, formatted, again)
+		}
+	}
+
+	// fizzbuzz breaks its chain one call per line, the way the formatter does
+	source, err := os.ReadFile("../examples/fizzbuzz.rs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	formatted, err := Source(string(source))
+	chain := "    range(1, 100)\n        .map(fizzbuzz)\n        .reverse()\n        .map(println);\n"
+	if err != nil || !strings.Contains(formatted, chain) {
+		t.Errorf("fizzbuzz: expected the chain\n%s\ngot\n%s", chain, formatted)
+	}
+}
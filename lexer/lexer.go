@@ -3,6 +3,7 @@ package lexer
 import (
 	"bufio"
 	"io"
+	"lang/diagnostic"
 	"lang/token"
 	"log"
 	"strings"
@@ -20,6 +21,14 @@ type Lexer struct {
 	curByte   int
 	position  *position
 	isNewline bool
+
+	// characters it doesn't know and strings left open
+	diagnostics []diagnostic.Diagnostic
+
+	// whitespace and comments read since the last token, kept for the
+	// next one when keepTrivia is set
+	keepTrivia bool
+	trivia     []token.Token
 }
 
 func NewLexer(code string) *Lexer {
@@ -32,6 +41,12 @@ func NewLexer(code string) *Lexer {
 	return l
 }
 
+// KeepTrivia makes the lexer keep the whitespace and comments before
+// every token as its Leading tokens, formatters need them
+func (l *Lexer) KeepTrivia() {
+	l.keepTrivia = true
+}
+
 func (l *Lexer) readChar() {
 	if l.curByte >= l.input.Size() {
 		l.char = 0 // byte 0 is EOF
@@ -81,7 +96,7 @@ func (l *Lexer) readNumber() (string, token.TokenType) {
 
 	out = append(out, l.char)
 
-	for isDigit([]byte(l.peekChar())[0], expectFloat) {
+	for isDigit([]byte(l.peekChar())[0], expectFloat) && !l.peekRange() {
 		if l.char == '.' {
 			t = token.FLOAT
 			expectFloat = false
@@ -110,29 +125,63 @@ func (l *Lexer) readString() string {
 
 func (l *Lexer) NextToken() *token.Token {
 	var t *token.Token
+	// scripts may start with #!/usr/bin/env mist
+	if l.curByte == 1 && l.char == '#' && l.isPeek('!') {
+		l.skipComment()
+	}
 	l.skipWhitespaces()
 
 	switch l.char {
 	case '"':
+		// the current character is one column behind
+		row, column := l.position.row, l.position.column-1
 		str := l.readString()
 		t = token.NewTokenString(token.STRING, str)
+		if l.char == 0 {
+			l.diagnostics = append(l.diagnostics, diagnostic.New(diagnostic.Error, diagnostic.UnterminatedString,
+				diagnostic.SpanOf(row, column, len(str)+1), "unterminated string"))
+		}
 	case '=':
 		if l.isPeek('=') {
 			l.readChar()
 			t = token.NewTokenString(token.EQ, "==")
+		} else if l.isPeek('>') {
+			l.readChar()
+			t = token.NewTokenString(token.FATARROW, "=>")
 		} else {
 			t = token.NewToken(token.ASSIGN, l.char)
 		}
 	case '+':
-		t = token.NewToken(token.PLUS, l.char)
+		if l.isPeek('=') {
+			l.readChar()
+			t = token.NewTokenString(token.PLUS_ASSIGN, "+=")
+		} else {
+			t = token.NewToken(token.PLUS, l.char)
+		}
 	case '-':
-		t = token.NewToken(token.MINUS, l.char)
+		if l.isPeek('>') {
+			l.readChar()
+			t = token.NewTokenString(token.ARROW, "->")
+		} else if l.isPeek('=') {
+			l.readChar()
+			t = token.NewTokenString(token.MINUS_ASSIGN, "-=")
+		} else {
+			t = token.NewToken(token.MINUS, l.char)
+		}
 	case '*':
-		t = token.NewToken(token.ASTERISK, l.char)
+		if l.isPeek('=') {
+			l.readChar()
+			t = token.NewTokenString(token.ASTERISK_ASSIGN, "*=")
+		} else {
+			t = token.NewToken(token.ASTERISK, l.char)
+		}
 	case '/':
 		if l.isPeek('/') {
 			l.skipComment()
 			return l.NextToken()
+		} else if l.isPeek('=') {
+			l.readChar()
+			t = token.NewTokenString(token.SLASH_ASSIGN, "/=")
 		} else {
 			t = token.NewToken(token.SLASH, l.char)
 		}
@@ -166,7 +215,12 @@ func (l *Lexer) NextToken() *token.Token {
 		l.readChar()
 		t = token.NewTokenString(token.AND, "&&")
 	case '%':
-		t = token.NewToken(token.MOD, l.char)
+		if l.isPeek('=') {
+			l.readChar()
+			t = token.NewTokenString(token.MOD_ASSIGN, "%=")
+		} else {
+			t = token.NewToken(token.MOD, l.char)
+		}
 	case '(':
 		t = token.NewToken(token.LPAREN, l.char)
 	case ')':
@@ -181,14 +235,29 @@ func (l *Lexer) NextToken() *token.Token {
 		t = token.NewToken(token.RBRACKET, l.char)
 	case ';':
 		t = token.NewToken(token.SEMICOLON, l.char)
+	case '?':
+		t = token.NewToken(token.QUESTION, l.char)
 	case ',':
 		t = token.NewToken(token.COMMA, l.char)
 	case ':':
-		t = token.NewToken(token.COLON, l.char)
+		if l.isPeek(':') {
+			l.readChar()
+			t = token.NewTokenString(token.PATH, "::")
+		} else {
+			t = token.NewToken(token.COLON, l.char)
+		}
 	case '.':
 		if isDigit(l.peekChar()[0], false) {
 			numberLiteral, tokenType := l.readNumber()
 			t = token.NewTokenString(tokenType, numberLiteral)
+		} else if l.isPeek('.') {
+			l.readChar()
+			if l.isPeek('=') {
+				l.readChar()
+				t = token.NewTokenString(token.DOTDOTEQ, "..=")
+			} else {
+				t = token.NewTokenString(token.DOTDOT, "..")
+			}
 		} else {
 			t = token.NewToken(token.DOT, '.')
 		}
@@ -208,13 +277,31 @@ func (l *Lexer) NextToken() *token.Token {
 
 	l.readChar()
 	l.setPosition(t)
+	t.Leading, l.trivia = l.trivia, nil
+
+	if t.Type == token.ILLEGAL {
+		l.diagnostics = append(l.diagnostics, diagnostic.New(diagnostic.Error, diagnostic.UnexpectedCharacter,
+			diagnostic.SpanOf(t.Row, t.Column, 1), "unexpected character %q", t.Literal))
+	}
 	return t
 }
 
+// Diagnostics of the tokens read so far
+func (l *Lexer) Diagnostics() []diagnostic.Diagnostic {
+	return l.diagnostics
+}
+
 func (l *Lexer) isPeek(char byte) bool {
 	return string(char) == l.peekChar()
 }
 
+// reports whether a .. follows, so 1..5 is a range rather than the
+// float 1. and a dot
+func (l *Lexer) peekRange() bool {
+	b, _ := l.input.Peek(2)
+	return len(b) == 2 && b[0] == '.' && b[1] == '.'
+}
+
 func (l *Lexer) setPosition(t *token.Token) {
 	t.Column = l.position.column - len(t.Literal) - 1
 	t.Row = l.position.row
@@ -222,10 +309,31 @@ func (l *Lexer) setPosition(t *token.Token) {
 
 func (l *Lexer) skipWhitespaces() {
 	for l.char == ' ' || l.char == '\t' || l.char == '\n' || l.char == '\r' {
-		l.readChar()
+		if !l.keepTrivia {
+			l.readChar()
+			continue
+		}
+
+		// the current character is one column behind
+		row, column := l.position.row, l.position.column-1
+		if l.char == '\n' {
+			l.readChar()
+			l.addTrivia(token.NEWLINE, "\n", row, column)
+			continue
+		}
+		var out []byte
+		for l.char == ' ' || l.char == '\t' || l.char == '\r' {
+			out = append(out, l.char)
+			l.readChar()
+		}
+		l.addTrivia(token.SPACE, string(out), row, column)
 	}
 }
 
+func (l *Lexer) addTrivia(t token.TokenType, literal string, row, column int) {
+	l.trivia = append(l.trivia, token.Token{Type: t, Literal: literal, Row: row, Column: column})
+}
+
 func isLetter(char byte) bool {
 	return char >= 'a' && char <= 'z' || char >= 'A' && char <= 'Z' || char == '_'
 }
@@ -243,7 +351,13 @@ func isAlphanumeric(char byte) bool {
 }
 
 func (l *Lexer) skipComment() {
-	for l.char != '\n' {
+	row, column := l.position.row, l.position.column-1
+	var out []byte
+	for l.char != '\n' && l.char != 0 {
+		out = append(out, l.char)
 		l.readChar()
 	}
+	if l.keepTrivia {
+		l.addTrivia(token.COMMENT, strings.TrimRight(string(out), " \t\r"), row, column)
+	}
 }
@@ -2,6 +2,7 @@ package lexer
 
 import (
 	"lang/token"
+	"reflect"
 	"testing"
 )
 
@@ -95,15 +96,165 @@ func TestLexer(t *testing.T) {
 				{Type: token.EOF, Literal: "\x00", Row: 1, Column: 60},
 			},
 		},
+
+		{
+			"match s { Shape::Circle(r) => r, [_, ..] => .5 }",
+			[]token.Token{
+				{Type: token.MATCH, Literal: "match", Row: 1, Column: 1},
+				{Type: token.ID, Literal: "s", Row: 1, Column: 7},
+				{Type: token.LBRACE, Literal: "{", Row: 1, Column: 9},
+				{Type: token.ID, Literal: "Shape", Row: 1, Column: 11},
+				{Type: token.PATH, Literal: "::", Row: 1, Column: 16},
+				{Type: token.ID, Literal: "Circle", Row: 1, Column: 18},
+				{Type: token.LPAREN, Literal: "(", Row: 1, Column: 24},
+				{Type: token.ID, Literal: "r", Row: 1, Column: 25},
+				{Type: token.RPAREN, Literal: ")", Row: 1, Column: 26},
+				{Type: token.FATARROW, Literal: "=>", Row: 1, Column: 28},
+				{Type: token.ID, Literal: "r", Row: 1, Column: 31},
+				{Type: token.COMMA, Literal: ",", Row: 1, Column: 32},
+				{Type: token.LBRACKET, Literal: "[", Row: 1, Column: 34},
+				{Type: token.ID, Literal: "_", Row: 1, Column: 35},
+				{Type: token.COMMA, Literal: ",", Row: 1, Column: 36},
+				{Type: token.DOTDOT, Literal: "..", Row: 1, Column: 38},
+				{Type: token.RBRACKET, Literal: "]", Row: 1, Column: 40},
+				{Type: token.FATARROW, Literal: "=>", Row: 1, Column: 42},
+				{Type: token.FLOAT, Literal: ".5", Row: 1, Column: 45},
+				{Type: token.RBRACE, Literal: "}", Row: 1, Column: 48},
+				{Type: token.EOF, Literal: "\x00", Row: 1, Column: 49},
+			},
+		},
+
+		{
+			"let mut x+=-=*=/=%=->",
+			[]token.Token{
+				{Type: token.LET, Literal: "let", Row: 1, Column: 1},
+				{Type: token.MUT, Literal: "mut", Row: 1, Column: 5},
+				{Type: token.ID, Literal: "x", Row: 1, Column: 9},
+				{Type: token.PLUS_ASSIGN, Literal: "+=", Row: 1, Column: 10},
+				{Type: token.MINUS_ASSIGN, Literal: "-=", Row: 1, Column: 12},
+				{Type: token.ASTERISK_ASSIGN, Literal: "*=", Row: 1, Column: 14},
+				{Type: token.SLASH_ASSIGN, Literal: "/=", Row: 1, Column: 16},
+				{Type: token.MOD_ASSIGN, Literal: "%=", Row: 1, Column: 18},
+				{Type: token.ARROW, Literal: "->", Row: 1, Column: 20},
+				{Type: token.EOF, Literal: "\x00", Row: 1, Column: 22},
+			},
+		},
+
+		{
+			"1..5 0..=n 1.5",
+			[]token.Token{
+				{Type: token.INT, Literal: "1", Row: 1, Column: 1},
+				{Type: token.DOTDOT, Literal: "..", Row: 1, Column: 2},
+				{Type: token.INT, Literal: "5", Row: 1, Column: 4},
+				{Type: token.INT, Literal: "0", Row: 1, Column: 6},
+				{Type: token.DOTDOTEQ, Literal: "..=", Row: 1, Column: 7},
+				{Type: token.ID, Literal: "n", Row: 1, Column: 10},
+				{Type: token.FLOAT, Literal: "1.5", Row: 1, Column: 12},
+				{Type: token.EOF, Literal: "\x00", Row: 1, Column: 15},
+			},
+		},
+		{
+			"f(x)?;",
+			[]token.Token{
+				{Type: token.ID, Literal: "f", Row: 1, Column: 1},
+				{Type: token.LPAREN, Literal: "(", Row: 1, Column: 2},
+				{Type: token.ID, Literal: "x", Row: 1, Column: 3},
+				{Type: token.RPAREN, Literal: ")", Row: 1, Column: 4},
+				{Type: token.QUESTION, Literal: "?", Row: 1, Column: 5},
+				{Type: token.SEMICOLON, Literal: ";", Row: 1, Column: 6},
+				{Type: token.EOF, Literal: "\x00", Row: 1, Column: 7},
+			},
+		},
+		{
+			"#!/usr/bin/env mist\nx;",
+			[]token.Token{
+				{Type: token.ID, Literal: "x", Row: 2, Column: 1},
+				{Type: token.SEMICOLON, Literal: ";", Row: 2, Column: 2},
+			},
+		},
 	}
 
 	for i, test := range input {
 		l := NewLexer(test.code)
 		for j, expected := range test.expected {
 			actual := l.NextToken()
-			if expected != *actual {
+			if !reflect.DeepEqual(expected, *actual) {
 				t.Errorf("case %d:token %d expected %#v, got=%#v", i, j, expected, actual)
 			}
 		}
 	}
 }
+
+func TestDiagnostics(t *testing.T) {
+	tests := []struct {
+		code     string
+		expected []string
+	}{
+		{"let x = 1;", []string{}},
+		{"let x = 1 $ 2;", []string{"[1,11] unexpected character \"$\""}},
+		{"let s = \"abc", []string{"[1,9] unterminated string"}},
+		{"$;\n\"a\" + \"b", []string{"[1,1] unexpected character \"$\"", "[2,7] unterminated string"}},
+	}
+
+	for i, test := range tests {
+		l := NewLexer(test.code)
+		for tok := l.NextToken(); tok.Type != token.EOF; tok = l.NextToken() {
+		}
+
+		diagnostics := l.Diagnostics()
+		if len(diagnostics) != len(test.expected) {
+			t.Errorf("case %d: expected %d diagnostics, got=%v", i, len(test.expected), diagnostics)
+			continue
+		}
+		for j, d := range diagnostics {
+			if d.String() != test.expected[j] {
+				t.Errorf("case %d: expected %s, got=%s", i, test.expected[j], d.String())
+			}
+		}
+	}
+}
+
+func TestTrivia(t *testing.T) {
+	tests := []struct {
+		code     string
+		expected [][]token.Token // the leading tokens of every token
+	}{
+		{"x", [][]token.Token{nil, nil}},
+		{
+			"// a\nx  // b\n",
+			[][]token.Token{
+				{
+					{Type: token.COMMENT, Literal: "// a", Row: 1, Column: 1},
+					{Type: token.NEWLINE, Literal: "\n", Row: 1, Column: 5},
+				},
+				{
+					{Type: token.SPACE, Literal: "  ", Row: 2, Column: 2},
+					{Type: token.COMMENT, Literal: "// b", Row: 2, Column: 4},
+					{Type: token.NEWLINE, Literal: "\n", Row: 2, Column: 8},
+				},
+			},
+		},
+		// a comment ending the input without a newline
+		{"x; // end", [][]token.Token{nil, nil, {
+			{Type: token.SPACE, Literal: " ", Row: 1, Column: 3},
+			{Type: token.COMMENT, Literal: "// end", Row: 1, Column: 4},
+		}}},
+	}
+
+	for i, test := range tests {
+		l := NewLexer(test.code)
+		l.KeepTrivia()
+		for j, expected := range test.expected {
+			actual := l.NextToken()
+			if !reflect.DeepEqual(expected, actual.Leading) {
+				t.Errorf("case %d: token %d expected leading %#v, got=%#v", i, j, expected, actual.Leading)
+			}
+		}
+	}
+
+	// without asking for them, the lexer drops them
+	l := NewLexer("// a\nx")
+	if tok := l.NextToken(); tok.Leading != nil || tok.Literal != "x" {
+		t.Errorf("expected x without leading tokens, got=%#v", tok)
+	}
+}
@@ -0,0 +1,406 @@
+package lsp
+
+import (
+	"io"
+	"lang/ast"
+	"lang/checker"
+	"lang/diagnostic"
+	"lang/eval"
+	"lang/lexer"
+	"lang/object"
+	"lang/parser"
+	"lang/token"
+	"sort"
+	"strings"
+)
+
+// an open document and what the server found in it
+type document struct {
+	uri         string
+	lines       []string
+	tokens      []token.Token
+	diagnostics []diagnostic.Diagnostic
+	index       *index
+}
+
+// lexes, parses and checks text. A document with syntax errors is still
+// indexed, as far as the parser made sense of it, but not checked.
+func newDocument(uri, text string, builtins map[string]bool) *document {
+	d := &document{uri: uri, lines: strings.Split(text, "\n")}
+
+	l := lexer.NewLexer(text)
+	for tok := l.NextToken(); tok.Type != token.EOF; tok = l.NextToken() {
+		d.tokens = append(d.tokens, *tok)
+	}
+
+	p := parser.NewParser(lexer.NewLexer(text))
+	program := p.Parse()
+	d.diagnostics = p.Diagnostics()
+	if len(d.diagnostics) == 0 {
+		c := checker.NewChecker()
+		c.Declare("args", argsType())
+		c.Check(program)
+		d.diagnostics = append(c.Diagnostics(), c.WarningDiagnostics()...)
+		diagnostic.Sort(d.diagnostics)
+	}
+
+	d.index = newIndex(program, builtins)
+	return d
+}
+
+// the position of a row and column of the lexer, which count bytes
+// from 1, in the UTF-16 code units LSP counts from 0
+func (d *document) position(row, column int) Position {
+	line := row - 1
+	if line < 0 {
+		return Position{}
+	}
+	if line >= len(d.lines) {
+		line = len(d.lines) - 1
+		column = len(d.lines[line]) + 1
+	}
+
+	text := d.lines[line]
+	offset := column - 1
+	if offset < 0 {
+		offset = 0
+	}
+	if offset > len(text) {
+		offset = len(text)
+	}
+
+	units := 0
+	for _, r := range text[:offset] {
+		units += utf16Len(r)
+	}
+	return Position{Line: line, Character: units}
+}
+
+// the row and column of the lexer at p
+func (d *document) rowColumn(p Position) (int, int) {
+	if p.Line < 0 || p.Line >= len(d.lines) {
+		return p.Line + 1, p.Character + 1
+	}
+
+	text := d.lines[p.Line]
+	units := 0
+	for i, r := range text {
+		if units >= p.Character {
+			return p.Line + 1, i + 1
+		}
+		units += utf16Len(r)
+	}
+	return p.Line + 1, len(text) + 1
+}
+
+func utf16Len(r rune) int {
+	if r >= 0x10000 {
+		return 2
+	}
+	return 1
+}
+
+func (d *document) rangeOf(row, column, length int) Range {
+	return Range{Start: d.position(row, column), End: d.position(row, column+length)}
+}
+
+func (d *document) tokenRange(tok token.Token) Range {
+	return d.rangeOf(tok.Row, tok.Column, len(tok.Literal))
+}
+
+func (d *document) lspDiagnostics() []Diagnostic {
+	diagnostics := []Diagnostic{}
+	for _, diag := range d.diagnostics {
+		severity := SeverityError
+		if diag.Severity == diagnostic.Warning {
+			severity = SeverityWarning
+		}
+
+		start, end := diag.Span.Start, diag.Span.End
+		r := Range{Start: d.position(start.Row, start.Column), End: d.position(end.Row, end.Column)}
+		if r.End.Line < r.Start.Line || r.End.Line == r.Start.Line && r.End.Character <= r.Start.Character {
+			r.End = Position{Line: r.Start.Line, Character: r.Start.Character + 1}
+		}
+
+		diagnostics = append(diagnostics, Diagnostic{
+			Range:    r,
+			Severity: severity,
+			Code:     diag.Code,
+			Source:   "mist",
+			Message:  diag.Message,
+		})
+	}
+	return diagnostics
+}
+
+func (d *document) hover(p Position) *Hover {
+	o := d.index.at(d.rowColumn(p))
+	if o == nil {
+		return nil
+	}
+
+	text := "builtin " + o.builtin
+	if o.decl != nil {
+		text = o.decl.detail
+		// a variable without a written type takes the one the checker found
+		if o.decl.typ == nil && o.typ != nil && o.decl.kind != KindStruct && o.decl.kind != KindEnum {
+			text += ": " + o.typ.String()
+		}
+	}
+
+	r := d.rangeOf(o.row, o.column, o.length)
+	return &Hover{Contents: MarkupContent{Kind: "markdown", Value: "```rust\n" + text + "\n```"}, Range: &r}
+}
+
+func (d *document) definition(p Position) *Location {
+	o := d.index.at(d.rowColumn(p))
+	if o == nil || o.decl == nil {
+		return nil
+	}
+	return &Location{URI: d.uri, Range: d.tokenRange(o.decl.token)}
+}
+
+func (d *document) symbols() []DocumentSymbol {
+	symbols := []DocumentSymbol{}
+	for _, decl := range d.index.declarations {
+		symbol := d.symbol(decl)
+		for _, m := range decl.members {
+			symbol.Children = append(symbol.Children, d.symbol(m))
+		}
+		symbols = append(symbols, symbol)
+	}
+	return symbols
+}
+
+func (d *document) symbol(decl *declaration) DocumentSymbol {
+	selection := d.tokenRange(decl.token)
+	r := Range{Start: d.position(decl.start.Row, decl.start.Column), End: d.statementEnd(decl.start)}
+	if decl.kind == KindField || decl.kind == KindEnumMember {
+		r = selection
+	}
+	return DocumentSymbol{Name: decl.name, Detail: decl.detail, Kind: decl.kind, Range: r, SelectionRange: selection}
+}
+
+// the end of the statement starting at start, its ; or the } closing
+// the braces it opens
+func (d *document) statementEnd(start token.Token) Position {
+	i := sort.Search(len(d.tokens), func(i int) bool {
+		t := d.tokens[i]
+		return t.Row > start.Row || t.Row == start.Row && t.Column >= start.Column
+	})
+
+	depth := 0
+	end := start
+	for ; i < len(d.tokens); i++ {
+		t := d.tokens[i]
+		if t.Type != token.STRING {
+			end = t
+		}
+
+		switch t.Type {
+		case token.LBRACE:
+			depth++
+		case token.RBRACE:
+			depth--
+			if depth <= 0 {
+				return d.position(t.Row, t.Column+1)
+			}
+		case token.SEMICOLON:
+			if depth == 0 {
+				return d.position(t.Row, t.Column+1)
+			}
+		}
+	}
+	return d.position(end.Row, end.Column+len(end.Literal))
+}
+
+// completion of the word at p, the members of a value when the word
+// follows a . or the names in scope otherwise
+func (d *document) completion(p Position, builtins map[string]bool) []CompletionItem {
+	row, column := d.rowColumn(p)
+	if row < 1 || row > len(d.lines) {
+		return []CompletionItem{}
+	}
+	before := d.lines[row-1][:column-1]
+	before = strings.TrimRightFunc(before, isIdentifierRune)
+
+	switch {
+	case strings.HasSuffix(before, "::"):
+		return d.members(strings.TrimSuffix(before, "::"), row, column, true)
+	case strings.HasSuffix(before, "."):
+		return d.members(strings.TrimSuffix(before, "."), row, column, false)
+	}
+
+	items := []CompletionItem{}
+	for name := range builtins {
+		kind := CompletionFunction
+		if name == "args" {
+			kind = CompletionVariable
+		}
+		items = append(items, CompletionItem{Label: name, Kind: kind, Detail: "builtin"})
+	}
+	for _, keyword := range token.Keywords() {
+		items = append(items, CompletionItem{Label: keyword, Kind: CompletionKeyword})
+	}
+	seen := map[string]bool{}
+	for _, decl := range d.index.all {
+		if seen[decl.name] || !d.visible(decl, row, column) {
+			continue
+		}
+		seen[decl.name] = true
+		items = append(items, CompletionItem{Label: decl.name, Kind: completionKind(decl.kind), Detail: decl.detail})
+	}
+	return sorted(items)
+}
+
+// the methods and fields of the value before a ., or the variants of
+// the enum before a ::
+func (d *document) members(receiver string, row, column int, path bool) []CompletionItem {
+	items := []CompletionItem{}
+	var methods map[string]object.BuiltinMethod
+
+	name := receiver[len(strings.TrimRightFunc(receiver, isIdentifierRune)):]
+	switch {
+	case strings.HasSuffix(receiver, `"`):
+		methods = eval.NewString("").Methods
+	case strings.HasSuffix(receiver, "]"):
+		methods = eval.NewList(nil).Methods
+	case name != "":
+		decl := d.declarationBefore(name, row, column)
+		typ := ""
+		switch {
+		case decl == nil:
+			typ = name
+		case decl.kind == KindEnum || path:
+			typ = decl.name
+		case decl.typ != nil:
+			typ = decl.typ.Name
+		}
+
+		if def := d.declarationBefore(typ, row, column); def != nil && (def.kind == KindStruct || def.kind == KindEnum) {
+			for _, m := range def.members {
+				if path == (m.kind == KindEnumMember) {
+					items = append(items, CompletionItem{Label: m.name, Kind: completionKind(m.kind), Detail: m.detail})
+				}
+			}
+			return sorted(items)
+		}
+		methods = builtinMethods(typ)
+	}
+
+	if path {
+		return sorted(items)
+	}
+	if methods == nil {
+		// the type isn't known, any method may do
+		for _, typ := range []string{"List", "String", "Map", "Option", "Result", "Range", "Iterator"} {
+			for name := range builtinMethods(typ) {
+				items = append(items, CompletionItem{Label: name, Kind: CompletionMethod, Detail: typ + " method"})
+			}
+		}
+		return sorted(items)
+	}
+	for name := range methods {
+		items = append(items, CompletionItem{Label: name, Kind: CompletionMethod})
+	}
+	return sorted(items)
+}
+
+// the methods of the builtin types, taken from real objects so the
+// list never misses one the evaluator knows about
+func builtinMethods(typ string) map[string]object.BuiltinMethod {
+	switch typ {
+	case "List":
+		return eval.NewList(nil).Methods
+	case "String":
+		return eval.NewString("").Methods
+	case "Map":
+		return eval.NewMap(nil).Methods
+	case "Option":
+		return eval.OptionType.Methods
+	case "Result":
+		return eval.ResultType.Methods
+	case "Range":
+		return eval.NewRange(0, 0, false).Methods
+	case "Iterator":
+		return eval.NewIterator(nil).Methods
+	default:
+		return nil
+	}
+}
+
+// the declaration of name nearest before row and column, one at the top
+// of the document when no local one comes before
+func (d *document) declarationBefore(name string, row, column int) *declaration {
+	var found *declaration
+	for _, decl := range d.index.all {
+		if decl.name != name || decl.kind == KindField || decl.kind == KindMethod || decl.kind == KindEnumMember {
+			continue
+		}
+		if !d.visible(decl, row, column) {
+			continue
+		}
+		if found == nil || found.local == decl.local && before(found.token, decl.token) || decl.local && !found.local {
+			found = decl
+		}
+	}
+	return found
+}
+
+// names at the top of the document are visible everywhere, the others
+// only after they are declared
+func (d *document) visible(decl *declaration, row, column int) bool {
+	if decl.kind == KindField || decl.kind == KindMethod || decl.kind == KindEnumMember {
+		return false
+	}
+	return !decl.local || decl.token.Row < row || decl.token.Row == row && decl.token.Column < column
+}
+
+func before(a, b token.Token) bool {
+	return a.Row < b.Row || a.Row == b.Row && a.Column < b.Column
+}
+
+func isIdentifierRune(r rune) bool {
+	return r == '_' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9'
+}
+
+func completionKind(kind SymbolKind) CompletionItemKind {
+	switch kind {
+	case KindFunction:
+		return CompletionFunction
+	case KindMethod:
+		return CompletionMethod
+	case KindField:
+		return CompletionField
+	case KindStruct:
+		return CompletionStruct
+	case KindEnum:
+		return CompletionEnum
+	case KindEnumMember:
+		return CompletionMember
+	case KindModule:
+		return CompletionModule
+	default:
+		return CompletionVariable
+	}
+}
+
+func sorted(items []CompletionItem) []CompletionItem {
+	sort.SliceStable(items, func(i, j int) bool { return items[i].Label < items[j].Label })
+	return items
+}
+
+// the names the builtins are bound to, and args which mist run binds to
+// the arguments of the program
+func builtinNames() map[string]bool {
+	names := map[string]bool{"args": true}
+	for name := range eval.NewBuiltins(io.Discard, io.Discard) {
+		names[name] = true
+	}
+	return names
+}
+
+// the type of args, like mist run declares it
+func argsType() *ast.TypeNode {
+	return ast.NewType("List", ast.NewType("String"))
+}
@@ -0,0 +1,508 @@
+package lsp
+
+import (
+	"lang/ast"
+	"lang/token"
+	"sort"
+	"strings"
+)
+
+// a name a document declares
+type declaration struct {
+	name   string
+	kind   SymbolKind
+	token  token.Token   // the name where it is declared
+	start  token.Token   // the first token of the declaring statement
+	detail string        // the declaration as hover shows it
+	typ    *ast.TypeNode // nil when it isn't written down
+
+	// fields and methods of a struct, variants of an enum
+	members []*declaration
+	// declared in a block or a function, not at the top of the document
+	local bool
+}
+
+func (d *declaration) member(name string) *declaration {
+	for _, m := range d.members {
+		if m.name == name {
+			return m
+		}
+	}
+	return nil
+}
+
+// a name written in the source, and what it refers to
+type occurrence struct {
+	row, column, length int
+	decl                *declaration
+	builtin             string // the builtin it names when decl is nil
+	// the type the checker found for the name, nil when unknown
+	typ *ast.TypeNode
+}
+
+// names are resolved the way object.Scope resolves them, the innermost
+// binding wins and a let shadows the bindings before it
+type scope struct {
+	names map[string]*declaration
+	outer *scope
+}
+
+func newScope(outer *scope) *scope {
+	return &scope{names: make(map[string]*declaration), outer: outer}
+}
+
+func (s *scope) lookup(name string) *declaration {
+	for ; s != nil; s = s.outer {
+		if d, ok := s.names[name]; ok {
+			return d
+		}
+	}
+	return nil
+}
+
+type index struct {
+	declarations []*declaration // the ones at the top of the document
+	all          []*declaration
+	occurrences  []occurrence // in source order
+}
+
+// the occurrence covering row and column, nil when there is none
+func (ix *index) at(row, column int) *occurrence {
+	i := sort.Search(len(ix.occurrences), func(i int) bool {
+		o := ix.occurrences[i]
+		return o.row > row || o.row == row && o.column+o.length > column
+	})
+	if i == len(ix.occurrences) {
+		return nil
+	}
+	o := &ix.occurrences[i]
+	if o.row != row || o.column > column {
+		return nil
+	}
+	return o
+}
+
+type indexer struct {
+	index    *index
+	scope    *scope
+	builtins map[string]bool
+	// function bodies are walked once the block around them is done,
+	// they run after it and see the names it declares later on
+	pending [][]func()
+	depth   int
+}
+
+func newIndex(program *ast.Program, builtins map[string]bool) *index {
+	ix := &indexer{
+		index:    &index{},
+		scope:    newScope(nil),
+		builtins: builtins,
+	}
+	ix.block(program.Statements)
+
+	sort.SliceStable(ix.index.occurrences, func(i, j int) bool {
+		a, b := ix.index.occurrences[i], ix.index.occurrences[j]
+		return a.row < b.row || a.row == b.row && a.column < b.column
+	})
+	return ix.index
+}
+
+func (ix *indexer) declare(d *declaration, bind bool) *declaration {
+	d.local = ix.depth > 0
+	if !d.local && d.kind != KindField && d.kind != KindMethod && d.kind != KindEnumMember {
+		ix.index.declarations = append(ix.index.declarations, d)
+	}
+	ix.index.all = append(ix.index.all, d)
+	if bind {
+		ix.scope.names[d.name] = d
+	}
+	ix.occur(d.token, d)
+	return d
+}
+
+func (ix *indexer) occur(tok token.Token, d *declaration) {
+	if d == nil || tok.Row == 0 || tok.Literal == "" {
+		return
+	}
+	ix.index.occurrences = append(ix.index.occurrences,
+		occurrence{row: tok.Row, column: tok.Column, length: len(tok.Literal), decl: d})
+}
+
+// a reference to a name, resolved in the current scope
+func (ix *indexer) reference(ident *ast.Identifier) {
+	if ident == nil || ident.Token.Row == 0 {
+		return
+	}
+
+	o := occurrence{row: ident.Token.Row, column: ident.Token.Column, length: len(ident.Value), typ: ident.Type}
+	o.decl = ix.scope.lookup(ident.Value)
+	if o.decl == nil {
+		if !ix.builtins[ident.Value] {
+			return
+		}
+		o.builtin = ident.Value
+	}
+	ix.index.occurrences = append(ix.index.occurrences, o)
+}
+
+// walks statements in the current scope
+func (ix *indexer) block(statements []ast.Statement) {
+	ix.pending = append(ix.pending, nil)
+	ix.hoist(statements)
+	for _, s := range statements {
+		ix.statement(s)
+	}
+
+	bodies := ix.pending[len(ix.pending)-1]
+	ix.pending = ix.pending[:len(ix.pending)-1]
+	for _, body := range bodies {
+		body()
+	}
+}
+
+// walks a block in a new scope, bind declares the names that come
+// before its statements
+func (ix *indexer) blockIn(block *ast.BlockStatement, bind func()) {
+	if block == nil {
+		return
+	}
+
+	outer := ix.scope
+	ix.scope = newScope(outer)
+	ix.depth++
+	defer func() {
+		ix.scope = outer
+		ix.depth--
+	}()
+
+	if bind != nil {
+		bind()
+	}
+	ix.block(block.Statements)
+}
+
+// functions, structs, enums and modules can be used before they are
+// declared
+func (ix *indexer) hoist(statements []ast.Statement) {
+	for _, s := range statements {
+		switch s := s.(type) {
+		case *ast.UseStatement:
+			ix.declare(&declaration{
+				name:   s.Name.Value,
+				kind:   KindModule,
+				token:  s.Name.Token,
+				start:  s.Token,
+				detail: strings.TrimSuffix(s.String(), ";"),
+			}, true)
+		case *ast.ExpressionStatement:
+			if fn, ok := s.Expression.(*ast.Function); ok && fn.Name != nil {
+				ix.declare(&declaration{
+					name:   fn.Name.Value,
+					kind:   KindFunction,
+					token:  fn.Name.Token,
+					start:  fn.Token,
+					detail: signature(fn.Name.Value, fn.FunctionLiteral),
+					typ:    functionType(fn.FunctionLiteral),
+				}, true)
+			}
+		case *ast.StructStatement:
+			d := ix.declare(&declaration{name: s.Name.Value, kind: KindStruct, token: s.Name.Token, start: s.Token}, true)
+			fields := []string{}
+			for _, f := range s.Fields {
+				fields = append(fields, f.ParamString())
+				d.members = append(d.members, ix.declare(&declaration{
+					name:   f.Value,
+					kind:   KindField,
+					token:  f.Token,
+					start:  f.Token,
+					detail: f.ParamString(),
+					typ:    f.Type,
+				}, false))
+			}
+			d.detail = "struct " + d.name + " { " + strings.Join(fields, ", ") + " }"
+		case *ast.EnumStatement:
+			d := ix.declare(&declaration{name: s.Name.Value, kind: KindEnum, token: s.Name.Token, start: s.Token}, true)
+			variants := []string{}
+			for _, v := range s.Variants {
+				variants = append(variants, v.String())
+				d.members = append(d.members, ix.declare(&declaration{
+					name:   v.Name.Value,
+					kind:   KindEnumMember,
+					token:  v.Name.Token,
+					start:  v.Name.Token,
+					detail: d.name + "::" + v.String(),
+				}, false))
+			}
+			d.detail = "enum " + d.name + " { " + strings.Join(variants, ", ") + " }"
+		}
+	}
+
+	// impl blocks may come before the struct they implement
+	for _, s := range statements {
+		impl, ok := s.(*ast.ImplStatement)
+		if !ok {
+			continue
+		}
+		def := ix.scope.lookup(impl.Name.Value)
+		for _, m := range impl.Methods {
+			d := ix.declare(&declaration{
+				name:   m.Name.Value,
+				kind:   KindMethod,
+				token:  m.Name.Token,
+				start:  m.Token,
+				detail: signature(m.Name.Value, m.FunctionLiteral),
+				typ:    functionType(m.FunctionLiteral),
+			}, false)
+			if def != nil && def.kind == KindStruct {
+				def.members = append(def.members, d)
+			}
+		}
+	}
+}
+
+func (ix *indexer) statement(node ast.Statement) {
+	switch node := node.(type) {
+	case *ast.LetStatement:
+		ix.expression(node.Value)
+		ix.typeNode(node.Name.Type)
+
+		detail := "let " + node.Name.ParamString()
+		if node.Mutable {
+			detail = "let mut " + node.Name.ParamString()
+		}
+		kind := KindConstant
+		if node.Mutable {
+			kind = KindVariable
+		}
+		ix.declare(&declaration{
+			name:   node.Name.Value,
+			kind:   kind,
+			token:  node.Name.Token,
+			start:  node.Token,
+			detail: detail,
+			typ:    node.Name.Type,
+		}, true)
+	case *ast.AssignStatement:
+		ix.expression(node.Target)
+		ix.expression(node.Value)
+	case *ast.ReturnStatement:
+		ix.expression(node.ReturnValue)
+	case *ast.ExpressionStatement:
+		ix.expression(node.Expression)
+	case *ast.BlockStatement:
+		ix.blockIn(node, nil)
+	case *ast.StructStatement:
+		for _, f := range node.Fields {
+			ix.typeNode(f.Type)
+		}
+	case *ast.EnumStatement:
+		for _, v := range node.Variants {
+			for _, f := range v.Fields {
+				ix.typeNode(f)
+			}
+		}
+	case *ast.ImplStatement:
+		ix.reference(node.Name)
+		for _, m := range node.Methods {
+			ix.function(m.FunctionLiteral)
+		}
+	case *ast.WhileStatement:
+		ix.expression(node.Condition)
+		ix.blockIn(node.Body, nil)
+	case *ast.ForStatement:
+		ix.expression(node.Iterable)
+		ix.blockIn(node.Body, func() {
+			for _, v := range node.Variables {
+				ix.declare(&declaration{name: v.Value, kind: KindVariable, token: v.Token, start: node.Token, detail: v.Value}, true)
+			}
+		})
+	case *ast.BreakStatement:
+		ix.expression(node.Value)
+	case *ast.TestStatement:
+		ix.blockIn(node.Body, nil)
+	}
+}
+
+func (ix *indexer) expression(node ast.Expression) {
+	switch node := node.(type) {
+	case *ast.Identifier:
+		ix.reference(node)
+	case *ast.PrefixExpression:
+		ix.expression(node.Right)
+	case *ast.InfixExpression:
+		ix.expression(node.Left)
+		ix.expression(node.Right)
+	case *ast.IfExpression:
+		ix.expression(node.Condition)
+		ix.blockIn(node.Consequence, nil)
+		ix.expression(node.Others)
+		ix.blockIn(node.Alternative, nil)
+	case *ast.Function:
+		ix.function(node.FunctionLiteral)
+	case *ast.FunctionLiteral:
+		ix.function(node)
+	case *ast.CallExpression:
+		ix.expression(node.Function)
+		for _, arg := range node.Arguments {
+			ix.expression(arg)
+		}
+	case *ast.ListLiteral:
+		for _, e := range node.Elements {
+			ix.expression(e)
+		}
+	case *ast.MapLiteral:
+		for key, value := range node.Pairs {
+			ix.expression(key)
+			ix.expression(value)
+		}
+	case *ast.IndexExpression:
+		ix.expression(node.Left)
+		ix.expression(node.Index)
+		ix.expression(node.End)
+	case *ast.RangeExpression:
+		ix.expression(node.Start)
+		ix.expression(node.End)
+	case *ast.TryExpression:
+		ix.expression(node.Value)
+	case *ast.AccessExpression:
+		ix.access(node)
+	case *ast.StructLiteral:
+		ix.reference(node.Name)
+		def := ix.scope.lookup(node.Name.Value)
+		for i, f := range node.Fields {
+			if def != nil {
+				ix.occur(f.Token, def.member(f.Value))
+			}
+			ix.expression(node.Values[i])
+		}
+	case *ast.MatchExpression:
+		ix.expression(node.Subject)
+		for _, arm := range node.Arms {
+			arm := arm
+			ix.blockIn(arm.Body, func() {
+				ix.pattern(arm.Pattern)
+				ix.expression(arm.Guard)
+			})
+		}
+	case *ast.LoopExpression:
+		ix.blockIn(node.Body, nil)
+	}
+}
+
+// the attribute of x.attribute or Enum::Variant, resolved when the type
+// of x is a struct of the document
+func (ix *indexer) access(node *ast.AccessExpression) {
+	ix.expression(node.Struct)
+
+	ident, ok := node.Struct.(*ast.Identifier)
+	if !ok {
+		return
+	}
+
+	var def *declaration
+	if d := ix.scope.lookup(ident.Value); d != nil {
+		switch {
+		case d.kind == KindEnum || d.kind == KindStruct:
+			def = d
+		case d.typ != nil:
+			def = ix.scope.lookup(d.typ.Name)
+		}
+	}
+	if def == nil || (def.kind != KindStruct && def.kind != KindEnum) {
+		return
+	}
+
+	// the attribute follows the . or :: right away
+	tok := token.Token{Literal: node.Attribute, Row: node.Token.Row, Column: node.Token.Column + len(node.Token.Literal)}
+	if m := def.member(node.Attribute); m != nil {
+		ix.occur(tok, m)
+	}
+}
+
+func (ix *indexer) pattern(node ast.Pattern) {
+	switch node := node.(type) {
+	case *ast.BindingPattern:
+		ix.declare(&declaration{name: node.Name.Value, kind: KindVariable, token: node.Name.Token, start: node.Token, detail: node.Name.Value}, true)
+	case *ast.VariantPattern:
+		if !node.Prelude {
+			ix.reference(node.Enum)
+			if def := ix.scope.lookup(node.Enum.Value); def != nil && node.Variant != nil {
+				ix.occur(node.Variant.Token, def.member(node.Variant.Value))
+			}
+		}
+		for _, f := range node.Fields {
+			ix.pattern(f)
+		}
+	case *ast.ListPattern:
+		for _, e := range node.Elements {
+			ix.pattern(e)
+		}
+		if node.Rest != nil {
+			ix.declare(&declaration{name: node.Rest.Value, kind: KindVariable, token: node.Rest.Token, start: node.Token, detail: node.Rest.Value}, true)
+		}
+	}
+}
+
+// the parameters and body of a function, walked once the current block
+// is done
+func (ix *indexer) function(fn *ast.FunctionLiteral) {
+	if fn == nil {
+		return
+	}
+	for _, p := range fn.Parameters {
+		ix.typeNode(p.Type)
+	}
+	ix.typeNode(fn.Type)
+
+	outer := ix.scope
+	depth := ix.depth
+	last := len(ix.pending) - 1
+	ix.pending[last] = append(ix.pending[last], func() {
+		scope, saved := ix.scope, ix.depth
+		ix.scope, ix.depth = outer, depth
+		defer func() { ix.scope, ix.depth = scope, saved }()
+
+		ix.blockIn(fn.Body, func() {
+			for _, p := range fn.Parameters {
+				ix.declare(&declaration{name: p.Value, kind: KindVariable, token: p.Token, start: p.Token, detail: p.ParamString(), typ: p.Type}, true)
+			}
+		})
+	})
+}
+
+// struct and enum names in a type annotation
+func (ix *indexer) typeNode(t *ast.TypeNode) {
+	if t == nil {
+		return
+	}
+	if d := ix.scope.lookup(t.Name); d != nil && (d.kind == KindStruct || d.kind == KindEnum) {
+		ix.occur(t.Token, d)
+	}
+	for _, p := range t.Parameters {
+		ix.typeNode(p)
+	}
+	ix.typeNode(t.Return)
+}
+
+// fn name(a: Int, b: Int) Int, the return type is left out when there
+// is none
+func signature(name string, fn *ast.FunctionLiteral) string {
+	params := []string{}
+	for _, p := range fn.Parameters {
+		params = append(params, p.ParamString())
+	}
+
+	s := "fn " + name + "(" + strings.Join(params, ", ") + ")"
+	if t := fn.Type.String(); t != "" && t != "Void" {
+		s += " " + t
+	}
+	return s
+}
+
+func functionType(fn *ast.FunctionLiteral) *ast.TypeNode {
+	params := []*ast.TypeNode{}
+	for _, p := range fn.Parameters {
+		params = append(params, p.Type)
+	}
+	return ast.NewFunctionType(params, fn.Type)
+}
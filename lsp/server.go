@@ -0,0 +1,199 @@
+// Package lsp is a language server for Mist. It speaks the Language Server
+// Protocol over a pair of streams, usually stdin and stdout, and reports
+// the diagnostics of the lexer, parser and checker, hovers, definitions,
+// document symbols and completions. Programs are never run.
+package lsp
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"lang/wire"
+)
+
+type server struct {
+	out       io.Writer
+	builtins  map[string]bool
+	documents map[string]*document
+
+	initialized bool
+	shutdown    bool
+}
+
+// Serve answers the messages read from in on out until the client exits
+// or closes in. Exiting before a shutdown request is an error.
+func Serve(in io.Reader, out io.Writer) error {
+	s := &server{out: out, builtins: builtinNames(), documents: map[string]*document{}}
+	r := bufio.NewReader(in)
+
+	for {
+		body, err := wire.Read(r)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		var req request
+		if err := json.Unmarshal(body, &req); err != nil {
+			err := wire.Write(s.out, errorResponse{JSONRPC: "2.0", ID: json.RawMessage("null"),
+				Error: &responseError{Code: codeParseError, Message: err.Error()}})
+			if err != nil {
+				return err
+			}
+			continue
+		}
+
+		if req.Method == "exit" {
+			if !s.shutdown {
+				return errors.New("exit before shutdown")
+			}
+			return nil
+		}
+
+		result, rerr := s.handle(&req)
+		if req.isNotification() {
+			continue
+		}
+		if rerr != nil {
+			err = wire.Write(s.out, errorResponse{JSONRPC: "2.0", ID: req.ID, Error: rerr})
+		} else {
+			err = wire.Write(s.out, response{JSONRPC: "2.0", ID: req.ID, Result: result})
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func (s *server) handle(req *request) (result interface{}, rerr *responseError) {
+	defer func() {
+		if r := recover(); r != nil {
+			result, rerr = nil, &responseError{Code: codeInternalError, Message: fmt.Sprint(r)}
+		}
+	}()
+
+	switch {
+	case req.Method == "initialize":
+		s.initialized = true
+		result := InitializeResult{Capabilities: ServerCapabilities{
+			TextDocumentSync:       syncFull,
+			HoverProvider:          true,
+			DefinitionProvider:     true,
+			DocumentSymbolProvider: true,
+			CompletionProvider:     CompletionOptions{TriggerCharacters: []string{".", ":"}},
+		}}
+		result.ServerInfo.Name = "mist"
+		return result, nil
+	case !s.initialized:
+		return nil, &responseError{Code: codeServerNotInitialized, Message: "server not initialized"}
+	case s.shutdown:
+		return nil, &responseError{Code: codeInvalidRequest, Message: "server is shutting down"}
+	}
+
+	switch req.Method {
+	case "initialized":
+		return nil, nil
+	case "shutdown":
+		s.shutdown = true
+		return nil, nil
+
+	case "textDocument/didOpen":
+		var params DidOpenTextDocumentParams
+		if err := decode(req.Params, &params); err != nil {
+			return nil, err
+		}
+		return nil, s.open(params.TextDocument.URI, params.TextDocument.Text)
+	case "textDocument/didChange":
+		var params DidChangeTextDocumentParams
+		if err := decode(req.Params, &params); err != nil {
+			return nil, err
+		}
+		if len(params.ContentChanges) == 0 {
+			return nil, nil
+		}
+		return nil, s.open(params.TextDocument.URI, params.ContentChanges[len(params.ContentChanges)-1].Text)
+	case "textDocument/didClose":
+		var params DidCloseTextDocumentParams
+		if err := decode(req.Params, &params); err != nil {
+			return nil, err
+		}
+		delete(s.documents, params.TextDocument.URI)
+		return nil, s.publish(params.TextDocument.URI, []Diagnostic{})
+
+	case "textDocument/hover":
+		var params TextDocumentPositionParams
+		if err := decode(req.Params, &params); err != nil {
+			return nil, err
+		}
+		if d := s.documents[params.TextDocument.URI]; d != nil {
+			if hover := d.hover(params.Position); hover != nil {
+				return hover, nil
+			}
+		}
+		return nil, nil
+	case "textDocument/definition":
+		var params TextDocumentPositionParams
+		if err := decode(req.Params, &params); err != nil {
+			return nil, err
+		}
+		if d := s.documents[params.TextDocument.URI]; d != nil {
+			if location := d.definition(params.Position); location != nil {
+				return location, nil
+			}
+		}
+		return nil, nil
+	case "textDocument/documentSymbol":
+		var params DocumentSymbolParams
+		if err := decode(req.Params, &params); err != nil {
+			return nil, err
+		}
+		if d := s.documents[params.TextDocument.URI]; d != nil {
+			return d.symbols(), nil
+		}
+		return []DocumentSymbol{}, nil
+	case "textDocument/completion":
+		var params TextDocumentPositionParams
+		if err := decode(req.Params, &params); err != nil {
+			return nil, err
+		}
+		list := CompletionList{Items: []CompletionItem{}}
+		if d := s.documents[params.TextDocument.URI]; d != nil {
+			list.Items = d.completion(params.Position, s.builtins)
+		}
+		return list, nil
+	}
+
+	// notifications the server doesn't know, like $/cancelRequest, are
+	// ignored, their errors are never sent
+	return nil, &responseError{Code: codeMethodNotFound, Message: fmt.Sprintf("method %q not found", req.Method)}
+}
+
+func decode(params json.RawMessage, v interface{}) *responseError {
+	if err := json.Unmarshal(params, v); err != nil {
+		return &responseError{Code: codeInvalidParams, Message: err.Error()}
+	}
+	return nil
+}
+
+// analyses the text of uri and publishes its diagnostics
+func (s *server) open(uri, text string) *responseError {
+	d := newDocument(uri, text, s.builtins)
+	s.documents[uri] = d
+	return s.publish(uri, d.lspDiagnostics())
+}
+
+func (s *server) publish(uri string, diagnostics []Diagnostic) *responseError {
+	err := wire.Write(s.out, notification{
+		JSONRPC: "2.0",
+		Method:  "textDocument/publishDiagnostics",
+		Params:  PublishDiagnosticsParams{URI: uri, Diagnostics: diagnostics},
+	})
+	if err != nil {
+		return &responseError{Code: codeInternalError, Message: err.Error()}
+	}
+	return nil
+}
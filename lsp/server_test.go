@@ -0,0 +1,484 @@
+package lsp
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"lang/wire"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// a scripted client, talking to a server running Serve over pipes
+type client struct {
+	t        *testing.T
+	in       *io.PipeWriter
+	messages chan map[string]json.RawMessage
+	done     chan error
+	id       int
+}
+
+func newClient(t *testing.T) *client {
+	serverIn, in := io.Pipe()
+	out, serverOut := io.Pipe()
+	c := &client{t: t, in: in, messages: make(chan map[string]json.RawMessage, 100), done: make(chan error, 1)}
+
+	go func() {
+		err := Serve(serverIn, serverOut)
+		serverOut.Close()
+		c.done <- err
+	}()
+	// messages are read as soon as they are written, so the server never
+	// blocks on a notification nobody waits for
+	go func() {
+		r := bufio.NewReader(out)
+		for {
+			body, err := wire.Read(r)
+			if err != nil {
+				close(c.messages)
+				return
+			}
+			var message map[string]json.RawMessage
+			if err := json.Unmarshal(body, &message); err != nil {
+				t.Errorf("invalid message %s: %s", body, err)
+			}
+			c.messages <- message
+		}
+	}()
+	return c
+}
+
+func (c *client) send(message interface{}) {
+	c.t.Helper()
+	if err := wire.Write(c.in, message); err != nil {
+		c.t.Fatalf("send: %s", err)
+	}
+}
+
+func (c *client) notify(method string, params interface{}) {
+	c.send(map[string]interface{}{"jsonrpc": "2.0", "method": method, "params": params})
+}
+
+// sends a request and returns its response
+func (c *client) request(method string, params interface{}) map[string]json.RawMessage {
+	c.t.Helper()
+	c.id++
+	c.send(map[string]interface{}{"jsonrpc": "2.0", "id": c.id, "method": method, "params": params})
+	for {
+		message := c.next()
+		if message["method"] == nil && string(message["id"]) == fmt.Sprint(c.id) {
+			return message
+		}
+	}
+}
+
+// sends a request and decodes its result into v
+func (c *client) call(method string, params interface{}, v interface{}) {
+	c.t.Helper()
+	response := c.request(method, params)
+	if response["error"] != nil {
+		c.t.Fatalf("%s: %s", method, response["error"])
+	}
+	if err := json.Unmarshal(response["result"], v); err != nil {
+		c.t.Fatalf("%s: %s", method, err)
+	}
+}
+
+func (c *client) next() map[string]json.RawMessage {
+	c.t.Helper()
+	select {
+	case message, ok := <-c.messages:
+		if !ok {
+			c.t.Fatal("server closed the connection")
+		}
+		return message
+	case <-time.After(5 * time.Second):
+		c.t.Fatal("timed out waiting for the server")
+		return nil
+	}
+}
+
+// the next diagnostics published
+func (c *client) diagnostics() PublishDiagnosticsParams {
+	c.t.Helper()
+	for {
+		message := c.next()
+		if string(message["method"]) == `"textDocument/publishDiagnostics"` {
+			var params PublishDiagnosticsParams
+			if err := json.Unmarshal(message["params"], &params); err != nil {
+				c.t.Fatal(err)
+			}
+			return params
+		}
+	}
+}
+
+func (c *client) initialize() {
+	c.t.Helper()
+	var result InitializeResult
+	c.call("initialize", map[string]interface{}{"capabilities": map[string]interface{}{}}, &result)
+	c.notify("initialized", map[string]interface{}{})
+}
+
+func (c *client) open(uri, text string) PublishDiagnosticsParams {
+	c.t.Helper()
+	c.notify("textDocument/didOpen", DidOpenTextDocumentParams{TextDocument: TextDocumentItem{URI: uri, LanguageID: "mist", Text: text}})
+	return c.diagnostics()
+}
+
+func (c *client) exit() error {
+	c.t.Helper()
+	c.request("shutdown", nil)
+	c.notify("exit", nil)
+	c.in.Close()
+	select {
+	case err := <-c.done:
+		return err
+	case <-time.After(5 * time.Second):
+		c.t.Fatal("timed out waiting for the server to exit")
+		return nil
+	}
+}
+
+func at(uri string, line, character int) TextDocumentPositionParams {
+	return TextDocumentPositionParams{TextDocument: TextDocumentIdentifier{URI: uri}, Position: Position{line, character}}
+}
+
+func TestLifecycle(t *testing.T) {
+	c := newClient(t)
+
+	response := c.request("textDocument/hover", at("file:///a.rs", 0, 0))
+	if code := errorCode(t, response); code != codeServerNotInitialized {
+		t.Errorf("hover before initialize: got code %d, want %d", code, codeServerNotInitialized)
+	}
+
+	var result InitializeResult
+	c.call("initialize", map[string]interface{}{}, &result)
+	if result.ServerInfo.Name != "mist" || result.Capabilities.TextDocumentSync != syncFull ||
+		!result.Capabilities.HoverProvider || !result.Capabilities.DefinitionProvider ||
+		!result.Capabilities.DocumentSymbolProvider {
+		t.Errorf("unexpected capabilities %+v", result)
+	}
+
+	response = c.request("textDocument/formatting", map[string]interface{}{})
+	if code := errorCode(t, response); code != codeMethodNotFound {
+		t.Errorf("unknown method: got code %d, want %d", code, codeMethodNotFound)
+	}
+	response = c.request("textDocument/hover", "nonsense")
+	if code := errorCode(t, response); code != codeInvalidParams {
+		t.Errorf("invalid params: got code %d, want %d", code, codeInvalidParams)
+	}
+	// unknown notifications are ignored
+	c.notify("$/cancelRequest", map[string]interface{}{"id": 1})
+
+	if err := c.exit(); err != nil {
+		t.Errorf("exit: %s", err)
+	}
+}
+
+func TestExitBeforeShutdown(t *testing.T) {
+	c := newClient(t)
+	c.initialize()
+	c.notify("exit", nil)
+	if err := <-c.done; err == nil {
+		t.Error("expected an error exiting before shutdown")
+	}
+}
+
+// a header the server can't trust ends it with an error, instead of a
+// crash or a huge allocation
+func TestInvalidContentLength(t *testing.T) {
+	for _, length := range []string{"-5", "99999999999"} {
+		err := Serve(strings.NewReader("Content-Length: "+length+"\r\n\r\n{}"), io.Discard)
+		if err == nil {
+			t.Errorf("expected an error for Content-Length %s", length)
+		}
+	}
+}
+
+func errorCode(t *testing.T, response map[string]json.RawMessage) int {
+	t.Helper()
+	var e responseError
+	if err := json.Unmarshal(response["error"], &e); err != nil {
+		t.Fatalf("expected an error, got %v", response)
+	}
+	return e.Code
+}
+
+func TestDiagnostics(t *testing.T) {
+	tests := []struct {
+		input       string
+		diagnostics []Diagnostic
+	}{
+		{
+			"fn main() {\n    let x: Int = 1;\n}",
+			[]Diagnostic{},
+		},
+		{
+			"fn main() {\n    let x: Int = ;\n    let y: Int = $;\n}",
+			[]Diagnostic{
+				{Range{Position{1, 17}, Position{1, 18}}, SeverityError, "E0109", "mist", "expected an expression, got ;"},
+				{Range{Position{2, 17}, Position{2, 18}}, SeverityError, "E0001", "mist", "unexpected character \"$\""},
+			},
+		},
+		{
+			"fn main() {\n    let x: Int = \"a\";\n}",
+			[]Diagnostic{
+				{Range{Position{1, 4}, Position{1, 7}}, SeverityError, "E0200", "mist", "type mismatch, expected value of type STRING to be of type INTEGER"},
+			},
+		},
+		{
+			// args is a List<String>, like mist run declares it
+			"fn main() {\n    let first: String = args[0];\n    let n: Int = args[0];\n}",
+			[]Diagnostic{
+				{Range{Position{2, 4}, Position{2, 7}}, SeverityError, "E0200", "mist", "type mismatch, expected value of type STRING to be of type INTEGER"},
+			},
+		},
+		{
+			// characters count UTF-16 code units, the lexer counts bytes
+			"fn main() {\n    let s: String = \"é😀\"; let x: Int = ;\n}",
+			[]Diagnostic{
+				{Range{Position{1, 40}, Position{1, 41}}, SeverityError, "E0109", "mist", "expected an expression, got ;"},
+			},
+		},
+	}
+
+	for i, test := range tests {
+		c := newClient(t)
+		c.initialize()
+		uri := fmt.Sprintf("file:///test%d.rs", i)
+		params := c.open(uri, test.input)
+		if params.URI != uri {
+			t.Errorf("case %d: got diagnostics for %q", i, params.URI)
+		}
+		if !reflect.DeepEqual(params.Diagnostics, test.diagnostics) {
+			t.Errorf("case %d: expected\n%+v\ngot\n%+v", i, test.diagnostics, params.Diagnostics)
+		}
+
+		c.notify("textDocument/didChange", map[string]interface{}{
+			"textDocument":   TextDocumentIdentifier{URI: uri},
+			"contentChanges": []map[string]string{{"text": "fn main() {}"}},
+		})
+		if params := c.diagnostics(); len(params.Diagnostics) != 0 {
+			t.Errorf("case %d: expected no diagnostics after the change, got %+v", i, params.Diagnostics)
+		}
+
+		c.notify("textDocument/didClose", DidCloseTextDocumentParams{TextDocument: TextDocumentIdentifier{URI: uri}})
+		if params := c.diagnostics(); params.Diagnostics == nil || len(params.Diagnostics) != 0 {
+			t.Errorf("case %d: expected closing to clear the diagnostics, got %+v", i, params.Diagnostics)
+		}
+		c.exit()
+	}
+}
+
+const program = `struct Point {
+    x: Int,
+    y: Int,
+}
+
+impl Point {
+    fn sum(self) Int {
+        return self.x + self.y;
+    }
+}
+
+enum Shape {
+    Circle(Float),
+    Empty,
+}
+
+fn add(a: Int, b: Int) Int {
+    return a + b;
+}
+
+fn main() {
+    let x: Int = 1;
+    let mut total: Int = add(x, 2);
+    if (true) {
+        let x: String = "shadow";
+        println(x);
+    };
+    let p: Point = Point { x: 1, y: 2 };
+    println(p.sum(), x, total, later());
+    let s: Shape = Shape::Circle(1.0);
+    let x: Int = x + 1;
+    println(x);
+}
+
+fn later() Int {
+    return 1;
+}
+`
+
+func TestHover(t *testing.T) {
+	tests := []struct {
+		line, character int
+		hover           string
+	}{
+		{22, 29, "let x: Int"},                    // x in add(x, 2)
+		{22, 26, "fn add(a: Int, b: Int) Int"},    // add
+		{22, 14, "let mut total: Int"},            //
+		{25, 16, "let x: String"},                 // the shadowing x
+		{25, 9, "builtin println"},                //
+		{28, 15, "fn sum(self) Int"},              // a method
+		{17, 11, "a: Int"},                        // a parameter
+		{7, 20, "x: Int"},                         // a field
+		{29, 29, "Shape::Circle(Float)"},          // a variant
+		{28, 33, "fn later() Int"},                // declared after it is used
+		{0, 8, "struct Point { x: Int, y: Int }"}, //
+		{30, 17, "let x: Int"},                    // x in x + 1, the x before it
+		{9, 0, ""},                                // nothing there
+		{100, 0, ""},                              // out of the document
+		{21, 50, ""},                              //
+	}
+
+	c := newClient(t)
+	c.initialize()
+	c.open("file:///main.rs", program)
+	for i, test := range tests {
+		var hover *Hover
+		c.call("textDocument/hover", at("file:///main.rs", test.line, test.character), &hover)
+		got := ""
+		if hover != nil {
+			got = hover.Contents.Value
+		}
+		want := ""
+		if test.hover != "" {
+			want = "```rust\n" + test.hover + "\n```"
+		}
+		if got != want {
+			t.Errorf("case %d: expected %q, got %q", i, want, got)
+		}
+	}
+	c.exit()
+}
+
+func TestDefinition(t *testing.T) {
+	tests := []struct {
+		line, character int
+		definition      *Range
+	}{
+		{22, 29, &Range{Position{21, 8}, Position{21, 9}}},   // x in add(x, 2)
+		{25, 16, &Range{Position{24, 12}, Position{24, 13}}}, // the x of the block shadows it
+		{28, 21, &Range{Position{21, 8}, Position{21, 9}}},   // back to the outer x after the block
+		{31, 12, &Range{Position{30, 8}, Position{30, 9}}},   // the x shadowing it in the same block
+		{30, 17, &Range{Position{21, 8}, Position{21, 9}}},   // its value sees the x before
+		{22, 26, &Range{Position{16, 3}, Position{16, 6}}},   // add
+		{28, 33, &Range{Position{34, 3}, Position{34, 8}}},   // later
+		{27, 20, &Range{Position{0, 7}, Position{0, 12}}},    // Point in a struct literal
+		{28, 16, &Range{Position{6, 7}, Position{6, 10}}},    // the method sum
+		{7, 20, &Range{Position{1, 4}, Position{1, 5}}},      // the field x
+		{29, 27, &Range{Position{12, 4}, Position{12, 10}}},  // Shape::Circle
+		{17, 11, &Range{Position{16, 7}, Position{16, 8}}},   // the parameter a
+		{25, 9, nil}, // println is a builtin
+		{9, 0, nil},
+	}
+
+	c := newClient(t)
+	c.initialize()
+	c.open("file:///main.rs", program)
+	for i, test := range tests {
+		var location *Location
+		c.call("textDocument/definition", at("file:///main.rs", test.line, test.character), &location)
+		if test.definition == nil {
+			if location != nil {
+				t.Errorf("case %d: expected no definition, got %+v", i, location)
+			}
+			continue
+		}
+		if location == nil {
+			t.Errorf("case %d: expected %+v, got no definition", i, *test.definition)
+			continue
+		}
+		if location.URI != "file:///main.rs" || location.Range != *test.definition {
+			t.Errorf("case %d: expected %+v, got %+v", i, *test.definition, location.Range)
+		}
+	}
+	c.exit()
+}
+
+func TestDocumentSymbols(t *testing.T) {
+	type symbol struct {
+		name     string
+		kind     SymbolKind
+		start    int
+		end      int
+		children []string
+	}
+	expected := []symbol{
+		{"Point", KindStruct, 0, 3, []string{"x", "y", "sum"}},
+		{"Shape", KindEnum, 11, 14, []string{"Circle", "Empty"}},
+		{"add", KindFunction, 16, 18, nil},
+		{"main", KindFunction, 20, 32, nil},
+		{"later", KindFunction, 34, 36, nil},
+	}
+
+	c := newClient(t)
+	c.initialize()
+	c.open("file:///main.rs", program+"let mut count: Int = 0;\n")
+	var symbols []DocumentSymbol
+	c.call("textDocument/documentSymbol", DocumentSymbolParams{TextDocument: TextDocumentIdentifier{URI: "file:///main.rs"}}, &symbols)
+	expected = append(expected, symbol{"count", KindVariable, 37, 37, nil})
+
+	if len(symbols) != len(expected) {
+		t.Fatalf("expected %d symbols, got %+v", len(expected), symbols)
+	}
+	for i, want := range expected {
+		got := symbols[i]
+		children := []string{}
+		for _, child := range got.Children {
+			children = append(children, child.Name)
+		}
+		if want.children == nil {
+			want.children = []string{}
+		}
+		if got.Name != want.name || got.Kind != want.kind || got.Range.Start.Line != want.start ||
+			got.Range.End.Line != want.end || !reflect.DeepEqual(children, want.children) {
+			t.Errorf("case %d: expected %+v, got %+v", i, want, got)
+		}
+	}
+	c.exit()
+}
+
+func TestCompletion(t *testing.T) {
+	tests := []struct {
+		input           string
+		line, character int
+		contains        []string
+		excludes        []string
+	}{
+		{"fn main() {\n    let xs: List<Int> = [1];\n    xs.\n}", 2, 7, []string{"map", "filter", "len"}, []string{"println", "otherwise"}},
+		{"fn main() {\n    let s: String = \"a\";\n    s.ot\n}", 2, 8, []string{"otherwise"}, []string{"map"}},
+		{"fn main() {\n    \"a\".\n}", 1, 8, []string{"otherwise"}, []string{"map"}},
+		{"struct P { x: Int }\nimpl P { fn norm(self) Int { return 0; } }\nfn main() {\n    let p: P = P { x: 1 };\n    p.\n}", 4, 6, []string{"x", "norm"}, []string{"map", "println"}},
+		{"enum E { A, B(Int) }\nfn main() {\n    let e: E = E::\n}", 2, 18, []string{"A", "B"}, []string{"map", "println"}},
+		{"fn helper() {}\nfn main() {\n    let value: Int = 1;\n    \n    let after: Int = 2;\n}", 3, 4, []string{"println", "len", "args", "let", "while", "helper", "value", "main"}, []string{"after", "map"}},
+	}
+
+	for i, test := range tests {
+		c := newClient(t)
+		c.initialize()
+		c.open("file:///main.rs", test.input)
+		var list CompletionList
+		c.call("textDocument/completion", at("file:///main.rs", test.line, test.character), &list)
+
+		labels := map[string]bool{}
+		for _, item := range list.Items {
+			labels[item.Label] = true
+		}
+		for _, label := range test.contains {
+			if !labels[label] {
+				t.Errorf("case %d: expected %q in %+v", i, label, list.Items)
+			}
+		}
+		for _, label := range test.excludes {
+			if labels[label] {
+				t.Errorf("case %d: didn't expect %q", i, label)
+			}
+		}
+		c.exit()
+	}
+}
@@ -1,66 +1,267 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
-	"lang/eval"
-	"lang/lexer"
+	"io"
+	"lang/diagnostic"
+	"lang/mist"
 	"lang/object"
-	"lang/parser"
 	"os"
-	"strconv"
+	"path/filepath"
 	"strings"
 )
 
-func printError(code string, msg string) {
-	split := strings.SplitAfterN(msg, " ", 2)
-	pos := strings.Split(split[0], ",")
-	row, _ := strconv.Atoi(strings.Split(pos[0], "[")[1])
-	col, _ := strconv.Atoi(strings.Split(pos[1], "]")[0])
+// exit codes of every command
+const (
+	exitOK = 0
+	// the program failed while running, or a file couldn't be read
+	exitRuntime = 1
+	// the program doesn't parse or type check, or the command line is wrong
+	exitCompile = 2
+)
+
+const usage = `mist is the Mist programming language.
+
+usage:
+	mist run [flags] [file] [args...]   run a program, from stdin without a file or with -
+	mist repl [--stage=lexer|parser|tree|eval]
+	mist tokens [file]                  print the tokens of a program
+	mist ast [--format=text|json|dot] [file]
+	mist tree [file]                    draw the syntax tree of a program
+	mist check [files...]               parse and type check programs and their modules without running them
+	mist fmt [--check] [files...]       format programs
+	mist test [--run=regex] [--junit=file] [paths...]
+	                                    run the test blocks of programs, in the current directory without paths
+	mist lsp                            serve the language server protocol on stdin and stdout
+	mist dap                            serve the debug adapter protocol on stdin and stdout
+
+mist file.rs runs file.rs like mist run file.rs. Programs are run by calling their main function.
+The modules programs use are searched for next to them, then in --path and in MIST_PATH.
+`
 
-	println()
-	rowNumber := strconv.Itoa(row) + ": "
-	println(rowNumber, strings.Split(code, "\n")[row-1])
-	println(strings.Repeat(" ", col+len(rowNumber)) + ("^ ") + split[1])
+// the commands, each parses its arguments and returns the exit code
+var commands = map[string]func(args []string) int{
+	"run":    runCommand,
+	"repl":   replCommand,
+	"tokens": tokensCommand,
+	"ast":    astCommand,
+	"tree":   treeCommand,
+	"check":  checkCommand,
+	"fmt":    fmtCommand,
+	"test":   testCommand,
+	"lsp":    lspCommand,
+	"dap":    dapCommand,
 }
 
 func main() {
-	file := os.Args[1]
-	bytes, err := os.ReadFile(file)
+	args := os.Args[1:]
+	if len(args) == 0 {
+		// echo 'fn main() {...}' | mist
+		if info, err := os.Stdin.Stat(); err == nil && info.Mode()&os.ModeCharDevice == 0 {
+			os.Exit(runCommand(args))
+		}
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(exitCompile)
+	}
+	switch args[0] {
+	case "help", "-h", "-help", "--help":
+		fmt.Print(usage)
+		os.Exit(exitOK)
+	}
+
+	if command, ok := commands[args[0]]; ok {
+		os.Exit(command(args[1:]))
+	}
+	// a file, or the flags of run before it
+	os.Exit(runCommand(args))
+}
+
+// reads the program in file, stdin when it is empty or -. The name
+// returned is the one diagnostics show.
+func readSource(file string) (string, string, error) {
+	if file == "" || file == "-" {
+		source, err := io.ReadAll(os.Stdin)
+		return "<stdin>", string(source), err
+	}
+	source, err := os.ReadFile(file)
+	if err != nil {
+		return file, "", fmt.Errorf("file not found %s", file)
+	}
+	return file, string(source), nil
+}
+
+// the exit code of a program that failed with err
+func exitCode(err error) int {
+	var mistErr *mist.Error
+	if errors.As(err, &mistErr) && mistErr.Stage == "run" {
+		return exitRuntime
+	}
+	return exitCompile
+}
+
+// prints d to stderr, format is "human" or "json"
+func printDiagnostic(code string, d diagnostic.Diagnostic, format string) {
+	if format == "json" {
+		bytes, _ := json.Marshal(d)
+		fmt.Fprintln(os.Stderr, string(bytes))
+		return
+	}
+
+	fmt.Fprintln(os.Stderr)
+	diagnostic.Render(os.Stderr, d, code, useColor())
+}
+
+// colors are only for terminals, and not for those who asked for none
+func useColor() bool {
+	if os.Getenv("NO_COLOR") != "" {
+		return false
+	}
+	info, err := os.Stderr.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// frames printed before the rest of a backtrace is cut, deep recursion
+// has thousands of them
+const maxFrames = 16
+
+// the source d points into, code of the program in file or the one of a
+// module it uses
+func sourceOf(file, code string, d diagnostic.Diagnostic) string {
+	if d.File == "" || d.File == file {
+		return code
+	}
+	source, err := os.ReadFile(d.File)
 	if err != nil {
-		fmt.Printf("file not found %s\n", file)
+		return ""
+	}
+	return string(source)
+}
+
+// the loader of the modules programs use, searching the directories of
+// --path and then those of MIST_PATH after the one of the program
+func moduleLoader(path string) mist.Loader {
+	dirs := append(filepath.SplitList(path), filepath.SplitList(os.Getenv("MIST_PATH"))...)
+	return mist.DirLoader{Path: dirs}
+}
+
+// prints the calls an error escaped from like rust does, innermost first
+func printBacktrace(file, code string, stack []object.Frame) {
+	if len(stack) == 0 {
 		return
 	}
+	// the call of main appended to the program has no place in the file
+	appended := strings.Count(code, "\n") + 1
 
-	code := string(bytes) + "\nmain();"
-	l := lexer.NewLexer(string(code))
-	// emit tokens, need to comment everyting else
+	println("stack backtrace:")
+	for i, frame := range stack {
+		if i == maxFrames {
+			println(fmt.Sprintf("      ... %d more frames", len(stack)-i))
+			break
+		}
+		println(fmt.Sprintf("%4d: %s", i, frame.Function))
+		if frame.Row != appended || frame.File != file {
+			println(fmt.Sprintf("          at %s:%d:%d", frame.File, frame.Row, frame.Column))
+		}
+	}
+}
+
+// the backtrace as notes of a diagnostic, for tools reading json
+func stackNotes(file, code string, stack []object.Frame) []string {
+	appended := strings.Count(code, "\n") + 1
 
-	// for l.NextToken().Type != token.EOF {
-	// 	fmt.Printf("%#v\n", l.NextToken())
-	// }
-	p := parser.NewParser(l)
-	program := p.Parse()
-	if len(p.Errors()) != 0 {
-		for _, err := range p.Errors() {
-			printError(code, err)
-			return
+	notes := []string{}
+	for _, frame := range stack {
+		if frame.Row == appended && frame.File == file {
+			notes = append(notes, "in "+frame.Function)
+			continue
 		}
+		notes = append(notes, fmt.Sprintf("in %s called at %s:%d:%d", frame.Function, frame.File, frame.Row, frame.Column))
 	}
+	return notes
+}
 
-	// uncomment to see AST, redirect to file if tree is too wide
-	// parser.DrawTree(program)
+func runCommand(args []string) int {
+	flags := flag.NewFlagSet("run", flag.ExitOnError)
+	engine := flags.String("engine", "tree", "backend used to run the program: vm or tree")
+	timeout := flags.Duration("timeout", 0, "stop the program after this long, 0 for no limit")
+	maxSteps := flags.Int("max-steps", 0, "stop the program after this many function calls and loop iterations, 0 for no limit")
+	errorFormat := flags.String("error-format", "human", "how errors and warnings are printed: human or json")
+	maxErrors := flags.Int("max-errors", 20, "stop printing errors after this many, 0 for no limit")
+	path := flags.String("path", "", "directories searched for modules, separated like PATH, before those of MIST_PATH")
+	flags.Parse(args)
+
+	if *errorFormat != "human" && *errorFormat != "json" {
+		fmt.Fprintf(os.Stderr, "unknown error format %s, expected human or json\n", *errorFormat)
+		return exitCompile
+	}
+
+	file, source, err := readSource(flags.Arg(0))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitRuntime
+	}
 
 	// prevents output if an error occurs, since this is currently an interpreter
 	// not a compiler
-	f := eval.SetupStdout()
-	defer f.Close()
+	var stdout strings.Builder
+	interpreter := mist.New(mist.Options{
+		Stdout:   &stdout,
+		Stderr:   os.Stderr,
+		Engine:   *engine,
+		MaxSteps: *maxSteps,
+		File:     file,
+		Loader:   moduleLoader(*path),
+	})
 
-	evaluated := eval.Eval(program, object.NewScope())
-	if evaluated.Type() == object.ERROR_OBJ {
-		printError(code, evaluated.Inspect())
-		return
+	// the arguments after the file, as the global args
+	programArgs := []string{}
+	if flags.NArg() > 1 {
+		programArgs = flags.Args()[1:]
+	}
+	interpreter.SetArgs(programArgs)
+
+	ctx := context.Background()
+	if *timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, *timeout)
+		defer cancel()
+	}
+
+	code := source + "\nmain();"
+	evaluated, err := interpreter.Run(ctx, code)
+	for _, warning := range interpreter.WarningDiagnostics() {
+		printDiagnostic(code, warning, *errorFormat)
+	}
+
+	if mistErr, ok := err.(*mist.Error); ok {
+		diagnostics := mistErr.Diagnostics
+		if *maxErrors > 0 && len(diagnostics) > *maxErrors {
+			diagnostics = diagnostics[:*maxErrors]
+		}
+		for _, d := range diagnostics {
+			if *errorFormat == "json" {
+				d.Notes = append(d.Notes, stackNotes(file, code, mistErr.Stack)...)
+			}
+			printDiagnostic(sourceOf(file, code, d), d, *errorFormat)
+		}
+		if *errorFormat == "human" {
+			printBacktrace(file, code, mistErr.Stack)
+			if hidden := len(mistErr.Diagnostics) - len(diagnostics); hidden > 0 {
+				fmt.Fprintf(os.Stderr, "\n... %d more errors, raise --max-errors to see them\n", hidden)
+			}
+		}
+		return exitCode(err)
 	}
-	stdout, _ := os.ReadFile(f.Name())
-	print(string(stdout))
-	print(evaluated.Inspect())
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitCode(err)
+	}
+
+	fmt.Print(stdout.String())
+	fmt.Print(evaluated.Inspect())
+	return exitOK
 }
@@ -0,0 +1,233 @@
+package mist
+
+import (
+	"fmt"
+	"lang/ast"
+	"lang/eval"
+	"lang/object"
+	"math"
+	"reflect"
+)
+
+var (
+	objectType = reflect.TypeOf((*object.Object)(nil)).Elem()
+	errorType  = reflect.TypeOf((*error)(nil)).Elem()
+)
+
+// FromGo converts a Go value to a Mist value. Booleans, numbers and
+// strings become Bool, Int, Float and String, slices and arrays become
+// Lists, maps become Maps and nil becomes null. Mist values are returned
+// as they are.
+func FromGo(value any) (object.Object, error) {
+	if value == nil {
+		return eval.NULL, nil
+	}
+	if obj, ok := value.(object.Object); ok {
+		return obj, nil
+	}
+	return fromValue(reflect.ValueOf(value))
+}
+
+func fromValue(v reflect.Value) (object.Object, error) {
+	switch v.Kind() {
+	case reflect.Bool:
+		if v.Bool() {
+			return eval.TRUE, nil
+		}
+		return eval.FALSE, nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return &object.Integer{Value: v.Int()}, nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		if v.Uint() > math.MaxInt64 {
+			return nil, fmt.Errorf("%d overflows Int", v.Uint())
+		}
+		return &object.Integer{Value: int64(v.Uint())}, nil
+	case reflect.Float32, reflect.Float64:
+		return &object.Float{Value: v.Float()}, nil
+	case reflect.String:
+		return eval.NewString(v.String()), nil
+	case reflect.Slice, reflect.Array:
+		elements := []object.Object{}
+		for i := 0; i < v.Len(); i++ {
+			e, err := fromValue(v.Index(i))
+			if err != nil {
+				return nil, err
+			}
+			elements = append(elements, e)
+		}
+		return eval.NewList(elements), nil
+	case reflect.Map:
+		pairs := make(map[object.MapKey]object.MapPair)
+		iter := v.MapRange()
+		for iter.Next() {
+			key, err := fromValue(iter.Key())
+			if err != nil {
+				return nil, err
+			}
+			mapKey, ok := key.(object.Hashable)
+			if !ok {
+				return nil, fmt.Errorf("unusable as map key: %s", key.Type())
+			}
+			value, err := fromValue(iter.Value())
+			if err != nil {
+				return nil, err
+			}
+			pairs[mapKey.MapKey()] = object.MapPair{Key: key, Value: value}
+		}
+		return eval.NewMap(pairs), nil
+	case reflect.Interface, reflect.Pointer:
+		if v.IsNil() {
+			return eval.NULL, nil
+		}
+		if obj, ok := v.Interface().(object.Object); ok {
+			return obj, nil
+		}
+		return fromValue(v.Elem())
+	default:
+		return nil, fmt.Errorf("cannot convert Go value of type %s to a Mist value", v.Type())
+	}
+}
+
+// ToGo converts a Mist value to a Go value, the inverse of FromGo. Ints
+// become int64, Floats float64, Lists []any and Maps map[any]any.
+func ToGo(value object.Object) (any, error) {
+	switch value := value.(type) {
+	case *object.Integer:
+		return value.Value, nil
+	case *object.Float:
+		return value.Value, nil
+	case *object.String:
+		return value.Value, nil
+	case *object.Boolean:
+		return value.Value, nil
+	case *object.Null:
+		return nil, nil
+	case *object.List:
+		elements := []any{}
+		for _, e := range value.Elements {
+			element, err := ToGo(e)
+			if err != nil {
+				return nil, err
+			}
+			elements = append(elements, element)
+		}
+		return elements, nil
+	case *object.Map:
+		pairs := map[any]any{}
+		for _, pair := range value.Pairs {
+			key, err := ToGo(pair.Key)
+			if err != nil {
+				return nil, err
+			}
+			val, err := ToGo(pair.Value)
+			if err != nil {
+				return nil, err
+			}
+			pairs[key] = val
+		}
+		return pairs, nil
+	default:
+		return nil, fmt.Errorf("cannot convert %s to a Go value", value.Type())
+	}
+}
+
+// toType converts a Mist value to a Go value of type t, the value is
+// already known to match mistType(t)
+func toType(value object.Object, t reflect.Type) (reflect.Value, error) {
+	if t == objectType {
+		return reflect.ValueOf(value), nil
+	}
+
+	v := reflect.New(t).Elem()
+	switch t.Kind() {
+	case reflect.Interface:
+		converted, err := ToGo(value)
+		if err != nil || converted == nil {
+			return v, err
+		}
+		v.Set(reflect.ValueOf(converted))
+	case reflect.Bool:
+		v.SetBool(value.(*object.Boolean).Value)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n := value.(*object.Integer).Value
+		if v.OverflowInt(n) {
+			return v, fmt.Errorf("%d overflows %s", n, t)
+		}
+		v.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		n := value.(*object.Integer).Value
+		if n < 0 || v.OverflowUint(uint64(n)) {
+			return v, fmt.Errorf("%d overflows %s", n, t)
+		}
+		v.SetUint(uint64(n))
+	case reflect.Float32, reflect.Float64:
+		v.SetFloat(value.(*object.Float).Value)
+	case reflect.String:
+		v.SetString(value.(*object.String).Value)
+	case reflect.Slice:
+		elements := value.(*object.List).Elements
+		v.Set(reflect.MakeSlice(t, len(elements), len(elements)))
+		for i, e := range elements {
+			element, err := toType(e, t.Elem())
+			if err != nil {
+				return v, err
+			}
+			v.Index(i).Set(element)
+		}
+	case reflect.Map:
+		v.Set(reflect.MakeMap(t))
+		for _, pair := range value.(*object.Map).Pairs {
+			key, err := toType(pair.Key, t.Key())
+			if err != nil {
+				return v, err
+			}
+			val, err := toType(pair.Value, t.Elem())
+			if err != nil {
+				return v, err
+			}
+			v.SetMapIndex(key, val)
+		}
+	}
+	return v, nil
+}
+
+// mistType is the Mist type of the values a Go type holds, nil for any
+// value. ok is false for Go types Mist can't convert to.
+func mistType(t reflect.Type) (*ast.TypeNode, bool) {
+	if t == objectType {
+		return nil, true
+	}
+
+	switch t.Kind() {
+	case reflect.Interface:
+		return nil, t.NumMethod() == 0
+	case reflect.Bool:
+		return ast.NewType("Bool"), true
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return ast.NewType("Int"), true
+	case reflect.Float32, reflect.Float64:
+		return ast.NewType("Float"), true
+	case reflect.String:
+		return ast.NewType("String"), true
+	case reflect.Slice:
+		elem, ok := mistType(t.Elem())
+		if !ok || elem == nil {
+			return ast.NewType("List"), ok
+		}
+		return ast.NewType("List", elem), true
+	case reflect.Map:
+		key, ok := mistType(t.Key())
+		if !ok || key == nil || key.Name == "Float" {
+			// Float can't be a map key
+			return nil, false
+		}
+		val, ok := mistType(t.Elem())
+		if !ok || val == nil {
+			return ast.NewType("Map"), ok
+		}
+		return ast.NewType("Map", key, val), true
+	default:
+		return nil, false
+	}
+}
@@ -0,0 +1,112 @@
+package mist
+
+import (
+	"fmt"
+	"lang/ast"
+	"lang/eval"
+	"lang/object"
+	"reflect"
+)
+
+// Register defines the global function name that calls fn, an ordinary
+// Go function such as func(int64, string) ([]float64, error). Arguments
+// and results are converted like ToGo and FromGo do, and a non nil error
+// returned last fails the program at the call. Calls are checked
+// against the signature of fn, unless it is variadic.
+func (in *Interpreter) Register(name string, fn any) error {
+	host, t, err := hostFunction(name, fn)
+	if err != nil {
+		return err
+	}
+	in.define(name, host, t)
+	return nil
+}
+
+// wraps fn in a builtin, along with its Mist signature
+func hostFunction(name string, fn any) (*object.BuiltinFunc, *ast.TypeNode, error) {
+	v := reflect.ValueOf(fn)
+	if v.Kind() != reflect.Func || v.IsNil() {
+		return nil, nil, fmt.Errorf("cannot register %s: expected a function, got %T", name, fn)
+	}
+	t := v.Type()
+
+	types := []*ast.TypeNode{}
+	for i := 0; i < t.NumIn(); i++ {
+		in := t.In(i)
+		if t.IsVariadic() && i == t.NumIn()-1 {
+			in = in.Elem()
+		}
+		typ, ok := mistType(in)
+		if !ok {
+			return nil, nil, fmt.Errorf("cannot register %s: unsupported parameter type %s", name, in)
+		}
+		types = append(types, typ)
+	}
+
+	results := t.NumOut()
+	failable := results > 0 && t.Out(results-1) == errorType
+	if failable {
+		results--
+	}
+	if results > 1 {
+		return nil, nil, fmt.Errorf("cannot register %s: expected at most one result besides an error, got %d", name, results)
+	}
+	ret := ast.NewType("Void")
+	if results == 1 {
+		typ, ok := mistType(t.Out(0))
+		if !ok {
+			return nil, nil, fmt.Errorf("cannot register %s: unsupported result type %s", name, t.Out(0))
+		}
+		ret = typ
+	}
+
+	call := func(budget *object.Budget, row *int, column *int, args ...object.Object) object.Object {
+		if len(args) != len(types) && !(t.IsVariadic() && len(args) >= len(types)-1) {
+			return eval.NewError(*row, *column, "function %s expected %d arguments, got %d",
+				name, len(types), len(args))
+		}
+
+		values := []reflect.Value{}
+		for i, arg := range args {
+			var typ *ast.TypeNode
+			var goType reflect.Type
+			if i < len(types)-1 || !t.IsVariadic() {
+				typ, goType = types[i], t.In(i)
+			} else {
+				typ, goType = types[len(types)-1], t.In(len(types)-1).Elem()
+			}
+
+			if err := eval.BuiltinArgumentTypeError(name, arg, i, typ, row, column); err != nil {
+				return err
+			}
+			value, err := toType(arg, goType)
+			if err != nil {
+				return eval.NewError(*row, *column, "%s: argument %d: %s", name, i+1, err)
+			}
+			values = append(values, value)
+		}
+
+		out := v.Call(values)
+		if failable {
+			if err, _ := out[len(out)-1].Interface().(error); err != nil {
+				return eval.NewError(*row, *column, "%s: %s", name, err)
+			}
+		}
+		if results == 0 {
+			return eval.NULL
+		}
+
+		result, err := fromValue(out[0])
+		if err != nil {
+			return eval.NewError(*row, *column, "result of %s: %s", name, err)
+		}
+		return result
+	}
+
+	// Fn types can't say that the last parameter repeats
+	signature := ast.NewType("Func")
+	if !t.IsVariadic() {
+		signature = ast.NewFunctionType(types, ret)
+	}
+	return &object.BuiltinFunc{Fn: call}, signature, nil
+}
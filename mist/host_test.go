@@ -0,0 +1,207 @@
+package mist
+
+import (
+	"context"
+	"errors"
+	"lang/object"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func newHostInterpreter(t *testing.T, engine string, checked bool) *Interpreter {
+	in := New(Options{Engine: engine, NoCheck: !checked})
+	functions := map[string]any{
+		"parse": strconv.ParseInt,
+		"scale": func(n int64, unit string) ([]float64, error) {
+			if unit != "m" && unit != "cm" {
+				return nil, errors.New("unknown unit " + unit)
+			}
+			factor := 1.0
+			if unit == "cm" {
+				factor = 100
+			}
+			return []float64{float64(n) * factor, float64(n) * factor * 2}, nil
+		},
+		"total": func(prices map[string]float64) float64 {
+			sum := 0.0
+			for _, p := range prices {
+				sum += p
+			}
+			return sum
+		},
+		"join":  func(sep string, parts ...string) string { return strings.Join(parts, sep) },
+		"small": func(n int8) int8 { return n },
+		"kind":  func(value any) string { return reflect.TypeOf(value).String() },
+		"noop":  func() {},
+		"boom":  func() int64 { panic("boom") },
+	}
+	for name, fn := range functions {
+		if err := in.Register(name, fn); err != nil {
+			t.Fatalf("unexpected error %s", err)
+		}
+	}
+	return in
+}
+
+func TestHostFunctions(t *testing.T) {
+	tests := []struct {
+		code     string
+		expected string
+	}{
+		{`parse("42", 10, 64) + 1`, "43"},
+		{`scale(3, "cm")`, "[300.000000, 600.000000]"},
+		{`scale(2, "m")[1]`, "4.000000"},
+		{`total({"a": 1.5, "b": 2.0})`, "3.500000"},
+		{`join(", ", "a", "b", "c")`, "a, b, c"},
+		{`join("-")`, ""},
+		{`[kind(1), kind([1]), kind({"a": true})]`, "[int64, []interface {}, map[interface {}]interface {}]"},
+		{`noop()`, ""},
+		{`catch(fn() List<Float> { scale(1, "km") })`, "Err([1,31] scale: unknown unit km)"},
+	}
+
+	for _, engine := range engines {
+		for i, test := range tests {
+			result, err := newHostInterpreter(t, engine, true).Run(context.Background(), test.code)
+			if err != nil {
+				t.Errorf("%s case %d: unexpected error %s", engine, i, err)
+				continue
+			}
+			if result.Inspect() != test.expected {
+				t.Errorf("%s case %d: expected %s, got %s", engine, i, test.expected, result.Inspect())
+			}
+		}
+	}
+}
+
+func TestHostFunctionErrors(t *testing.T) {
+	tests := []struct {
+		code     string
+		checked  bool
+		expected string
+	}{
+		{`scale(1, "km")`, true, "[1,6] scale: unknown unit km"},
+		{`parse("x", 10, 64)`, true, `[1,6] parse: strconv.ParseInt: parsing "x": invalid syntax`},
+		{`scale(1)`, false, "[1,6] function scale expected 2 arguments, got 1"},
+		{`scale("1", "m")`, false, "[1,6] scale expected argument 1 to be of type INTEGER, got=STRING"},
+		{`total({"a": 1})`, false, `[1,6] total expected value at key "a" of argument 1 to be of type FLOAT, got=INTEGER`},
+		{`join(", ", "a", 1)`, false, "[1,5] join expected argument 3 to be of type STRING, got=INTEGER"},
+		{`small(300)`, false, "[1,6] small: argument 1: 300 overflows int8"},
+		{`kind(fn() {})`, false, "[1,5] kind: argument 1: cannot convert FUNCTION to a Go value"},
+		// the checker knows the signatures
+		{`scale(1)`, true, "[1,6] function scale expected 2 arguments, got 1"},
+		{`let xs: List<Int> = scale(1, "m");`, true, "[1,1] type mismatch"},
+		{`scale("1", "m")`, true, "[1,6] scale expected argument 1 to be of type INTEGER, got=STRING"},
+		{`total({"a": 1})`, true, "[1,6] total expected argument 1 to be of type Map<String, Float>, got=Map<String, Int>"},
+		// a panicking Go function fails the run, not the host
+		{`boom()`, true, "[0,0] panic: boom"},
+	}
+
+	for _, engine := range engines {
+		for i, test := range tests {
+			_, err := newHostInterpreter(t, engine, test.checked).Run(context.Background(), test.code)
+			if err == nil || !strings.HasPrefix(err.Error(), test.expected) {
+				t.Errorf("%s case %d: expected %s, got %v", engine, i, test.expected, err)
+			}
+		}
+	}
+}
+
+func TestCheckHostCalls(t *testing.T) {
+	for _, engine := range engines {
+		in := newHostInterpreter(t, engine, true)
+		err := in.Check(`scale("a", "m");`)
+		var mistErr *Error
+		if !errors.As(err, &mistErr) || mistErr.Stage != "check" {
+			t.Errorf("%s: expected a check error, got %v", engine, err)
+		}
+		if err := in.Check(`scale(1, "m"); join("-", "a", 1);`); err != nil {
+			t.Errorf("%s: unexpected error %s", engine, err)
+		}
+	}
+}
+
+func TestCallPanics(t *testing.T) {
+	for _, engine := range engines {
+		in := newHostInterpreter(t, engine, true)
+		if _, err := in.Run(context.Background(), "fn f() Int { boom() }"); err != nil {
+			t.Fatalf("%s: unexpected error %s", engine, err)
+		}
+
+		_, err := in.Call(context.Background(), "f")
+		var mistErr *Error
+		if !errors.As(err, &mistErr) || mistErr.Stage != "run" || mistErr.Messages[0] != "[0,0] panic: boom" {
+			t.Errorf("%s: expected a run error for the panic, got %v", engine, err)
+		}
+	}
+}
+
+func TestRegisterUnsupported(t *testing.T) {
+	tests := []struct {
+		fn       any
+		expected string
+	}{
+		{42, "cannot register f: expected a function, got int"},
+		{func(c chan int) {}, "cannot register f: unsupported parameter type chan int"},
+		{func() (int, string) { return 0, "" }, "cannot register f: expected at most one result besides an error, got 2"},
+		{func() *testing.T { return nil }, "cannot register f: unsupported result type *testing.T"},
+		{func(map[float64]int) {}, "cannot register f: unsupported parameter type map[float64]int"},
+	}
+
+	for i, test := range tests {
+		err := New(Options{}).Register("f", test.fn)
+		if err == nil || err.Error() != test.expected {
+			t.Errorf("case %d: expected %s, got %v", i, test.expected, err)
+		}
+	}
+}
+
+func TestConversions(t *testing.T) {
+	tests := []struct {
+		value    any
+		expected string
+	}{
+		{nil, ""},
+		{true, "true"},
+		{uint8(7), "7"},
+		{float32(0.5), "0.500000"},
+		{"hi", "hi"},
+		{[]int{1, 2}, "[1, 2]"},
+		{[2]string{"a", "b"}, "[a, b]"},
+		{map[string][]bool{"a": {true}}, "{a: [true]}"},
+		{&object.Integer{Value: 3}, "3"},
+	}
+
+	for i, test := range tests {
+		value, err := FromGo(test.value)
+		if err != nil {
+			t.Errorf("case %d: unexpected error %s", i, err)
+			continue
+		}
+		if value.Inspect() != test.expected {
+			t.Errorf("case %d: expected %s, got %s", i, test.expected, value.Inspect())
+		}
+
+		// round trip through ToGo, Mist values come back as they are
+		if _, ok := test.value.(object.Object); ok {
+			continue
+		}
+		back, err := ToGo(value)
+		if err != nil {
+			t.Errorf("case %d: unexpected error %s", i, err)
+			continue
+		}
+		again, _ := FromGo(back)
+		if again.Inspect() != test.expected {
+			t.Errorf("case %d: expected %s after a round trip, got %s", i, test.expected, again.Inspect())
+		}
+	}
+
+	if _, err := FromGo(struct{}{}); err == nil || err.Error() != "cannot convert Go value of type struct {} to a Mist value" {
+		t.Errorf("expected struct {} to be rejected, got %v", err)
+	}
+	if _, err := FromGo(uint64(1 << 63)); err == nil || err.Error() != "9223372036854775808 overflows Int" {
+		t.Errorf("expected 1 << 63 to overflow, got %v", err)
+	}
+}
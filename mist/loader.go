@@ -0,0 +1,98 @@
+package mist
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+)
+
+// Loader finds the modules programs use and import. Hosts that serve
+// modules from memory or an fs.FS implement it, or use FSLoader and
+// MemoryLoader.
+type Loader interface {
+	// Load returns the file and the source of the module name, a slash
+	// separated file name such as "utils/math.mist", as used by the
+	// program in the file from. Names are resolved relative to the
+	// directory of from first and then along a search path. The file
+	// returned identifies the module, a module is evaluated once however
+	// many programs use it. Modules that aren't found fail with an error
+	// wrapping fs.ErrNotExist.
+	Load(from, name string) (file, source string, err error)
+}
+
+// DirLoader loads modules from the file system of the operating system,
+// the default Loader
+type DirLoader struct {
+	// directories searched after the one of the program, in order
+	Path []string
+}
+
+func (l DirLoader) Load(from, name string) (string, string, error) {
+	name = filepath.FromSlash(name)
+	if filepath.IsAbs(name) {
+		source, err := os.ReadFile(name)
+		return filepath.Clean(name), string(source), err
+	}
+
+	dirs := append([]string{filepath.Dir(from)}, l.Path...)
+	for _, dir := range dirs {
+		file := filepath.Join(dir, name)
+		source, err := os.ReadFile(file)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		return file, string(source), err
+	}
+	return "", "", notFound(name)
+}
+
+// FSLoader loads modules from an fs.FS, such as an embed.FS, whose file
+// names are slash separated and relative to its root
+type FSLoader struct {
+	FS fs.FS
+
+	// directories of FS searched after the one of the program, in order
+	Path []string
+}
+
+func (l FSLoader) Load(from, name string) (string, string, error) {
+	for _, file := range candidates(from, name, l.Path) {
+		source, err := fs.ReadFile(l.FS, file)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		return file, string(source), err
+	}
+	return "", "", notFound(name)
+}
+
+// MemoryLoader serves the sources of modules by their slash separated
+// file names, like FSLoader with an empty search path
+type MemoryLoader map[string]string
+
+func (l MemoryLoader) Load(from, name string) (string, string, error) {
+	for _, file := range candidates(from, name, nil) {
+		if source, ok := l[file]; ok {
+			return file, source, nil
+		}
+	}
+	return "", "", notFound(name)
+}
+
+// the files name may be in, in the order they are searched
+func candidates(from, name string, dirs []string) []string {
+	files := []string{}
+	for _, dir := range append([]string{path.Dir(filepath.ToSlash(from))}, dirs...) {
+		file := path.Join(dir, name)
+		if fs.ValidPath(file) {
+			files = append(files, file)
+		}
+	}
+	return files
+}
+
+func notFound(name string) error {
+	return &fs.PathError{Op: "load", Path: name, Err: fs.ErrNotExist}
+}
@@ -0,0 +1,394 @@
+// Package mist embeds the Mist interpreter in Go programs. Every
+// Interpreter owns its builtins, output and globals, so interpreters
+// running in different goroutines don't share any state.
+package mist
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"lang/ast"
+	"lang/checker"
+	"lang/compiler"
+	"lang/diagnostic"
+	"lang/eval"
+	"lang/lexer"
+	"lang/object"
+	"lang/parser"
+	"lang/vm"
+	"path/filepath"
+	"strings"
+)
+
+// Options configure an Interpreter, the zero value runs programs on
+// the tree walker and discards their output
+type Options struct {
+	// print and println write to Stdout, eprint and eprintln to Stderr
+	Stdout io.Writer
+	Stderr io.Writer
+
+	// backend that runs the programs, "tree" (the default) or "vm"
+	Engine string
+
+	// runs programs without checking their types first
+	NoCheck bool
+
+	// name of the file the programs come from, for diagnostics and
+	// backtraces. The modules programs use are looked up from its
+	// directory.
+	File string
+
+	// finds the modules programs use and import, a DirLoader without a
+	// search path when nil
+	Loader Loader
+
+	// limits of every Run and Call, exceeding one fails the program where
+	// it was stopped. Zero means no limit, except for MaxDepth which
+	// defaults to DefaultMaxDepth since deeper recursion overflows the Go
+	// stack.
+	MaxSteps int // function calls, loop iterations and the ones of builtins
+	MaxDepth int // nested function calls
+	MaxSize  int // elements of a list or map, bytes of a string
+
+	// watches the programs run on the tree walker, statement by statement,
+	// the vm ignores it
+	Hook object.Hook
+}
+
+// DefaultMaxDepth is the call depth of programs that don't set MaxDepth
+const DefaultMaxDepth = 100000
+
+// Interpreter runs Mist programs one after another against the same
+// globals, like the lines of a repl. It is not safe for concurrent use,
+// create one per goroutine instead.
+type Interpreter struct {
+	opts     Options
+	builtins map[string]object.Object
+	checker  *checker.Checker
+	warnings []diagnostic.Diagnostic
+	budget   *object.Budget
+
+	// globals of the tree walker
+	scope *object.Scope
+
+	// globals of the vm, the compiler keeps their slots between programs
+	compiler *compiler.Compiler
+	globals  []object.Object
+
+	modules *modules
+	// globals defined by the host, which modules see as well
+	host []global
+}
+
+type global struct {
+	name  string
+	value object.Object
+	typ   *ast.TypeNode
+}
+
+// Error is returned for programs that fail to parse, type check or run,
+// each message starts with the "[row,col]" it points at
+type Error struct {
+	Stage    string // "parse", "load", "check" or "run"
+	Messages []string
+	// the same errors with their spans, codes and suggested fixes
+	Diagnostics []diagnostic.Diagnostic
+	// the function calls a runtime error escaped from, innermost first
+	Stack []object.Frame
+}
+
+func (e *Error) Error() string {
+	return strings.Join(e.Messages, "\n")
+}
+
+func New(opts Options) *Interpreter {
+	if opts.Stdout == nil {
+		opts.Stdout = io.Discard
+	}
+	if opts.Stderr == nil {
+		opts.Stderr = io.Discard
+	}
+	if opts.Engine == "" {
+		opts.Engine = "tree"
+	}
+	if opts.MaxDepth == 0 {
+		opts.MaxDepth = DefaultMaxDepth
+	}
+	if opts.Loader == nil {
+		opts.Loader = DirLoader{}
+	}
+
+	builtins := eval.NewBuiltins(opts.Stdout, opts.Stderr)
+	budget := &object.Budget{MaxSteps: opts.MaxSteps, MaxDepth: opts.MaxDepth, MaxSize: opts.MaxSize}
+	scope := object.NewGlobalScope(builtins)
+	scope.SetBudget(budget)
+	scope.SetHook(opts.Hook)
+	scope.SetFile(opts.File)
+	c := compiler.NewCompiler()
+	c.SetFile(opts.File)
+
+	// the file of the interpreter is where cycles of modules start
+	loading := []string{}
+	if opts.File != "" {
+		loading = append(loading, filepath.Clean(opts.File))
+	}
+
+	return &Interpreter{
+		opts:     opts,
+		builtins: builtins,
+		checker:  checker.NewChecker(),
+		budget:   budget,
+		scope:    scope,
+		compiler: c,
+		modules:  &modules{loaded: make(map[string]*module), loading: loading},
+	}
+}
+
+// every Run and Call starts with the whole budget
+func (in *Interpreter) resetBudget(ctx context.Context) {
+	in.budget.Context = ctx
+	in.budget.Steps = 0
+	in.budget.Depth = 0
+}
+
+// Run parses, checks and runs source, returning the value of its last
+// statement. The globals it defines are kept for the next Run. The
+// program stops with an error once ctx is done.
+func (in *Interpreter) Run(ctx context.Context, source string) (result object.Object, err error) {
+	defer in.recoverPanic(&result, &err)
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	program, err := in.parse(source)
+	if err != nil {
+		return nil, err
+	}
+	if err := in.loadModules(ctx, program, true); err != nil {
+		return nil, err
+	}
+	if err := in.check(program); err != nil {
+		return nil, err
+	}
+
+	in.resetBudget(ctx)
+	result, err = in.eval(program)
+	if err != nil {
+		return nil, err
+	}
+	if runErr, ok := result.(*object.Error); ok {
+		return nil, in.runError(runErr)
+	}
+	return result, nil
+}
+
+// Check parses and type checks source without running it, along with
+// the modules it uses. The errors are the ones Run would fail with
+// before running anything, and the warnings are kept for
+// WarningDiagnostics.
+func (in *Interpreter) Check(source string) error {
+	program, err := in.parse(source)
+	if err != nil {
+		return err
+	}
+	if err := in.loadModules(context.Background(), program, false); err != nil {
+		return err
+	}
+	return in.check(program)
+}
+
+// Type checks expression against the globals of the programs run so
+// far and returns its type without running it, nil when the checker
+// can't tell it statically
+func (in *Interpreter) Type(expression string) (*ast.TypeNode, error) {
+	program, err := in.parse(expression)
+	if err != nil {
+		return nil, err
+	}
+	var statement *ast.ExpressionStatement
+	if len(program.Statements) == 1 {
+		statement, _ = program.Statements[0].(*ast.ExpressionStatement)
+	}
+	if statement == nil {
+		return nil, fmt.Errorf("%q is not an expression", strings.TrimSpace(expression))
+	}
+	if err := in.check(program); err != nil {
+		return nil, err
+	}
+	return checker.TypeOf(statement.Expression), nil
+}
+
+// Globals are the names of the globals defined by the programs run so
+// far and by Set, sorted
+func (in *Interpreter) Globals() []string {
+	if in.opts.Engine == "vm" {
+		return in.compiler.GlobalNames()
+	}
+	return in.scope.Names()
+}
+
+func (in *Interpreter) parse(source string) (*ast.Program, error) {
+	p := parser.NewParser(lexer.NewLexer(source))
+	program := p.Parse()
+	if len(p.Diagnostics()) != 0 {
+		return nil, in.newError("parse", p.Diagnostics())
+	}
+	return program, nil
+}
+
+func (in *Interpreter) check(program *ast.Program) error {
+	in.warnings = []diagnostic.Diagnostic{}
+	if !in.opts.NoCheck {
+		in.checker.Check(program)
+		if len(in.checker.Diagnostics()) != 0 {
+			return in.newError("check", in.checker.Diagnostics())
+		}
+		in.warnings = in.inFile(in.checker.WarningDiagnostics())
+	}
+	return nil
+}
+
+func (in *Interpreter) eval(program *ast.Program) (object.Object, error) {
+	switch in.opts.Engine {
+	case "tree":
+		return eval.Eval(program, in.scope), nil
+	case "vm":
+		if err := in.compiler.Compile(program); err != nil {
+			return nil, err
+		}
+		machine := vm.NewWithGlobals(in.compiler.Bytecode(), in.builtins, in.globals)
+		machine.SetBudget(in.budget)
+		result := machine.Run()
+		in.globals = machine.Globals()
+		return result, nil
+	default:
+		return nil, fmt.Errorf("unknown engine %s, expected vm or tree", in.opts.Engine)
+	}
+}
+
+func (in *Interpreter) newError(stage string, diagnostics []diagnostic.Diagnostic) *Error {
+	return &Error{Stage: stage, Messages: diagnostic.Strings(diagnostics), Diagnostics: in.inFile(diagnostics)}
+}
+
+func (in *Interpreter) runError(err *object.Error) *Error {
+	stack := []object.Frame{}
+	for _, frame := range err.Stack {
+		if frame.File == "" {
+			frame.File = in.opts.File
+		}
+		stack = append(stack, frame)
+	}
+
+	e := in.newError("run", []diagnostic.Diagnostic{eval.Diagnostic(err)})
+	// errors raised in the functions of a module point into its file
+	if err.File != "" {
+		e.Diagnostics[0].File = err.File
+	}
+	e.Messages = []string{err.Inspect()}
+	e.Stack = stack
+	return e
+}
+
+// copies of diagnostics that point into the file of the interpreter
+func (in *Interpreter) inFile(diagnostics []diagnostic.Diagnostic) []diagnostic.Diagnostic {
+	copies := []diagnostic.Diagnostic{}
+	for _, d := range diagnostics {
+		d.File = in.opts.File
+		copies = append(copies, d)
+	}
+	return copies
+}
+
+// Warnings of the last Run, problems that don't stop a program such as
+// a match that misses variants
+func (in *Interpreter) Warnings() []string {
+	return diagnostic.Strings(in.warnings)
+}
+
+// WarningDiagnostics are the Warnings of the last Run with their spans
+func (in *Interpreter) WarningDiagnostics() []diagnostic.Diagnostic {
+	return in.warnings
+}
+
+// Call calls the global function name with args, under the same limits
+// as Run
+func (in *Interpreter) Call(ctx context.Context, name string, args ...object.Object) (result object.Object, err error) {
+	defer in.recoverPanic(&result, &err)
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	fn, ok := in.Get(name)
+	if !ok {
+		return nil, in.newError("run", []diagnostic.Diagnostic{
+			diagnostic.New(diagnostic.Error, diagnostic.RuntimeError, diagnostic.SpanOf(0, 0, 1), "%s is not defined", name),
+		})
+	}
+
+	in.resetBudget(ctx)
+	row, column := 0, 0
+	result = eval.Call(in.budget, fn, args, &row, &column)
+	if runErr, ok := result.(*object.Error); ok {
+		return nil, in.runError(runErr)
+	}
+	return result, nil
+}
+
+// turns a panic while running, like one in a registered Go function,
+// into a run error so it doesn't take the host down with it
+func (in *Interpreter) recoverPanic(result *object.Object, err *error) {
+	r := recover()
+	if r == nil {
+		return
+	}
+	*result = nil
+	*err = in.newError("run", []diagnostic.Diagnostic{
+		diagnostic.New(diagnostic.Error, diagnostic.RuntimeError, diagnostic.SpanOf(0, 0, 1), "panic: %v", r),
+	})
+}
+
+// Get returns the value of a global defined by a program or by Set
+func (in *Interpreter) Get(name string) (object.Object, bool) {
+	if in.opts.Engine != "vm" {
+		return in.scope.Get(name)
+	}
+
+	index, ok := in.compiler.ResolveGlobal(name)
+	if !ok || index >= len(in.globals) || in.globals[index] == nil {
+		return nil, false
+	}
+	return in.globals[index], true
+}
+
+// Set defines an immutable global that the programs run afterwards see
+func (in *Interpreter) Set(name string, value object.Object) {
+	in.define(name, value, eval.TypeOf(value))
+}
+
+// SetArgs defines the global args, the command line arguments of the
+// programs as a List<String> even when there are none
+func (in *Interpreter) SetArgs(args []string) {
+	elements := make([]object.Object, len(args))
+	for i, arg := range args {
+		elements[i] = eval.NewString(arg)
+	}
+	in.define("args", eval.NewList(elements), ast.NewType("List", ast.NewType("String")))
+}
+
+func (in *Interpreter) define(name string, value object.Object, t *ast.TypeNode) {
+	in.checker.Declare(name, t)
+	in.setGlobal(name, value)
+	in.host = append(in.host, global{name: name, value: value, typ: t})
+}
+
+func (in *Interpreter) setGlobal(name string, value object.Object) {
+	if in.opts.Engine != "vm" {
+		in.scope.Set(name, value)
+		return
+	}
+
+	index := in.compiler.DefineGlobal(name)
+	for len(in.globals) <= index {
+		in.globals = append(in.globals, nil)
+	}
+	in.globals[index] = value
+}
@@ -0,0 +1,407 @@
+package mist
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"lang/diagnostic"
+	"lang/object"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+var engines = []string{"tree", "vm"}
+
+func TestRun(t *testing.T) {
+	tests := []struct {
+		code     string
+		expected string
+		stdout   string
+		stderr   string
+	}{
+		{"1 + 2", "3", "", ""},
+		{`println("hello"); print(1, 2); 0`, "0", "hello\n12", ""},
+		{`eprintln("oops"); eprint("!"); 0`, "0", "", "oops\n!"},
+		{"fn main() Int { println(4); 5 }; main()", "5", "4\n", ""},
+	}
+
+	for _, engine := range engines {
+		for i, test := range tests {
+			var stdout, stderr strings.Builder
+			in := New(Options{Stdout: &stdout, Stderr: &stderr, Engine: engine})
+
+			result, err := in.Run(context.Background(), test.code)
+			if err != nil {
+				t.Errorf("%s case %d: unexpected error %s", engine, i, err)
+				continue
+			}
+			if result.Inspect() != test.expected {
+				t.Errorf("%s case %d: expected %s, got %s", engine, i, test.expected, result.Inspect())
+			}
+			if stdout.String() != test.stdout {
+				t.Errorf("%s case %d: expected stdout %q, got %q", engine, i, test.stdout, stdout.String())
+			}
+			if stderr.String() != test.stderr {
+				t.Errorf("%s case %d: expected stderr %q, got %q", engine, i, test.stderr, stderr.String())
+			}
+		}
+	}
+}
+
+func TestErrors(t *testing.T) {
+	tests := []struct {
+		code       string
+		stage      string
+		expected   string
+		diagnostic string
+	}{
+		{"let x: Int = ;", "parse", "[1,14]", diagnostic.ExpectedExpression},
+		{"let x: Int = 1.5;", "check", "[1,1]", diagnostic.TypeError},
+		{"[1, 2][5]", "run", "[1,7]", diagnostic.RuntimeError},
+		{"let x: String = \"a;", "parse", "[1,17]", diagnostic.UnterminatedString},
+	}
+
+	for _, engine := range engines {
+		for i, test := range tests {
+			_, err := New(Options{Engine: engine, File: "main.rs"}).Run(context.Background(), test.code)
+
+			var mistErr *Error
+			if !errors.As(err, &mistErr) {
+				t.Errorf("%s case %d: expected a mist.Error, got %v", engine, i, err)
+				continue
+			}
+			if mistErr.Stage != test.stage {
+				t.Errorf("%s case %d: expected stage %s, got %s", engine, i, test.stage, mistErr.Stage)
+			}
+			if !strings.HasPrefix(mistErr.Messages[0], test.expected) {
+				t.Errorf("%s case %d: expected %s, got %s", engine, i, test.expected, mistErr.Messages[0])
+			}
+
+			d := mistErr.Diagnostics[0]
+			if d.Code != test.diagnostic || d.File != "main.rs" || d.String() != mistErr.Messages[0] {
+				t.Errorf("%s case %d: expected a %s diagnostic in main.rs matching %s, got %+v",
+					engine, i, test.diagnostic, mistErr.Messages[0], d)
+			}
+		}
+	}
+}
+
+// runtime errors span the token they point at
+func TestRuntimeSpans(t *testing.T) {
+	tests := []struct {
+		code     string
+		expected diagnostic.Span
+	}{
+		{"[1, 2][5]", diagnostic.Span{Start: diagnostic.Position{Row: 1, Column: 7}, End: diagnostic.Position{Row: 1, Column: 8}}},
+		{"let mut x: Int = 1; x /= 0;", diagnostic.Span{Start: diagnostic.Position{Row: 1, Column: 23}, End: diagnostic.Position{Row: 1, Column: 25}}},
+		{"fn f(n: Int) Int { 10 / n }; f(0)", diagnostic.Span{Start: diagnostic.Position{Row: 1, Column: 23}, End: diagnostic.Position{Row: 1, Column: 24}}},
+	}
+
+	for _, engine := range engines {
+		for i, test := range tests {
+			_, err := New(Options{Engine: engine}).Run(context.Background(), test.code)
+
+			var mistErr *Error
+			if !errors.As(err, &mistErr) {
+				t.Errorf("%s case %d: expected a mist.Error, got %v", engine, i, err)
+				continue
+			}
+			if span := mistErr.Diagnostics[0].Span; span != test.expected {
+				t.Errorf("%s case %d: expected span %v, got %v", engine, i, test.expected, span)
+			}
+		}
+	}
+}
+
+func TestCheck(t *testing.T) {
+	tests := []struct {
+		code  string
+		stage string // empty when the code checks
+	}{
+		{"let x: Int = 1;", ""},
+		{"println(\"never printed\");", ""},
+		{"[1, 2][5]", ""},
+		{"let x: Int = ;", "parse"},
+		{"let x: Int = 1.5;", "check"},
+	}
+
+	for i, test := range tests {
+		var stdout strings.Builder
+		err := New(Options{Stdout: &stdout}).Check(test.code)
+
+		var mistErr *Error
+		switch {
+		case test.stage == "" && err != nil:
+			t.Errorf("case %d: unexpected error %s", i, err)
+		case test.stage != "" && (!errors.As(err, &mistErr) || mistErr.Stage != test.stage):
+			t.Errorf("case %d: expected a %s error, got %v", i, test.stage, err)
+		}
+		if stdout.Len() != 0 {
+			t.Errorf("case %d: expected the code not to run, it printed %q", i, stdout.String())
+		}
+	}
+}
+
+// args is a List<String>, with or without arguments
+func TestSetArgs(t *testing.T) {
+	for _, engine := range engines {
+		in := New(Options{Engine: engine})
+		in.SetArgs(nil)
+		var mistErr *Error
+		if err := in.Check("let n: Int = args[0];"); !errors.As(err, &mistErr) || mistErr.Stage != "check" {
+			t.Errorf("%s: expected args[0] not to check as an Int, got %v", engine, err)
+		}
+
+		in.SetArgs([]string{"a", "b"})
+		result, err := in.Run(context.Background(), "let first: String = args[0]; first + args[1]")
+		if err != nil || result.Inspect() != "ab" {
+			t.Errorf("%s: expected ab, got %v (%v)", engine, result, err)
+		}
+	}
+}
+
+func TestCanceledContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if _, err := New(Options{}).Run(ctx, "1"); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected context.Canceled, got %v", err)
+	}
+}
+
+func TestGlobals(t *testing.T) {
+	for _, engine := range engines {
+		in := New(Options{Engine: engine})
+		in.Set("limit", &object.Integer{Value: 10})
+
+		steps := []struct {
+			code     string
+			expected string
+		}{
+			{"let mut total: Int = limit;", ""},
+			{"fn add(n: Int) Int { total += n; total }", "fn add(n: Int) Int"},
+			{"add(5)", "15"},
+			{"total * 2", "30"},
+		}
+
+		for i, step := range steps {
+			result, err := in.Run(context.Background(), step.code)
+			if err != nil {
+				t.Fatalf("%s case %d: unexpected error %s", engine, i, err)
+			}
+			if result.Inspect() != step.expected {
+				t.Errorf("%s case %d: expected %s, got %s", engine, i, step.expected, result.Inspect())
+			}
+		}
+
+		total, ok := in.Get("total")
+		if !ok || total.Inspect() != "15" {
+			t.Errorf("%s: expected total to be 15, got %v", engine, total)
+		}
+
+		result, err := in.Call(context.Background(), "add", &object.Integer{Value: 1})
+		if err != nil || result.Inspect() != "16" {
+			t.Errorf("%s: expected add(1) to be 16, got %v (%v)", engine, result, err)
+		}
+
+		if _, err := in.Call(context.Background(), "missing"); err == nil || err.Error() != "[0,0] missing is not defined" {
+			t.Errorf("%s: expected missing to be undefined, got %v", engine, err)
+		}
+
+		if names := in.Globals(); !reflect.DeepEqual(names, []string{"add", "limit", "total"}) {
+			t.Errorf("%s: expected the globals add, limit and total, got %v", engine, names)
+		}
+	}
+}
+
+func TestType(t *testing.T) {
+	in := New(Options{})
+	if _, err := in.Run(context.Background(), "let xs: List<Int> = [1, 2]; fn half(x: Int) Float { x / 2.0 }"); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		expression string
+		expected   string
+		err        string
+	}{
+		{"1 + 2", "Int", ""},
+		{"xs", "List<Int>", ""},
+		{"half(xs[0])", "Float", ""},
+		{"half", "Fn(Int) -> Float", ""},
+		{"xs + 1", "", "[1,4] "},
+		{"let y: Int = 1;", "", "\"let y: Int = 1;\" is not an expression"},
+		{"", "", "\"\" is not an expression"},
+	}
+
+	for i, test := range tests {
+		typ, err := in.Type(test.expression)
+		if test.err != "" {
+			if err == nil || !strings.HasPrefix(err.Error(), test.err) {
+				t.Errorf("case %d: expected an error starting with %s, got %v", i, test.err, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("case %d: unexpected error %s", i, err)
+			continue
+		}
+		if typ.String() != test.expected {
+			t.Errorf("case %d: expected %s, got %s", i, test.expected, typ.String())
+		}
+	}
+
+	// what isn't an expression isn't checked either, y stays undefined
+	if _, err := in.Type("y"); err == nil {
+		t.Errorf("expected y not to be defined")
+	}
+}
+
+// interpreters share nothing, run with -race to check it
+func TestParallelInterpreters(t *testing.T) {
+	var wg sync.WaitGroup
+	outputs := make([]strings.Builder, 8)
+
+	for i := range outputs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			in := New(Options{Stdout: &outputs[i], Engine: engines[i%2]})
+			in.Set("id", &object.Integer{Value: int64(i)})
+			code := `let mut n: Int = 0; for x in range(0, 100) { n += x; }; println(id, " ", n);`
+			if _, err := in.Run(context.Background(), code); err != nil {
+				t.Errorf("case %d: unexpected error %s", i, err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	for i := range outputs {
+		expected := fmt.Sprintf("%d 5050\n", i)
+		if outputs[i].String() != expected {
+			t.Errorf("case %d: expected %q, got %q", i, expected, outputs[i].String())
+		}
+	}
+}
+
+func TestLimits(t *testing.T) {
+	tests := []struct {
+		code     string
+		opts     Options
+		expected string
+	}{
+		{"let mut n: Int = 0; while (true) { n += 1; }", Options{MaxSteps: 100}, "[1,21] step limit of 100 exceeded"},
+		{"for x in [1, 2, 3] { x; }", Options{MaxSteps: 3}, "[1,1] step limit of 3 exceeded"},
+		{"fn f(n: Int) Int { f(n + 1) }; f(0)", Options{MaxSteps: 50}, "[1,21] step limit of 50 exceeded"},
+		{"fn f(n: Int) Int { f(n + 1) }; f(0)", Options{MaxDepth: 10}, "[1,21] call depth limit of 10 exceeded"},
+		{"fn f(n: Int) Int { f(n + 1) }; f(0)", Options{}, "[1,21] call depth limit of 100000 exceeded"},
+		{"[1, 2].map(fn(x: Int) Int { [x].map(fn(y: Int) Int { y })[0] })", Options{MaxDepth: 1}, "[1,36] call depth limit of 1 exceeded"},
+		{"[1, 2, 3, 4]", Options{MaxSize: 3}, "[1,1] size limit of 3 exceeded by a LIST of size 4"},
+		{`{"a": 1, "b": 2}`, Options{MaxSize: 1}, "[1,1] size limit of 1 exceeded by a MAP of size 2"},
+		{`let mut s: String = "ab"; loop { s = s + s; }`, Options{MaxSize: 10}, "[1,40] size limit of 10 exceeded by a STRING of size 16"},
+		{"let mut xs: List<Int> = []; loop { xs = xs + [1]; }", Options{MaxSize: 2}, "[1,44] size limit of 2 exceeded by a LIST of size 3"},
+		{"range(0, 10).filter(fn(x: Int) Bool { true })", Options{MaxSize: 5}, "[1,20] size limit of 5 exceeded by a LIST of size 6"},
+		// sizes are checked before building the value, and builtins that
+		// loop count their iterations as steps
+		{`"x".repeat(200000000)`, Options{MaxSize: 1000}, "[1,11] size limit of 1000 exceeded by a STRING of size 200000000"},
+		{`"x" * 200000000`, Options{MaxSize: 1000}, "[1,5] size limit of 1000 exceeded by a STRING of size 200000000"},
+		{`"x".pad_left(200000000)`, Options{MaxSize: 1000}, "[1,13] size limit of 1000 exceeded by a STRING of size 200000000"},
+		{"(0..30000000).collect()", Options{MaxSize: 1000}, "[1,22] size limit of 1000 exceeded by a LIST of size 1001"},
+		{"[[1, 2], [3]].flatten()", Options{MaxSize: 2}, "[1,22] size limit of 2 exceeded by a LIST of size 3"},
+		{`let mut s: String = "ab"; loop { s += s; }`, Options{MaxSize: 10}, "[1,36] size limit of 10 exceeded by a STRING of size 16"},
+		{"(0..1000).collect()", Options{MaxSteps: 100}, "[1,18] step limit of 100 exceeded"},
+		{"(0..1000).filter(fn(x: Int) Bool { x < 0 }).collect()", Options{MaxSteps: 100}, "[1,17] step limit of 100 exceeded"},
+		{"[5, 4, 3, 2, 1].sort()", Options{MaxSteps: 3}, "[1,21] step limit of 3 exceeded"},
+		{`"ab".repeat(10)`, Options{MaxSteps: 3}, "[1,12] step limit of 3 exceeded"},
+		// catch can't hide an exceeded limit
+		{"loop { catch(fn() Int { loop { 1; } }); }", Options{MaxSteps: 10}, "[1,25] step limit of 10 exceeded"},
+	}
+
+	for _, engine := range engines {
+		for i, test := range tests {
+			test.opts.Engine = engine
+			_, err := New(test.opts).Run(context.Background(), test.code)
+			if err == nil || err.Error() != test.expected {
+				t.Errorf("%s case %d: expected %s, got %v", engine, i, test.expected, err)
+			}
+		}
+	}
+}
+
+func TestTimeout(t *testing.T) {
+	for _, engine := range engines {
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		_, err := New(Options{Engine: engine}).Run(ctx, "fn spin() { loop { 1; } }; spin()")
+		cancel()
+
+		expected := "[1,13] execution stopped: context deadline exceeded"
+		if err == nil || err.Error() != expected {
+			t.Errorf("%s: expected %s, got %v", engine, expected, err)
+		}
+	}
+}
+
+// builtins that loop check the deadline too, and so do calls from the host
+func TestTimeoutInBuiltins(t *testing.T) {
+	for _, engine := range engines {
+		in := New(Options{Engine: engine})
+		ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+		_, err := in.Run(ctx, "(0..20000000).collect().len()")
+		cancel()
+
+		expected := "[1,22] execution stopped: context deadline exceeded"
+		if err == nil || err.Error() != expected {
+			t.Errorf("%s: expected %s, got %v", engine, expected, err)
+		}
+
+		if _, err := in.Run(context.Background(), "fn spin() { loop { 1; } }"); err != nil {
+			t.Fatalf("%s: unexpected error %s", engine, err)
+		}
+		ctx, cancel = context.WithTimeout(context.Background(), 50*time.Millisecond)
+		_, err = in.Call(ctx, "spin")
+		cancel()
+
+		expected = "[1,13] execution stopped: context deadline exceeded"
+		if err == nil || err.Error() != expected {
+			t.Errorf("%s: expected %s, got %v", engine, expected, err)
+		}
+	}
+}
+
+// a limit stops one Run, the next starts with the whole budget
+func TestBudgetPerRun(t *testing.T) {
+	for _, engine := range engines {
+		in := New(Options{Engine: engine, MaxSteps: 10})
+		for i := 0; i < 3; i++ {
+			if _, err := in.Run(context.Background(), "for x in range(1, 8) { x; }"); err != nil {
+				t.Errorf("%s case %d: unexpected error %s", engine, i, err)
+			}
+		}
+	}
+}
+
+func TestBacktrace(t *testing.T) {
+	for _, engine := range engines {
+		in := New(Options{Engine: engine, File: "main.rs"})
+		_, err := in.Run(context.Background(), "fn f() Int { [1][2] }; fn g() Int { f() }; g()")
+
+		var mistErr *Error
+		if !errors.As(err, &mistErr) {
+			t.Fatalf("%s: expected a mist.Error, got %v", engine, err)
+		}
+		expected := []object.Frame{{Function: "f", File: "main.rs", Row: 1, Column: 38}, {Function: "g", File: "main.rs", Row: 1, Column: 45}}
+		if !reflect.DeepEqual(mistErr.Stack, expected) {
+			t.Errorf("%s: expected backtrace %v, got %v", engine, expected, mistErr.Stack)
+		}
+
+		// calls from the host are at 0,0
+		_, err = in.Call(context.Background(), "g")
+		expected = []object.Frame{{Function: "f", File: "main.rs", Row: 1, Column: 38}, {Function: "g", File: "main.rs", Row: 0, Column: 0}}
+		if !errors.As(err, &mistErr) || !reflect.DeepEqual(mistErr.Stack, expected) {
+			t.Errorf("%s: expected backtrace %v, got %v", engine, expected, err)
+		}
+	}
+}
@@ -0,0 +1,205 @@
+package mist
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"lang/ast"
+	"lang/diagnostic"
+	"lang/object"
+	"lang/token"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// a module used by the programs of an Interpreter, loaded once
+type module struct {
+	file        string
+	program     *ast.Program
+	interpreter *Interpreter
+
+	// names of the pub definitions and, once the module ran, their values
+	public  []string
+	exports map[string]object.Object
+}
+
+// the modules of an Interpreter, shared with the interpreters that load
+// them
+type modules struct {
+	loaded map[string]*module // by file
+
+	// files of the modules being loaded, the outermost first
+	loading []string
+}
+
+// loads the modules used by program and binds them to their names, for
+// the checker and, when run is set, for the engine. Modules run once,
+// the first time a program that uses them runs.
+func (in *Interpreter) loadModules(ctx context.Context, program *ast.Program, run bool) error {
+	for _, statement := range program.Statements {
+		use, ok := statement.(*ast.UseStatement)
+		if !ok {
+			continue
+		}
+
+		m, err := in.module(use)
+		if err != nil {
+			return err
+		}
+		if run && m.exports == nil {
+			if err := m.run(ctx); err != nil {
+				return err
+			}
+		}
+
+		in.checker.DeclareModule(use.Name.Value, m.interpreter.checker, m.public)
+		if run {
+			in.setGlobal(use.Name.Value, &object.Module{Name: use.Name.Value, File: m.file, Exports: m.exports})
+		}
+	}
+	return nil
+}
+
+// finds, parses and checks the module use names, or returns it when it
+// was loaded before
+func (in *Interpreter) module(use *ast.UseStatement) (*module, error) {
+	file, source, err := in.findModule(use)
+	if err != nil {
+		return nil, err
+	}
+
+	for i, loading := range in.modules.loading {
+		if loading == filepath.Clean(file) {
+			cycle := append(append([]string{}, in.modules.loading[i:]...), file)
+			return nil, in.loadError(use, diagnostic.ImportCycle, "import cycle: %s", strings.Join(cycle, " -> "))
+		}
+	}
+	if m, ok := in.modules.loaded[file]; ok {
+		return m, nil
+	}
+
+	in.modules.loading = append(in.modules.loading, filepath.Clean(file))
+	defer func() { in.modules.loading = in.modules.loading[:len(in.modules.loading)-1] }()
+
+	m := &module{file: file, interpreter: in.child(file)}
+	m.program, err = m.interpreter.parse(source)
+	if err != nil {
+		return nil, err
+	}
+	// the modules of a module are checked with it but only run with it
+	if err := m.interpreter.loadModules(context.Background(), m.program, false); err != nil {
+		return nil, err
+	}
+	if err := m.interpreter.check(m.program); err != nil {
+		return nil, err
+	}
+	m.public = publicNames(m.program)
+
+	in.modules.loaded[file] = m
+	return m, nil
+}
+
+// runs m and the modules it uses, and keeps the values of its public
+// definitions
+func (m *module) run(ctx context.Context) error {
+	in := m.interpreter
+	if err := in.loadModules(ctx, m.program, true); err != nil {
+		return err
+	}
+
+	in.resetBudget(ctx)
+	result, err := in.eval(m.program)
+	if err != nil {
+		return err
+	}
+	if runErr, ok := result.(*object.Error); ok {
+		return in.runError(runErr)
+	}
+
+	m.exports = make(map[string]object.Object)
+	for _, name := range m.public {
+		if value, ok := in.Get(name); ok {
+			m.exports[name] = value
+		}
+	}
+	return nil
+}
+
+// use utils::math; is in utils/math.mist or utils/math.rs, and import
+// "lib/strings.mist"; in the file named
+func (in *Interpreter) findModule(use *ast.UseStatement) (string, string, error) {
+	names := []string{use.Path}
+	if use.Token.Type == token.USE {
+		base := strings.ReplaceAll(use.Path, "::", "/")
+		names = []string{base + ".mist", base + ".rs"}
+	}
+
+	for _, name := range names {
+		file, source, err := in.opts.Loader.Load(in.opts.File, name)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return "", "", in.loadError(use, diagnostic.ModuleNotFound, "cannot load module %s: %s", modulePath(use), err)
+		}
+		return file, source, nil
+	}
+	return "", "", in.loadError(use, diagnostic.ModuleNotFound, "cannot find module %s", modulePath(use))
+}
+
+// an Interpreter for the module in file, with the options, limits and
+// host globals of in. Hooks only watch the programs they were given to.
+func (in *Interpreter) child(file string) *Interpreter {
+	opts := in.opts
+	opts.File = file
+	opts.Hook = nil
+
+	child := New(opts)
+	child.budget = in.budget
+	child.scope.SetBudget(in.budget)
+	child.modules = in.modules
+	for _, g := range in.host {
+		child.define(g.name, g.value, g.typ)
+	}
+	return child
+}
+
+func (in *Interpreter) loadError(use *ast.UseStatement, code, format string, a ...interface{}) *Error {
+	span := diagnostic.SpanOf(use.Token.Row, use.Token.Column, len(use.Token.Literal))
+	return in.newError("load", []diagnostic.Diagnostic{diagnostic.New(diagnostic.Error, code, span, format, a...)})
+}
+
+// the path of a module as written in the program
+func modulePath(use *ast.UseStatement) string {
+	if use.Token.Type == token.IMPORT {
+		return strconv.Quote(use.Path)
+	}
+	return use.Path
+}
+
+// names of the pub definitions of program
+func publicNames(program *ast.Program) []string {
+	names := []string{}
+	for _, statement := range program.Statements {
+		switch s := statement.(type) {
+		case *ast.LetStatement:
+			if s.Public {
+				names = append(names, s.Name.Value)
+			}
+		case *ast.StructStatement:
+			if s.Public {
+				names = append(names, s.Name.Value)
+			}
+		case *ast.EnumStatement:
+			if s.Public {
+				names = append(names, s.Name.Value)
+			}
+		case *ast.ExpressionStatement:
+			if fn, ok := s.Expression.(*ast.Function); ok && fn.Public && fn.Name != nil {
+				names = append(names, fn.Name.Value)
+			}
+		}
+	}
+	return names
+}
@@ -0,0 +1,171 @@
+package mist
+
+import (
+	"context"
+	"errors"
+	"lang/diagnostic"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+var testModules = MemoryLoader{
+	"utils/math.mist": `
+pub let PI: Float = 3.14;
+pub fn square(x: Int) Int { x * x }
+fn helper() Int { 1 }
+pub struct Point { x: Int, y: Int }
+impl Point {
+    fn new(x: Int, y: Int) Point { Point { x: x, y: y } }
+    fn sum(self) Int { self.x + self.y + helper() }
+}
+pub fn fail() Int { [1][3] }
+println("math");
+`,
+	"lib/strings.rs": `
+use shout;
+pub fn twice(s: String) String { shout::it(s + s) }
+`,
+	"lib/shout.mist": `pub fn it(s: String) String { s + "!" }`,
+	"cycle/a.mist":   "use b; pub fn a() Int { 1 }",
+	"cycle/b.mist":   "use a; pub fn b() Int { 2 }",
+	"broken.mist":    `pub let x: Int = "one";`,
+}
+
+func TestModules(t *testing.T) {
+	tests := []struct {
+		code     string
+		expected string
+	}{
+		{"use utils::math; math::square(3)", "9"},
+		{"use utils::math; math::PI", "3.140000"},
+		{"use utils::math; math::Point::new(1, 2).sum()", "4"},
+		{"use utils::math as m; m::square(2)", "4"},
+		{`import "lib/strings.rs"; strings::twice("a")`, "aa!"},
+		{`import "utils/math.mist" as m; use utils::math; m::square(2) + math::square(2)`, "8"},
+		{"use utils::math; math", "module math"},
+	}
+
+	for _, engine := range engines {
+		for i, test := range tests {
+			var stdout strings.Builder
+			in := New(Options{Stdout: &stdout, Engine: engine, File: "main.rs", Loader: testModules})
+
+			result, err := in.Run(context.Background(), test.code)
+			if err != nil {
+				t.Errorf("%s case %d: unexpected error %s", engine, i, err)
+				continue
+			}
+			if result.Inspect() != test.expected {
+				t.Errorf("%s case %d: expected %s, got %s", engine, i, test.expected, result.Inspect())
+			}
+			// however many times it is used, a module runs once
+			if strings.Count(stdout.String(), "math\n") > 1 {
+				t.Errorf("%s case %d: expected math to run once, got %q", engine, i, stdout.String())
+			}
+		}
+	}
+}
+
+func TestModuleErrors(t *testing.T) {
+	tests := []struct {
+		code       string
+		stage      string
+		expected   string
+		file       string
+		diagnostic string
+	}{
+		{"use utils::missing;", "load", "[1,1] cannot find module utils::missing", "main.rs", diagnostic.ModuleNotFound},
+		{`import "cycle/a.mist";`, "load", "[1,1] import cycle: cycle/a.mist -> cycle/b.mist -> cycle/a.mist", "cycle/b.mist", diagnostic.ImportCycle},
+		{"use utils::math; math::helper()", "check", "[1,22] module math has no public helper", "main.rs", diagnostic.TypeError},
+		{"use broken;", "check", "[1,5] type mismatch", "broken.mist", diagnostic.TypeError},
+		// errors raised in a module point into its file
+		{"use utils::math;\nmath::fail()", "run", "[10,24] index 3 out of range", "utils/math.mist", diagnostic.RuntimeError},
+	}
+
+	for _, engine := range engines {
+		for i, test := range tests {
+			_, err := New(Options{Engine: engine, File: "main.rs", Loader: testModules}).Run(context.Background(), test.code)
+
+			var mistErr *Error
+			if !errors.As(err, &mistErr) {
+				t.Errorf("%s case %d: expected a mist.Error, got %v", engine, i, err)
+				continue
+			}
+			if mistErr.Stage != test.stage {
+				t.Errorf("%s case %d: expected stage %s, got %s", engine, i, test.stage, mistErr.Stage)
+			}
+			if !strings.HasPrefix(mistErr.Messages[0], test.expected) {
+				t.Errorf("%s case %d: expected %s, got %s", engine, i, test.expected, mistErr.Messages[0])
+			}
+			d := mistErr.Diagnostics[0]
+			if d.File != test.file || d.Code != test.diagnostic {
+				t.Errorf("%s case %d: expected %s in %s, got %s in %s", engine, i, test.diagnostic, test.file, d.Code, d.File)
+			}
+		}
+	}
+}
+
+func TestCheckModules(t *testing.T) {
+	var stdout strings.Builder
+	in := New(Options{Stdout: &stdout, File: "main.rs", Loader: testModules})
+
+	if err := in.Check("use utils::math; let n: Int = math::square(2);"); err != nil {
+		t.Fatalf("unexpected error %s", err)
+	}
+	if stdout.Len() != 0 {
+		t.Errorf("expected Check not to run modules, got %q", stdout.String())
+	}
+	if err := in.Check("use utils::math; let s: String = math::square(2);"); err == nil {
+		t.Errorf("expected a type error")
+	}
+}
+
+func TestLoaders(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, "lib"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "lib", "one.mist"), []byte("pub let n: Int = 1;"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	fsys := fstest.MapFS{
+		"app/main.rs":  {Data: []byte("")},
+		"lib/one.mist": {Data: []byte("pub let n: Int = 1;")},
+	}
+
+	tests := []struct {
+		loader Loader
+		from   string
+		name   string
+		file   string
+	}{
+		// next to the program
+		{DirLoader{}, filepath.Join(dir, "main.rs"), "lib/one.mist", filepath.Join(dir, "lib", "one.mist")},
+		// along the search path
+		{DirLoader{Path: []string{dir}}, "main.rs", "lib/one.mist", filepath.Join(dir, "lib", "one.mist")},
+		{FSLoader{FS: fsys}, "main.rs", "lib/one.mist", "lib/one.mist"},
+		{FSLoader{FS: fsys}, "app/main.rs", "../lib/one.mist", "lib/one.mist"},
+		{FSLoader{FS: fsys, Path: []string{"."}}, "app/main.rs", "lib/one.mist", "lib/one.mist"},
+		{testModules, "lib/main.rs", "shout.mist", "lib/shout.mist"},
+	}
+
+	for i, test := range tests {
+		file, _, err := test.loader.Load(test.from, test.name)
+		if err != nil {
+			t.Errorf("case %d: unexpected error %s", i, err)
+			continue
+		}
+		if file != test.file {
+			t.Errorf("case %d: expected %s, got %s", i, test.file, file)
+		}
+	}
+
+	for i, loader := range []Loader{DirLoader{}, FSLoader{FS: fsys}, testModules} {
+		if _, _, err := loader.Load("main.rs", "lib/none.mist"); !errors.Is(err, os.ErrNotExist) {
+			t.Errorf("case %d: expected a missing module, got %v", i, err)
+		}
+	}
+}
@@ -0,0 +1,94 @@
+package mist
+
+import (
+	"context"
+	"fmt"
+	"lang/ast"
+	"lang/object"
+)
+
+// Test is a test "name" { ... } block of a program
+type Test struct {
+	Name   string
+	Row    int
+	Column int
+}
+
+// Tests are the test blocks of source in the order they are written,
+// source is only parsed
+func (in *Interpreter) Tests(source string) ([]Test, error) {
+	program, err := in.parse(source)
+	if err != nil {
+		return nil, err
+	}
+
+	tests := []Test{}
+	for _, test := range testStatements(program) {
+		tests = append(tests, Test{Name: test.Name, Row: test.Token.Row, Column: test.Token.Column})
+	}
+	return tests, nil
+}
+
+// RunTest runs source, which defines the globals of its tests, and then
+// the body of its test named name in a scope of its own, failing with
+// the error of the first assertion that doesn't hold. Tests are meant to
+// run in an Interpreter each, so those before don't leave globals behind.
+func (in *Interpreter) RunTest(ctx context.Context, source, name string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	program, err := in.parse(source)
+	if err != nil {
+		return err
+	}
+	var test *ast.TestStatement
+	for _, t := range testStatements(program) {
+		if t.Name == name {
+			test = t
+			break
+		}
+	}
+	if test == nil {
+		return fmt.Errorf("no test named %q", name)
+	}
+	if err := in.loadModules(ctx, program, true); err != nil {
+		return err
+	}
+	if err := in.check(program); err != nil {
+		return err
+	}
+
+	in.resetBudget(ctx)
+	result, err := in.eval(program)
+	if err != nil {
+		return err
+	}
+	if runErr, ok := result.(*object.Error); ok {
+		return in.runError(runErr)
+	}
+
+	// the body is called like a function, so its variables go away with it
+	body := &ast.FunctionLiteral{Token: test.Token, Body: test.Body}
+	call := &ast.CallExpression{Token: test.Token, Function: body, Arguments: []ast.Expression{}}
+	result, err = in.eval(&ast.Program{Statements: []ast.Statement{
+		&ast.ExpressionStatement{Token: test.Token, Expression: call},
+	}})
+	if err != nil {
+		return err
+	}
+	if runErr, ok := result.(*object.Error); ok {
+		return in.runError(runErr)
+	}
+	return nil
+}
+
+func testStatements(program *ast.Program) []*ast.TestStatement {
+	tests := []*ast.TestStatement{}
+	for _, statement := range program.Statements {
+		if test, ok := statement.(*ast.TestStatement); ok {
+			tests = append(tests, test)
+		}
+	}
+	return tests
+}
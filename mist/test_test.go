@@ -0,0 +1,74 @@
+package mist
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const testProgram = `fn add(a: Int, b: Int) Int { a + b }
+let mut calls: Int = 0;
+
+test "adds" {
+    calls += 1;
+    let sum: Int = add(1, 2);
+    assert_eq(sum, 3);
+}
+
+test "adds wrong" {
+    calls += 1;
+    assert_eq(add(2, 2), 5);
+}
+
+test "sees its own globals" {
+    assert_eq(calls, 0);
+}
+`
+
+func TestTests(t *testing.T) {
+	tests, err := New(Options{}).Tests(testProgram)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []Test{{"adds", 4, 1}, {"adds wrong", 10, 1}, {"sees its own globals", 15, 1}}
+	if !reflect.DeepEqual(tests, expected) {
+		t.Errorf("expected %v, got %v", expected, tests)
+	}
+
+	// running the program as usual skips the tests
+	result, err := New(Options{}).Run(context.Background(), testProgram+"calls")
+	if err != nil || result.Inspect() != "0" {
+		t.Errorf("expected the tests to be skipped, got %v %v", result, err)
+	}
+}
+
+func TestRunTest(t *testing.T) {
+	tests := []struct {
+		name     string
+		expected string
+	}{
+		{"adds", ""},
+		{"adds wrong", "[12,14] assertion failed: left == right\n  left: 4\n right: 5"},
+		{"sees its own globals", ""},
+		{"missing", `no test named "missing"`},
+	}
+
+	for _, engine := range engines {
+		for i, test := range tests {
+			err := New(Options{Engine: engine}).RunTest(context.Background(), testProgram, test.name)
+			actual := ""
+			if err != nil {
+				actual = err.Error()
+			}
+			if actual != test.expected {
+				t.Errorf("%s case %d: expected %q, got %q", engine, i, test.expected, actual)
+			}
+		}
+	}
+
+	err := New(Options{}).RunTest(context.Background(), testProgram+`test "bad" { assert_eq(1, "a" + 1); }`, "adds")
+	if mistErr, ok := err.(*Error); !ok || mistErr.Stage != "check" || !strings.Contains(err.Error(), "not defined over") {
+		t.Errorf("expected the program to be checked before its tests run, got %v", err)
+	}
+}
@@ -0,0 +1,18 @@
+package object
+
+import "context"
+
+// Budget bounds what a program may use while it runs and counts what it
+// used so far, a zero limit means no limit. Every scope of a program
+// shares the budget of its outermost scope.
+type Budget struct {
+	// stops the program once done
+	Context context.Context
+
+	MaxSteps int // function calls, loop iterations and the ones of builtins
+	MaxDepth int // nested function calls
+	MaxSize  int // elements of a list or map, bytes of a string
+
+	Steps int
+	Depth int
+}
@@ -0,0 +1,16 @@
+package object
+
+import "lang/ast"
+
+// Hook is told what the tree walker is about to do, debuggers stop the
+// program there. Every scope of a program shares the hook of its
+// outermost scope, programs without one only pay a nil check.
+type Hook interface {
+	// Statement is called before node runs in scope, an error stops the
+	// program with it
+	Statement(node ast.Statement, scope *Scope) *Error
+	// Call and Return surround every call to a Mist function, named like
+	// the frames of a backtrace and made at row and column
+	Call(function string, row, column int)
+	Return()
+}
@@ -5,6 +5,8 @@ import (
 	"fmt"
 	"hash/fnv"
 	"lang/ast"
+	"lang/code"
+	"sort"
 	"strings"
 )
 
@@ -16,9 +18,18 @@ const (
 	NULL_OBJ     = "NULL"
 	FUNCTION_OBJ = "FUNCTION"
 	RETURN_OBJ   = "RETURN"
+	BREAK_OBJ    = "BREAK"
+	CONTINUE_OBJ = "CONTINUE"
 	ERROR_OBJ    = "ERROR"
 	LIST_OBJ     = "LIST"
 	MAP_OBJ      = "MAP"
+	RANGE_OBJ    = "RANGE"
+	ITER_OBJ     = "ITERATOR"
+
+	COMPILED_FUNCTION_OBJ = "COMPILED_FUNCTION"
+	STRUCT_TYPE_OBJ       = "STRUCT_TYPE"
+	ENUM_TYPE_OBJ         = "ENUM_TYPE"
+	MODULE_OBJ            = "MODULE"
 )
 
 func MapTypeToObject(t string) ObjectType {
@@ -33,21 +44,28 @@ func MapTypeToObject(t string) ObjectType {
 		return BOOLEAN_OBJ
 	case "Void":
 		return NULL_OBJ
-	case "Func":
+	case "Func", "Fn":
 		return FUNCTION_OBJ
 	case "List":
 		return LIST_OBJ
 	case "Map":
 		return MAP_OBJ
-	default:
+	case "Range":
+		return RANGE_OBJ
+	case "Iterator":
+		return ITER_OBJ
+	case "":
 		return NULL_OBJ
+	default:
+		// instances of a struct are of the type named after it
+		return ObjectType(t)
 	}
 }
 
 type (
 	ObjectType      string
-	BuiltinFunction func(row *int, column *int, args ...Object) Object
-	BuiltinMethod   func(row *int, column *int, structure Object, args ...Object) Object
+	BuiltinFunction func(budget *Budget, row *int, column *int, args ...Object) Object
+	BuiltinMethod   func(budget *Budget, row *int, column *int, structure Object, args ...Object) Object
 )
 
 type Object interface {
@@ -110,19 +128,51 @@ type ReturnValue struct {
 func (rv *ReturnValue) Type() ObjectType { return RETURN_OBJ }
 func (rv *ReturnValue) Inspect() string  { return rv.Value.Inspect() }
 
+// like ReturnValue, break and continue unwind blocks until the
+// innermost loop handles them
+type Break struct {
+	Value Object
+}
+
+func (b *Break) Type() ObjectType { return BREAK_OBJ }
+func (b *Break) Inspect() string  { return "break" }
+
+type Continue struct{}
+
+func (c *Continue) Type() ObjectType { return CONTINUE_OBJ }
+func (c *Continue) Inspect() string  { return "continue" }
+
 type Error struct {
 	Message string
+	// the token the error points at, Length is 0 when it isn't known
+	Row, Column, Length int
+	// the file the error is at, empty when it is in the file of the program
+	File string
+	// stops the program, catch doesn't turn it into an Err
+	Fatal bool
+	// the function calls the error escaped from, innermost first
+	Stack []Frame
+}
+
+// a call to a Mist function
+type Frame struct {
+	Function string // the name, "<closure at row:col>" for function literals
+	File     string // of the call, empty when it is in the file of the program
+	Row      int    // where the function was called
+	Column   int
 }
 
 func (e *Error) Type() ObjectType { return ERROR_OBJ }
-func (e *Error) Inspect() string  { return e.Message }
+func (e *Error) Inspect() string  { return fmt.Sprintf("[%d,%d] %s", e.Row, e.Column, e.Message) }
 
 type Function struct {
 	Name       *ast.Identifier
 	Parameters []*ast.Identifier
 	Body       *ast.BlockStatement
 	Scope      *Scope
-	ReturnType string
+	ReturnType *ast.TypeNode
+	// where a function literal is written, it names it in backtraces
+	Position code.Position
 }
 
 func (f *Function) Type() ObjectType { return FUNCTION_OBJ }
@@ -139,11 +189,63 @@ func (f *Function) Inspect() string {
 		out.WriteString(f.Name.Value)
 	}
 	out.WriteString("(" + strings.Join(params, ", ") + ") ")
-	out.WriteString(f.ReturnType)
+	out.WriteString(f.ReturnType.String())
+
+	return out.String()
+}
+
+// function body lowered by the compiler, only lives in the constant pool
+type CompiledFunction struct {
+	Instructions  code.Instructions
+	Positions     map[int]code.Position
+	NumLocals     int
+	NumParameters int
+	Name          *ast.Identifier
+	Parameters    []*ast.Identifier
+	ReturnType    *ast.TypeNode
+	Position      code.Position
+	// the file of the program the function was compiled from, functions
+	// of other files run in the vm of their own program
+	File string
+}
+
+func (cf *CompiledFunction) Type() ObjectType { return COMPILED_FUNCTION_OBJ }
+func (cf *CompiledFunction) Inspect() string {
+	return fmt.Sprintf("CompiledFunction[%p]", cf)
+}
+
+// the vm counterpart of Function
+type Closure struct {
+	Fn   *CompiledFunction
+	Free []Object
+	// re-enters the vm that created the closure, lets builtins
+	// such as List.map apply it
+	Caller func(cl *Closure, row *int, column *int, args ...Object) Object
+}
+
+func (c *Closure) Type() ObjectType { return FUNCTION_OBJ }
+func (c *Closure) Inspect() string {
+	var out bytes.Buffer
+
+	params := []string{}
+	for _, p := range c.Fn.Parameters {
+		params = append(params, p.ParamString())
+	}
+
+	out.WriteString("fn" + " ")
+	if c.Fn.Name != nil {
+		out.WriteString(c.Fn.Name.Value)
+	}
+	out.WriteString("(" + strings.Join(params, ", ") + ") ")
+	out.WriteString(c.Fn.ReturnType.String())
 
 	return out.String()
 }
 
+func (c *Closure) Call(row *int, column *int, args ...Object) Object {
+	return c.Caller(c, row, column, args...)
+}
+
 type BuiltinFunc struct {
 	Fn BuiltinFunction
 }
@@ -196,14 +298,15 @@ type MapPair struct {
 }
 
 type Map struct {
-	Pairs map[MapKey]MapPair
+	Pairs   map[MapKey]MapPair
+	Methods map[string]BuiltinMethod
 }
 
 func (m *Map) Type() ObjectType { return MAP_OBJ }
 func (m *Map) Inspect() string {
 	var out bytes.Buffer
 	pairs := []string{}
-	for _, pair := range m.Pairs {
+	for _, pair := range m.SortedPairs() {
 		pairs = append(pairs, fmt.Sprintf("%s: %s",
 			pair.Key.Inspect(), pair.Value.Inspect()))
 	}
@@ -212,6 +315,75 @@ func (m *Map) Inspect() string {
 	out.WriteString("}")
 	return out.String()
 }
+func (m *Map) SetMethods(name string, method BuiltinMethod) {
+	if m.Methods == nil {
+		m.Methods = make(map[string]BuiltinMethod)
+	}
+	m.Methods[name] = method
+}
+
+// SortedPairs returns the pairs of m ordered by key, numbers by value and
+// strings alphabetically, the order maps are printed and iterated in
+func (m *Map) SortedPairs() []MapPair {
+	pairs := make([]MapPair, 0, len(m.Pairs))
+	for _, pair := range m.Pairs {
+		pairs = append(pairs, pair)
+	}
+	sort.Slice(pairs, func(i, j int) bool {
+		return keyLess(pairs[i].Key, pairs[j].Key)
+	})
+	return pairs
+}
+
+func keyLess(a, b Object) bool {
+	if a.Type() != b.Type() {
+		return a.Type() < b.Type()
+	}
+	switch a := a.(type) {
+	case *Integer:
+		return a.Value < b.(*Integer).Value
+	case *Float:
+		return a.Value < b.(*Float).Value
+	case *String:
+		return a.Value < b.(*String).Value
+	case *Boolean:
+		return !a.Value && b.(*Boolean).Value
+	default:
+		return a.Inspect() < b.Inspect()
+	}
+}
+
+// Range is the integers from Start up to End, End included when
+// Inclusive, Step apart. Ranges are values, each loop over one starts
+// from Start again.
+type Range struct {
+	Start, End, Step int64
+	Inclusive        bool
+	Methods          map[string]BuiltinMethod
+}
+
+func (r *Range) Type() ObjectType { return RANGE_OBJ }
+func (r *Range) Inspect() string {
+	op := ".."
+	if r.Inclusive {
+		op = "..="
+	}
+	if r.Step != 1 {
+		return fmt.Sprintf("(%d%s%d).step(%d)", r.Start, op, r.End, r.Step)
+	}
+	return fmt.Sprintf("%d%s%d", r.Start, op, r.End)
+}
+
+// Iterator is a lazy sequence of values that is consumed once. Next
+// returns the next value, nil once there are none left, or an *Error
+// raised while computing it.
+type Iterator struct {
+	Next    func() Object
+	Methods map[string]BuiltinMethod
+}
+
+func (it *Iterator) Type() ObjectType { return ITER_OBJ }
+func (it *Iterator) Inspect() string  { return "<iterator>" }
 
 type MapKey struct {
 	Type  ObjectType
@@ -243,3 +415,96 @@ func (s *String) MapKey() MapKey {
 	h.Write([]byte(s.Value))
 	return MapKey{Type: s.Type(), Value: h.Sum64()}
 }
+
+// a struct declaration, impl blocks add its methods
+type StructType struct {
+	Name    string
+	Fields  []*ast.Identifier
+	Methods map[string]BuiltinMethod
+}
+
+func (st *StructType) Type() ObjectType { return STRUCT_TYPE_OBJ }
+func (st *StructType) Inspect() string  { return "struct " + st.Name }
+func (st *StructType) SetMethods(name string, method BuiltinMethod) {
+	if st.Methods == nil {
+		st.Methods = make(map[string]BuiltinMethod)
+	}
+	st.Methods[name] = method
+}
+
+type Struct struct {
+	Definition *StructType
+	Fields     map[string]Object
+}
+
+func (s *Struct) Type() ObjectType { return ObjectType(s.Definition.Name) }
+func (s *Struct) Inspect() string {
+	fields := []string{}
+	for _, f := range s.Definition.Fields {
+		fields = append(fields, f.Value+": "+s.Fields[f.Value].Inspect())
+	}
+
+	return s.Definition.Name + " { " + strings.Join(fields, ", ") + " }"
+}
+
+// a module bound by use or import, its public definitions are read as
+// math::name
+type Module struct {
+	Name    string
+	File    string
+	Exports map[string]Object
+}
+
+func (m *Module) Type() ObjectType { return MODULE_OBJ }
+func (m *Module) Inspect() string  { return "module " + m.Name }
+
+type EnumType struct {
+	Name     string
+	Variants []*ast.Variant
+	Methods  map[string]BuiltinMethod
+	// the variants are in scope without the enum name, e.g. Some(1)
+	Prelude bool
+}
+
+func (et *EnumType) Type() ObjectType { return ENUM_TYPE_OBJ }
+func (et *EnumType) Inspect() string  { return "enum " + et.Name }
+func (et *EnumType) SetMethods(name string, method BuiltinMethod) {
+	if et.Methods == nil {
+		et.Methods = make(map[string]BuiltinMethod)
+	}
+	et.Methods[name] = method
+}
+
+// Variant looks up a variant by name, nil if the enum has none
+func (et *EnumType) Variant(name string) *ast.Variant {
+	for _, v := range et.Variants {
+		if v.Name.Value == name {
+			return v
+		}
+	}
+	return nil
+}
+
+// a value of an enum, Values holds the payload of its variant
+type EnumValue struct {
+	Definition *EnumType
+	Variant    string
+	Values     []Object
+}
+
+func (ev *EnumValue) Type() ObjectType { return ObjectType(ev.Definition.Name) }
+func (ev *EnumValue) Inspect() string {
+	name := ev.Definition.Name + "::" + ev.Variant
+	if ev.Definition.Prelude {
+		name = ev.Variant
+	}
+	if len(ev.Values) == 0 {
+		return name
+	}
+
+	values := []string{}
+	for _, v := range ev.Values {
+		values = append(values, v.Inspect())
+	}
+	return name + "(" + strings.Join(values, ", ") + ")"
+}
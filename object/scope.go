@@ -1,8 +1,24 @@
 package object
 
+import (
+	"lang/ast"
+	"sort"
+)
+
 type Scope struct {
 	store map[string]Object
-	outer *Scope
+	// declared types of the bindings that can be reassigned, nil until
+	// the scope has one
+	mutable map[string]*ast.TypeNode
+	outer   *Scope
+	// resolved after every binding, only set on the outermost scope
+	builtins map[string]Object
+	// shared by every scope of a program, nil when nothing is limited
+	budget *Budget
+	// shared like the budget, nil when nobody is watching
+	hook Hook
+	// the program run in the scope is from, only set on the outermost scope
+	file string
 }
 
 func NewScope() *Scope {
@@ -12,6 +28,77 @@ func NewScope() *Scope {
 	}
 }
 
+// the outermost scope of a program, names no binding shadows resolve
+// to builtins
+func NewGlobalScope(builtins map[string]Object) *Scope {
+	scope := NewScope()
+	scope.builtins = builtins
+	return scope
+}
+
+// Builtin looks up name in the builtins of the outermost scope
+func (s *Scope) Builtin(name string) (Object, bool) {
+	for s.outer != nil {
+		s = s.outer
+	}
+	obj, ok := s.builtins[name]
+	return obj, ok
+}
+
+// SetBudget limits the program run in s and the scopes created from it
+func (s *Scope) SetBudget(b *Budget) {
+	s.budget = b
+}
+
+func (s *Scope) Budget() *Budget {
+	return s.budget
+}
+
+// SetHook makes hook watch the program run in s and the scopes created
+// from it
+func (s *Scope) SetHook(hook Hook) {
+	s.hook = hook
+}
+
+func (s *Scope) Hook() Hook {
+	return s.hook
+}
+
+// SetFile names the file of the program run in s, for errors raised in
+// the functions it defines
+func (s *Scope) SetFile(file string) {
+	s.file = file
+}
+
+// File of the program s belongs to
+func (s *Scope) File() string {
+	for s.outer != nil {
+		s = s.outer
+	}
+	return s.file
+}
+
+// Outer is the scope s was created in, nil for the outermost one
+func (s *Scope) Outer() *Scope {
+	return s.outer
+}
+
+// Names are the names bound in s itself, sorted
+func (s *Scope) Names() []string {
+	names := make([]string, 0, len(s.store))
+	for name := range s.store {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Local looks name up in s itself, not in the scopes around it
+func (s *Scope) Local(name string) (Object, bool) {
+	obj, ok := s.store[name]
+	return obj, ok
+}
+
 func (s *Scope) Get(name string) (Object, bool) {
 	obj, ok := s.store[name]
 	if !ok && s.outer != nil {
@@ -22,11 +109,53 @@ func (s *Scope) Get(name string) (Object, bool) {
 
 func (s *Scope) Set(name string, val Object) Object {
 	s.store[name] = val
+	delete(s.mutable, name)
+	return val
+}
+
+// binds name like Set, but allows reassigning it with values of type t
+func (s *Scope) SetMutable(name string, val Object, t *ast.TypeNode) Object {
+	s.store[name] = val
+	if s.mutable == nil {
+		s.mutable = make(map[string]*ast.TypeNode)
+	}
+	s.mutable[name] = t
 	return val
 }
 
+// Mutability reports whether name is bound and whether it can be
+// reassigned, along with the type it was declared with
+func (s *Scope) Mutability(name string) (declared *ast.TypeNode, mutable bool, ok bool) {
+	owner := s.owner(name)
+	if owner == nil {
+		return nil, false, false
+	}
+	declared, mutable = owner.mutable[name]
+	return declared, mutable, true
+}
+
+// Assign rebinds name in the scope that declared it
+func (s *Scope) Assign(name string, val Object) Object {
+	if owner := s.owner(name); owner != nil {
+		owner.store[name] = val
+	}
+	return val
+}
+
+func (s *Scope) owner(name string) *Scope {
+	if _, ok := s.store[name]; ok {
+		return s
+	}
+	if s.outer != nil {
+		return s.outer.owner(name)
+	}
+	return nil
+}
+
 func NewInnerScope(outer *Scope) *Scope {
 	scope := NewScope()
 	scope.outer = outer
+	scope.budget = outer.budget
+	scope.hook = outer.hook
 	return scope
 }
@@ -3,14 +3,19 @@ package parser
 import (
 	"fmt"
 	"lang/ast"
+	"lang/diagnostic"
 	"lang/lexer"
 	"lang/token"
+	"path"
 	"strconv"
+	"strings"
+	"unicode"
 )
 
 const (
 	_           int = iota // assigns integers serially
 	LOWEST                 // place holder
+	RANGE                  // a..b
 	BITWISE                // AND and OR
 	EQUALS                 // ==
 	LESSGREATER            // < or >
@@ -25,6 +30,8 @@ const (
 var precedences = map[token.TokenType]int{
 	token.EQ:       EQUALS,
 	token.NE:       EQUALS,
+	token.DOTDOT:   RANGE,
+	token.DOTDOTEQ: RANGE,
 	token.OR:       BITWISE,
 	token.AND:      BITWISE,
 	token.LT:       LESSGREATER,
@@ -40,6 +47,8 @@ var precedences = map[token.TokenType]int{
 	token.LPAREN:   CALL,
 	token.LBRACKET: INDEX,
 	token.DOT:      INDEX,
+	token.PATH:     INDEX,
+	token.QUESTION: INDEX,
 }
 
 type (
@@ -49,11 +58,25 @@ type (
 
 type Parser struct {
 	l      *lexer.Lexer
-	errors []string
+	errors []diagnostic.Diagnostic
 
 	curToken  token.Token
 	peekToken token.Token
 
+	// name of the struct whose impl block is being parsed
+	receiver string
+
+	// set while parsing the subject of a match, where `x {` opens the
+	// arms rather than a struct literal
+	noStructLiteral bool
+
+	// kinds of the loops around the statement being parsed, innermost
+	// last, break and continue are only allowed inside one
+	loops []token.TokenType
+
+	// braces opened up to curToken and not closed yet
+	depth int
+
 	prefixParseFn map[token.TokenType]prefixParseFn
 	infixParseFn  map[token.TokenType]infixParseFn
 }
@@ -61,7 +84,7 @@ type Parser struct {
 func NewParser(l *lexer.Lexer) *Parser {
 	p := &Parser{
 		l:      l,
-		errors: []string{},
+		errors: []diagnostic.Diagnostic{},
 	}
 
 	// fill curToken and peekToken
@@ -82,6 +105,8 @@ func NewParser(l *lexer.Lexer) *Parser {
 	p.registerPrefix(token.FUNC, p.parseFunction)
 	p.registerPrefix(token.LBRACKET, p.parseArrayLiteral)
 	p.registerPrefix(token.LBRACE, p.parseMapLiteral)
+	p.registerPrefix(token.MATCH, p.parseMatchExpression)
+	p.registerPrefix(token.LOOP, p.parseLoopExpression)
 
 	p.infixParseFn = make(map[token.TokenType]infixParseFn)
 	p.registerInfix(token.PLUS, p.parseInfixExpression)
@@ -100,7 +125,11 @@ func NewParser(l *lexer.Lexer) *Parser {
 	p.registerInfix(token.LPAREN, p.parseCallExpression)
 	p.registerInfix(token.LBRACKET, p.parseIndexExpression)
 	p.registerInfix(token.DOT, p.parseAccessExpression)
+	p.registerInfix(token.PATH, p.parseAccessExpression)
+	p.registerInfix(token.QUESTION, p.parseTryExpression)
 	p.registerInfix(token.MOD, p.parseInfixExpression)
+	p.registerInfix(token.DOTDOT, p.parseRangeExpression)
+	p.registerInfix(token.DOTDOTEQ, p.parseRangeExpression)
 
 	return p
 }
@@ -116,6 +145,13 @@ func (p *Parser) registerInfix(tokenType token.TokenType, fn infixParseFn) {
 func (p *Parser) nextToken() {
 	p.curToken = p.peekToken
 	p.peekToken = *p.l.NextToken()
+
+	switch p.curToken.Type {
+	case token.LBRACE:
+		p.depth++
+	case token.RBRACE:
+		p.depth--
+	}
 }
 
 func (p *Parser) advanceIfPeek(t token.TokenType) bool {
@@ -128,6 +164,20 @@ func (p *Parser) advanceIfPeek(t token.TokenType) bool {
 	}
 }
 
+// struct names are identifiers, so a type is either a TYPE or an ID
+func (p *Parser) peekTypeIs() bool {
+	return p.peekTokenIs(token.TYPE) || p.peekTokenIs(token.ID)
+}
+
+func (p *Parser) advanceIfPeekType() bool {
+	if p.peekTypeIs() {
+		p.nextToken()
+		return true
+	}
+	p.setPeekError(token.TYPE)
+	return false
+}
+
 func (p *Parser) peekTokenIs(token token.TokenType) bool {
 	return p.peekToken.Type == token
 }
@@ -152,17 +202,50 @@ func (p *Parser) curPrecedence() int {
 	return LOWEST
 }
 
+// Errors are the "[row,col] message" forms of Diagnostics
 func (p *Parser) Errors() []string {
-	return p.errors
+	return diagnostic.Strings(p.Diagnostics())
+}
+
+// Diagnostics of the lexer and the parser, in the order of the source.
+// Only the first error at a token is kept, the others follow from it.
+func (p *Parser) Diagnostics() []diagnostic.Diagnostic {
+	all := append(p.l.Diagnostics(), p.errors...)
+	diagnostic.Sort(all)
+
+	diagnostics := []diagnostic.Diagnostic{}
+	for i, d := range all {
+		if i == 0 || d.Span.Start != all[i-1].Span.Start {
+			diagnostics = append(diagnostics, d)
+		}
+	}
+	return diagnostics
+}
+
+// adds an error pointing at tok
+func (p *Parser) report(code string, tok token.Token, format string, a ...interface{}) *diagnostic.Diagnostic {
+	d := diagnostic.New(diagnostic.Error, code, diagnostic.SpanOf(tok.Row, tok.Column, len(tok.Literal)), format, a...)
+	p.errors = append(p.errors, d)
+	return &p.errors[len(p.errors)-1]
 }
 
 func (p *Parser) setPeekError(t token.TokenType) {
 	if p.peekToken.Literal == "\x00" {
 		p.peekToken.Literal = "EOF"
 	}
-	msg := fmt.Sprintf("[%d,%d] expected next token to be %s, got %s",
-		p.curToken.Row, p.curToken.Column, t, p.peekToken.Literal)
-	p.errors = append(p.errors, msg)
+	d := p.report(diagnostic.UnexpectedToken, p.curToken, "expected next token to be %s, got %s", t, p.peekToken.Literal)
+
+	// a missing closing bracket or semicolon goes right after the
+	// current token
+	switch t {
+	case token.RPAREN, token.RBRACKET, token.RBRACE, token.SEMICOLON:
+		at := d.Span.End
+		d.Fixes = append(d.Fixes, diagnostic.Fix{
+			Message:     fmt.Sprintf("insert `%s`", t),
+			Span:        diagnostic.Span{Start: at, End: at},
+			Replacement: string(t),
+		})
+	}
 }
 
 // entry point
@@ -171,29 +254,140 @@ func (p *Parser) Parse() *ast.Program {
 	program.Statements = []ast.Statement{}
 
 	for p.curToken.Type != token.EOF {
-		stmt := p.parseStatement()
-		if stmt != nil {
-			program.Statements = append(program.Statements, stmt)
+		// a ; on its own is an empty statement
+		if !p.curTokenIs(token.SEMICOLON) {
+			program.Statements = append(program.Statements, p.parseStatementOrSkip())
 		}
 		p.nextToken()
 	}
 	return program
 }
 
+// parses a statement, one that fails is replaced by a BadStatement and
+// its tokens are skipped so that parsing goes on from the next one
+func (p *Parser) parseStatementOrSkip() ast.Statement {
+	from := p.curToken
+	depth := p.depth
+	if from.Type == token.LBRACE {
+		depth--
+	}
+
+	if stmt := p.parseStatement(); stmt != nil {
+		return stmt
+	}
+
+	p.synchronize(depth)
+	return &ast.BadStatement{From: from, To: p.curToken}
+}
+
+// tokens that start a statement, where parsing picks up after an error
+var statementStarts = map[token.TokenType]bool{
+	token.LET:      true,
+	token.RETURN:   true,
+	token.STRUCT:   true,
+	token.IMPL:     true,
+	token.ENUM:     true,
+	token.WHILE:    true,
+	token.FOR:      true,
+	token.BREAK:    true,
+	token.CONTINUE: true,
+	token.FUNC:     true,
+	token.USE:      true,
+	token.IMPORT:   true,
+	token.PUB:      true,
+}
+
+// skips to the end of the statement curToken is in: the ; that ends it,
+// a } that ends its line, or the token before the next statement or the
+// } of the block around it, which has depth braces open around it.
+// Braces opened by the statement are skipped whole.
+func (p *Parser) synchronize(depth int) {
+	for !p.curTokenIs(token.EOF) && !p.peekTokenIs(token.EOF) && p.depth >= depth {
+		if p.depth == depth {
+			switch {
+			case p.curTokenIs(token.SEMICOLON),
+				p.curTokenIs(token.RBRACE) && p.peekToken.Row > p.curToken.Row,
+				p.peekTokenIs(token.RBRACE),
+				statementStarts[p.peekToken.Type]:
+				return
+			}
+		}
+		p.nextToken()
+	}
+}
+
+func isBad(exp ast.Expression) bool {
+	_, ok := exp.(*ast.BadExpression)
+	return ok
+}
+
+// nil when the statement failed to parse, the parse functions return
+// typed nils which wouldn't compare equal to nil as an ast.Statement
 func (p *Parser) parseStatement() ast.Statement {
 	switch p.curToken.Type {
 	case token.LET:
-		return p.parseLetStatement()
+		if stmt := p.parseLetStatement(); stmt != nil {
+			return stmt
+		}
 	case token.RETURN:
-		return p.parseReturnStatement()
+		if stmt := p.parseReturnStatement(); stmt != nil {
+			return stmt
+		}
+	case token.STRUCT:
+		if stmt := p.parseStructStatement(); stmt != nil {
+			return stmt
+		}
+	case token.IMPL:
+		if stmt := p.parseImplStatement(); stmt != nil {
+			return stmt
+		}
+	case token.ENUM:
+		if stmt := p.parseEnumStatement(); stmt != nil {
+			return stmt
+		}
+	case token.WHILE:
+		if stmt := p.parseWhileStatement(); stmt != nil {
+			return stmt
+		}
+	case token.FOR:
+		if stmt := p.parseForStatement(); stmt != nil {
+			return stmt
+		}
+	case token.BREAK:
+		if stmt := p.parseBreakStatement(); stmt != nil {
+			return stmt
+		}
+	case token.CONTINUE:
+		if stmt := p.parseContinueStatement(); stmt != nil {
+			return stmt
+		}
+	case token.USE, token.IMPORT:
+		if stmt := p.parseUseStatement(); stmt != nil {
+			return stmt
+		}
+	case token.PUB:
+		return p.parsePubStatement()
 	default:
+		// test isn't a keyword, it starts a test only when a name follows
+		if p.curToken.Literal == "test" && p.curTokenIs(token.ID) && p.peekTokenIs(token.STRING) {
+			if stmt := p.parseTestStatement(); stmt != nil {
+				return stmt
+			}
+			return nil
+		}
 		return p.parseExpressionStatement()
 	}
+	return nil
 }
 
 func (p *Parser) parseLetStatement() *ast.LetStatement {
 	stmt := &ast.LetStatement{Token: p.curToken}
 
+	if p.peekTokenIs(token.MUT) {
+		p.nextToken()
+		stmt.Mutable = true
+	}
+
 	if !p.advanceIfPeek(token.ID) {
 		return nil
 	}
@@ -207,11 +401,14 @@ func (p *Parser) parseLetStatement() *ast.LetStatement {
 		return nil
 	}
 
-	if !p.advanceIfPeek(token.TYPE) {
+	if !p.advanceIfPeekType() {
 		return nil
 	}
 
-	stmt.Name.Type = p.curToken
+	stmt.Name.Type = p.parseType()
+	if stmt.Name.Type == nil {
+		return nil
+	}
 
 	if !p.advanceIfPeek(token.ASSIGN) {
 		return nil
@@ -249,10 +446,49 @@ func (p *Parser) parseReturnStatement() *ast.ReturnStatement {
 	return stmt
 }
 
-func (p *Parser) parseExpressionStatement() *ast.ExpressionStatement {
+func (p *Parser) parseExpressionStatement() ast.Statement {
 	stmt := &ast.ExpressionStatement{Token: p.curToken}
 
 	stmt.Expression = p.parseExpression(LOWEST)
+	if isBad(stmt.Expression) {
+		return nil
+	}
+
+	if _, ok := assignOperators[p.peekToken.Type]; ok {
+		if assign := p.parseAssignStatement(stmt.Expression); assign != nil {
+			return assign
+		}
+		return nil
+	}
+
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+
+	return stmt
+}
+
+// the infix operator each assignment operator applies before assigning
+var assignOperators = map[token.TokenType]string{
+	token.ASSIGN:          "",
+	token.PLUS_ASSIGN:     "+",
+	token.MINUS_ASSIGN:    "-",
+	token.ASTERISK_ASSIGN: "*",
+	token.SLASH_ASSIGN:    "/",
+	token.MOD_ASSIGN:      "%",
+}
+
+func (p *Parser) parseAssignStatement(target ast.Expression) *ast.AssignStatement {
+	p.nextToken()
+	stmt := &ast.AssignStatement{Token: p.curToken, Target: target, Operator: assignOperators[p.curToken.Type]}
+
+	if name, _ := ast.AssignTarget(target); name == nil {
+		p.report(diagnostic.InvalidAssignment, p.curToken, "cannot assign to %s", target)
+		return nil
+	}
+
+	p.nextToken()
+	stmt.Value = p.parseExpression(LOWEST)
 
 	if p.peekTokenIs(token.SEMICOLON) {
 		p.nextToken()
@@ -261,15 +497,21 @@ func (p *Parser) parseExpressionStatement() *ast.ExpressionStatement {
 	return stmt
 }
 
+// never nil, an expression that fails to parse is a BadExpression
 func (p *Parser) parseExpression(precedence int) ast.Expression {
+	start := p.curToken
 	prefix := p.prefixParseFn[p.curToken.Type]
 
 	if prefix == nil {
-		return nil
+		if p.curTokenIs(token.EOF) {
+			p.curToken.Literal = "EOF"
+		}
+		p.report(diagnostic.ExpectedExpression, p.curToken, "expected an expression, got %s", p.curToken.Literal)
+		return &ast.BadExpression{Token: start}
 	}
 
 	leftExp := prefix()
-	for !p.peekTokenIs(token.SEMICOLON) && precedence < p.peekPrecedence() {
+	for leftExp != nil && !p.peekTokenIs(token.SEMICOLON) && precedence < p.peekPrecedence() {
 		infix := p.infixParseFn[p.peekToken.Type]
 		if infix == nil {
 			return leftExp
@@ -279,40 +521,60 @@ func (p *Parser) parseExpression(precedence int) ast.Expression {
 		leftExp = infix(leftExp)
 	}
 
+	if leftExp == nil {
+		return &ast.BadExpression{Token: start}
+	}
 	return leftExp
 }
 
 func (p *Parser) parseIdentifier() ast.Expression {
-	return &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+	ident := &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+
+	// struct names are capitalized, which tells `Point { x: 1 }`
+	// apart from an identifier followed by a block
+	if p.peekTokenIs(token.LBRACE) && isStructName(ident.Value) && !p.noStructLiteral {
+		return p.parseStructLiteral(ident)
+	}
+
+	return ident
+}
+
+func isStructName(name string) bool {
+	return name[0] >= 'A' && name[0] <= 'Z'
+}
+
+// kind is "struct" or "enum", tok is the name they declare
+func (p *Parser) lowercaseName(kind string, tok token.Token) {
+	d := p.report(diagnostic.LowercaseName, tok, "%s names must start with an uppercase letter, got %s", kind, tok.Literal)
+	name := strings.ToUpper(tok.Literal[:1]) + tok.Literal[1:]
+	d.Fixes = append(d.Fixes, diagnostic.Fix{Message: fmt.Sprintf("rename it to `%s`", name), Span: d.Span, Replacement: name})
 }
 
 func (p *Parser) parseIntegerLiteral() ast.Expression {
 	literal, err := strconv.ParseInt(p.curToken.Literal, 0, 64)
 	if err != nil {
-		msg := fmt.Sprintf("could not parse %s as an integer", p.curToken.Literal)
-		p.errors = append(p.errors, msg)
+		p.report(diagnostic.InvalidNumber, p.curToken, "could not parse %s as an integer", p.curToken.Literal)
 		return nil
 	}
 
 	return &ast.IntegerLiteral{
 		Token: p.curToken,
 		Value: literal,
-		Type:  token.Token{Type: token.TYPE, Literal: "Int"},
+		Type:  ast.NewType("Int"),
 	}
 }
 
 func (p *Parser) parseFloatLiteral() ast.Expression {
 	literal, err := strconv.ParseFloat(p.curToken.Literal, 64)
 	if err != nil {
-		msg := fmt.Sprintf("could not parse %s as a float", p.curToken.Literal)
-		p.errors = append(p.errors, msg)
+		p.report(diagnostic.InvalidNumber, p.curToken, "could not parse %s as a float", p.curToken.Literal)
 		return nil
 	}
 
 	return &ast.FloatLiteral{
 		Token: p.curToken,
 		Value: literal,
-		Type:  token.Token{Type: token.TYPE, Literal: "Float"},
+		Type:  ast.NewType("Float"),
 	}
 }
 
@@ -320,7 +582,7 @@ func (p *Parser) parseStringLiteral() ast.Expression {
 	return &ast.StringLiteral{
 		Token: p.curToken,
 		Value: p.curToken.Literal,
-		Type:  token.Token{Type: token.TYPE, Literal: "String"},
+		Type:  ast.NewType("String"),
 	}
 }
 
@@ -333,7 +595,7 @@ func (p *Parser) parsePrefixExpression() ast.Expression {
 	p.nextToken()
 
 	expression.Right = p.parseExpression(PREFIX)
-	expression.Type = token.Token{Type: token.TYPE, Literal: expression.Right.ReturnType()}
+	expression.Type = ast.NewType(expression.Right.ReturnType())
 
 	return expression
 }
@@ -352,6 +614,22 @@ func (p *Parser) parseInfixExpression(left ast.Expression) ast.Expression {
 	return expression
 }
 
+func (p *Parser) parseRangeExpression(start ast.Expression) ast.Expression {
+	expression := &ast.RangeExpression{
+		Token:     p.curToken,
+		Type:      ast.NewType("Range"),
+		Start:     start,
+		Inclusive: p.curTokenIs(token.DOTDOTEQ),
+	}
+
+	p.nextToken()
+	expression.End = p.parseExpression(RANGE)
+	if expression.End == nil {
+		return nil
+	}
+	return expression
+}
+
 func (p *Parser) parseBoolean() ast.Expression {
 	return &ast.Boolean{Token: p.curToken, Value: p.curTokenIs(token.TRUE)}
 }
@@ -410,9 +688,9 @@ func (p *Parser) parseBlockStatement() *ast.BlockStatement {
 	p.nextToken()
 
 	for !p.curTokenIs(token.RBRACE) && !p.curTokenIs(token.EOF) {
-		stmt := p.parseStatement()
-		if stmt != nil {
-			block.Statements = append(block.Statements, stmt)
+		// a ; on its own is an empty statement
+		if !p.curTokenIs(token.SEMICOLON) {
+			block.Statements = append(block.Statements, p.parseStatementOrSkip())
 		}
 		p.nextToken()
 	}
@@ -436,7 +714,7 @@ func (p *Parser) parseFunctionDefinition() ast.Expression {
 		return nil
 	}
 
-	fn.Name = p.parseIdentifier().(*ast.Identifier)
+	fn.Name = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
 
 	if !p.advanceIfPeek(token.LPAREN) {
 		return nil
@@ -444,18 +722,21 @@ func (p *Parser) parseFunctionDefinition() ast.Expression {
 
 	lit.Parameters = p.parseFunctionParameters()
 
-	if p.peekTokenIs(token.TYPE) {
+	if p.peekTypeIs() {
 		p.nextToken()
-		lit.Type = p.curToken
+		lit.Type = p.parseType()
+		if lit.Type == nil {
+			return nil
+		}
 	} else {
-		lit.Type = token.Token{Type: token.TYPE, Literal: "Void"}
+		lit.Type = ast.NewType("Void")
 	}
 
 	if !p.advanceIfPeek(token.LBRACE) {
 		return nil
 	}
 
-	lit.Body = p.parseBlockStatement()
+	lit.Body = p.parseFunctionBody()
 
 	return fn
 }
@@ -469,22 +750,34 @@ func (p *Parser) parseFunctionLiteral() ast.Expression {
 
 	lit.Parameters = p.parseFunctionParameters()
 
-	if p.peekTokenIs(token.TYPE) {
+	if p.peekTypeIs() {
 		p.nextToken()
-		lit.Type = p.curToken
+		lit.Type = p.parseType()
+		if lit.Type == nil {
+			return nil
+		}
 	} else {
-		lit.Type = token.Token{Type: token.TYPE, Literal: "Void"}
+		lit.Type = ast.NewType("Void")
 	}
 
 	if !p.advanceIfPeek(token.LBRACE) {
 		return nil
 	}
 
-	lit.Body = p.parseBlockStatement()
+	lit.Body = p.parseFunctionBody()
 
 	return lit
 }
 
+// a loop around a function doesn't extend into its body
+func (p *Parser) parseFunctionBody() *ast.BlockStatement {
+	loops := p.loops
+	p.loops = nil
+	defer func() { p.loops = loops }()
+
+	return p.parseBlockStatement()
+}
+
 func (p *Parser) parseFunctionParameters() []*ast.Identifier {
 	identifiers := []*ast.Identifier{}
 
@@ -495,32 +788,20 @@ func (p *Parser) parseFunctionParameters() []*ast.Identifier {
 
 	p.nextToken()
 
-	ident := &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
-
-	if !p.advanceIfPeek(token.COLON) {
-		return nil
-	}
-
-	if !p.advanceIfPeek(token.TYPE) {
+	ident := p.parseParameter()
+	if ident == nil {
 		return nil
 	}
-
-	ident.Type = p.curToken
 	identifiers = append(identifiers, ident)
 
 	for p.peekTokenIs(token.COMMA) {
 		p.nextToken()
 		p.nextToken()
-		ident := &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
-
-		if !p.advanceIfPeek(token.COLON) {
-			return nil
-		}
 
-		if !p.advanceIfPeek(token.TYPE) {
+		ident := p.parseParameter()
+		if ident == nil {
 			return nil
 		}
-		ident.Type = p.curToken
 		identifiers = append(identifiers, ident)
 	}
 
@@ -531,6 +812,31 @@ func (p *Parser) parseFunctionParameters() []*ast.Identifier {
 	return identifiers
 }
 
+// parses `name: Type`, curToken is the name
+func (p *Parser) parseParameter() *ast.Identifier {
+	ident := &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+
+	// the receiver of a method takes the type of its impl block
+	if ident.Value == "self" && p.receiver != "" && !p.peekTokenIs(token.COLON) {
+		ident.Type = ast.NewType(p.receiver)
+		return ident
+	}
+
+	if !p.advanceIfPeek(token.COLON) {
+		return nil
+	}
+
+	if !p.advanceIfPeekType() {
+		return nil
+	}
+
+	ident.Type = p.parseType()
+	if ident.Type == nil {
+		return nil
+	}
+	return ident
+}
+
 func (p *Parser) parseCallExpression(function ast.Expression) ast.Expression {
 	exp := &ast.CallExpression{Token: p.curToken, Function: function}
 	exp.Arguments = p.parseExpressionList(token.RPAREN)
@@ -540,7 +846,7 @@ func (p *Parser) parseCallExpression(function ast.Expression) ast.Expression {
 func (p *Parser) parseArrayLiteral() ast.Expression {
 	array := &ast.ListLiteral{
 		Token: p.curToken,
-		Type:  token.Token{Type: token.TYPE, Literal: "List"},
+		Type:  ast.NewType("List"),
 	}
 	array.Elements = p.parseExpressionList(token.RBRACKET)
 	return array
@@ -571,8 +877,20 @@ func (p *Parser) parseExpressionList(end token.TokenType) []ast.Expression {
 
 func (p *Parser) parseIndexExpression(left ast.Expression) ast.Expression {
 	exp := &ast.IndexExpression{Token: p.curToken, Left: left}
-	p.nextToken()
-	exp.Index = p.parseExpression(LOWEST)
+	if !p.peekTokenIs(token.COLON) {
+		p.nextToken()
+		exp.Index = p.parseExpression(LOWEST)
+	}
+
+	// xs[start:end], xs[:end], xs[start:] and xs[:]
+	if p.peekTokenIs(token.COLON) {
+		p.nextToken()
+		exp.Slice = true
+		if !p.peekTokenIs(token.RBRACKET) {
+			p.nextToken()
+			exp.End = p.parseExpression(LOWEST)
+		}
+	}
 	if !p.advanceIfPeek(token.RBRACKET) {
 		return nil
 	}
@@ -582,16 +900,22 @@ func (p *Parser) parseIndexExpression(left ast.Expression) ast.Expression {
 
 func (p *Parser) parseAccessExpression(str ast.Expression) ast.Expression {
 	exp := &ast.AccessExpression{Token: p.curToken, Struct: str}
-	p.nextToken()
+	if !p.advanceIfPeek(token.ID) {
+		return nil
+	}
 	exp.Attribute = p.curToken.Literal
 
 	return exp
 }
 
+func (p *Parser) parseTryExpression(value ast.Expression) ast.Expression {
+	return &ast.TryExpression{Token: p.curToken, Value: value}
+}
+
 func (p *Parser) parseMapLiteral() ast.Expression {
 	hash := &ast.MapLiteral{
 		Token: p.curToken,
-		Type:  token.Token{Type: token.TYPE, Literal: "Map"},
+		Type:  ast.NewType("Map"),
 	}
 
 	hash.Pairs = make(map[ast.Expression]ast.Expression)
@@ -617,5 +941,728 @@ func (p *Parser) parseMapLiteral() ast.Expression {
 		return nil
 	}
 
+	keys := []ast.Expression{}
+	values := []ast.Expression{}
+	for key, value := range hash.Pairs {
+		keys = append(keys, key)
+		values = append(values, value)
+	}
+	hash.KeyType = commonType(keys)
+	hash.ValueType = commonType(values)
+	if hash.KeyType != nil && hash.ValueType != nil {
+		hash.Type = ast.NewType("Map", hash.KeyType, hash.ValueType)
+	}
+
 	return hash
 }
+
+// the type shared by all expressions, nil when they differ or
+// are only known after type checking
+func commonType(exps []ast.Expression) *ast.TypeNode {
+	if len(exps) == 0 || exps[0] == nil {
+		return nil
+	}
+
+	name := exps[0].ReturnType()
+	for _, e := range exps[1:] {
+		if e == nil || e.ReturnType() != name {
+			return nil
+		}
+	}
+	return ast.NewType(name)
+}
+
+// parses a type annotation such as Int, List<Int>, Map<String, Int>
+// or Fn(Int, Int) -> Bool, curToken is the name of the type
+func (p *Parser) parseType() *ast.TypeNode {
+	t := &ast.TypeNode{Token: p.curToken, Name: p.curToken.Literal}
+
+	switch {
+	case t.IsFunction() && p.peekTokenIs(token.LPAREN):
+		p.nextToken()
+		t.Parameters = p.parseTypeList(token.RPAREN)
+		if t.Parameters == nil {
+			return nil
+		}
+
+		t.Return = ast.NewType("Void")
+		if p.peekTokenIs(token.ARROW) {
+			p.nextToken()
+			if !p.advanceIfPeekType() {
+				return nil
+			}
+			t.Return = p.parseType()
+			if t.Return == nil {
+				return nil
+			}
+		}
+	case p.peekTokenIs(token.LT):
+		p.nextToken()
+		t.Parameters = p.parseTypeList(token.GT)
+		if t.Parameters == nil {
+			return nil
+		}
+
+		expected := typeParameters[t.Name]
+		if len(t.Parameters) != expected {
+			p.report(diagnostic.TypeParameters, t.Token, "type %s expects %d type parameters, got %d",
+				t.Name, expected, len(t.Parameters))
+			return nil
+		}
+	}
+
+	return t
+}
+
+// number of type parameters of the parameterized types
+var typeParameters = map[string]int{
+	"List":     1,
+	"Map":      2,
+	"Option":   1,
+	"Result":   2,
+	"Iterator": 1,
+}
+
+func (p *Parser) parseTypeList(end token.TokenType) []*ast.TypeNode {
+	list := []*ast.TypeNode{}
+
+	if p.peekTokenIs(end) {
+		p.nextToken()
+		return list
+	}
+
+	for {
+		if !p.advanceIfPeekType() {
+			return nil
+		}
+
+		t := p.parseType()
+		if t == nil {
+			return nil
+		}
+		list = append(list, t)
+
+		if !p.peekTokenIs(token.COMMA) {
+			break
+		}
+		p.nextToken()
+	}
+
+	if !p.advanceIfPeek(end) {
+		return nil
+	}
+	return list
+}
+
+func (p *Parser) parseStructStatement() *ast.StructStatement {
+	stmt := &ast.StructStatement{Token: p.curToken}
+
+	if !p.advanceIfPeek(token.ID) {
+		return nil
+	}
+
+	stmt.Name = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+	if !isStructName(stmt.Name.Value) {
+		p.lowercaseName("struct", p.curToken)
+		return nil
+	}
+
+	if !p.advanceIfPeek(token.LBRACE) {
+		return nil
+	}
+
+	stmt.Fields = []*ast.Identifier{}
+	for !p.peekTokenIs(token.RBRACE) {
+		if !p.advanceIfPeek(token.ID) {
+			return nil
+		}
+
+		field := p.parseParameter()
+		if field == nil {
+			return nil
+		}
+		stmt.Fields = append(stmt.Fields, field)
+
+		if !p.peekTokenIs(token.RBRACE) && !p.advanceIfPeek(token.COMMA) {
+			return nil
+		}
+	}
+	p.nextToken()
+
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+
+	return stmt
+}
+
+func (p *Parser) parseImplStatement() *ast.ImplStatement {
+	stmt := &ast.ImplStatement{Token: p.curToken}
+
+	if !p.advanceIfPeek(token.ID) {
+		return nil
+	}
+
+	stmt.Name = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+
+	if !p.advanceIfPeek(token.LBRACE) {
+		return nil
+	}
+
+	p.receiver = stmt.Name.Value
+	defer func() { p.receiver = "" }()
+
+	stmt.Methods = []*ast.Function{}
+	for !p.peekTokenIs(token.RBRACE) {
+		if !p.advanceIfPeek(token.FUNC) {
+			return nil
+		}
+
+		if !p.peekTokenIs(token.ID) {
+			p.setPeekError(token.ID)
+			return nil
+		}
+
+		method, ok := p.parseFunctionDefinition().(*ast.Function)
+		if !ok {
+			return nil
+		}
+		stmt.Methods = append(stmt.Methods, method)
+
+		if p.peekTokenIs(token.SEMICOLON) {
+			p.nextToken()
+		}
+	}
+	p.nextToken()
+
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+
+	return stmt
+}
+
+func (p *Parser) parseStructLiteral(name *ast.Identifier) ast.Expression {
+	lit := &ast.StructLiteral{
+		Token:  name.Token,
+		Type:   ast.NewType(name.Value),
+		Name:   name,
+		Fields: []*ast.Identifier{},
+		Values: []ast.Expression{},
+	}
+
+	p.nextToken()
+
+	for !p.peekTokenIs(token.RBRACE) {
+		if !p.advanceIfPeek(token.ID) {
+			return nil
+		}
+
+		field := &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+
+		if !p.advanceIfPeek(token.COLON) {
+			return nil
+		}
+
+		p.nextToken()
+		lit.Fields = append(lit.Fields, field)
+		lit.Values = append(lit.Values, p.parseExpression(LOWEST))
+
+		if !p.peekTokenIs(token.RBRACE) && !p.advanceIfPeek(token.COMMA) {
+			return nil
+		}
+	}
+	p.nextToken()
+
+	return lit
+}
+
+func (p *Parser) parseEnumStatement() *ast.EnumStatement {
+	stmt := &ast.EnumStatement{Token: p.curToken}
+
+	if !p.advanceIfPeek(token.ID) {
+		return nil
+	}
+
+	stmt.Name = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+	if !isStructName(stmt.Name.Value) {
+		p.lowercaseName("enum", p.curToken)
+		return nil
+	}
+
+	if !p.advanceIfPeek(token.LBRACE) {
+		return nil
+	}
+
+	stmt.Variants = []*ast.Variant{}
+	declared := map[string]bool{}
+	for !p.peekTokenIs(token.RBRACE) {
+		if !p.advanceIfPeek(token.ID) {
+			return nil
+		}
+
+		variant := &ast.Variant{
+			Name:   &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal},
+			Fields: []*ast.TypeNode{},
+		}
+		if declared[variant.Name.Value] {
+			p.report(diagnostic.DuplicateVariant, p.curToken, "variant %s of %s is declared twice",
+				variant.Name.Value, stmt.Name.Value)
+			return nil
+		}
+		declared[variant.Name.Value] = true
+
+		if p.peekTokenIs(token.LPAREN) {
+			p.nextToken()
+			variant.Fields = p.parseTypeList(token.RPAREN)
+			if variant.Fields == nil {
+				return nil
+			}
+		}
+		stmt.Variants = append(stmt.Variants, variant)
+
+		if !p.peekTokenIs(token.RBRACE) && !p.advanceIfPeek(token.COMMA) {
+			return nil
+		}
+	}
+	p.nextToken()
+
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+
+	return stmt
+}
+
+func (p *Parser) parseMatchExpression() ast.Expression {
+	exp := &ast.MatchExpression{Token: p.curToken}
+
+	p.nextToken()
+	p.noStructLiteral = true
+	exp.Subject = p.parseExpression(LOWEST)
+	p.noStructLiteral = false
+	if isBad(exp.Subject) {
+		return nil
+	}
+
+	if !p.advanceIfPeek(token.LBRACE) {
+		return nil
+	}
+
+	exp.Arms = []*ast.MatchArm{}
+	for !p.peekTokenIs(token.RBRACE) {
+		p.nextToken()
+		arm := p.parseMatchArm()
+		if arm == nil {
+			return nil
+		}
+		exp.Arms = append(exp.Arms, arm)
+
+		// a comma is optional after a block
+		if p.curTokenIs(token.RBRACE) && !p.peekTokenIs(token.COMMA) {
+			continue
+		}
+		if !p.peekTokenIs(token.RBRACE) && !p.advanceIfPeek(token.COMMA) {
+			return nil
+		}
+	}
+	p.nextToken()
+
+	return exp
+}
+
+// parses `pattern if guard => body`, curToken is the start of the pattern
+func (p *Parser) parseMatchArm() *ast.MatchArm {
+	arm := &ast.MatchArm{Token: p.curToken}
+
+	arm.Pattern = p.parsePattern()
+	if arm.Pattern == nil {
+		return nil
+	}
+
+	if p.peekTokenIs(token.IF) {
+		p.nextToken()
+		p.nextToken()
+		arm.Guard = p.parseExpression(LOWEST)
+		if isBad(arm.Guard) {
+			return nil
+		}
+	}
+
+	if !p.advanceIfPeek(token.FATARROW) {
+		return nil
+	}
+
+	p.nextToken()
+	if p.curTokenIs(token.LBRACE) {
+		arm.Body = p.parseBlockStatement()
+		return arm
+	}
+
+	body := &ast.ExpressionStatement{Token: p.curToken, Expression: p.parseExpression(LOWEST)}
+	if isBad(body.Expression) {
+		return nil
+	}
+	arm.Body = &ast.BlockStatement{Token: body.Token, Statements: []ast.Statement{body}}
+	return arm
+}
+
+func (p *Parser) parsePattern() ast.Pattern {
+	switch p.curToken.Type {
+	case token.ID:
+		ident := &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+		if ident.Value == "_" {
+			return &ast.WildcardPattern{Token: p.curToken}
+		}
+		if p.peekTokenIs(token.PATH) {
+			return p.parseVariantPattern(ident)
+		}
+		if enum, ok := preludeVariants[ident.Value]; ok {
+			pattern := &ast.VariantPattern{
+				Token:   p.curToken,
+				Enum:    &ast.Identifier{Token: p.curToken, Value: enum},
+				Variant: ident,
+				Fields:  []ast.Pattern{},
+				Prelude: true,
+			}
+			return p.parseVariantFields(pattern)
+		}
+		return &ast.BindingPattern{Token: p.curToken, Name: ident}
+	case token.INT, token.FLOAT, token.STRING, token.TRUE, token.FALSE:
+		return &ast.LiteralPattern{Token: p.curToken, Value: p.prefixParseFn[p.curToken.Type]()}
+	case token.MINUS:
+		if !p.peekTokenIs(token.INT) && !p.peekTokenIs(token.FLOAT) {
+			p.setPeekError(token.INT)
+			return nil
+		}
+		return &ast.LiteralPattern{Token: p.curToken, Value: p.parsePrefixExpression()}
+	case token.LBRACKET:
+		return p.parseListPattern()
+	default:
+		if p.curTokenIs(token.EOF) {
+			p.curToken.Literal = "EOF"
+		}
+		p.report(diagnostic.ExpectedPattern, p.curToken, "expected a pattern, got %s", p.curToken.Literal)
+		return nil
+	}
+}
+
+func (p *Parser) parseVariantPattern(enum *ast.Identifier) ast.Pattern {
+	pattern := &ast.VariantPattern{Token: p.curToken, Enum: enum, Fields: []ast.Pattern{}}
+
+	p.nextToken()
+	if !p.advanceIfPeek(token.ID) {
+		return nil
+	}
+	pattern.Variant = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+
+	return p.parseVariantFields(pattern)
+}
+
+// the payload of a variant pattern, curToken is the name of the variant
+func (p *Parser) parseVariantFields(pattern *ast.VariantPattern) ast.Pattern {
+	if !p.peekTokenIs(token.LPAREN) {
+		return pattern
+	}
+	p.nextToken()
+
+	for !p.peekTokenIs(token.RPAREN) {
+		p.nextToken()
+		field := p.parsePattern()
+		if field == nil {
+			return nil
+		}
+		pattern.Fields = append(pattern.Fields, field)
+
+		if !p.peekTokenIs(token.RPAREN) && !p.advanceIfPeek(token.COMMA) {
+			return nil
+		}
+	}
+	p.nextToken()
+
+	return pattern
+}
+
+// variants of the builtin enums, which patterns name without the enum
+var preludeVariants = map[string]string{
+	"Some": "Option",
+	"None": "Option",
+	"Ok":   "Result",
+	"Err":  "Result",
+}
+
+func (p *Parser) parseListPattern() ast.Pattern {
+	pattern := &ast.ListPattern{Token: p.curToken, Elements: []ast.Pattern{}}
+
+	for !p.peekTokenIs(token.RBRACKET) {
+		p.nextToken()
+
+		// the rest of the list, only allowed last
+		if p.curTokenIs(token.DOTDOT) {
+			pattern.HasRest = true
+			if p.peekTokenIs(token.ID) {
+				p.nextToken()
+				pattern.Rest = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+			}
+			if !p.advanceIfPeek(token.RBRACKET) {
+				return nil
+			}
+			return pattern
+		}
+
+		element := p.parsePattern()
+		if element == nil {
+			return nil
+		}
+		pattern.Elements = append(pattern.Elements, element)
+
+		if !p.peekTokenIs(token.RBRACKET) && !p.advanceIfPeek(token.COMMA) {
+			return nil
+		}
+	}
+	p.nextToken()
+
+	return pattern
+}
+
+// parses the body of a loop of the given kind, curToken is the {
+func (p *Parser) parseLoopBody(kind token.TokenType) *ast.BlockStatement {
+	p.loops = append(p.loops, kind)
+	defer func() { p.loops = p.loops[:len(p.loops)-1] }()
+
+	return p.parseBlockStatement()
+}
+
+func (p *Parser) parseWhileStatement() *ast.WhileStatement {
+	stmt := &ast.WhileStatement{Token: p.curToken}
+
+	if !p.advanceIfPeek(token.LPAREN) {
+		return nil
+	}
+
+	p.nextToken()
+	stmt.Condition = p.parseExpression(LOWEST)
+
+	if !p.advanceIfPeek(token.RPAREN) {
+		return nil
+	}
+
+	if !p.advanceIfPeek(token.LBRACE) {
+		return nil
+	}
+
+	stmt.Body = p.parseLoopBody(token.WHILE)
+	return stmt
+}
+
+func (p *Parser) parseForStatement() *ast.ForStatement {
+	stmt := &ast.ForStatement{Token: p.curToken}
+
+	for {
+		if !p.advanceIfPeek(token.ID) {
+			return nil
+		}
+		stmt.Variables = append(stmt.Variables, &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal})
+
+		if len(stmt.Variables) == 2 || !p.peekTokenIs(token.COMMA) {
+			break
+		}
+		p.nextToken()
+	}
+
+	if !p.advanceIfPeek(token.IN) {
+		return nil
+	}
+
+	p.nextToken()
+	p.noStructLiteral = true
+	stmt.Iterable = p.parseExpression(LOWEST)
+	p.noStructLiteral = false
+	if isBad(stmt.Iterable) {
+		return nil
+	}
+
+	if !p.advanceIfPeek(token.LBRACE) {
+		return nil
+	}
+
+	stmt.Body = p.parseLoopBody(token.FOR)
+	return stmt
+}
+
+func (p *Parser) parseLoopExpression() ast.Expression {
+	exp := &ast.LoopExpression{Token: p.curToken}
+
+	if !p.advanceIfPeek(token.LBRACE) {
+		return nil
+	}
+
+	exp.Body = p.parseLoopBody(token.LOOP)
+	return exp
+}
+
+func (p *Parser) parseBreakStatement() *ast.BreakStatement {
+	stmt := &ast.BreakStatement{Token: p.curToken}
+
+	if len(p.loops) == 0 {
+		p.report(diagnostic.OutsideLoop, stmt.Token, "break outside of a loop")
+		return nil
+	}
+
+	if !p.peekTokenIs(token.SEMICOLON) && !p.peekTokenIs(token.RBRACE) {
+		if p.loops[len(p.loops)-1] != token.LOOP {
+			p.report(diagnostic.BreakValueOutsideLoop, stmt.Token, "break with a value is only allowed inside loop")
+			return nil
+		}
+
+		p.nextToken()
+		stmt.Value = p.parseExpression(LOWEST)
+	}
+
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+
+	return stmt
+}
+
+func (p *Parser) parseTestStatement() *ast.TestStatement {
+	stmt := &ast.TestStatement{Token: p.curToken}
+
+	if p.depth > 0 {
+		p.report(diagnostic.NestedTest, stmt.Token, "test blocks are only allowed at the top level")
+		return nil
+	}
+
+	p.nextToken()
+	stmt.Name = p.curToken.Literal
+
+	if !p.advanceIfPeek(token.LBRACE) {
+		return nil
+	}
+
+	stmt.Body = p.parseFunctionBody()
+	return stmt
+}
+
+func (p *Parser) parseUseStatement() *ast.UseStatement {
+	stmt := &ast.UseStatement{Token: p.curToken}
+
+	if p.depth > 0 {
+		p.report(diagnostic.NestedDeclaration, stmt.Token, "%s is only allowed at the top level", stmt.Token.Literal)
+		return nil
+	}
+
+	if stmt.Token.Type == token.IMPORT {
+		if !p.advanceIfPeek(token.STRING) {
+			return nil
+		}
+		stmt.Path = p.curToken.Literal
+		// import "lib/strings.mist" is named strings
+		name := path.Base(stmt.Path)
+		name = strings.TrimSuffix(name, path.Ext(name))
+		stmt.Name = &ast.Identifier{Token: p.curToken, Value: name}
+	} else {
+		parts := []string{}
+		for {
+			if !p.advanceIfPeek(token.ID) {
+				return nil
+			}
+			parts = append(parts, p.curToken.Literal)
+			if !p.peekTokenIs(token.PATH) {
+				break
+			}
+			p.nextToken()
+		}
+		stmt.Path = strings.Join(parts, "::")
+		stmt.Name = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+	}
+
+	if p.peekTokenIs(token.AS) {
+		p.nextToken()
+		if !p.advanceIfPeek(token.ID) {
+			return nil
+		}
+		stmt.Name = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+		stmt.Alias = true
+	} else if !isIdentifier(stmt.Name.Value) {
+		p.report(diagnostic.InvalidModuleName, p.curToken, "%s is not a valid module name, name it with as", stmt.Name.Value)
+		return nil
+	}
+
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+	return stmt
+}
+
+// a module name is written like an identifier
+func isIdentifier(name string) bool {
+	if name == "" {
+		return false
+	}
+	for i, c := range name {
+		if c != '_' && !unicode.IsLetter(c) && (i == 0 || !unicode.IsDigit(c)) {
+			return false
+		}
+	}
+	return token.LookupIdentifier(name) == token.ID
+}
+
+// pub in front of a top level fn, struct, enum or let exports it from
+// its module
+func (p *Parser) parsePubStatement() ast.Statement {
+	tok := p.curToken
+	if p.depth > 0 {
+		p.report(diagnostic.NestedDeclaration, tok, "pub is only allowed at the top level")
+		return nil
+	}
+
+	switch p.peekToken.Type {
+	case token.FUNC, token.STRUCT, token.ENUM, token.LET:
+	default:
+		if p.peekTokenIs(token.EOF) {
+			p.peekToken.Literal = "EOF"
+		}
+		p.report(diagnostic.ExpectedDeclaration, p.peekToken, "expected fn, struct, enum or let after pub, got %s", p.peekToken.Literal)
+		return nil
+	}
+	p.nextToken()
+
+	switch stmt := p.parseStatement().(type) {
+	case *ast.LetStatement:
+		stmt.Public = true
+		return stmt
+	case *ast.StructStatement:
+		stmt.Public = true
+		return stmt
+	case *ast.EnumStatement:
+		stmt.Public = true
+		return stmt
+	case *ast.ExpressionStatement:
+		fn, ok := stmt.Expression.(*ast.Function)
+		if !ok {
+			p.report(diagnostic.ExpectedDeclaration, tok, "pub functions must have a name")
+			return nil
+		}
+		fn.Public = true
+		return stmt
+	default:
+		return nil
+	}
+}
+
+func (p *Parser) parseContinueStatement() *ast.ContinueStatement {
+	stmt := &ast.ContinueStatement{Token: p.curToken}
+
+	if len(p.loops) == 0 {
+		p.report(diagnostic.OutsideLoop, stmt.Token, "continue outside of a loop")
+		return nil
+	}
+
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+
+	return stmt
+}
@@ -2,7 +2,11 @@ package parser
 
 import (
 	"lang/ast"
+	"lang/diagnostic"
 	"lang/lexer"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 )
 
@@ -32,6 +36,15 @@ func TestLetStatement(t *testing.T) {
 		{code: "let y: Float = .75;", id: "y", expression: ".75", typeLiteral: "Float"},
 		{code: "let z: Float = y;", id: "z", expression: "y", typeLiteral: "Float"},
 		{code: "let a: Func = b;", id: "a", expression: "b", typeLiteral: "Func"},
+		{code: "let xs: List<Int> = ys;", id: "xs", expression: "ys", typeLiteral: "List<Int>"},
+		{
+			code:        "let m: Map<String, List<Float>> = n;",
+			id:          "m",
+			expression:  "n",
+			typeLiteral: "Map<String, List<Float>>",
+		},
+		{code: "let f: Fn(Int, Int) -> Bool = g;", id: "f", expression: "g", typeLiteral: "Fn(Int, Int) -> Bool"},
+		{code: "let h: Fn() = g;", id: "h", expression: "g", typeLiteral: "Fn() -> Void"},
 	}
 
 	for i, test := range tests {
@@ -348,6 +361,11 @@ func TestOperatorPrecedence(t *testing.T) {
 		{code: "5 || add(3,4) * 5", expected: "(5 || (add(3, 4) * 5))"},
 		{code: "5 <= 3 >= 4", expected: "((5 <= 3) >= 4)"},
 		{code: "(3 + 5) * 4 != 3 * 1 + 24", expected: "(((3 + 5) * 4) != ((3 * 1) + 24))"},
+		{code: "s[1:n + 1]", expected: "(s[1:(n + 1)])"},
+		{code: "s[:2] + s[2:] + s[:]", expected: "(((s[:2]) + (s[2:])) + (s[:]))"},
+		{code: "0..n + 1", expected: "(0..(n + 1))"},
+		{code: "x - 1..=y * 2", expected: "((x - 1)..=(y * 2))"},
+		{code: "(0..10).step(2)", expected: "(0..10).step(2)"},
 	}
 
 	for i, test := range tests {
@@ -490,6 +508,12 @@ func TestFunctionLiteral(t *testing.T) {
 			expectedParameters: []string{"x: Float", "y: Float"},
 			expectedReturnType: "Float",
 		},
+		{
+			code:               "fn(xs:List<Int>,f:Fn(Int)->Bool) List<Int> {xs.filter(f)}",
+			expectedBody:       "xs.filter(f)",
+			expectedParameters: []string{"xs: List<Int>", "f: Fn(Int) -> Bool"},
+			expectedReturnType: "List<Int>",
+		},
 	}
 
 	for i, test := range tests {
@@ -687,3 +711,552 @@ func TestMapLiter(t *testing.T) {
 		}
 	}
 }
+
+func TestTypeAnnotationErrors(t *testing.T) {
+	tests := []struct {
+		code     string
+		expected string
+	}{
+		{code: "let x: List<Int, Int> = y;", expected: "[1,8] type List expects 1 type parameters, got 2"},
+		{code: "let x: Map<String> = y;", expected: "[1,8] type Map expects 2 type parameters, got 1"},
+		{code: "let x: Int<Int> = y;", expected: "[1,8] type Int expects 0 type parameters, got 1"},
+		{code: "let x: List<Int = y;", expected: "[1,13] expected next token to be >, got ="},
+		{code: "let f: Fn(Int) -> = g;", expected: "[1,16] expected next token to be TYPE, got ="},
+	}
+
+	for i, test := range tests {
+		l := lexer.NewLexer(test.code)
+		p := NewParser(l)
+		p.Parse()
+
+		errors := p.Errors()
+		if len(errors) == 0 {
+			t.Errorf("case %d: expected error %s, got none", i, test.expected)
+			continue
+		}
+
+		if errors[0] != test.expected {
+			t.Errorf("case %d: expected error %s, got=%s", i, test.expected, errors[0])
+		}
+	}
+}
+
+func TestMapLiteralTypes(t *testing.T) {
+	tests := []struct {
+		code     string
+		expected string
+	}{
+		{code: `{"one": 1, "two": 2}`, expected: "Map<String, Int>"},
+		{code: `{"one": 1, "two": 2.0}`, expected: "Map"},
+		{code: `{"one": x}`, expected: "Map"},
+	}
+
+	for i, test := range tests {
+		l := lexer.NewLexer(test.code)
+		p := NewParser(l)
+
+		program := p.Parse()
+		checkParserErrors(i, t, p)
+
+		stmt := program.Statements[0].(*ast.ExpressionStatement)
+		mapLiteral, ok := stmt.Expression.(*ast.MapLiteral)
+		if !ok {
+			t.Fatalf("case %d: expression not *ast.MapLiteral, got=%T", i, stmt.Expression)
+		}
+
+		if mapLiteral.ReturnType() != test.expected {
+			t.Errorf("case %d: expected type %s, got=%s", i, test.expected, mapLiteral.ReturnType())
+		}
+	}
+}
+
+func TestStructs(t *testing.T) {
+	tests := []struct {
+		code     string
+		expected string
+	}{
+		{code: "struct Point { x: Int, y: Int }", expected: "struct Point { x: Int, y: Int }"},
+		{code: "struct Pair { first: List<Int>, second: Point, }", expected: "struct Pair { first: List<Int>, second: Point }"},
+		{
+			code:     "impl Point { fn norm(self) Float { self.x } fn origin() Point { Point { x: 0, y: 0 } } }",
+			expected: "impl Point { fn norm(self) Float self.x fn origin() Point Point { x: 0, y: 0 } }",
+		},
+		{code: "let p: Point = Point { x: 1, y: 2 };", expected: "let p: Point = Point { x: 1, y: 2 };"},
+		{code: "fn f(p: Point) Point { p }", expected: "fn f(p: Point) Point p"},
+	}
+
+	for i, test := range tests {
+		l := lexer.NewLexer(test.code)
+		p := NewParser(l)
+
+		program := p.Parse()
+		checkParserErrors(i, t, p)
+
+		if program.String() != test.expected {
+			t.Errorf("case %d: expected %s, got=%s", i, test.expected, program.String())
+		}
+	}
+}
+
+func TestStructErrors(t *testing.T) {
+	tests := []struct {
+		code     string
+		expected string
+	}{
+		{code: "struct point { x: Int }", expected: "[1,8] struct names must start with an uppercase letter, got point"},
+		{code: "struct Point { x }", expected: "[1,16] expected next token to be :, got }"},
+		{code: "impl Point { let x: Int = 1; }", expected: "[1,12] expected next token to be FUNC, got let"},
+		{code: "fn f(self) Int { 1 }", expected: "[1,6] expected next token to be :, got )"},
+		{code: "Point { x 1 }", expected: "[1,9] expected next token to be :, got 1"},
+	}
+
+	for i, test := range tests {
+		l := lexer.NewLexer(test.code)
+		p := NewParser(l)
+		p.Parse()
+
+		errors := p.Errors()
+		if len(errors) == 0 {
+			t.Errorf("case %d: expected error %s, got none", i, test.expected)
+			continue
+		}
+
+		if errors[0] != test.expected {
+			t.Errorf("case %d: expected error %s, got=%s", i, test.expected, errors[0])
+		}
+	}
+}
+
+func TestEnumsAndMatch(t *testing.T) {
+	tests := []struct {
+		code     string
+		expected string
+	}{
+		{code: "enum Shape { Circle(Float), Rect(Float, Float), Empty }", expected: "enum Shape { Circle(Float), Rect(Float, Float), Empty }"},
+		{code: "enum Tree { Leaf, Node(List<Tree>), }", expected: "enum Tree { Leaf, Node(List<Tree>) }"},
+		{code: "Shape::Circle(1.5)", expected: "Shape::Circle(1.5)"},
+		{code: "match x { 1 => a, _ => b }", expected: "match x { 1 => a, _ => b }"},
+		{code: `match x { -1 => a, "s" => b, true => c }`, expected: `match x { (-1) => a, "s" => b, true => c }`},
+		{code: "match x { n if n > 0 => n }", expected: "match x { n if (n > 0) => n }"},
+		{code: "match xs { [] => 0, [a, ..rest] => a, [a, ..] => a }", expected: "match xs { [] => 0, [a, ..rest] => a, [a, ..] => a }"},
+		{code: "match s { Shape::Rect(w, _) => w, Shape::Empty => 0 }", expected: "match s { Shape::Rect(w, _) => w, Shape::Empty => 0 }"},
+		{code: "match s { _ => { let a: Int = 1; a } x => x }", expected: "match s { _ => let a: Int = 1;a, x => x }"},
+		// a capitalized subject is not a struct literal
+		{code: "match Empty { _ => 1 }", expected: "match Empty { _ => 1 }"},
+	}
+
+	for i, test := range tests {
+		l := lexer.NewLexer(test.code)
+		p := NewParser(l)
+
+		program := p.Parse()
+		checkParserErrors(i, t, p)
+
+		if program.String() != test.expected {
+			t.Errorf("case %d: expected %s, got=%s", i, test.expected, program.String())
+		}
+	}
+}
+
+func TestEnumAndMatchErrors(t *testing.T) {
+	tests := []struct {
+		code     string
+		expected string
+	}{
+		{code: "enum shape { A }", expected: "[1,6] enum names must start with an uppercase letter, got shape"},
+		{code: "enum Shape { A, A(Int) }", expected: "[1,17] variant A of Shape is declared twice"},
+		{code: "match x { 1 + 2 => 3 }", expected: "[1,11] expected next token to be =>, got +"},
+		{code: "match x { fn => 3 }", expected: "[1,11] expected a pattern, got fn"},
+		{code: "match x {", expected: "[1,10] expected a pattern, got EOF"},
+		{code: "match x { [a, ..rest, b] => 3 }", expected: "[1,17] expected next token to be ], got ,"},
+		{code: "match x { 1 => 2 3 => 4 }", expected: "[1,16] expected next token to be ,, got 3"},
+	}
+
+	for i, test := range tests {
+		l := lexer.NewLexer(test.code)
+		p := NewParser(l)
+		p.Parse()
+
+		errors := p.Errors()
+		if len(errors) == 0 {
+			t.Errorf("case %d: expected error %s, got none", i, test.expected)
+			continue
+		}
+
+		if errors[0] != test.expected {
+			t.Errorf("case %d: expected error %s, got=%s", i, test.expected, errors[0])
+		}
+	}
+}
+
+func TestLoops(t *testing.T) {
+	tests := []struct {
+		code     string
+		expected string
+	}{
+		{code: "while (x < 3) { x; }", expected: "while (x < 3) { x }"},
+		{code: "for x in xs { continue; }", expected: "for x in xs { continue; }"},
+		{code: "for i, c in \"ab\" { c }", expected: "for i, c in ab { c }"},
+		{code: "let n: Int = loop { break 1; };", expected: "let n: Int = loop { break 1; };"},
+		{code: "loop { if (x) { break; } }", expected: "loop { ifx break; }"},
+		{code: "while (true) { loop { break 2; }; continue; }", expected: "while true { loop { break 2; }continue; }"},
+		// a capitalized iterable is not a struct literal
+		{code: "for x in Xs { x }", expected: "for x in Xs { x }"},
+	}
+
+	for i, test := range tests {
+		l := lexer.NewLexer(test.code)
+		p := NewParser(l)
+
+		program := p.Parse()
+		checkParserErrors(i, t, p)
+
+		if program.String() != test.expected {
+			t.Errorf("case %d: expected %s, got=%s", i, test.expected, program.String())
+		}
+	}
+}
+
+func TestLoopErrors(t *testing.T) {
+	tests := []struct {
+		code     string
+		expected string
+	}{
+		{code: "break;", expected: "[1,1] break outside of a loop"},
+		{code: "fn f() { continue; }", expected: "[1,10] continue outside of a loop"},
+		{code: "loop { fn() { break; }; }", expected: "[1,15] break outside of a loop"},
+		{code: "while (true) { break 1; }", expected: "[1,16] break with a value is only allowed inside loop"},
+		{code: "for x, y, z in xs { }", expected: "[1,8] expected next token to be IN, got ,"},
+	}
+
+	for i, test := range tests {
+		l := lexer.NewLexer(test.code)
+		p := NewParser(l)
+		p.Parse()
+
+		errors := p.Errors()
+		if len(errors) == 0 {
+			t.Errorf("case %d: expected error %s, got none", i, test.expected)
+			continue
+		}
+
+		if errors[0] != test.expected {
+			t.Errorf("case %d: expected error %s, got=%s", i, test.expected, errors[0])
+		}
+	}
+}
+
+func TestTestStatements(t *testing.T) {
+	tests := []struct {
+		code     string
+		expected string
+	}{
+		{code: `test "adds" { assert_eq(1 + 1, 2); }`, expected: `test "adds" { assert_eq((1 + 1), 2) }`},
+		{code: `test "empty one" { }`, expected: `test "empty one" {  }`},
+		// test is a keyword only before a name
+		{code: "let test: Int = 1; test + 1", expected: "let test: Int = 1;(test + 1)"},
+	}
+
+	for i, test := range tests {
+		l := lexer.NewLexer(test.code)
+		p := NewParser(l)
+
+		program := p.Parse()
+		checkParserErrors(i, t, p)
+
+		if program.String() != test.expected {
+			t.Errorf("case %d: expected %s, got=%s", i, test.expected, program.String())
+		}
+	}
+
+	errors := []struct {
+		code     string
+		expected string
+	}{
+		{code: `fn f() { test "inner" { } }`, expected: "[1,10] test blocks are only allowed at the top level"},
+		{code: `test "a" { test "b" { } }`, expected: "[1,12] test blocks are only allowed at the top level"},
+		{code: `test "a" 1`, expected: "[1,8] expected next token to be {, got 1"},
+		{code: `while (true) { test "a" { break; } }`, expected: "[1,16] test blocks are only allowed at the top level"},
+	}
+
+	for i, test := range errors {
+		p := NewParser(lexer.NewLexer(test.code))
+		p.Parse()
+
+		errors := p.Errors()
+		if len(errors) == 0 {
+			t.Errorf("case %d: expected error %s, got none", i, test.expected)
+			continue
+		}
+
+		if errors[0] != test.expected {
+			t.Errorf("case %d: expected error %s, got=%s", i, test.expected, errors[0])
+		}
+	}
+}
+
+func TestModules(t *testing.T) {
+	tests := []struct {
+		code     string
+		expected string
+	}{
+		{code: "use utils::math;", expected: "use utils::math;"},
+		{code: "use math", expected: "use math;"},
+		{code: "use utils::math as m;", expected: "use utils::math as m;"},
+		{code: `import "lib/strings.mist";`, expected: `import "lib/strings.mist";`},
+		{code: `import "lib/string-utils.mist" as strings;`, expected: `import "lib/string-utils.mist" as strings;`},
+		{code: "pub fn f() Int { 1 }", expected: "pub fn f() Int 1"},
+		{code: "pub let x: Int = 1;", expected: "pub let x: Int = 1;"},
+		{code: "pub struct Point { x: Int }", expected: "pub struct Point { x: Int }"},
+		{code: "pub enum Shape { Dot }", expected: "pub enum Shape { Dot }"},
+	}
+
+	for i, test := range tests {
+		p := NewParser(lexer.NewLexer(test.code))
+
+		program := p.Parse()
+		checkParserErrors(i, t, p)
+
+		if program.String() != test.expected {
+			t.Errorf("case %d: expected %s, got=%s", i, test.expected, program.String())
+		}
+	}
+
+	errors := []struct {
+		code     string
+		expected string
+	}{
+		{code: "fn f() { use math; }", expected: "[1,10] use is only allowed at the top level"},
+		{code: `import "lib/string-utils.mist";`, expected: "[1,10] string-utils is not a valid module name, name it with as"},
+		{code: "pub 1", expected: "[1,5] expected fn, struct, enum or let after pub, got 1"},
+		{code: "pub", expected: "[1,4] expected fn, struct, enum or let after pub, got EOF"},
+		{code: "pub fn () { }", expected: "[1,1] pub functions must have a name"},
+		{code: "fn f() { pub let x: Int = 1; }", expected: "[1,10] pub is only allowed at the top level"},
+	}
+
+	for i, test := range errors {
+		p := NewParser(lexer.NewLexer(test.code))
+		p.Parse()
+
+		errors := p.Errors()
+		if len(errors) == 0 {
+			t.Errorf("case %d: expected error %s, got none", i, test.expected)
+			continue
+		}
+
+		if errors[0] != test.expected {
+			t.Errorf("case %d: expected error %s, got=%s", i, test.expected, errors[0])
+		}
+	}
+}
+
+func TestAssignments(t *testing.T) {
+	tests := []struct {
+		code     string
+		expected string
+	}{
+		{code: "let mut x: Int = 1;", expected: "let mut x: Int = 1;"},
+		{code: "x = x + 1", expected: "x = (x + 1);"},
+		{code: "x += 1; x -= 2; x *= 3; x /= 4; x %= 5;", expected: "x += 1;x -= 2;x *= 3;x /= 4;x %= 5;"},
+		{code: `xs[0] = 1; m["a"][1] += 2;`, expected: `(xs[0]) = 1;((m[a])[1]) += 2;`},
+		{code: "fn f() { x = 1 }", expected: "fn f() Void x = 1;"},
+	}
+
+	for i, test := range tests {
+		l := lexer.NewLexer(test.code)
+		p := NewParser(l)
+
+		program := p.Parse()
+		checkParserErrors(i, t, p)
+
+		if program.String() != test.expected {
+			t.Errorf("case %d: expected %s, got=%s", i, test.expected, program.String())
+		}
+	}
+
+	errors := []struct {
+		code     string
+		expected string
+	}{
+		{code: "f() = 1;", expected: "[1,5] cannot assign to f()"},
+		{code: "x.y += 1;", expected: "[1,5] cannot assign to x.y"},
+		{code: "s[0:1] = \"a\";", expected: "[1,8] cannot assign to (s[0:1])"},
+		{code: "let mut: Int = 1;", expected: "[1,5] expected next token to be ID, got :"},
+	}
+
+	for i, test := range errors {
+		l := lexer.NewLexer(test.code)
+		p := NewParser(l)
+		p.Parse()
+
+		errors := p.Errors()
+		if len(errors) == 0 {
+			t.Errorf("case %d: expected error %s, got none", i, test.expected)
+			continue
+		}
+
+		if errors[0] != test.expected {
+			t.Errorf("case %d: expected error %s, got=%s", i, test.expected, errors[0])
+		}
+	}
+}
+
+func TestOptionsAndResults(t *testing.T) {
+	tests := []struct {
+		code     string
+		expected string
+	}{
+		{code: "f(x)?", expected: "(f(x)?)"},
+		{code: "-m.get(1)? + 2", expected: "((-(m.get(1)?)) + 2)"},
+		{code: "let x: Option<Int> = Some(1);", expected: "let x: Option<Int> = Some(1);"},
+		{code: "fn f() Result<Int, String> { Ok(1) }", expected: "fn f() Result<Int, String> Ok(1)"},
+		{code: "match o { Some(x) => x, None => 0 }", expected: "match o { Some(x) => x, None => 0 }"},
+		{code: "match r { Ok([a, ..]) => a, Err(e) => e }", expected: "match r { Ok([a, ..]) => a, Err(e) => e }"},
+		{code: "match o { Option::Some(x) => x }", expected: "match o { Option::Some(x) => x }"},
+	}
+
+	for i, test := range tests {
+		l := lexer.NewLexer(test.code)
+		p := NewParser(l)
+
+		program := p.Parse()
+		checkParserErrors(i, t, p)
+
+		if program.String() != test.expected {
+			t.Errorf("case %d: expected %s, got=%s", i, test.expected, program.String())
+		}
+	}
+
+	errors := []struct {
+		code     string
+		expected string
+	}{
+		{code: "let x: Option<Int, Int> = None;", expected: "[1,8] type Option expects 1 type parameters, got 2"},
+		{code: "let x: Result<Int> = Ok(1);", expected: "[1,8] type Result expects 2 type parameters, got 1"},
+	}
+
+	for i, test := range errors {
+		l := lexer.NewLexer(test.code)
+		p := NewParser(l)
+		p.Parse()
+
+		errors := p.Errors()
+		if len(errors) == 0 {
+			t.Errorf("case %d: expected error %s, got none", i, test.expected)
+			continue
+		}
+
+		if errors[0] != test.expected {
+			t.Errorf("case %d: expected error %s, got=%s", i, test.expected, errors[0])
+		}
+	}
+}
+
+func TestDiagnostics(t *testing.T) {
+	tests := []struct {
+		code string
+		name string
+		span diagnostic.Span
+		fix  string
+	}{
+		{"let x: Int = (1;", diagnostic.UnexpectedToken, diagnostic.SpanOf(1, 15, 1), ")"},
+		{"struct point { x: Int }", diagnostic.LowercaseName, diagnostic.SpanOf(1, 8, 5), "Point"},
+		{"enum shape { Circle }", diagnostic.LowercaseName, diagnostic.SpanOf(1, 6, 5), "Shape"},
+		{"fn f() Int { break; }", diagnostic.OutsideLoop, diagnostic.SpanOf(1, 14, 5), ""},
+		{"let x: Int = 99999999999999999999;", diagnostic.InvalidNumber, diagnostic.SpanOf(1, 14, 20), ""},
+		{"let x: Int = $;", diagnostic.UnexpectedCharacter, diagnostic.SpanOf(1, 14, 1), ""},
+	}
+
+	for i, test := range tests {
+		p := NewParser(lexer.NewLexer(test.code))
+		p.Parse()
+
+		diagnostics := p.Diagnostics()
+		if len(diagnostics) == 0 {
+			t.Errorf("case %d: expected a %s diagnostic, got none", i, test.name)
+			continue
+		}
+
+		d := diagnostics[0]
+		if d.Code != test.name || d.Span != test.span {
+			t.Errorf("case %d: expected %s at %v, got=%s at %v", i, test.name, test.span, d.Code, d.Span)
+		}
+		if test.fix == "" {
+			continue
+		}
+		if len(d.Fixes) != 1 || d.Fixes[0].Replacement != test.fix {
+			t.Errorf("case %d: expected a fix to %s, got=%v", i, test.fix, d.Fixes)
+		}
+	}
+}
+
+func TestRecovery(t *testing.T) {
+	tests := []struct {
+		code     string
+		expected []string
+		program  string
+	}{
+		{
+			code:     "let x: Int = ;\nlet y: Int = 2;\nlet z = 3;\nlet w: Int = 4;",
+			expected: []string{"[1,14] expected an expression, got ;", "[3,5] expected next token to be :, got ="},
+			program:  "<bad statement>let y: Int = 2;<bad statement>let w: Int = 4;",
+		},
+		{
+			code: "fn main() {\n  if (x { 1 }\n  let y Int = 2;\n  println(x + );\n}\nfn f() Int { 1 }",
+			expected: []string{
+				"[2,7] expected next token to be ), got {",
+				"[3,7] expected next token to be :, got Int",
+				"[4,15] expected an expression, got )",
+			},
+			program: "fn main() Void <bad statement><bad statement>println()fn f() Int 1",
+		},
+		{
+			code: "struct point { x: Int }\nenum E { A, A }\nmatch x { 1 => , 2 => 3 }\nlet a: Int = 1;",
+			expected: []string{
+				"[1,8] struct names must start with an uppercase letter, got point",
+				"[2,13] variant A of E is declared twice",
+				"[3,16] expected an expression, got ,",
+			},
+			program: "<bad statement><bad statement><bad statement>let a: Int = 1;",
+		},
+		{code: "x.;", expected: []string{"[1,2] expected next token to be ID, got ;"}, program: "<bad statement>"},
+		{code: "-", expected: []string{"[1,2] expected an expression, got EOF"}, program: "(-<bad expression>)"},
+		{code: "let x: Int = $;", expected: []string{"[1,14] unexpected character \"$\""}, program: "let x: Int = <bad expression>;"},
+		{code: "; let x: Int = 1;;", expected: []string{}, program: "let x: Int = 1;"},
+	}
+
+	for i, test := range tests {
+		p := NewParser(lexer.NewLexer(test.code))
+		program := p.Parse()
+
+		errors := p.Errors()
+		if strings.Join(errors, "\n") != strings.Join(test.expected, "\n") {
+			t.Errorf("case %d: expected errors %q, got=%q", i, test.expected, errors)
+		}
+		if program.String() != test.program {
+			t.Errorf("case %d: expected %s, got=%s", i, test.program, program.String())
+		}
+	}
+}
+
+// malformed programs are reported, never crash the parser
+func FuzzParse(f *testing.F) {
+	examples, _ := filepath.Glob("../examples/*.rs")
+	for _, example := range examples {
+		code, err := os.ReadFile(example)
+		if err != nil {
+			f.Fatal(err)
+		}
+		f.Add(string(code))
+	}
+	f.Add("fn main() { if (x { 1 } let y: Int = ; }")
+	f.Add("match x { Option::Some(1 => , [a, .. => }")
+	f.Add("impl P { fn }} struct { enum E { A(Int, } let mut")
+
+	f.Fuzz(func(t *testing.T, code string) {
+		p := NewParser(lexer.NewLexer(code))
+		program := p.Parse()
+		_ = program.String()
+		_ = p.Errors()
+	})
+}
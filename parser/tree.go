@@ -2,17 +2,18 @@ package parser
 
 import (
 	"fmt"
+	"io"
 	"lang/ast"
 
 	"github.com/m1gwings/treedrawer/tree"
 )
 
-func DrawTree(p *ast.Program) {
+func DrawTree(w io.Writer, p *ast.Program) {
 	t := tree.NewTree(tree.NodeString("Program"))
 	for _, stmt := range p.Statements {
 		drawStatement(stmt, t)
 	}
-	fmt.Println(t)
+	fmt.Fprintln(w, t)
 }
 
 func drawStatement(stmt ast.Statement, parent *tree.Tree) {
@@ -27,6 +28,32 @@ func drawStatement(stmt ast.Statement, parent *tree.Tree) {
 		drawBlockStatement(stmt, parent)
 	case *ast.ExpressionStatement:
 		drawExpression(stmt.Expression, parent)
+	case *ast.WhileStatement:
+		child := parent.AddChild(tree.NodeString(stmt.TokenLiteral()))
+		drawExpression(stmt.Condition, child)
+		drawBlockStatement(stmt.Body, child.AddChild(tree.NodeString("do")))
+	case *ast.ForStatement:
+		drawForStatement(stmt, parent)
+	case *ast.BreakStatement:
+		child := parent.AddChild(tree.NodeString(stmt.TokenLiteral()))
+		if stmt.Value != nil {
+			drawExpression(stmt.Value, child)
+		}
+	case *ast.ContinueStatement:
+		parent.AddChild(tree.NodeString(stmt.TokenLiteral()))
+	case *ast.UseStatement:
+		child := parent.AddChild(tree.NodeString(stmt.TokenLiteral()))
+		child.AddChild(tree.NodeString(stmt.Path))
+		if stmt.Alias {
+			child.AddChild(tree.NodeString("as " + stmt.Name.Value))
+		}
+	case *ast.TestStatement:
+		child := parent.AddChild(tree.NodeString("test \"" + stmt.Name + "\""))
+		drawBlockStatement(stmt.Body, child)
+	case *ast.AssignStatement:
+		child := parent.AddChild(tree.NodeString(stmt.TokenLiteral()))
+		drawExpression(stmt.Target, child)
+		drawExpression(stmt.Value, child)
 	}
 }
 
@@ -62,6 +89,14 @@ func drawExpression(exp ast.Expression, parent *tree.Tree) {
 		drawListLiteral(exp, child)
 	case *ast.AccessExpression:
 		drawAccessExpression(exp, parent)
+	case *ast.TryExpression:
+		child := parent.AddChild(tree.NodeString(exp.TokenLiteral()))
+		drawExpression(exp.Value, child)
+	case *ast.MatchExpression:
+		drawMatchExpression(exp, parent)
+	case *ast.LoopExpression:
+		child := parent.AddChild(tree.NodeString(exp.TokenLiteral()))
+		drawBlockStatement(exp.Body, child)
 	}
 }
 
@@ -155,3 +190,28 @@ func drawAccessExpression(exp *ast.AccessExpression, parent *tree.Tree) {
 	drawExpression(exp.Struct, parent)
 	parent.AddChild(tree.NodeString(exp.Attribute))
 }
+
+func drawMatchExpression(exp *ast.MatchExpression, parent *tree.Tree) {
+	child := parent.AddChild(tree.NodeString(exp.TokenLiteral()))
+	drawExpression(exp.Subject, child)
+	for _, arm := range exp.Arms {
+		label := arm.Pattern.String()
+		if arm.Guard != nil {
+			label += " if " + arm.Guard.String()
+		}
+		drawBlockStatement(arm.Body, child.AddChild(tree.NodeString(label)))
+	}
+}
+
+func drawForStatement(stmt *ast.ForStatement, parent *tree.Tree) {
+	child := parent.AddChild(tree.NodeString(stmt.TokenLiteral()))
+	names := ""
+	for i, v := range stmt.Variables {
+		if i > 0 {
+			names += ", "
+		}
+		names += v.Value
+	}
+	drawExpression(stmt.Iterable, child.AddChild(tree.NodeString(names+" in")))
+	drawBlockStatement(stmt.Body, child.AddChild(tree.NodeString("do")))
+}
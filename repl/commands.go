@@ -0,0 +1,115 @@
+package repl
+
+import (
+	"context"
+	"fmt"
+	"lang/ast"
+	"lang/eval"
+	"lang/lexer"
+	"lang/parser"
+	"os"
+	"strings"
+	"time"
+)
+
+const help = `:type expr   the type of expr, without evaluating it
+:env         the globals and their values
+:load file   evaluate a file, its definitions are kept
+:reset       forget every global
+:ast expr    the syntax tree of expr
+:time expr   evaluate expr and show how long it took
+:history     the inputs entered so far
+:help        this help
+:quit        leave the repl
+`
+
+// runs a meta-command, reports whether the repl goes on
+func (r *repl) command(line string) bool {
+	name, argument := line, ""
+	if i := strings.IndexAny(line, " \t"); i >= 0 {
+		name, argument = line[:i], strings.TrimSpace(line[i+1:])
+	}
+
+	switch name {
+	case ":quit", ":q", ":exit":
+		return false
+	case ":help", ":h":
+		fmt.Fprint(r.out, help)
+	case ":type", ":t":
+		r.typeOf(argument)
+	case ":env":
+		r.env()
+	case ":load":
+		r.load(argument)
+	case ":reset":
+		r.reset()
+	case ":ast":
+		r.ast(argument)
+	case ":time":
+		start := time.Now()
+		r.evaluate(argument)
+		fmt.Fprintf(r.out, "took %s\n", time.Since(start))
+	case ":history":
+		for i, input := range r.history.inputs {
+			fmt.Fprintf(r.out, "%4d  %s\n", i+1, strings.ReplaceAll(input, "\n", "\n      "))
+		}
+	default:
+		fmt.Fprintf(r.out, "unknown command %s, :help lists them\n", name)
+	}
+	return true
+}
+
+func (r *repl) typeOf(expression string) {
+	t, err := r.interpreter.Type(expression)
+	if err != nil {
+		r.failed(expression, err)
+		return
+	}
+	if t == nil {
+		fmt.Fprintln(r.out, "unknown until evaluated")
+		return
+	}
+	fmt.Fprintln(r.out, t.String())
+}
+
+func (r *repl) env() {
+	for _, name := range r.interpreter.Globals() {
+		value, ok := r.interpreter.Get(name)
+		if !ok {
+			continue
+		}
+		line := name
+		if t := eval.TypeOf(value); t != nil {
+			line += ": " + t.String()
+		}
+		fmt.Fprintf(r.out, "%s = %s\n", line, value.Inspect())
+	}
+}
+
+func (r *repl) load(file string) {
+	source, err := os.ReadFile(file)
+	if err != nil {
+		r.error(err)
+		return
+	}
+	if _, err := r.interpreter.Run(context.Background(), string(source)); err != nil {
+		r.failed(string(source), err)
+	}
+}
+
+func (r *repl) ast(expression string) {
+	p := parser.NewParser(lexer.NewLexer(expression))
+	program := p.Parse()
+	if len(p.Diagnostics()) != 0 {
+		r.diagnostics(expression, p.Diagnostics())
+		return
+	}
+	// a lone expression is shown without the program around it
+	if len(program.Statements) == 1 {
+		if statement, ok := program.Statements[0].(*ast.ExpressionStatement); ok {
+			fmt.Fprint(r.out, ast.Dump(statement.Expression))
+			return
+		}
+	}
+	fmt.Fprint(r.out, ast.Dump(program))
+}
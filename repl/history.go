@@ -0,0 +1,60 @@
+package repl
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strconv"
+)
+
+// inputs kept from the sessions before
+const maxHistory = 1000
+
+// the inputs entered in the repl, kept in a file across sessions. The
+// file has an input per line, quoted like a Go string since inputs may
+// span lines.
+type history struct {
+	inputs []string
+	file   *os.File
+}
+
+// reads the history in path and opens it to add the next inputs, no
+// path keeps the history of this session only
+func openHistory(path string) (*history, error) {
+	h := &history{}
+	if path == "" {
+		return h, nil
+	}
+
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return h, fmt.Errorf("no history: %s", err)
+	}
+	h.file = file
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(nil, 1<<20)
+	for scanner.Scan() {
+		// lines that aren't quoted are from something else, skip them
+		if input, err := strconv.Unquote(scanner.Text()); err == nil {
+			h.inputs = append(h.inputs, input)
+		}
+	}
+	if len(h.inputs) > maxHistory {
+		h.inputs = h.inputs[len(h.inputs)-maxHistory:]
+	}
+	return h, nil
+}
+
+func (h *history) add(input string) {
+	h.inputs = append(h.inputs, input)
+	if h.file != nil {
+		fmt.Fprintln(h.file, strconv.Quote(input))
+	}
+}
+
+func (h *history) close() {
+	if h.file != nil {
+		h.file.Close()
+	}
+}
@@ -2,13 +2,15 @@ package repl
 
 import (
 	"bufio"
+	"context"
 	"fmt"
 	"io"
-	"lang/eval"
+	"lang/diagnostic"
 	"lang/lexer"
-	"lang/object"
+	"lang/mist"
 	"lang/parser"
 	"lang/token"
+	"strings"
 )
 
 var Stage map[string]int64 = map[string]int64{
@@ -20,52 +22,175 @@ var Stage map[string]int64 = map[string]int64{
 
 const PROMPT = ">> "
 
-func Start(in io.Reader, out io.Writer, mode int64) {
+// the prompt of the lines after the first one of an input that isn't
+// complete yet, like a function spanning lines
+const CONTINUE = ".. "
+
+// Options configure a repl, the zero value lexes lines and keeps no
+// history
+type Options struct {
+	// how far the input goes, one of the values of Stage
+	Stage int64
+
+	// file the inputs are appended to, the ones it holds already are the
+	// history of the repl from the start. Empty keeps no history.
+	History string
+}
+
+type repl struct {
+	out         io.Writer
+	opts        Options
+	interpreter *mist.Interpreter
+	history     *history
+}
+
+// Start reads inputs from in until it ends or :quit, writing what they
+// give and the prompts to out
+func Start(in io.Reader, out io.Writer, opts Options) {
+	r := &repl{out: out, opts: opts}
+	r.reset()
+
+	h, err := openHistory(opts.History)
+	if err != nil {
+		r.error(err)
+	}
+	r.history = h
+	defer r.history.close()
+
 	scanner := bufio.NewScanner(in)
-	scope := object.NewScope()
+	input := ""
+	blanks := 0
 	for {
-		fmt.Printf(PROMPT)
-		scanned := scanner.Scan()
-		if !scanned {
+		if input == "" {
+			io.WriteString(out, PROMPT)
+		} else {
+			io.WriteString(out, CONTINUE)
+		}
+		if !scanner.Scan() {
+			io.WriteString(out, "\n")
 			return
 		}
 		line := scanner.Text()
-		l := lexer.NewLexer(line)
 
-		if mode == 0 {
-			for tok := l.NextToken(); tok.Type != token.EOF; tok = l.NextToken() {
-				fmt.Printf("%#v\n", tok)
+		if input == "" && strings.HasPrefix(strings.TrimSpace(line), ":") {
+			if !r.command(strings.TrimSpace(line)) {
+				return
 			}
+			continue
 		}
 
-		if mode == 1 || mode == 2 || mode == 3 {
-			p := parser.NewParser(l)
-			program := p.Parse()
-			if len(p.Errors()) != 0 {
-				printParserErrors(out, p.Errors())
-				continue
-			}
+		// two blank lines give up on completing the input
+		if strings.TrimSpace(line) == "" {
+			blanks++
+		} else {
+			blanks = 0
+		}
+		input += line + "\n"
+		if incomplete(input) && blanks < 2 {
+			continue
+		}
 
-			if mode == 1 {
-				io.WriteString(out, program.String())
-				io.WriteString(out, "\n")
-			}
+		if strings.TrimSpace(input) != "" {
+			r.history.add(strings.TrimSuffix(input, "\n"))
+			r.evaluate(input)
+		}
+		input, blanks = "", 0
+	}
+}
 
-			if mode == 2 {
-				parser.DrawTree(program)
-			}
+// starts over with no globals
+func (r *repl) reset() {
+	r.interpreter = mist.New(mist.Options{Stdout: r.out, Stderr: r.out})
+}
 
-			if mode == 3 {
-				evaluated := eval.Eval(program, scope)
-				io.WriteString(out, evaluated.Inspect())
-				io.WriteString(out, "\n")
-			}
+// goes as far with input as the stage of the repl
+func (r *repl) evaluate(input string) {
+	if r.opts.Stage == Stage["lexer"] {
+		l := lexer.NewLexer(input)
+		for tok := l.NextToken(); tok.Type != token.EOF; tok = l.NextToken() {
+			fmt.Fprintf(r.out, "%d:%d\t%s\t%q\n", tok.Row, tok.Column, tok.Type, tok.Literal)
 		}
+		r.diagnostics(input, l.Diagnostics())
+		return
+	}
+
+	if r.opts.Stage == Stage["parser"] || r.opts.Stage == Stage["tree"] {
+		p := parser.NewParser(lexer.NewLexer(input))
+		program := p.Parse()
+		if len(p.Diagnostics()) != 0 {
+			r.diagnostics(input, p.Diagnostics())
+			return
+		}
+		if r.opts.Stage == Stage["parser"] {
+			fmt.Fprintln(r.out, program.String())
+		} else {
+			parser.DrawTree(r.out, program)
+		}
+		return
+	}
+
+	evaluated, err := r.interpreter.Run(context.Background(), input)
+	if err != nil {
+		r.failed(input, err)
+		return
+	}
+	r.diagnostics(input, r.interpreter.WarningDiagnostics())
+	// statements have no value worth showing
+	if evaluated != nil && evaluated.Inspect() != "" {
+		fmt.Fprintln(r.out, evaluated.Inspect())
 	}
 }
 
-func printParserErrors(out io.Writer, errors []string) {
-	for _, msg := range errors {
-		io.WriteString(out, "\t"+msg+"\n")
+// shows why input failed, with the lines it failed at
+func (r *repl) failed(input string, err error) {
+	if mistErr, ok := err.(*mist.Error); ok {
+		r.diagnostics(input, mistErr.Diagnostics)
+		return
+	}
+	r.error(err)
+}
+
+func (r *repl) diagnostics(input string, diagnostics []diagnostic.Diagnostic) {
+	for _, d := range diagnostics {
+		diagnostic.Render(r.out, d, input, false)
+	}
+}
+
+func (r *repl) error(err error) {
+	fmt.Fprintf(r.out, "error: %s\n", err)
+}
+
+// reports whether more lines are needed to complete input: a bracket
+// or a string is left open, or it ends with an operator
+func incomplete(input string) bool {
+	l := lexer.NewLexer(input)
+	depth := 0
+	var last token.TokenType
+	for tok := l.NextToken(); tok.Type != token.EOF; tok = l.NextToken() {
+		switch tok.Type {
+		case token.LPAREN, token.LBRACKET, token.LBRACE:
+			depth++
+		case token.RPAREN, token.RBRACKET, token.RBRACE:
+			depth--
+		}
+		last = tok.Type
+	}
+
+	for _, d := range l.Diagnostics() {
+		if d.Code == diagnostic.UnterminatedString {
+			return true
+		}
+	}
+	if depth > 0 {
+		return true
+	}
+
+	switch last {
+	case token.ASSIGN, token.PLUS, token.MINUS, token.ASTERISK, token.SLASH, token.MOD, token.POWER,
+		token.EQ, token.NE, token.LT, token.GT, token.LE, token.GE, token.AND, token.OR, token.BANG,
+		token.PLUS_ASSIGN, token.MINUS_ASSIGN, token.ASTERISK_ASSIGN, token.SLASH_ASSIGN, token.MOD_ASSIGN,
+		token.DOT, token.PATH, token.COMMA, token.COLON, token.ARROW, token.FATARROW, token.DOTDOT:
+		return true
 	}
+	return false
 }
@@ -0,0 +1,114 @@
+package repl
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// runs input through a repl evaluating it, without the prompts
+func run(t *testing.T, input string, opts Options) string {
+	t.Helper()
+	var out strings.Builder
+	Start(strings.NewReader(input), &out, opts)
+	output := strings.ReplaceAll(out.String(), PROMPT, "")
+	return strings.ReplaceAll(output, CONTINUE, "")
+}
+
+func TestEval(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"1 + 2\n", "3\n\n"},
+		{"let x: Int = 2;\nx * 21\n", "42\n\n"},
+		{"println(\"hi\");\n", "hi\n\n"},
+		// inputs spanning lines
+		{"fn add(a: Int,\n  b: Int) Int {\n  a + b\n}\nadd(1, 2)\n", "fn add(a: Int, b: Int) Int\n3\n\n"},
+		{"1 +\n2\n", "3\n\n"},
+		{"[1,\n2,\n3]\n", "[1, 2, 3]\n\n"},
+		{"\"a\nb\"\n", "a\nb\n\n"},
+		// two blank lines give up on the open bracket
+		{"(1 +\n\n\n1\n", "error[E01"},
+		// errors are shown with the line they are at
+		{"[1][4]\n", "error[E0300]: index 4 out of range"},
+		{"1 + \"a\"\n", "error[E0200]: operator + is not defined over INTEGER and STRING\n --> 1:3\n  |\n1 | 1 + \"a\"\n"},
+	}
+
+	for i, test := range tests {
+		actual := run(t, test.input, Options{Stage: Stage["eval"]})
+		if !strings.HasPrefix(actual, test.expected) {
+			t.Errorf("case %d: expected output starting with %q, got %q", i, test.expected, actual)
+		}
+	}
+}
+
+func TestCommands(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "lib.rs")
+	if err := os.WriteFile(file, []byte("fn double(x: Int) Int { x * 2 }\nlet limit: Int = 3;\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{":type 1 + 2\n", "Int\n"},
+		{"let xs: List<Int> = [1];\n:type xs\n", "List<Int>\n"},
+		{":type \"a\" + 1\n", "error[E0200]"},
+		{":type let x: Int = 1;\n", "error: \"let x: Int = 1;\" is not an expression\n"},
+		{"let x: Int = 1;\nfn f() Int { x }\n:env\n", "fn f() Int\nf: Fn() -> Int = fn f() Int\nx: Int = 1\n"},
+		{":load " + file + "\ndouble(limit)\n", "6\n"},
+		{":load missing.rs\n", "error: open missing.rs"},
+		{"let x: Int = 1;\n:reset\n:env\nx\n", "error[E0200]: x is not defined"},
+		{":ast 1 + x\n", "InfixExpression 1:3 operator: \"+\"\n  right: Identifier 1:5 value: \"x\"\n  left: IntegerLiteral 1:1 type: \"Int\" value: 1\n"},
+		{":time 1 + 1\n", "2\ntook "},
+		{"1\n2\n:history\n", "1\n2\n   1  1\n   2  2\n"},
+		{":what\n", "unknown command :what, :help lists them\n"},
+	}
+
+	for i, test := range tests {
+		actual := run(t, test.input, Options{Stage: Stage["eval"]})
+		if !strings.HasPrefix(actual, test.expected) {
+			t.Errorf("case %d: expected output starting with %q, got %q", i, test.expected, actual)
+		}
+	}
+}
+
+func TestQuit(t *testing.T) {
+	if actual := run(t, "1\n:quit\n2\n", Options{Stage: Stage["eval"]}); actual != "1\n" {
+		t.Errorf("expected the repl to stop at :quit, got %q", actual)
+	}
+}
+
+func TestStages(t *testing.T) {
+	tests := []struct {
+		stage    string
+		expected string
+	}{
+		{"lexer", "1:1\tID\t\"x\"\n1:3\t+\t\"+\"\n1:5\tINT\t\"1\"\n"},
+		{"parser", "(x + 1)\n"},
+		{"tree", "Program"},
+	}
+
+	for i, test := range tests {
+		actual := run(t, "x + 1\n", Options{Stage: Stage[test.stage]})
+		if !strings.Contains(actual, test.expected) {
+			t.Errorf("case %d: expected output with %q, got %q", i, test.expected, actual)
+		}
+	}
+}
+
+func TestHistory(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history")
+
+	run(t, "let x: Int = 1;\nfn f(a: Int,\n  b: Int) Int { a }\n:env\n", Options{Stage: Stage["eval"], History: path})
+	// the next session starts with the inputs of the ones before
+	actual := run(t, "2\n:history\n", Options{Stage: Stage["eval"], History: path})
+
+	expected := "2\n   1  let x: Int = 1;\n   2  fn f(a: Int,\n        b: Int) Int { a }\n   3  2\n"
+	if !strings.HasPrefix(actual, expected) {
+		t.Errorf("expected %q, got %q", expected, actual)
+	}
+}
@@ -0,0 +1,226 @@
+// Package tester runs the test blocks of Mist programs, each in an
+// interpreter of its own, and reports them like mist test does
+package tester
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/fs"
+	"lang/mist"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// extensions of the files directories are searched for
+var extensions = []string{".rs", ".mist"}
+
+// Options configure how tests run, the zero value runs all of them on
+// the tree walker
+type Options struct {
+	// backend that runs the tests, "tree" or "vm"
+	Engine string
+
+	// only the tests whose name matches run, all of them when nil
+	Run *regexp.Regexp
+
+	// stops a test after this long, 0 for no limit
+	Timeout time.Duration
+
+	// finds the modules of the programs, the default of mist.Options
+	// when nil
+	Loader mist.Loader
+}
+
+// Result of a test
+type Result struct {
+	File     string
+	Name     string
+	Duration time.Duration
+
+	// what the test printed
+	Output string
+
+	// why the test failed, nil when it passed. A *mist.Error for failed
+	// assertions and other runtime errors.
+	Err error
+}
+
+func (r Result) Passed() bool { return r.Err == nil }
+
+// Files are the programs in paths, the files named and those with a
+// Mist extension in the directories named, sorted. Hidden directories
+// are skipped.
+func Files(paths []string) ([]string, error) {
+	files := []string{}
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+		if !info.IsDir() {
+			files = append(files, path)
+			continue
+		}
+
+		found := []string{}
+		err = filepath.WalkDir(path, func(name string, entry fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if entry.IsDir() {
+				if name != path && strings.HasPrefix(entry.Name(), ".") {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			for _, extension := range extensions {
+				if filepath.Ext(name) == extension {
+					found = append(found, name)
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		sort.Strings(found)
+		files = append(files, found...)
+	}
+	return files, nil
+}
+
+// RunFile runs the tests of source, the program in file, in the order
+// they are written. The error is for programs that don't parse or type
+// check, whose tests don't run.
+func RunFile(file, source string, opts Options) ([]Result, error) {
+	checked := mist.New(mist.Options{File: file, Engine: opts.Engine, Loader: opts.Loader})
+	if err := checked.Check(source); err != nil {
+		return nil, err
+	}
+	tests, err := checked.Tests(source)
+	if err != nil {
+		return nil, err
+	}
+
+	results := []Result{}
+	for _, test := range tests {
+		if opts.Run != nil && !opts.Run.MatchString(test.Name) {
+			continue
+		}
+		results = append(results, runTest(file, source, test.Name, opts))
+	}
+	return results, nil
+}
+
+// runs a test in a new interpreter, so the globals earlier tests changed
+// are as the program left them
+func runTest(file, source, name string, opts Options) Result {
+	var output strings.Builder
+	interpreter := mist.New(mist.Options{Stdout: &output, Stderr: &output, File: file, Engine: opts.Engine, Loader: opts.Loader})
+
+	ctx := context.Background()
+	if opts.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, opts.Timeout)
+		defer cancel()
+	}
+
+	start := time.Now()
+	err := interpreter.RunTest(ctx, source, name)
+	return Result{File: file, Name: name, Duration: time.Since(start), Output: output.String(), Err: err}
+}
+
+// Summary of results, like "3 passed, 1 failed"
+func Summary(results []Result) string {
+	if len(results) == 0 {
+		return "no tests"
+	}
+	failed := 0
+	for _, r := range results {
+		if !r.Passed() {
+			failed++
+		}
+	}
+	summary := fmt.Sprintf("%d passed", len(results)-failed)
+	if failed > 0 {
+		summary += fmt.Sprintf(", %d failed", failed)
+	}
+	return summary
+}
+
+type junitSuites struct {
+	XMLName  xml.Name     `xml:"testsuites"`
+	Tests    int          `xml:"tests,attr"`
+	Failures int          `xml:"failures,attr"`
+	Time     string       `xml:"time,attr"`
+	Suites   []junitSuite `xml:"testsuite"`
+}
+
+type junitSuite struct {
+	Name     string      `xml:"name,attr"`
+	Tests    int         `xml:"tests,attr"`
+	Failures int         `xml:"failures,attr"`
+	Time     string      `xml:"time,attr"`
+	Cases    []junitCase `xml:"testcase"`
+
+	duration time.Duration
+}
+
+type junitCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	Time      string        `xml:"time,attr"`
+	Failure   *junitFailure `xml:"failure,omitempty"`
+	Output    string        `xml:"system-out,omitempty"`
+}
+
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+	Text    string `xml:",chardata"`
+}
+
+// JUnit writes results as JUnit XML for CI, with a suite per file
+func JUnit(w io.Writer, results []Result) error {
+	suites := junitSuites{}
+	var total time.Duration
+	for _, r := range results {
+		if len(suites.Suites) == 0 || suites.Suites[len(suites.Suites)-1].Name != r.File {
+			suites.Suites = append(suites.Suites, junitSuite{Name: r.File})
+		}
+		suite := &suites.Suites[len(suites.Suites)-1]
+
+		c := junitCase{Name: r.Name, ClassName: r.File, Time: seconds(r.Duration), Output: r.Output}
+		if !r.Passed() {
+			message, _, _ := strings.Cut(r.Err.Error(), "\n")
+			c.Failure = &junitFailure{Message: message, Text: r.Err.Error()}
+			suite.Failures++
+			suites.Failures++
+		}
+		suite.Cases = append(suite.Cases, c)
+		suite.Tests++
+		suites.Tests++
+		suite.duration += r.Duration
+		suite.Time = seconds(suite.duration)
+		total += r.Duration
+	}
+	suites.Time = seconds(total)
+
+	io.WriteString(w, xml.Header)
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", "  ")
+	if err := encoder.Encode(suites); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+func seconds(d time.Duration) string {
+	return fmt.Sprintf("%.3f", d.Seconds())
+}
@@ -0,0 +1,135 @@
+package tester
+
+import (
+	"errors"
+	"lang/mist"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+const program = `fn double(n: Int) Int { n * 2 }
+
+test "doubles" {
+    assert_eq(double(2), 4);
+}
+
+test "doubles zero" {
+    println("zero");
+    assert_eq(double(0), 1);
+}
+`
+
+func TestFiles(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"b.rs", "a.mist", "notes.txt", "sub/c.rs", ".git/d.rs"} {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(""), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	files, err := Files([]string{dir, filepath.Join(dir, "notes.txt")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{"a.mist", "b.rs", "sub/c.rs", "notes.txt"}
+	for i := range expected {
+		expected[i] = filepath.Join(dir, expected[i])
+	}
+	if !reflect.DeepEqual(files, expected) {
+		t.Errorf("expected %v, got %v", expected, files)
+	}
+
+	if _, err := Files([]string{filepath.Join(dir, "missing")}); err == nil {
+		t.Errorf("expected an error for a missing path")
+	}
+}
+
+func TestRunFile(t *testing.T) {
+	tests := []struct {
+		run      string
+		expected []string
+	}{
+		{"", []string{"doubles: ok", "doubles zero: [9,14] assertion failed: left == right"}},
+		{"zero$", []string{"doubles zero: [9,14] assertion failed: left == right"}},
+		{"^none", []string{}},
+	}
+
+	for _, engine := range []string{"tree", "vm"} {
+		for i, test := range tests {
+			opts := Options{Engine: engine}
+			if test.run != "" {
+				opts.Run = regexp.MustCompile(test.run)
+			}
+			results, err := RunFile("double.rs", program, opts)
+			if err != nil {
+				t.Fatalf("%s case %d: unexpected error %s", engine, i, err)
+			}
+
+			actual := []string{}
+			for _, r := range results {
+				if r.Passed() {
+					actual = append(actual, r.Name+": ok")
+					continue
+				}
+				message, _, _ := strings.Cut(r.Err.Error(), "\n")
+				actual = append(actual, r.Name+": "+message)
+				if r.Output != "zero\n" {
+					t.Errorf("%s case %d: expected the output of the test, got %q", engine, i, r.Output)
+				}
+			}
+			if !reflect.DeepEqual(actual, test.expected) {
+				t.Errorf("%s case %d: expected %v, got %v", engine, i, test.expected, actual)
+			}
+		}
+	}
+
+	_, err := RunFile("bad.rs", `test "a" { assert_eq(1, "a" + 1); }`, Options{})
+	var mistErr *mist.Error
+	if !errors.As(err, &mistErr) || mistErr.Stage != "check" {
+		t.Errorf("expected a check error, got %v", err)
+	}
+}
+
+func TestJUnit(t *testing.T) {
+	results, err := RunFile("double.rs", program, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range results {
+		results[i].Duration = 0
+	}
+
+	var out strings.Builder
+	if err := JUnit(&out, results); err != nil {
+		t.Fatal(err)
+	}
+	expected := `<?xml version="1.0" encoding="UTF-8"?>
+<testsuites tests="2" failures="1" time="0.000">
+  <testsuite name="double.rs" tests="2" failures="1" time="0.000">
+    <testcase name="doubles" classname="double.rs" time="0.000"></testcase>
+    <testcase name="doubles zero" classname="double.rs" time="0.000">
+      <failure message="[9,14] assertion failed: left == right">[9,14] assertion failed: left == right&#xA;  left: 0&#xA; right: 1</failure>
+      <system-out>zero&#xA;</system-out>
+    </testcase>
+  </testsuite>
+</testsuites>
+`
+	if out.String() != expected {
+		t.Errorf("expected\n%s\ngot\n%s", expected, out.String())
+	}
+
+	if summary := Summary(results); summary != "1 passed, 1 failed" {
+		t.Errorf("expected 1 passed, 1 failed, got %s", summary)
+	}
+	if summary := Summary(nil); summary != "no tests" {
+		t.Errorf("expected no tests, got %s", summary)
+	}
+}
@@ -1,5 +1,7 @@
 package token
 
+import "sort"
+
 const (
 	EOF     = "EOF"
 	ILLEGAL = "ILLEGAL"
@@ -29,6 +31,19 @@ const (
 	AND      = "&&"
 	DOT      = "."
 	MOD      = "%"
+	ARROW    = "->"
+	FATARROW = "=>"
+	PATH     = "::"
+	DOTDOT   = ".."
+	DOTDOTEQ = "..="
+	QUESTION = "?"
+
+	// compound assignment
+	PLUS_ASSIGN     = "+="
+	MINUS_ASSIGN    = "-="
+	ASTERISK_ASSIGN = "*="
+	SLASH_ASSIGN    = "/="
+	MOD_ASSIGN      = "%="
 
 	// delimiters
 	COMMA     = ","
@@ -36,13 +51,28 @@ const (
 	COLON     = ":"
 
 	// keywords
-	IF     = "IF"
-	ELSE   = "ELSE"
-	FUNC   = "FUNC"
-	LET    = "LET"
-	RETURN = "RETURN"
-	FALSE  = "FALSE"
-	TRUE   = "TRUE"
+	IF       = "IF"
+	ELSE     = "ELSE"
+	FUNC     = "FUNC"
+	LET      = "LET"
+	RETURN   = "RETURN"
+	FALSE    = "FALSE"
+	TRUE     = "TRUE"
+	STRUCT   = "STRUCT"
+	IMPL     = "IMPL"
+	ENUM     = "ENUM"
+	MATCH    = "MATCH"
+	WHILE    = "WHILE"
+	FOR      = "FOR"
+	IN       = "IN"
+	LOOP     = "LOOP"
+	BREAK    = "BREAK"
+	CONTINUE = "CONTINUE"
+	MUT      = "MUT"
+	USE      = "USE"
+	IMPORT   = "IMPORT"
+	PUB      = "PUB"
+	AS       = "AS"
 
 	// others
 	LPAREN   = "("
@@ -51,6 +81,11 @@ const (
 	RBRACE   = "}"
 	LBRACKET = "["
 	RBRACKET = "]"
+
+	// trivia, only kept when the lexer is asked to
+	COMMENT = "COMMENT"
+	NEWLINE = "NEWLINE"
+	SPACE   = "SPACE"
 )
 
 type TokenType string
@@ -60,6 +95,9 @@ type Token struct {
 	Literal string
 	Row     int
 	Column  int
+	// the whitespace and comments before the token, as COMMENT, NEWLINE
+	// and SPACE tokens, when the lexer keeps them
+	Leading []Token
 }
 
 func NewToken(t TokenType, lit byte) *Token {
@@ -77,13 +115,28 @@ func NewTokenString(t TokenType, lit string) *Token {
 }
 
 var keywords = map[string]TokenType{
-	"if":     IF,
-	"else":   ELSE,
-	"fn":     FUNC,
-	"let":    LET,
-	"true":   TRUE,
-	"false":  FALSE,
-	"return": RETURN,
+	"if":       IF,
+	"else":     ELSE,
+	"fn":       FUNC,
+	"let":      LET,
+	"true":     TRUE,
+	"false":    FALSE,
+	"return":   RETURN,
+	"struct":   STRUCT,
+	"impl":     IMPL,
+	"enum":     ENUM,
+	"match":    MATCH,
+	"while":    WHILE,
+	"for":      FOR,
+	"in":       IN,
+	"loop":     LOOP,
+	"break":    BREAK,
+	"continue": CONTINUE,
+	"mut":      MUT,
+	"use":      USE,
+	"import":   IMPORT,
+	"pub":      PUB,
+	"as":       AS,
 }
 
 // Golang doesn't have sets, we use 0-sized
@@ -96,6 +149,7 @@ var types = map[string]void{
 	"Int":    null,
 	"Float":  null,
 	"Func":   null,
+	"Fn":     null,
 	"Void":   null,
 	"Bool":   null,
 	"String": null,
@@ -103,6 +157,16 @@ var types = map[string]void{
 	"Map":    null,
 }
 
+// Keywords of the language, sorted
+func Keywords() []string {
+	words := []string{}
+	for word := range keywords {
+		words = append(words, word)
+	}
+	sort.Strings(words)
+	return words
+}
+
 func LookupIdentifier(identifier string) TokenType {
 	if tokenType, isKeyword := keywords[identifier]; isKeyword {
 		return tokenType
@@ -0,0 +1,11 @@
+package vm
+
+import "lang/object"
+
+// holds a mutable local, closures capture the cell instead of the value
+type cell struct {
+	value object.Object
+}
+
+func (c *cell) Type() object.ObjectType { return "CELL" }
+func (c *cell) Inspect() string         { return c.value.Inspect() }
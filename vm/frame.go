@@ -0,0 +1,27 @@
+package vm
+
+import (
+	"lang/code"
+	"lang/object"
+)
+
+type Frame struct {
+	cl          *object.Closure
+	ip          int
+	basePointer int
+	// position of the call expression, errors about the
+	// returned value point at it
+	call code.Position
+	// stack heights the loops being run started at, innermost last
+	loops []int
+	// function calls this frame is nested in, 0 for the main frame
+	depth int
+}
+
+func NewFrame(cl *object.Closure, basePointer int, call code.Position) *Frame {
+	return &Frame{cl: cl, ip: -1, basePointer: basePointer, call: call}
+}
+
+func (f *Frame) Instructions() code.Instructions {
+	return f.cl.Fn.Instructions
+}
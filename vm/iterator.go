@@ -0,0 +1,14 @@
+package vm
+
+import (
+	"lang/object"
+)
+
+// the state of a for loop, never visible to programs
+type iterator struct {
+	next func() ([]object.Object, *object.Error)
+	n    int
+}
+
+func (it *iterator) Type() object.ObjectType { return "ITERATOR" }
+func (it *iterator) Inspect() string         { return "iterator" }
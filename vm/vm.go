@@ -0,0 +1,717 @@
+package vm
+
+import (
+	"lang/ast"
+	"lang/code"
+	"lang/compiler"
+	"lang/eval"
+	"lang/object"
+)
+
+// initial sizes, both grow on demand since recursive programs can go
+// deep
+const (
+	StackSize = 2048
+	MaxFrames = 1024
+)
+
+type VM struct {
+	constants   []object.Object
+	types       []*ast.TypeNode
+	patterns    []ast.Pattern
+	assigns     []*ast.AssignStatement
+	globals     []object.Object
+	globalNames []string
+	// the file of the program, closures from other files run in the vm
+	// of their own program since their constants and globals are there
+	file     string
+	builtins []object.Object
+	// the same builtins by name, for globals read before they are defined
+	builtinsByName map[string]object.Object
+
+	stack []object.Object
+	sp    int // always points to the next free slot, top of stack is stack[sp-1]
+
+	frames      []*Frame
+	framesIndex int
+
+	// handed to every closure so builtins can call back into the vm
+	caller func(cl *object.Closure, row *int, column *int, args ...object.Object) object.Object
+
+	// limits of the program, nil when nothing is limited
+	budget *object.Budget
+}
+
+// New runs bytecode with the builtins of eval.NewBuiltins
+func New(bytecode *compiler.Bytecode, builtins map[string]object.Object) *VM {
+	return NewWithGlobals(bytecode, builtins, nil)
+}
+
+// NewWithGlobals runs bytecode against the globals left by a previous
+// vm, for programs compiled one after another by the same compiler
+func NewWithGlobals(bytecode *compiler.Bytecode, builtins map[string]object.Object, globals []object.Object) *VM {
+	mainFn := &object.CompiledFunction{
+		Instructions: bytecode.Instructions,
+		Positions:    bytecode.Positions,
+		File:         bytecode.File,
+	}
+	mainClosure := &object.Closure{Fn: mainFn}
+
+	indexed := []object.Object{}
+	for _, name := range eval.BuiltinNames() {
+		indexed = append(indexed, builtins[name])
+	}
+
+	for len(globals) < len(bytecode.Globals) {
+		globals = append(globals, nil)
+	}
+
+	vm := &VM{
+		constants:      bytecode.Constants,
+		types:          bytecode.Types,
+		patterns:       bytecode.Patterns,
+		assigns:        bytecode.Assigns,
+		globals:        globals,
+		globalNames:    bytecode.Globals,
+		file:           bytecode.File,
+		builtins:       indexed,
+		builtinsByName: builtins,
+		stack:          make([]object.Object, StackSize),
+		frames:         make([]*Frame, 0, MaxFrames),
+	}
+	vm.caller = vm.callFromHost
+
+	// the main frame is called like any other closure
+	mainClosure.Caller = vm.caller
+	vm.push(mainClosure)
+	vm.pushFrame(NewFrame(mainClosure, vm.sp, code.Position{}))
+	return vm
+}
+
+// SetBudget limits the program like object.Scope.SetBudget does for the
+// tree walker
+func (vm *VM) SetBudget(b *object.Budget) {
+	vm.budget = b
+}
+
+// entry point, returns the value of the program or an *object.Error
+func (vm *VM) Run() object.Object {
+	return vm.execute(0)
+}
+
+// the globals once the program ran, to hand to the next vm
+func (vm *VM) Globals() []object.Object {
+	return vm.globals
+}
+
+// runs until the frame at index base returns
+func (vm *VM) execute(base int) object.Object {
+	frame := vm.frames[vm.framesIndex-1]
+	ins := frame.Instructions()
+
+	for {
+		frame.ip++
+		ip := frame.ip
+		var err object.Object
+
+		switch code.Opcode(ins[ip]) {
+		case code.OpConstant:
+			index := code.ReadUint16(ins[ip+1:])
+			frame.ip += 2
+			vm.push(vm.constants[index])
+
+		case code.OpPop:
+			vm.sp--
+
+		case code.OpNull:
+			vm.push(eval.NULL)
+
+		case code.OpTrue:
+			vm.push(eval.TRUE)
+
+		case code.OpFalse:
+			vm.push(eval.FALSE)
+
+		case code.OpInfix:
+			operator := code.Operators[ins[ip+1]]
+			frame.ip++
+			right := vm.pop()
+			left := vm.pop()
+			result := vm.executeInfix(operator, left, right, frame, ip)
+			if isError(result) {
+				err = result
+			} else if sizeErr := vm.sizeError(result, frame, ip); sizeErr != nil {
+				err = sizeErr
+			} else {
+				vm.push(result)
+			}
+
+		case code.OpPrefix:
+			operator := code.Operators[ins[ip+1]]
+			frame.ip++
+			row, column := vm.position(frame, ip)
+			result := eval.Prefix(operator, vm.pop(), &row, &column)
+			if isError(result) {
+				err = result
+			} else {
+				vm.push(result)
+			}
+
+		case code.OpJump:
+			frame.ip = int(code.ReadUint16(ins[ip+1:])) - 1
+
+		case code.OpJumpNotTruthy:
+			target := int(code.ReadUint16(ins[ip+1:]))
+			frame.ip += 2
+			if !eval.IsTruthy(vm.pop()) {
+				frame.ip = target - 1
+			}
+
+		case code.OpGetGlobal:
+			index := code.ReadUint16(ins[ip+1:])
+			frame.ip += 2
+			value := vm.globals[index]
+			if value == nil {
+				// declared but not defined yet, fall back to
+				// builtins like evalIdentifier does
+				name := vm.globalNames[index]
+				if builtin, ok := vm.builtinsByName[name]; ok {
+					value = builtin
+				} else {
+					row, column := vm.position(frame, ip)
+					err = eval.NewError(row, column, "%s is not defined", name)
+					break
+				}
+			}
+			vm.push(value)
+
+		case code.OpSetGlobal:
+			index := code.ReadUint16(ins[ip+1:])
+			frame.ip += 2
+			vm.globals[index] = vm.pop()
+
+		case code.OpGetLocal:
+			index := code.ReadUint8(ins[ip+1:])
+			frame.ip++
+			vm.push(vm.stack[frame.basePointer+int(index)])
+
+		case code.OpSetLocal:
+			index := code.ReadUint8(ins[ip+1:])
+			frame.ip++
+			vm.stack[frame.basePointer+int(index)] = vm.pop()
+
+		case code.OpGetBuiltin:
+			index := code.ReadUint8(ins[ip+1:])
+			frame.ip++
+			vm.push(vm.builtins[index])
+
+		case code.OpGetFree:
+			index := code.ReadUint8(ins[ip+1:])
+			frame.ip++
+			vm.push(frame.cl.Free[index])
+
+		case code.OpCurrentClosure:
+			vm.push(frame.cl)
+
+		case code.OpUndefined:
+			name := vm.constants[code.ReadUint16(ins[ip+1:])].(*object.String).Value
+			frame.ip += 2
+			row, column := vm.position(frame, ip)
+			err = eval.NewError(row, column, "%s is not defined", name)
+
+		case code.OpAssertType:
+			t := vm.types[code.ReadUint16(ins[ip+1:])]
+			frame.ip += 2
+			row, column := vm.position(frame, ip)
+			if typeErr := eval.LetTypeError(vm.stack[vm.sp-1], t, &row, &column); typeErr != nil {
+				err = typeErr
+			}
+
+		case code.OpList:
+			numElements := int(code.ReadUint16(ins[ip+1:]))
+			frame.ip += 2
+			var elements []object.Object
+			if numElements > 0 {
+				elements = make([]object.Object, numElements)
+				copy(elements, vm.stack[vm.sp-numElements:vm.sp])
+			}
+			vm.sp -= numElements
+			row, column := vm.position(frame, ip)
+			list := eval.NewList(elements)
+			if sizeErr := eval.SizeError(vm.budget, list, row, column); sizeErr != nil {
+				err = sizeErr
+				break
+			}
+			vm.push(list)
+
+		case code.OpMap:
+			numPairs := int(code.ReadUint16(ins[ip+1:]))
+			frame.ip += 2
+			keys := make([]object.Object, numPairs)
+			values := make([]object.Object, numPairs)
+			start := vm.sp - 2*numPairs
+			for i := 0; i < numPairs; i++ {
+				keys[i] = vm.stack[start+2*i]
+				values[i] = vm.stack[start+2*i+1]
+			}
+			vm.sp = start
+			row, column := vm.position(frame, ip)
+			result := eval.MapLiteral(keys, values, &row, &column)
+			if isError(result) {
+				err = result
+			} else if sizeErr := eval.SizeError(vm.budget, result, row, column); sizeErr != nil {
+				err = sizeErr
+			} else {
+				vm.push(result)
+			}
+
+		case code.OpIndex:
+			index := vm.pop()
+			left := vm.pop()
+			row, column := vm.position(frame, ip)
+			result := eval.Index(left, index, &row, &column)
+			if isError(result) {
+				err = result
+			} else {
+				vm.push(result)
+			}
+
+		case code.OpSlice:
+			end := vm.pop()
+			start := vm.pop()
+			left := vm.pop()
+			row, column := vm.position(frame, ip)
+			result := eval.Slice(left, start, end, &row, &column)
+			if isError(result) {
+				err = result
+			} else {
+				vm.push(result)
+			}
+
+		case code.OpRange:
+			inclusive := code.ReadUint8(ins[ip+1:]) == 1
+			frame.ip++
+			end := vm.pop()
+			start := vm.pop()
+			row, column := vm.position(frame, ip)
+			result := eval.Range(start, end, inclusive, &row, &column)
+			if isError(result) {
+				err = result
+			} else {
+				vm.push(result)
+			}
+
+		case code.OpAccess:
+			attribute := vm.constants[code.ReadUint16(ins[ip+1:])].(*object.String).Value
+			frame.ip += 2
+			row, column := vm.position(frame, ip)
+			result := eval.Access(vm.pop(), attribute, &row, &column)
+			if isError(result) {
+				err = result
+			} else {
+				vm.push(result)
+			}
+
+		case code.OpStruct:
+			fields := vm.constants[code.ReadUint16(ins[ip+1:])].(*object.List)
+			frame.ip += 2
+			row, column := vm.position(frame, ip)
+
+			names := []string{}
+			for _, f := range fields.Elements {
+				names = append(names, f.(*object.String).Value)
+			}
+			values := make([]object.Object, len(names))
+			copy(values, vm.stack[vm.sp-len(names):vm.sp])
+			vm.sp -= len(names)
+
+			result := eval.StructLiteral(vm.pop(), names, values, &row, &column)
+			if isError(result) {
+				err = result
+			} else {
+				vm.push(result)
+			}
+
+		case code.OpImpl:
+			row, column := vm.position(frame, ip)
+			method := vm.pop()
+			if result := eval.Implement(vm.stack[vm.sp-1], method, &row, &column); result != nil {
+				err = result
+			}
+
+		case code.OpMatch:
+			pattern := vm.patterns[code.ReadUint16(ins[ip+1:])]
+			frame.ip += 2
+			value := vm.pop()
+
+			names := ast.Enums(pattern)
+			enums := map[string]object.Object{}
+			for i, name := range names {
+				enums[name.Value] = vm.stack[vm.sp-len(names)+i]
+			}
+			vm.sp -= len(names)
+
+			bindings, ok, matchErr := eval.MatchPattern(pattern, value, enums)
+			if matchErr != nil {
+				err = matchErr
+				break
+			}
+			vm.push(nativeBoolToBooleanObject(ok))
+			for range ast.Bindings(pattern) {
+				if ok {
+					vm.push(bindings[0])
+					bindings = bindings[1:]
+				} else {
+					vm.push(eval.NULL)
+				}
+			}
+
+		case code.OpNoMatch:
+			row, column := vm.position(frame, ip)
+			err = eval.NoMatchError(vm.pop(), &row, &column)
+
+		case code.OpEnterLoop:
+			frame.loops = append(frame.loops, vm.sp)
+
+		case code.OpExitLoop:
+			frame.loops = frame.loops[:len(frame.loops)-1]
+
+		case code.OpBreak:
+			value := vm.pop()
+			vm.sp = frame.loops[len(frame.loops)-1]
+			frame.loops = frame.loops[:len(frame.loops)-1]
+			vm.push(value)
+			frame.ip = int(code.ReadUint16(ins[ip+1:])) - 1
+
+		case code.OpContinue:
+			vm.sp = frame.loops[len(frame.loops)-1]
+			frame.ip = int(code.ReadUint16(ins[ip+1:])) - 1
+
+		case code.OpStep:
+			row, column := vm.position(frame, ip)
+			if stepErr := eval.Step(vm.budget, row, column); stepErr != nil {
+				err = stepErr
+			}
+
+		case code.OpIter:
+			n := int(code.ReadUint8(ins[ip+1:]))
+			frame.ip++
+			row, column := vm.position(frame, ip)
+			next, iterErr := eval.ForItems(vm.pop(), n, &row, &column)
+			if iterErr != nil {
+				err = iterErr
+				break
+			}
+			vm.push(&iterator{next: next, n: n})
+
+		case code.OpNext:
+			it := vm.pop().(*iterator)
+			values, nextErr := it.next()
+			if nextErr != nil {
+				err = nextErr
+				break
+			}
+			vm.push(nativeBoolToBooleanObject(values != nil))
+			for i := 0; i < it.n; i++ {
+				if values != nil {
+					vm.push(values[i])
+				} else {
+					vm.push(eval.NULL)
+				}
+			}
+
+		case code.OpCell:
+			vm.push(&cell{value: vm.pop()})
+
+		case code.OpGetCell:
+			vm.push(vm.pop().(*cell).value)
+
+		case code.OpSetCell:
+			c := vm.pop().(*cell)
+			c.value = vm.pop()
+
+		case code.OpAssign:
+			node := vm.assigns[code.ReadUint16(ins[ip+1:])]
+			frame.ip += 2
+			_, targets := ast.AssignTarget(node.Target)
+
+			value := vm.pop()
+			indexes := make([]object.Object, len(targets))
+			copy(indexes, vm.stack[vm.sp-len(targets):vm.sp])
+			vm.sp -= len(targets)
+			current := vm.pop()
+
+			result := eval.Assign(vm.budget, node, current, indexes, value)
+			if isError(result) {
+				err = result
+				break
+			}
+			vm.push(result)
+
+		case code.OpImmutable:
+			name := vm.constants[code.ReadUint16(ins[ip+1:])].(*object.String).Value
+			frame.ip += 2
+			row, column := vm.position(frame, ip)
+			err = eval.ImmutableError(name, &row, &column)
+
+		case code.OpTry:
+			target := int(code.ReadUint16(ins[ip+1:]))
+			frame.ip += 2
+			row, column := vm.position(frame, ip)
+			value := vm.pop()
+			payload, ok, tryErr := eval.Try(value, &row, &column)
+			switch {
+			case tryErr != nil:
+				err = tryErr
+			case ok:
+				vm.push(payload)
+				frame.ip = target - 1
+			default:
+				vm.push(value)
+			}
+
+		case code.OpClosure:
+			index := code.ReadUint16(ins[ip+1:])
+			numFree := int(code.ReadUint8(ins[ip+3:]))
+			frame.ip += 3
+			fn := vm.constants[index].(*object.CompiledFunction)
+			free := make([]object.Object, numFree)
+			copy(free, vm.stack[vm.sp-numFree:vm.sp])
+			vm.sp -= numFree
+			vm.push(&object.Closure{Fn: fn, Free: free, Caller: vm.caller})
+
+		case code.OpCall:
+			numArgs := int(code.ReadUint8(ins[ip+1:]))
+			frame.ip++
+			row, column := vm.position(frame, ip)
+			callee := vm.stack[vm.sp-1-numArgs]
+
+			if cl, ok := callee.(*object.Closure); ok && cl.Fn.File == vm.file {
+				err = vm.callClosure(cl, numArgs, code.Position{Row: row, Column: column})
+				if err == nil {
+					frame = vm.frames[vm.framesIndex-1]
+					ins = frame.Instructions()
+				}
+				break
+			}
+
+			args := make([]object.Object, numArgs)
+			copy(args, vm.stack[vm.sp-numArgs:vm.sp])
+			vm.sp -= numArgs + 1
+			result := eval.Call(vm.budget, callee, args, &row, &column)
+			if isError(result) {
+				err = result
+			} else if sizeErr := eval.SizeError(vm.budget, result, row, column); sizeErr != nil {
+				err = sizeErr
+			} else {
+				vm.push(result)
+			}
+
+		case code.OpReturnValue:
+			value := vm.pop()
+			if err = vm.checkReturn(frame, value); err != nil {
+				// the error points at the call, the caller is the
+				// innermost frame like in the tree walker
+				vm.framesIndex--
+				break
+			}
+
+			vm.framesIndex--
+			vm.sp = frame.basePointer - 1
+			if vm.framesIndex == base {
+				return value
+			}
+
+			vm.push(value)
+			frame = vm.frames[vm.framesIndex-1]
+			ins = frame.Instructions()
+		}
+
+		if err != nil {
+			vm.spanError(err, frame, ip)
+			vm.traceback(err, base)
+			vm.unwind(base)
+			return err
+		}
+	}
+}
+
+// integers take a fast path, everything else is delegated to the
+// tree walker so both report the same results and errors
+func (vm *VM) executeInfix(operator string, left, right object.Object, frame *Frame, ip int) object.Object {
+	if l, ok := left.(*object.Integer); ok {
+		if r, ok := right.(*object.Integer); ok {
+			switch operator {
+			case "+":
+				return &object.Integer{Value: l.Value + r.Value}
+			case "-":
+				return &object.Integer{Value: l.Value - r.Value}
+			case "*":
+				return &object.Integer{Value: l.Value * r.Value}
+			case "<":
+				return nativeBoolToBooleanObject(l.Value < r.Value)
+			case ">":
+				return nativeBoolToBooleanObject(l.Value > r.Value)
+			case "==":
+				return nativeBoolToBooleanObject(l.Value == r.Value)
+			case "!=":
+				return nativeBoolToBooleanObject(l.Value != r.Value)
+			}
+		}
+	}
+
+	row, column := vm.position(frame, ip)
+	return eval.Infix(vm.budget, operator, left, right, &row, &column)
+}
+
+// only strings, lists and maps have a size, integers skip the check
+func (vm *VM) sizeError(value object.Object, frame *Frame, ip int) *object.Error {
+	if vm.budget == nil || vm.budget.MaxSize <= 0 {
+		return nil
+	}
+	row, column := vm.position(frame, ip)
+	return eval.SizeError(vm.budget, value, row, column)
+}
+
+// mirrors the checks of eval.callFunction
+func (vm *VM) callClosure(cl *object.Closure, numArgs int, call code.Position) object.Object {
+	fn := cl.Fn
+	if numArgs != fn.NumParameters {
+		name := ""
+		if fn.Name != nil {
+			name = fn.Name.Value
+		}
+		return eval.NewError(call.Row, call.Column, "function %s expected %d arguments, got %d",
+			name, fn.NumParameters, numArgs)
+	}
+
+	depth := 1
+	if vm.framesIndex > 0 {
+		depth = vm.frames[vm.framesIndex-1].depth + 1
+	}
+	if err := eval.Step(vm.budget, call.Row, call.Column); err != nil {
+		return err
+	}
+	if err := eval.DepthError(vm.budget, depth, call.Row, call.Column); err != nil {
+		return err
+	}
+
+	basePointer := vm.sp - numArgs
+	for argId, arg := range vm.stack[basePointer:vm.sp] {
+		if err := eval.ArgumentTypeError(arg, argId, fn.Parameters[argId], &call.Row, &call.Column); err != nil {
+			return err
+		}
+	}
+
+	frame := NewFrame(cl, basePointer, call)
+	frame.depth = depth
+	vm.pushFrame(frame)
+	vm.sp = basePointer + fn.NumLocals
+	vm.grow(vm.sp)
+	return nil
+}
+
+// used by closures that are called from builtins, e.g. List.map
+func (vm *VM) callFromHost(cl *object.Closure, row *int, column *int, args ...object.Object) object.Object {
+	vm.push(cl)
+	for _, arg := range args {
+		vm.push(arg)
+	}
+
+	if err := vm.callClosure(cl, len(args), code.Position{Row: *row, Column: *column}); err != nil {
+		vm.sp -= len(args) + 1
+		return err
+	}
+
+	return vm.execute(vm.framesIndex - 1)
+}
+
+func (vm *VM) checkReturn(frame *Frame, value object.Object) object.Object {
+	fn := frame.cl.Fn
+	// the main frame has no declared return type
+	if fn.ReturnType == nil {
+		return nil
+	}
+
+	if err := eval.ReturnTypeError(value, fn.ReturnType, &frame.call.Row, &frame.call.Column); err != nil {
+		return err
+	}
+	return nil
+}
+
+// gives an error raised by the instruction at ip the length of the token
+// it points at, like eval does with the token of the node
+func (vm *VM) spanError(err object.Object, frame *Frame, ip int) {
+	e, ok := err.(*object.Error)
+	if !ok || e.Length > 0 {
+		return
+	}
+	if pos, ok := frame.cl.Fn.Positions[ip]; ok && pos.Row == e.Row && pos.Column == e.Column {
+		e.Length = pos.Length
+	}
+}
+
+// records the calls an error escapes from, the frames down to base
+func (vm *VM) traceback(err object.Object, base int) {
+	e, ok := err.(*object.Error)
+	if !ok {
+		return
+	}
+
+	for i := vm.framesIndex - 1; i >= base; i-- {
+		f := vm.frames[i]
+		// the main frame is no call
+		if f.depth == 0 {
+			continue
+		}
+		eval.WithFrame(e, f.cl.Fn.Name, f.cl.Fn.Position, f.cl.Fn.File, f.call.Row, f.call.Column)
+	}
+}
+
+// drops every frame above base, including base itself
+func (vm *VM) unwind(base int) {
+	vm.sp = vm.frames[base].basePointer - 1
+	vm.framesIndex = base
+}
+
+func (vm *VM) position(frame *Frame, ip int) (int, int) {
+	pos := frame.cl.Fn.Positions[ip]
+	return pos.Row, pos.Column
+}
+
+func (vm *VM) pushFrame(f *Frame) {
+	if vm.framesIndex < len(vm.frames) {
+		vm.frames[vm.framesIndex] = f
+	} else {
+		vm.frames = append(vm.frames, f)
+	}
+	vm.framesIndex++
+}
+
+func (vm *VM) push(obj object.Object) {
+	vm.grow(vm.sp + 1)
+	vm.stack[vm.sp] = obj
+	vm.sp++
+}
+
+func (vm *VM) pop() object.Object {
+	vm.sp--
+	return vm.stack[vm.sp]
+}
+
+func (vm *VM) grow(size int) {
+	for size > len(vm.stack) {
+		vm.stack = append(vm.stack, make([]object.Object, len(vm.stack))...)
+	}
+}
+
+func nativeBoolToBooleanObject(input bool) *object.Boolean {
+	if input {
+		return eval.TRUE
+	}
+	return eval.FALSE
+}
+
+func isError(obj object.Object) bool {
+	return obj != nil && obj.Type() == object.ERROR_OBJ
+}
@@ -0,0 +1,223 @@
+package vm
+
+import (
+	"io"
+	"lang/ast"
+	"lang/compiler"
+	"lang/eval"
+	"lang/lexer"
+	"lang/object"
+	"lang/parser"
+	"reflect"
+	"testing"
+)
+
+func parse(input string) *ast.Program {
+	l := lexer.NewLexer(input)
+	p := parser.NewParser(l)
+	return p.Parse()
+}
+
+func testRun(t *testing.T, i int, input string) object.Object {
+	c := compiler.NewCompiler()
+	if err := c.Compile(parse(input)); err != nil {
+		t.Fatalf("case %d: compiler error: %s", i, err)
+	}
+	return New(c.Bytecode(), eval.NewBuiltins(io.Discard, io.Discard)).Run()
+}
+
+// every program must behave the same on both backends
+func TestMatchesTreeWalker(t *testing.T) {
+	tests := []string{
+		"5",
+		"(1+1)^10 - 1 * 4",
+		"1.23 * 2.0",
+		"30 + 1.1",
+		`"Hello" + " " + "world!"`,
+		"!false && true",
+		"8 >= 2 ^ 3 + 1",
+		"if (10 < 20) {10} else {0}",
+		"if (31 <= 30) {0}",
+		"if (1 > 2) {1} else if (2 > 1) {2} else {3}",
+		"3+2; return 10; 9 + 2;",
+		"if (10 != 20) {if (2 > 0) {return 3;} return 1;}",
+		"let x: Int = 5; return x;",
+		"let x: Int = 5; let x: Int = x * 2; x",
+		"let x: Int = 10; let y: Int = if (true) { let x: Int = 3; x }; x + y",
+		"let add: Func = fn(x: Int, y:Int) Int {return x*2;}; add(5,add(2,3));",
+		"fn(x:Int)Int{return x;}(5)",
+		"fn adder(x: Int) Func { fn(y: Int) Int { x + y } }; adder(2)(3)",
+		"fn fib(x: Int) Int { if (x < 2) {x} else {fib(x-2) + fib(x-1)} }; fib(15)",
+		"fn main() Int { fn inner(x: Int) Int { if (x == 0) {0} else {inner(x - 1)} }; inner(10) }; main()",
+		"fn a() Int { b() }; fn b() Int { 7 }; a()",
+		"[1, 2, 3].map(fn(x: Int) Int { x * 2 })",
+		"range(0, 10).filter(fn(x: Int) Bool { x % 2 == 0 }).len()",
+		"let l: List = [1, 2, 1]; l.update(1, 5)[1]",
+		`{"one": 1, "two": 2}["two"]`,
+		`("fizz" * false).otherwise(string(3))`,
+		"max([1, 5, 3])",
+		`"héllo"[1] + "héllo"[1:3] + "héllo"[:1] + "héllo"[4:]`,
+		"[1, 2, 3][1:]",
+		`"a b c".split(" ").join("-").upper().pad_left(8, ".")`,
+		`"x1".parse_int()`,
+		`{"b": 2, "a": 1}.set("c", 3).remove("a").entries()`,
+		`{"b": 2, "a": 1}.filter(fn(k: String, v: Int) Bool { v > 1 }).merge({"z": 0})`,
+		`from_entries([[2, "two"], [1, "one"]]).map_values(fn(s: String) Int { s.len() })`,
+		`{"a": 1}.get("b", 7)`,
+		"[3, 1, 2].sort_by(fn(x: Int) Int { -x }).fold(0, fn(acc: Int, x: Int) Int { acc * 10 + x })",
+		"[1, 2, 3, 4].window(2).map(fn(w: List<Int>) Int { w.sum() }).group_by(fn(x: Int) Bool { x > 4 })",
+		"[1, 2, 2, 3].unique().zip([4, 5]).flatten().chunk(3)",
+		"[1, 2, 3].find(fn(x: Int) Bool { x > 1 })",
+		"[[1, 2], [3]].sort_by(len).push([]).enumerate()",
+		"let f: Func = fn(x: Int) Int { x }; f",
+		// errors
+		`"Hello"+3`,
+		"3 || 8; return 0;",
+		"someVar;",
+		"len(4)",
+		"let x: Int = 1.0;",
+		"fn f(x: Int) Int { x }; f(1, 2)",
+		"fn f(x: Int) Int { x }; f(true)",
+		"fn f(x: Int) String { x }; f(1)",
+		"[1, 2][5]",
+		"[1].append(1)",
+		"[1, 2].fold(0, fn(x: Int) Int { x })",
+		"[1, 2].count(fn(x: Int) Bool { [x][3] == 1 })",
+		"1(2)",
+		"{[1]: 2}",
+		"fn f(x: Int) Int { x / true }; [1, 2].map(f)[0]",
+		"[1, 2].map(len)",
+		"[1, 2].filter(len)",
+		`let xs: List<Int> = [1, 2, "three"];`,
+		`let m: Map<String, Int> = {"a": 1, "b": 2.5};`,
+		"let f: Fn(Int) -> Bool = fn(x: String) Bool { true };",
+		"fn sum(xs: List<Int>) Int { 0 }; sum([1, 1.5]);",
+		`fn names() List<String> { ["a", 1] }; names();`,
+		`[1, "a"].map(fn(x: Int) Int { x * 2 })`,
+		"fn apply(f: Fn(Int) -> Int, x: Int) Int { f(x) }; apply(fn(x: Int) Int { x * 3 }, 2)",
+		"struct P { x: Int, y: Int } P { y: 2, x: 1 }",
+		"struct P { x: Int } impl P { fn get(self) Int { self.x } fn new(x: Int) P { P { x: x } } } P.new(4).get()",
+		"struct P { x: Int } impl P { fn double(self) P { P { x: self.x * 2 } } } [P { x: 1 }].map(fn(p: P) P { p.double() })",
+		"fn main() Int { struct P { x: Int } impl P { fn get(self) Int { self.x } } P { x: 3 }.get() }; main()",
+		"struct P { x: Int } P { x: 1.5 }",
+		"struct P { x: Int, y: Int } P { x: 1 }",
+		"struct P { x: Int } P { x: 1 }.y",
+		"struct P { x: Int } impl P { fn f(self, n: Int) Int { n } } P { x: 1 }.f()",
+		"enum S { C(Float), R(Float, Float), E } [S::C(1.0), S::R(2.0, 3.0), S::E].map(fn(s: S) Float { match s { S::C(r) => r, S::R(w, h) => w * h, S::E => 0.0 } })",
+		"let n: Int = 4; match [1, n, 3] { [] => 0, [x] => x, [x, y, ..rest] if y > 3 => rest, _ => 1 }",
+		`match -2 { 1 => "one", -2 => "minus two", _ => "other" }`,
+		"fn f(n: Int) Int { match n { 0 => 0, m => match m { 1 => 1, k => k + f(k - 1) } } }; f(4)",
+		"let x: Int = 1; let y: Int = match 5 { x => x * 2 }; x + y",
+		"enum S { C(Float) } S::C(1.0)",
+		"enum S { C(Float) } match S::C(2.0) { S::C(1.0) => 1 }",
+		"enum S { C(Float) } S::C(1)",
+		"enum S { C(Float) } S::D",
+		"enum S { C(Float) } match 1 { S::C(a, b) => a }",
+		"match 1 { Q::C(a) => a }",
+		"impl Q { fn f() {} }",
+		"let Q: Int = 1; Q { x: 1 }",
+		"fn find(xs: List<Int>, n: Int) Int { for i, x in xs { if (x == n) { return i; } }; -1 }; find([4, 5, 6], 6) + find([1], 2)",
+		"loop { for x in [1, 2, 3] { if (x == 2) { continue; }; if (x == 3) { break; } }; break 10; }",
+		"1 + loop { let x: Int = 2; if (true) { break x * 3; }; }",
+		`fn key(m: Map<String, Int>) String { for k, v in m { if (v == 2) { return k; } }; "" }; key({"a": 1, "b": 2})`,
+		`fn chars(s: String) List<String> { for i, c in s { if (i == 1) { return [c]; } }; [] }; chars("héy")`,
+		"fn g() Int { loop { match 1 { 1 => { break; }, _ => 0 } }; 5 }; g()",
+		"[1, 2].map(fn(n: Int) Int { loop { for x in [n * 10] { break; }; break n; } })",
+		"while (false) { 1; }",
+		"for x in 5 { x; }",
+		"let mut x: Int = 10; x += 5; x -= 1; x *= 2; x /= 4; x %= 4; x",
+		"let mut n: Int = 0; for x in [1, 2, 3] { n += x; }; n",
+		"fn sum(xs: List<Int>) Int { let mut n: Int = 0; let mut i: Int = 0; while (i < xs.len()) { n += xs[i]; i += 1; }; n }; sum([4, 5, 6])",
+		"let mut xs: List<Int> = [1, 2]; let ys: List<Int> = xs; xs[0] = 9; [xs, ys]",
+		`let mut m: Map<String, List<Int>> = {"a": [1]}; m["b"] = [2, 3]; m["b"][1] -= 3; m["b"]`,
+		"fn counter() Fn() -> Int { let mut c: Int = 0; fn() Int { c += 1; c } }; let next: Fn() -> Int = counter(); next(); next(); next()",
+		"fn f() Int { let mut c: Int = 0; let inc: Func = fn() { c += 1; }; inc(); inc(); c }; f()",
+		"fn f() List<Int> { let mut fs: List = []; for x in [1, 2] { let mut y: Int = x; fs = fs + [fn() Int { y *= 10; y }]; }; fs.map(fn(g: Func) Int { g() }) }; f()",
+		"fn f() Int { let mut x: Int = 1; if (true) { let x: Int = 5; }; x += 1; x }; f()",
+		"let x: Int = 1; x = 2;",
+		"fn f() { let x: Int = 1; x = 2; }; f()",
+		"y = 2;",
+		"len = 2;",
+		"fn f() Int { 1 }; f = 2;",
+		"let mut x: Int = 1; x = 1.5;",
+		"fn f() { let mut x: Int = 1; x += true; }; f()",
+		"let mut xs: List<Int> = [1]; xs[3] = 1;",
+		`let mut xs: List<Int> = [1]; xs[0] = "a";`,
+		"let mut n: Int = 1; n[0] = 2;",
+		"fn f(n: Int) Int { while (true) { for x in n { return x; } } }; f(1)",
+		"[1, loop { break 2; }, 3]",
+		"fn half(n: Int) Option<Int> { if (n % 2 == 0) { Some(n / 2) } else { None } }; fn q(n: Int) Option<Int> { half(half(n)?) }; [q(8), q(6), q(3)]",
+		`fn p(s: String) Result<Int, String> { if (s == "1") { Ok(1) } else { Err(s) } }; fn sum(xs: List<String>) Result<Int, String> { let mut n: Int = 0; for x in xs { n += p(x)?; }; Ok(n) }; [sum(["1", "1"]), sum(["1", "x"])]`,
+		"fn f(xs: List<Int>) Option<Int> { let n: Int = loop { break xs.get(5)?; }; Some(n) }; f([1])",
+		"Some(2).map(fn(x: Int) Int { x * 3 }).and_then(fn(x: Int) Option<Int> { Some(x + 1) }).unwrap_or(0)",
+		`let m: Map<String, Int> = {"a": 1}; [m.get("a"), m.get("b"), [1].get(0), [1].get(1)]`,
+		"match Some([1, 2]) { Some([a, ..rest]) => rest, None => [] }",
+		"[catch(fn() Int { [1][2] }), catch(fn() Int { 1 })]",
+		"Ok(1).is_ok() && Err(1).is_err() && None.is_none()",
+		"None.unwrap()",
+		"Err(1).unwrap()",
+		"1?",
+		"let o: Option<Int> = Some(1.5);",
+		"Some(1).and_then(fn(x: Int) Int { x })",
+		"fn f(n: Int) Int { if (n == 0) { [1][2] } else { f(n - 1) } }; fn g() Int { f(2) }; g()",
+		"[1, 2].map(fn(x: Int) Int { [x][5] })",
+		`"abc"[1:9]`,
+		`"abc"[3]`,
+		`fn f() Int { "a" }; fn g() Int { f() }; g()`,
+		"fn f() Int { [1][2] }; fn g() Int { [0].map(fn(x: Int) Int { f() })[0] }; g()",
+		"1 / 0",
+		"let mut x: Int = 7; x %= 0;",
+		"match catch(fn() Int { 1 / 0 }) { Ok(x) => x, Err(e) => e }",
+		"(0..1000000).filter(fn(x: Int) Bool { x % 7 == 3 }).map(fn(x: Int) Int { x * x }).take(3).collect()",
+		`[(0..=10).step(5), (5..0).step(-2).len(), len(0..3), "ab".iter().chain({"k": 1}).collect()]`,
+		"let mut s: Int = 0; for i, x in (1..4).iter().enumerate() { s += i * x[1]; } s",
+		"(0..3).zip(1.5)",
+		"1..true",
+		`["a"].iter().map(fn(x: Int) Int { x }).collect()`,
+	}
+
+	for i, input := range tests {
+		expected := eval.Eval(parse(input), object.NewGlobalScope(eval.NewBuiltins(io.Discard, io.Discard)))
+		actual := testRun(t, i, input)
+
+		if expected.Type() != actual.Type() {
+			t.Errorf("case %d: %s\nexpected type %s, got=%s (%s)",
+				i, input, expected.Type(), actual.Type(), actual.Inspect())
+			continue
+		}
+
+		if expected.Inspect() != actual.Inspect() {
+			t.Errorf("case %d: %s\nexpected %s,\ngot\t %s", i, input, expected.Inspect(), actual.Inspect())
+		}
+
+		if err, ok := expected.(*object.Error); ok && !reflect.DeepEqual(err.Stack, actual.(*object.Error).Stack) {
+			t.Errorf("case %d: %s\nexpected backtrace %v,\ngot\t %v", i, input, err.Stack, actual.(*object.Error).Stack)
+		}
+	}
+}
+
+func TestNullResult(t *testing.T) {
+	tests := []string{
+		"if (false) {1}",
+		"let x: Int = 1;",
+		"fn f() { return; }; f()",
+		"for x in [1, 2] { x; }",
+		"loop { break; }",
+	}
+
+	for i, input := range tests {
+		if result := testRun(t, i, input); result != eval.NULL {
+			t.Errorf("case %d: expected NULL, got=%T (%+v)", i, result, result)
+		}
+	}
+}
+
+func TestDeepRecursion(t *testing.T) {
+	input := "fn count(x: Int) Int { if (x == 0) {0} else {1 + count(x - 1)} }; count(100000)"
+	result := testRun(t, 0, input)
+
+	integer, ok := result.(*object.Integer)
+	if !ok || integer.Value != 100000 {
+		t.Errorf("expected 100000, got=%T (%+v)", result, result)
+	}
+}
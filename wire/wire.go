@@ -0,0 +1,52 @@
+// Package wire reads and writes the messages the language server and the
+// debug adapter exchange with their client: a JSON body after a header
+// that gives its length, the base protocol both of them share.
+package wire
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/textproto"
+	"strconv"
+)
+
+// MaxLength is the largest body Read accepts, so a wrong header can't
+// make it allocate more than the client could mean to send
+const MaxLength = 64 << 20
+
+// Read reads the next message, a header with its length and a JSON body
+func Read(r *bufio.Reader) ([]byte, error) {
+	header, err := textproto.NewReader(r).ReadMIMEHeader()
+	if err != nil {
+		return nil, err
+	}
+
+	length, err := strconv.Atoi(header.Get("Content-Length"))
+	if err != nil || length < 0 {
+		return nil, fmt.Errorf("invalid Content-Length %q", header.Get("Content-Length"))
+	}
+	if length > MaxLength {
+		return nil, fmt.Errorf("Content-Length %d is over the limit of %d bytes", length, MaxLength)
+	}
+
+	body := make([]byte, length)
+	if _, err := io.ReadFull(r, body); err != nil {
+		return nil, err
+	}
+	return body, nil
+}
+
+// Write writes message as JSON after the header with its length
+func Write(w io.Writer, message interface{}) error {
+	body, err := json.Marshal(message)
+	if err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintf(w, "Content-Length: %d\r\n\r\n", len(body)); err != nil {
+		return err
+	}
+	_, err = w.Write(body)
+	return err
+}
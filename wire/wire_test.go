@@ -0,0 +1,54 @@
+package wire
+
+import (
+	"bufio"
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestRead(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+		err      string
+	}{
+		{"Content-Length: 2\r\n\r\n{}", "{}", ""},
+		{"Content-Type: application/json\r\nContent-Length: 4\r\n\r\nnull", "null", ""},
+		{"Content-Length: 0\r\n\r\n", "", ""},
+		{"Content-Length: -5\r\n\r\n{}", "", `invalid Content-Length "-5"`},
+		{"Content-Length: abc\r\n\r\n{}", "", `invalid Content-Length "abc"`},
+		{"\r\n{}", "", `invalid Content-Length ""`},
+		{"Content-Length: 99999999999\r\n\r\n{}", "", "Content-Length 99999999999 is over the limit of 67108864 bytes"},
+		{"Content-Length: 5\r\n\r\n{}", "", "unexpected EOF"},
+	}
+
+	for i, test := range tests {
+		body, err := Read(bufio.NewReader(strings.NewReader(test.input)))
+		if test.err != "" {
+			if err == nil || err.Error() != test.err {
+				t.Errorf("case %d: expected error %q, got %v", i, test.err, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("case %d: unexpected error %v", i, err)
+			continue
+		}
+		if string(body) != test.expected {
+			t.Errorf("case %d: expected %q, got %q", i, test.expected, body)
+		}
+	}
+}
+
+func TestWrite(t *testing.T) {
+	var out bytes.Buffer
+	if err := Write(&out, map[string]int{"a": 1}); err != nil {
+		t.Fatal(err)
+	}
+
+	body, err := Read(bufio.NewReader(&out))
+	if err != nil || string(body) != `{"a":1}` {
+		t.Errorf("expected to read back {\"a\":1}, got %q and %v", body, err)
+	}
+}